@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	"github.com/spf13/viper"
+
+	"github.com/mattgen88/blog/backup"
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/models"
+)
+
+// backupBlog writes the whole blog to the archive named on the command line
+func backupBlog(db *sql.DB) error {
+	flags := flag.NewFlagSet("backup", flag.ContinueOnError)
+	hashes := flags.Bool("hashes", false, "include password hashes and webhook secrets so users can sign in and webhooks deliver after a restore")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: blog backup [flags] <archive.tar.gz>")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return errors.New("an archive must be named")
+	}
+
+	store, err := mediaStore()
+	if err != nil {
+		return err
+	}
+	schema, err := models.SchemaVersion(db)
+	if err != nil {
+		return err
+	}
+	b, err := models.Dump(db, *hashes)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.Create(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if err := backup.Write(f, b, schema, *hashes, store); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	logs.Info("Backed up", "users", len(b.Users), "categories", len(b.Categories), "articles", len(b.Articles), "comments", len(b.Comments), "media", len(b.Media), "webhooks", len(b.Webhooks), "path", flags.Arg(0))
+	return nil
+}
+
+// restoreBlog restores the archive named on the command line into an empty
+// database
+func restoreBlog(db *sql.DB) error {
+	if len(os.Args) != 3 {
+		return errors.New("Usage: blog restore <archive.tar.gz>")
+	}
+
+	store, err := mediaStore()
+	if err != nil {
+		return err
+	}
+
+	// Media files are spooled until the database rows are written, then put
+	// in the store before they are committed. A failed restore removes them
+	// again, leaving the store as it was.
+	spool, err := ioutil.TempDir("", "blog-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(spool)
+
+	f, err := os.Open(os.Args[2])
+	if err != nil {
+		return err
+	}
+	b, manifest, err := backup.Read(f, models.LatestSchemaVersion(), media.NewLocal(spool))
+	f.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := waitForDatabase(db); err != nil {
+		return err
+	}
+	if err := models.Migrate(db); err != nil {
+		return err
+	}
+	var restored []string
+	err = models.Restore(db, b, func() (err error) {
+		restored, err = restoreMedia(b, media.NewLocal(spool), store)
+		return err
+	})
+	if err != nil {
+		for _, key := range restored {
+			if err := store.Delete(key); err != nil {
+				logs.Warn("Failed to remove media of the failed restore", "key", key, "err", err)
+			}
+		}
+		return err
+	}
+	// The restore wrote to the database directly, so running instances
+	// reload everything
+	if node := clusterNode(db); node != nil {
+		if err := node.PublishResync(); err != nil {
+			logs.Warn("Failed to tell running instances of the restore", "err", err)
+		}
+	}
+
+	logs.Info("Restored", "users", len(b.Users), "categories", len(b.Categories), "articles", len(b.Articles), "comments", len(b.Comments), "media", len(b.Media), "webhooks", len(b.Webhooks), "created", manifest.Created)
+	if !manifest.Hashes {
+		logs.Warn("The archive has no password hashes, users must be given new passwords to sign in")
+		if len(b.Webhooks) > 0 {
+			logs.Warn("The archive has no webhook secrets, webhooks are inactive until given new secrets")
+		}
+	}
+
+	if viper.GetString("search_index") != "" {
+		return reindex(db)
+	}
+	return nil
+}
+
+// restoreMedia moves the media files of a restored backup from the spool
+// into the store, returning the keys of those it put even when it fails
+func restoreMedia(b *models.Backup, spool, store media.Store) ([]string, error) {
+	var restored []string
+	for _, m := range b.Media {
+		file, err := spool.Open(m.Key)
+		if err != nil {
+			return restored, fmt.Errorf("media %s: %v", m.Key, err)
+		}
+		err = store.Put(m.Key, file, m.Size, m.ContentType)
+		file.Close()
+		if err != nil {
+			return restored, fmt.Errorf("media %s: %v", m.Key, err)
+		}
+		restored = append(restored, m.Key)
+	}
+	return restored, nil
+}
@@ -0,0 +1,278 @@
+// Package backup writes the whole blog to a portable archive and restores it
+// into an empty database.
+//
+// An archive is a gzipped tar holding manifest.json followed by one JSON
+// document per table and the files of the media library under media/. The
+// manifest records the archive format, the schema
+// version of the database it was taken from and the SHA-256 checksum of
+// every other file, all of which are checked before anything is restored.
+package backup
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/models"
+)
+
+// Format is the version of the archive layout written by this build. Format
+// 2 added the media library and 3 webhooks.
+const Format = 3
+
+// mediaDir is the directory of the archive media files are kept in, under
+// their keys
+const mediaDir = "media/"
+
+// manifestName is the first file of every archive
+const manifestName = "manifest.json"
+
+// Errors found checking an archive
+var (
+	ErrNoManifest = errors.New("archive has no manifest")
+	ErrFormat     = errors.New("archive format is newer than this build understands")
+	ErrSchema     = errors.New("archive was taken from a newer schema than this build's")
+	ErrChecksum   = errors.New("archive failed its integrity check")
+)
+
+// Manifest describes an archive
+type Manifest struct {
+	Format  int       `json:"format"`
+	Schema  int       `json:"schema"`
+	Created time.Time `json:"created"`
+	// Hashes is set when the archive includes password hashes and webhook
+	// secrets
+	Hashes bool `json:"hashes"`
+	// Files maps the name of every other file to its SHA-256 checksum
+	Files map[string]string `json:"files"`
+}
+
+// tables names the file each part of a backup is stored in
+func tables(b *models.Backup) map[string]interface{} {
+	return map[string]interface{}{
+		"roles.json":      &b.Roles,
+		"users.json":      &b.Users,
+		"categories.json": &b.Categories,
+		"articles.json":   &b.Articles,
+		"comments.json":   &b.Comments,
+		"spamtokens.json": &b.SpamTokens,
+		"media.json":      &b.Media,
+		"webhooks.json":   &b.Webhooks,
+	}
+}
+
+// Write archives a backup taken at schema version schema to w, with the
+// files of its media read from store
+func Write(w io.Writer, b *models.Backup, schema int, hashes bool, store media.Store) error {
+	files := make(map[string][]byte)
+	for name, table := range tables(b) {
+		body, err := json.MarshalIndent(table, "", "  ")
+		if err != nil {
+			return err
+		}
+		files[name] = body
+	}
+
+	manifest := Manifest{
+		Format:  Format,
+		Schema:  schema,
+		Created: time.Now().UTC(),
+		Hashes:  hashes,
+		Files:   make(map[string]string, len(files)),
+	}
+	names := make([]string, 0, len(files))
+	for name, body := range files {
+		manifest.Files[name] = checksum(body)
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	// Media files are read twice, to checksum them for the manifest and then
+	// to archive them, rather than held in memory
+	for _, m := range b.Media {
+		sum, err := checksumStored(store, m.Key)
+		if err != nil {
+			return fmt.Errorf("media %s: %v", m.Key, err)
+		}
+		manifest.Files[mediaDir+m.Key] = sum
+	}
+
+	body, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	if err := writeFile(tw, manifestName, body, manifest.Created); err != nil {
+		return err
+	}
+	for _, name := range names {
+		if err := writeFile(tw, name, files[name], manifest.Created); err != nil {
+			return err
+		}
+	}
+	for _, m := range b.Media {
+		if err := writeStored(tw, store, m, manifest.Created); err != nil {
+			return fmt.Errorf("media %s: %v", m.Key, err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// writeFile adds a file to the archive
+func writeFile(tw *tar.Writer, name string, body []byte, modified time.Time) error {
+	err := tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0644,
+		Size:    int64(len(body)),
+		ModTime: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = tw.Write(body)
+	return err
+}
+
+// checksumStored returns the hex encoded SHA-256 of a stored file
+func checksumStored(store media.Store, key string) (string, error) {
+	file, err := store.Open(key)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeStored adds a stored media file to the archive
+func writeStored(tw *tar.Writer, store media.Store, m models.MediaRecord, modified time.Time) error {
+	file, err := store.Open(m.Key)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = tw.WriteHeader(&tar.Header{
+		Name:    mediaDir + m.Key,
+		Mode:    0644,
+		Size:    m.Size,
+		ModTime: modified,
+	})
+	if err != nil {
+		return err
+	}
+	_, err = io.CopyN(tw, file, m.Size)
+	return err
+}
+
+// Read checks an archive against its manifest and the schema version of
+// this build, returning the backup it holds. Media files are put in spool,
+// where they are left for the caller to move once the backup is restored.
+func Read(r io.Reader, latestSchema int, spool media.Store) (*models.Backup, *Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+
+	files := make(map[string][]byte)
+	sums := make(map[string]string)
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		if strings.HasPrefix(header.Name, mediaDir) {
+			// Media files are streamed to the spool, too large to be held in
+			// memory, and checked against the manifest with the rest
+			hash := sha256.New()
+			err := spool.Put(strings.TrimPrefix(header.Name, mediaDir), io.TeeReader(tr, hash), header.Size, "")
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", header.Name, err)
+			}
+			sums[header.Name] = hex.EncodeToString(hash.Sum(nil))
+			continue
+		}
+		body, err := ioutil.ReadAll(tr)
+		if err != nil {
+			return nil, nil, err
+		}
+		files[header.Name] = body
+		sums[header.Name] = checksum(body)
+	}
+
+	body, ok := files[manifestName]
+	if !ok {
+		return nil, nil, ErrNoManifest
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(body, &manifest); err != nil {
+		return nil, nil, fmt.Errorf("%s: %v", manifestName, err)
+	}
+	if manifest.Format > Format {
+		return nil, &manifest, ErrFormat
+	}
+	if manifest.Schema > latestSchema {
+		return nil, &manifest, ErrSchema
+	}
+
+	for name := range sums {
+		if _, ok := manifest.Files[name]; !ok && name != manifestName {
+			return nil, &manifest, fmt.Errorf("%v: %s is not in the manifest", ErrChecksum, name)
+		}
+	}
+	for name, sum := range manifest.Files {
+		got, ok := sums[name]
+		if !ok {
+			return nil, &manifest, fmt.Errorf("%v: %s is missing", ErrChecksum, name)
+		}
+		if got != sum {
+			return nil, &manifest, fmt.Errorf("%v: %s is corrupt", ErrChecksum, name)
+		}
+	}
+
+	b := &models.Backup{}
+	for name, table := range tables(b) {
+		body, ok := files[name]
+		if !ok {
+			// Tables added to later formats are absent from older archives
+			continue
+		}
+		if err := json.Unmarshal(body, table); err != nil {
+			return nil, &manifest, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+	return b, &manifest, nil
+}
+
+// checksum returns the hex encoded SHA-256 of body
+func checksum(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
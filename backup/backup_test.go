@@ -0,0 +1,89 @@
+package backup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/models"
+)
+
+// tempStore returns a local store in a temporary directory, and a function
+// removing it
+func tempStore(t *testing.T) (media.Store, func()) {
+	dir, err := ioutil.TempDir("", "backup-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return media.NewLocal(dir), func() { os.RemoveAll(dir) }
+}
+
+func TestRoundTrip(t *testing.T) {
+	store, remove := tempStore(t)
+	defer remove()
+	photo := []byte("not really a jpeg")
+	if err := store.Put("abc.jpg", bytes.NewReader(photo), int64(len(photo)), "image/jpeg"); err != nil {
+		t.Fatal(err)
+	}
+	b := &models.Backup{
+		Users:    []models.UserRecord{{ID: 1, Username: "admin"}},
+		Articles: []models.ArticleRecord{{ID: 3, Title: "Hello", Slug: "hello", Author: 1, Category: 1}},
+		Media:    []models.MediaRecord{{ID: 7, Key: "abc.jpg", Filename: "photo.jpg", ContentType: "image/jpeg", Size: int64(len(photo)), Owner: 1}},
+		Webhooks: []models.WebhookRecord{{ID: 2, URL: "https://example.com/hook", Secret: "secret", Events: []string{models.EventArticlePublished}, Active: true}},
+	}
+
+	var archive bytes.Buffer
+	if err := Write(&archive, b, 10, false, store); err != nil {
+		t.Fatal(err)
+	}
+
+	spool, removeSpool := tempStore(t)
+	defer removeSpool()
+	restored, manifest, err := Read(bytes.NewReader(archive.Bytes()), 10, spool)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Format != Format || manifest.Schema != 10 {
+		t.Errorf("manifest = %+v", manifest)
+	}
+	if len(restored.Articles) != 1 || restored.Articles[0].Slug != "hello" {
+		t.Errorf("articles = %+v", restored.Articles)
+	}
+	if len(restored.Webhooks) != 1 || restored.Webhooks[0].Secret != "secret" || len(restored.Webhooks[0].Events) != 1 {
+		t.Errorf("webhooks = %+v", restored.Webhooks)
+	}
+	if len(restored.Media) != 1 || restored.Media[0].Filename != "photo.jpg" {
+		t.Fatalf("media = %+v", restored.Media)
+	}
+	file, err := spool.Open("abc.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	if got, _ := ioutil.ReadAll(file); !bytes.Equal(got, photo) {
+		t.Errorf("spooled file = %q, want %q", got, photo)
+	}
+}
+
+func TestReadRejects(t *testing.T) {
+	store, remove := tempStore(t)
+	defer remove()
+	var archive bytes.Buffer
+	if err := Write(&archive, &models.Backup{}, 10, false, store); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := Read(bytes.NewReader(archive.Bytes()), 9, store); err != ErrSchema {
+		t.Errorf("reading a newer schema: err = %v, want %v", err, ErrSchema)
+	}
+
+	// Media whose file is missing fails the backup rather than being left
+	// out of it
+	b := &models.Backup{Media: []models.MediaRecord{{ID: 1, Key: "missing.png", Size: 1}}}
+	if err := Write(&bytes.Buffer{}, b, 10, false, store); err == nil || !strings.Contains(err.Error(), "missing.png") {
+		t.Errorf("backing up a missing file: err = %v", err)
+	}
+}
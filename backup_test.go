@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/models"
+)
+
+// TestRestoreMedia checks a failed restore reports the files it already put
+// in the store, so they can be removed again
+func TestRestoreMedia(t *testing.T) {
+	dir, err := ioutil.TempDir("", "restore-test-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	spool, store := media.NewLocal(dir+"/spool"), media.NewLocal(dir+"/store")
+	for _, key := range []string{"a.jpg", "c.jpg"} {
+		if err := spool.Put(key, bytes.NewReader([]byte(key)), int64(len(key)), "image/jpeg"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		keys     []string
+		restored []string
+		fails    bool
+	}{
+		{"none", nil, nil, false},
+		{"all", []string{"a.jpg", "c.jpg"}, []string{"a.jpg", "c.jpg"}, false},
+		{"missing", []string{"a.jpg", "b.jpg", "c.jpg"}, []string{"a.jpg"}, true},
+	}
+	for _, test := range tests {
+		b := &models.Backup{}
+		for _, key := range test.keys {
+			b.Media = append(b.Media, models.MediaRecord{Key: key, Size: int64(len(key)), ContentType: "image/jpeg"})
+		}
+		restored, err := restoreMedia(b, spool, store)
+		if (err != nil) != test.fails || !reflect.DeepEqual(restored, test.restored) {
+			t.Errorf("%s: restored %q, err %v", test.name, restored, err)
+		}
+		for _, key := range restored {
+			if file, err := store.Open(key); err != nil {
+				t.Errorf("%s: %s wasn't stored: %v", test.name, key, err)
+			} else {
+				file.Close()
+			}
+		}
+	}
+}
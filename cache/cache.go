@@ -0,0 +1,201 @@
+// Package cache keeps rendered responses in memory.
+//
+// The cache is bounded by the total size of the bodies it holds, evicting
+// the least recently used response when a new one doesn't fit, and expires
+// responses after a time to live. Each response is tagged with what it was
+// rendered from, such as the articles it lists, so a write can invalidate
+// exactly the responses showing what it changed.
+package cache
+
+import (
+	"container/list"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Options configures a cache
+type Options struct {
+	// MaxBytes bounds the total size of the bodies held
+	MaxBytes int
+	// TTL is how long a response is served for at most
+	TTL time.Duration
+}
+
+// Response is a rendered response
+type Response struct {
+	Status int
+	Header http.Header
+	Body   []byte
+}
+
+// entry is a cached response with what it was rendered from
+type entry struct {
+	key      string
+	response *Response
+	tags     []string
+	expires  time.Time
+}
+
+// Cache is a size bounded LRU cache of responses with a time to live. It is
+// safe for concurrent use.
+type Cache struct {
+	opts Options
+
+	mu    sync.Mutex
+	lru   *list.List
+	items map[string]*list.Element
+	// tagged holds the keys of the responses rendered from each tag
+	tagged map[string]map[string]struct{}
+	size   int
+	// generation counts invalidations, so responses rendered while one
+	// happened aren't stored
+	generation uint64
+	stats      Stats
+}
+
+// Stats counts how the cache has been used
+type Stats struct {
+	Hits   uint64
+	Misses uint64
+	// Evictions counts responses dropped to make room for others
+	Evictions uint64
+	// Invalidations counts responses dropped because what they were
+	// rendered from changed
+	Invalidations uint64
+	Entries       int
+	Bytes         int
+}
+
+// New returns an empty cache
+func New(opts Options) *Cache {
+	if opts.TTL <= 0 {
+		opts.TTL = 5 * time.Minute
+	}
+	return &Cache{
+		opts:   opts,
+		lru:    list.New(),
+		items:  make(map[string]*list.Element),
+		tagged: make(map[string]map[string]struct{}),
+	}
+}
+
+// Get returns the response stored under key unless it has expired
+func (c *Cache) Get(key string) (*Response, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[key]
+	if !ok {
+		c.stats.Misses++
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if time.Now().After(e.expires) {
+		c.remove(el)
+		c.stats.Misses++
+		return nil, false
+	}
+	c.lru.MoveToFront(el)
+	c.stats.Hits++
+	return e.response, true
+}
+
+// Generation returns a token to pass to Set for a response about to be
+// rendered
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Set stores a response under key, tagged with what it was rendered from.
+// Responses rendered while anything was invalidated, since generation was
+// taken, may be stale and are dropped, as are those larger than the cache.
+func (c *Cache) Set(key string, res *Response, tags []string, generation uint64) {
+	size := len(res.Body)
+	if size > c.opts.MaxBytes {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if generation != c.generation {
+		return
+	}
+	if el, ok := c.items[key]; ok {
+		c.remove(el)
+	}
+	for c.size+size > c.opts.MaxBytes {
+		c.remove(c.lru.Back())
+		c.stats.Evictions++
+	}
+
+	e := &entry{key: key, response: res, tags: tags, expires: time.Now().Add(c.opts.TTL)}
+	c.items[key] = c.lru.PushFront(e)
+	c.size += size
+	for _, tag := range tags {
+		keys, ok := c.tagged[tag]
+		if !ok {
+			keys = make(map[string]struct{})
+			c.tagged[tag] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+// Invalidate removes every response rendered from any of the tags
+func (c *Cache) Invalidate(tags ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	for _, tag := range tags {
+		for key := range c.tagged[tag] {
+			if el, ok := c.items[key]; ok {
+				c.remove(el)
+				c.stats.Invalidations++
+			}
+		}
+	}
+}
+
+// Purge removes every response
+func (c *Cache) Purge() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.generation++
+	c.stats.Invalidations += uint64(len(c.items))
+	c.lru.Init()
+	c.items = make(map[string]*list.Element)
+	c.tagged = make(map[string]map[string]struct{})
+	c.size = 0
+}
+
+// Stats returns how the cache has been used and what it holds
+func (c *Cache) Stats() Stats {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	stats := c.stats
+	stats.Entries = len(c.items)
+	stats.Bytes = c.size
+	return stats
+}
+
+// remove drops an entry and forgets its tags
+func (c *Cache) remove(el *list.Element) {
+	e := c.lru.Remove(el).(*entry)
+	delete(c.items, e.key)
+	c.size -= len(e.response.Body)
+	for _, tag := range e.tags {
+		if keys, ok := c.tagged[tag]; ok {
+			delete(keys, e.key)
+			if len(keys) == 0 {
+				delete(c.tagged, tag)
+			}
+		}
+	}
+}
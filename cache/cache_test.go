@@ -0,0 +1,138 @@
+package cache
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// keys returns the keys the cache holds responses for, sorted
+func keys(c *Cache) []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	held := []string{}
+	for key := range c.items {
+		held = append(held, key)
+	}
+	sort.Strings(held)
+	return held
+}
+
+func body(n int) *Response {
+	return &Response{Status: 200, Body: make([]byte, n)}
+}
+
+func TestInvalidate(t *testing.T) {
+	tests := []struct {
+		name       string
+		invalidate []string
+		kept       []string
+	}{
+		{"nothing", nil, []string{"/articles", "/articles/1", "/articles/2", "/categories/go"}},
+		{"one article", []string{"article:1"}, []string{"/articles/2", "/categories/go"}},
+		{"listed article", []string{"article:2"}, []string{"/articles/1", "/categories/go"}},
+		{"category", []string{"category:go"}, []string{"/articles", "/articles/1", "/articles/2"}},
+		{"several", []string{"article:1", "category:go"}, []string{"/articles/2"}},
+		{"unknown", []string{"article:3"}, []string{"/articles", "/articles/1", "/articles/2", "/categories/go"}},
+	}
+	for _, test := range tests {
+		c := New(Options{MaxBytes: 1000})
+		gen := c.Generation()
+		c.Set("/articles", body(10), []string{"articles", "article:1", "article:2"}, gen)
+		c.Set("/articles/1", body(10), []string{"article:1"}, gen)
+		c.Set("/articles/2", body(10), []string{"article:2"}, gen)
+		c.Set("/categories/go", body(10), []string{"category:go"}, gen)
+
+		c.Invalidate(test.invalidate...)
+		if kept := keys(c); !reflect.DeepEqual(kept, test.kept) {
+			t.Errorf("%s: kept %q, want %q", test.name, kept, test.kept)
+		}
+		if stats := c.Stats(); stats.Invalidations != uint64(4-len(test.kept)) || stats.Bytes != 10*len(test.kept) {
+			t.Errorf("%s: stats = %+v", test.name, stats)
+		}
+	}
+}
+
+func TestStaleGeneration(t *testing.T) {
+	c := New(Options{MaxBytes: 1000})
+	gen := c.Generation()
+	c.Invalidate("article:1")
+	c.Set("/articles/1", body(10), []string{"article:1"}, gen)
+	if _, ok := c.Get("/articles/1"); ok {
+		t.Error("a response rendered during an invalidation was stored")
+	}
+
+	c.Set("/articles/1", body(10), []string{"article:1"}, c.Generation())
+	if _, ok := c.Get("/articles/1"); !ok {
+		t.Error("a response rendered after the invalidation wasn't stored")
+	}
+}
+
+func TestEviction(t *testing.T) {
+	c := New(Options{MaxBytes: 30})
+	gen := c.Generation()
+	c.Set("a", body(10), []string{"x"}, gen)
+	c.Set("b", body(10), []string{"x"}, gen)
+	c.Set("c", body(10), nil, gen)
+	c.Get("a")
+	c.Set("d", body(10), nil, gen)
+	if held := keys(c); !reflect.DeepEqual(held, []string{"a", "c", "d"}) {
+		t.Errorf("held %q after eviction, want the least recently used dropped", held)
+	}
+
+	c.Set("big", body(31), nil, c.Generation())
+	if _, ok := c.Get("big"); ok {
+		t.Error("a response larger than the cache was stored")
+	}
+
+	// The tags of evicted responses are forgotten
+	c.Invalidate("x")
+	if stats := c.Stats(); stats.Evictions != 1 || stats.Invalidations != 1 || stats.Entries != 2 || stats.Bytes != 20 {
+		t.Errorf("stats = %+v", stats)
+	}
+	if len(c.tagged) != 0 {
+		t.Errorf("tags %v left after invalidation", c.tagged)
+	}
+}
+
+func TestReplace(t *testing.T) {
+	c := New(Options{MaxBytes: 100})
+	c.Set("a", body(10), []string{"x"}, c.Generation())
+	c.Set("a", body(20), []string{"y"}, c.Generation())
+	c.Invalidate("x")
+	res, ok := c.Get("a")
+	if !ok || len(res.Body) != 20 {
+		t.Fatal("replacing a response didn't drop its old tags")
+	}
+	if stats := c.Stats(); stats.Bytes != 20 || stats.Hits != 1 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestExpiry(t *testing.T) {
+	c := New(Options{MaxBytes: 100, TTL: time.Millisecond})
+	c.Set("a", body(10), nil, c.Generation())
+	time.Sleep(5 * time.Millisecond)
+	if _, ok := c.Get("a"); ok {
+		t.Error("an expired response was served")
+	}
+	if stats := c.Stats(); stats.Misses != 1 || stats.Entries != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
+
+func TestPurge(t *testing.T) {
+	c := New(Options{MaxBytes: 100})
+	gen := c.Generation()
+	c.Set("a", body(10), []string{"x"}, gen)
+	c.Set("b", body(10), nil, gen)
+	c.Purge()
+	c.Set("c", body(10), nil, gen)
+	if held := keys(c); len(held) != 0 {
+		t.Errorf("held %q after purging", held)
+	}
+	if stats := c.Stats(); stats.Invalidations != 2 || stats.Bytes != 0 {
+		t.Errorf("stats = %+v", stats)
+	}
+}
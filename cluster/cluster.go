@@ -0,0 +1,299 @@
+// Package cluster keeps instances of the blog sharing a database in step.
+//
+// Writes to articles, categories, users and media are published with Postgres
+// NOTIFY on a channel every instance LISTENs on, and each instance applies
+// the writes made by the others to what it holds in memory, such as the
+// response cache and the search index. Notifications sent while the
+// listening connection is down are lost, so after it reconnects everything
+// held in memory is resynchronised from the database instead, as it is once
+// an instance starts listening. Commands writing outside of the models, such
+// as a restore, ask every instance to resynchronise.
+package cluster
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/models"
+)
+
+// Channel is the channel writes are published on
+const Channel = "blog_writes"
+
+// resyncAction is the action of notifications asking every instance to
+// resynchronise, sent after writes made outside of the models such as a
+// restore
+const resyncAction models.Action = "resync"
+
+// logs is the logger of the cluster
+var logs = logging.For("cluster")
+
+// Options configures the connection notifications are received on
+type Options struct {
+	// MinReconnect is the wait before reconnecting after the connection is
+	// lost, doubling after each failed attempt up to MaxReconnect
+	MinReconnect time.Duration
+	MaxReconnect time.Duration
+	// PingInterval is how often an idle connection is checked, so a lost
+	// connection is noticed and reconnected
+	PingInterval time.Duration
+}
+
+// notification is the payload of a NOTIFY
+type notification struct {
+	// Instance is the instance which made the write
+	Instance string        `json:"instance"`
+	Model    string        `json:"model"`
+	Action   models.Action `json:"action"`
+	ID       int           `json:"id"`
+	Key      string        `json:"key"`
+	// Category is the category an article is filed under
+	Category int `json:"category,omitempty"`
+}
+
+// Node publishes the writes of this instance and applies those of others
+type Node struct {
+	db       *sql.DB
+	dsn      string
+	opts     Options
+	instance string
+
+	mu       sync.Mutex
+	handlers []func(models.Event)
+	resyncs  []func()
+
+	listener *pq.Listener
+	stop     chan struct{}
+	done     sync.WaitGroup
+	once     sync.Once
+
+	statsMu sync.Mutex
+	stats   Stats
+}
+
+// Stats counts the notifications of a node
+type Stats struct {
+	Published uint64
+	// PublishFailures counts writes other instances weren't told of
+	PublishFailures uint64
+	// Received counts the writes of other instances applied
+	Received uint64
+	Resyncs  uint64
+}
+
+// Stats returns the counts of the notifications of the node
+func (n *Node) Stats() Stats {
+	n.statsMu.Lock()
+	defer n.statsMu.Unlock()
+	return n.stats
+}
+
+// count updates the counts of the notifications of the node
+func (n *Node) count(f func(*Stats)) {
+	n.statsMu.Lock()
+	defer n.statsMu.Unlock()
+	f(&n.stats)
+}
+
+// New returns a node, which does nothing until it publishes writes and is
+// started. dsn is used to open the connection notifications are received on.
+func New(db *sql.DB, dsn string, opts Options) *Node {
+	if opts.MinReconnect <= 0 {
+		opts.MinReconnect = time.Second
+	}
+	if opts.MaxReconnect <= 0 {
+		opts.MaxReconnect = time.Minute
+	}
+	if opts.PingInterval <= 0 {
+		opts.PingInterval = 90 * time.Second
+	}
+
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		logs.Error("Failed to generate an instance id", "err", err)
+	}
+	return &Node{
+		db:       db,
+		dsn:      dsn,
+		opts:     opts,
+		instance: hex.EncodeToString(id),
+		stop:     make(chan struct{}),
+	}
+}
+
+// OnWrite registers a function applying writes made by other instances. The
+// event is built from the notification, with the article loaded for
+// articles which still exist.
+func (n *Node) OnWrite(f func(models.Event)) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.handlers = append(n.handlers, f)
+}
+
+// OnResync registers a function reloading what is held in memory from the
+// database, called when writes may have been missed
+func (n *Node) OnResync(f func()) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.resyncs = append(n.resyncs, f)
+}
+
+// Publish notifies the other instances of model writes
+func (n *Node) Publish() {
+	models.Listen(n.publish)
+}
+
+// publish sends a notification of a write
+func (n *Node) publish(e models.Event) {
+	switch e.Model {
+	case "article", "category", "user", "media":
+	default:
+		return
+	}
+
+	note := notification{Instance: n.instance, Model: e.Model, Action: e.Action, ID: e.ID, Key: e.Key}
+	if article, ok := e.Object.(*models.SQLArticle); ok && article.Category != nil {
+		note.Category = article.Category.ID
+	}
+	payload, err := json.Marshal(note)
+	if err != nil {
+		logs.Error("Failed to encode write notification", "err", err)
+		return
+	}
+	if _, err := n.db.Exec(`SELECT pg_notify($1, $2)`, Channel, string(payload)); err != nil {
+		logs.Error("Failed to notify other instances of a write", "err", err)
+		n.count(func(s *Stats) { s.PublishFailures++ })
+		return
+	}
+	n.count(func(s *Stats) { s.Published++ })
+}
+
+// PublishResync asks the other instances to reload everything they hold in
+// memory from the database
+func (n *Node) PublishResync() error {
+	payload, err := json.Marshal(notification{Instance: n.instance, Action: resyncAction})
+	if err != nil {
+		return err
+	}
+	_, err = n.db.Exec(`SELECT pg_notify($1, $2)`, Channel, string(payload))
+	return err
+}
+
+// Start listens for the writes of other instances in the background
+func (n *Node) Start() {
+	n.listener = pq.NewListener(n.dsn, n.opts.MinReconnect, n.opts.MaxReconnect, func(event pq.ListenerEventType, err error) {
+		switch event {
+		case pq.ListenerEventDisconnected:
+			logs.Warn("Lost the connection listening for writes", "err", err)
+		case pq.ListenerEventConnectionAttemptFailed:
+			logs.Warn("Failed to reconnect to listen for writes", "err", err)
+		case pq.ListenerEventReconnected:
+			logs.Info("Reconnected to listen for writes")
+		}
+	})
+	n.done.Add(1)
+	go n.run()
+}
+
+// Stop stops listening and waits for the write being applied
+func (n *Node) Stop() {
+	n.once.Do(func() {
+		close(n.stop)
+		if n.listener != nil {
+			n.listener.Close()
+		}
+	})
+	n.done.Wait()
+}
+
+// run applies notifications until stopped
+func (n *Node) run() {
+	defer n.done.Done()
+
+	if err := n.listener.Listen(Channel); err != nil {
+		logs.Error("Failed to listen for writes", "err", err)
+		return
+	}
+	// Writes made before listening started, such as while this instance
+	// was down, were never received
+	n.resync()
+
+	ping := time.NewTicker(n.opts.PingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case <-n.stop:
+			return
+		case pn, ok := <-n.listener.Notify:
+			if !ok {
+				return
+			}
+			if pn == nil {
+				// Sent after reconnecting, anything may have changed
+				// while the connection was down
+				n.resync()
+				continue
+			}
+			n.receive(pn.Extra)
+		case <-ping.C:
+			if err := n.listener.Ping(); err != nil {
+				logs.Warn("Connection listening for writes is down", "err", err)
+			}
+		}
+	}
+}
+
+// receive applies a notification sent by another instance
+func (n *Node) receive(payload string) {
+	var note notification
+	if err := json.Unmarshal([]byte(payload), &note); err != nil {
+		logs.Warn("Ignoring malformed write notification", "err", err)
+		return
+	}
+	if note.Instance == n.instance {
+		return
+	}
+	if note.Action == resyncAction {
+		n.resync()
+		return
+	}
+
+	e := models.Event{Model: note.Model, Action: note.Action, ID: note.ID, Key: note.Key}
+	if note.Model == "article" {
+		article := &models.SQLArticle{ID: note.ID, Slug: note.Key, Category: &models.SQLCategory{ID: note.Category}}
+		if note.Action != models.Deleted {
+			if loaded := models.NewSQLArticle(note.Key, n.db); loaded.Exists() {
+				article = loaded
+			}
+		}
+		e.Object = article
+	}
+
+	n.mu.Lock()
+	handlers := n.handlers
+	n.mu.Unlock()
+	for _, f := range handlers {
+		f(e)
+	}
+	n.count(func(s *Stats) { s.Received++ })
+}
+
+// resync reloads everything held in memory
+func (n *Node) resync() {
+	logs.Info("Resynchronising with the database")
+	n.count(func(s *Stats) { s.Resyncs++ })
+	n.mu.Lock()
+	resyncs := n.resyncs
+	n.mu.Unlock()
+	for _, f := range resyncs {
+		f()
+	}
+}
@@ -0,0 +1,65 @@
+package cluster
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/mattgen88/blog/models"
+)
+
+func TestReceive(t *testing.T) {
+	payload := func(note notification) string {
+		body, err := json.Marshal(note)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(body)
+	}
+
+	tests := []struct {
+		name     string
+		payload  string
+		events   int
+		resyncs  int
+		received uint64
+	}{
+		{"malformed", "{", 0, 0, 0},
+		{"own write", payload(notification{Instance: "self", Model: "category", Action: models.Updated, ID: 1}), 0, 0, 0},
+		{"own resync", payload(notification{Instance: "self", Action: resyncAction}), 0, 0, 0},
+		{"resync", payload(notification{Instance: "other", Action: resyncAction}), 0, 1, 0},
+		{"category", payload(notification{Instance: "other", Model: "category", Action: models.Updated, ID: 1, Key: "go"}), 1, 0, 1},
+		{"deleted article", payload(notification{Instance: "other", Model: "article", Action: models.Deleted, ID: 2, Key: "first", Category: 3}), 1, 0, 1},
+	}
+	for _, test := range tests {
+		n := New(nil, "", Options{})
+		n.instance = "self"
+		var events []models.Event
+		resyncs := 0
+		n.OnWrite(func(e models.Event) { events = append(events, e) })
+		n.OnResync(func() { resyncs++ })
+
+		n.receive(test.payload)
+		if len(events) != test.events || resyncs != test.resyncs || n.Stats().Received != test.received {
+			t.Errorf("%s: %d events, %d resyncs, stats %+v", test.name, len(events), resyncs, n.Stats())
+		}
+	}
+}
+
+func TestReceiveDeletedArticle(t *testing.T) {
+	n := New(nil, "", Options{})
+	var got models.Event
+	n.OnWrite(func(e models.Event) { got = e })
+
+	body, _ := json.Marshal(notification{Instance: "other", Model: "article", Action: models.Deleted, ID: 2, Key: "first", Category: 3})
+	n.receive(string(body))
+
+	// Deleted articles can't be loaded, so listeners get what the
+	// notification says of them
+	article, ok := got.Object.(*models.SQLArticle)
+	if !ok {
+		t.Fatalf("object = %T", got.Object)
+	}
+	if got.ID != 2 || got.Key != "first" || article.ID != 2 || article.Slug != "first" || article.Category.ID != 3 {
+		t.Errorf("event = %+v, article = %+v", got, article)
+	}
+}
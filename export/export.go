@@ -0,0 +1,226 @@
+// Package export mirrors pages served by the blog into a directory that can
+// be published on plain static hosting.
+//
+// Pages are requested from the blog's own http.Handler, so they are rendered
+// exactly as they would be served. Every page is written as index.html in a
+// directory named after its path and root relative links in HTML are
+// rewritten to relative ones, so the export works from any location, even
+// straight off the filesystem. Uploaded media and their variants are kept as
+// files under their own paths. A manifest of content hashes kept alongside
+// the export means later runs only rewrite files whose content changed and
+// remove those no longer exported.
+package export
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// manifestFile records the hash of every exported file
+const manifestFile = ".export.json"
+
+// Report summarises an export
+type Report struct {
+	Written   int
+	Unchanged int
+	Removed   int
+}
+
+// Exporter writes pages served by a handler to a directory
+type Exporter struct {
+	handler  http.Handler
+	dir      string
+	previous map[string]string
+	current  map[string]string
+	report   Report
+}
+
+// New returns an exporter writing the pages of handler into dir
+func New(handler http.Handler, dir string) (*Exporter, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	e := &Exporter{
+		handler:  handler,
+		dir:      dir,
+		previous: make(map[string]string),
+		current:  make(map[string]string),
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(dir, manifestFile))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(body, &e.previous); err != nil {
+			return nil, fmt.Errorf("%s: %v", manifestFile, err)
+		}
+	}
+	return e, nil
+}
+
+// filePaths match the paths of files served without an extension, the
+// uploaded media and their variants
+var filePaths = regexp.MustCompile(`^/media/[0-9]+/(file|variants/[^/]+)$`)
+
+// Target returns the file, relative to the export, a path is written to.
+// Paths naming a file, like /feed.rss or /media/1/file, are kept while pages
+// become an index.html in the directory of their path.
+func Target(p string) string {
+	p = path.Clean("/" + p)
+	if path.Ext(p) != "" || filePaths.MatchString(p) {
+		return strings.TrimPrefix(p, "/")
+	}
+	return strings.TrimPrefix(path.Join(p, "index.html"), "/")
+}
+
+// Page exports the HTML page served at p
+func (e *Exporter) Page(p string) error {
+	body, err := e.fetch(p, "text/html")
+	if err != nil {
+		return err
+	}
+	target := Target(p)
+	return e.write(target, relativize(body, target))
+}
+
+// File exports the document served at p, such as a feed, unchanged
+func (e *Exporter) File(p string) error {
+	body, err := e.fetch(p, "*/*")
+	if err != nil {
+		return err
+	}
+	return e.write(Target(p), body)
+}
+
+// CopyDir exports every file below src under the path prefix
+func (e *Exporter) CopyDir(src, prefix string) error {
+	return filepath.Walk(src, func(file string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		rel, err := filepath.Rel(src, file)
+		if err != nil {
+			return err
+		}
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		return e.write(strings.TrimPrefix(path.Join(prefix, filepath.ToSlash(rel)), "/"), body)
+	})
+}
+
+// Finish removes files exported by the previous run but not this one and
+// saves the manifest for the next
+func (e *Exporter) Finish() (Report, error) {
+	var stale []string
+	for target := range e.previous {
+		if _, ok := e.current[target]; !ok {
+			stale = append(stale, target)
+		}
+	}
+	sort.Strings(stale)
+	for _, target := range stale {
+		err := os.Remove(filepath.Join(e.dir, filepath.FromSlash(target)))
+		if err != nil && !os.IsNotExist(err) {
+			return e.report, err
+		}
+		e.report.Removed++
+	}
+
+	body, err := json.MarshalIndent(e.current, "", "  ")
+	if err != nil {
+		return e.report, err
+	}
+	return e.report, ioutil.WriteFile(filepath.Join(e.dir, manifestFile), body, 0644)
+}
+
+// fetch requests p from the handler
+func (e *Exporter) fetch(p, accept string) ([]byte, error) {
+	r := httptest.NewRequest("GET", (&url.URL{Path: p}).String(), nil)
+	r.Header.Set("Accept", accept)
+	w := httptest.NewRecorder()
+	e.handler.ServeHTTP(w, r)
+	if w.Code != http.StatusOK {
+		return nil, fmt.Errorf("%s: %d %s", p, w.Code, http.StatusText(w.Code))
+	}
+	return w.Body.Bytes(), nil
+}
+
+// write saves body as target unless it is unchanged since the last export
+func (e *Exporter) write(target string, body []byte) error {
+	sum := sha256.Sum256(body)
+	hash := hex.EncodeToString(sum[:])
+	e.current[target] = hash
+
+	file := filepath.Join(e.dir, filepath.FromSlash(target))
+	if e.previous[target] == hash {
+		if _, err := os.Stat(file); err == nil {
+			e.report.Unchanged++
+			return nil
+		}
+	}
+
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(file, body, 0644); err != nil {
+		return err
+	}
+	e.report.Written++
+	return nil
+}
+
+// rootLink matches root relative URLs in HTML attributes
+var rootLink = regexp.MustCompile(`(href|src|action)="(/[^/"][^"]*|/)"`)
+
+// relativize rewrites the root relative links of a page exported to target
+// to be relative to it
+func relativize(body []byte, target string) []byte {
+	from := path.Dir("/" + target)
+	return rootLink.ReplaceAllFunc(body, func(m []byte) []byte {
+		parts := rootLink.FindSubmatch(m)
+		link := string(parts[2])
+
+		fragment := ""
+		if i := strings.Index(link, "#"); i >= 0 {
+			link, fragment = link[:i], link[i:]
+		}
+		// Static hosting can't answer queries
+		if i := strings.Index(link, "?"); i >= 0 {
+			link = link[:i]
+		}
+		p, err := url.PathUnescape(link)
+		if err != nil {
+			return m
+		}
+
+		rel, err := filepath.Rel(from, "/"+Target(p))
+		if err != nil {
+			return m
+		}
+		href := (&url.URL{Path: filepath.ToSlash(rel)}).String() + fragment
+
+		var out bytes.Buffer
+		out.Write(parts[1])
+		out.WriteString(`="`)
+		out.WriteString(href)
+		out.WriteString(`"`)
+		return out.Bytes()
+	})
+}
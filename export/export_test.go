@@ -0,0 +1,135 @@
+package export
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		path, want string
+	}{
+		{"/", "index.html"},
+		{"", "index.html"},
+		{"/articles", "articles/index.html"},
+		{"/articles/first/", "articles/first/index.html"},
+		{"/feed.rss", "feed.rss"},
+		{"/categories/go/feed.atom", "categories/go/feed.atom"},
+		{"/sitemap-2.xml", "sitemap-2.xml"},
+		{"/media/3/file", "media/3/file"},
+		{"/media/3/variants/thumb", "media/3/variants/thumb"},
+		{"/media/3", "media/3/index.html"},
+		{"/media/3/variants", "media/3/variants/index.html"},
+		{"/articles/../robots.txt", "robots.txt"},
+	}
+	for _, test := range tests {
+		if got := Target(test.path); got != test.want {
+			t.Errorf("Target(%q) = %q, want %q", test.path, got, test.want)
+		}
+	}
+}
+
+func TestRelativize(t *testing.T) {
+	tests := []struct {
+		name, target, body, want string
+	}{
+		{"root", "articles/first/index.html", `<a href="/">`, `<a href="../../index.html">`},
+		{"sibling page", "articles/first/index.html", `<a href="/articles/second">`, `<a href="../second/index.html">`},
+		{"from root", "index.html", `<a href="/articles/first">`, `<a href="articles/first/index.html">`},
+		{"file", "articles/first/index.html", `<link href="/feed.rss">`, `<link href="../../feed.rss">`},
+		{"media", "articles/first/index.html", `<img src="/media/3/file">`, `<img src="../../media/3/file">`},
+		{"variant", "index.html", `<img src="/media/3/variants/thumb">`, `<img src="media/3/variants/thumb">`},
+		{"fragment", "articles/first/index.html", `<a href="/categories/go#top">`, `<a href="../../categories/go/index.html#top">`},
+		{"query", "index.html", `<form action="/search?q=go">`, `<form action="search/index.html">`},
+		{"escaped", "index.html", `<a href="/tags/go%20lang">`, `<a href="tags/go%20lang/index.html">`},
+		{"protocol relative", "index.html", `<a href="//cdn.example.com/x.js">`, `<a href="//cdn.example.com/x.js">`},
+		{"absolute", "index.html", `<a href="https://example.com/">`, `<a href="https://example.com/">`},
+		{"relative", "index.html", `<a href="about">`, `<a href="about">`},
+	}
+	for _, test := range tests {
+		if got := string(relativize([]byte(test.body), test.target)); got != test.want {
+			t.Errorf("%s: relativize = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestExporter(t *testing.T) {
+	pages := map[string]string{
+		"/":             `<a href="/articles/first">First</a>`,
+		"/feed.rss":     `<rss/>`,
+		"/media/1/file": "image",
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := pages[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte(body))
+	})
+
+	dir, err := ioutil.TempDir("", "export-")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	run := func(paths ...string) Report {
+		e, err := New(handler, dir)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, p := range paths {
+			if p == "/" {
+				err = e.Page(p)
+			} else {
+				err = e.File(p)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		report, err := e.Finish()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return report
+	}
+
+	tests := []struct {
+		name  string
+		paths []string
+		want  Report
+	}{
+		{"first", []string{"/", "/feed.rss", "/media/1/file"}, Report{Written: 3}},
+		{"unchanged", []string{"/", "/feed.rss", "/media/1/file"}, Report{Unchanged: 3}},
+		{"removed", []string{"/", "/media/1/file"}, Report{Unchanged: 2, Removed: 1}},
+	}
+	for _, test := range tests {
+		if got := run(test.paths...); got != test.want {
+			t.Errorf("%s: report = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+
+	body, err := ioutil.ReadFile(filepath.Join(dir, "index.html"))
+	if err != nil || string(body) != `<a href="articles/first/index.html">First</a>` {
+		t.Errorf("index.html = %q, %v", body, err)
+	}
+	if body, err := ioutil.ReadFile(filepath.Join(dir, "media", "1", "file")); err != nil || string(body) != "image" {
+		t.Errorf("media/1/file = %q, %v", body, err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "feed.rss")); !os.IsNotExist(err) {
+		t.Errorf("feed.rss wasn't removed: %v", err)
+	}
+
+	e, err := New(handler, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Page("/missing"); err == nil {
+		t.Error("exporting a missing page succeeded")
+	}
+}
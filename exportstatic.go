@@ -0,0 +1,152 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/spf13/viper"
+
+	"github.com/mattgen88/blog/export"
+	"github.com/mattgen88/blog/imaging"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/sitemap"
+)
+
+// feedFormats are exported for the blog and every category and author
+var feedFormats = []string{"rss", "atom", "json"}
+
+// exportBatch is how many articles or files are loaded at once
+const exportBatch = 500
+
+// exportStatic renders every page of the blog with its feeds, sitemap and
+// theme assets, and the media library, into a directory for static hosting
+func exportStatic(db *sql.DB) error {
+	if viper.GetString("base_url") == "" {
+		return errors.New("base_url must be set to export feeds and sitemaps")
+	}
+	dir := viper.GetString("export_dir")
+	if len(os.Args) > 2 {
+		dir = os.Args[2]
+	}
+
+	// The mirror is served from the root of wherever it is hosted
+	r, t, err := router(db, nil, nil, nil, nil, nil, "")
+	if err != nil {
+		return err
+	}
+	e, err := export.New(r, dir)
+	if err != nil {
+		return err
+	}
+
+	pages := []string{"/", "/articles"}
+	files := []string{"/robots.txt"}
+	for _, format := range feedFormats {
+		files = append(files, "/feed."+format)
+	}
+
+	count, _, err := models.ListedArticleCount(db)
+	if err != nil {
+		return err
+	}
+	for offset := 0; offset < count; offset += exportBatch {
+		articles, err := models.ListedArticles(offset, exportBatch, db)
+		if err != nil {
+			return err
+		}
+		for _, article := range articles {
+			pages = append(pages, "/articles/"+article.Key)
+		}
+	}
+
+	// Categories, authors and tags are those of articles, as the sitemap
+	// lists them
+	groups := 0
+	for _, g := range []struct {
+		group, prefix string
+		feeds         bool
+	}{
+		{"category", "/categories/", true},
+		{"author", "/users/", true},
+		{"tag", "/tags/", false},
+	} {
+		listed, err := models.ListedGroups(g.group, db)
+		if err != nil {
+			return err
+		}
+		groups += len(listed)
+		for _, l := range listed {
+			pages = append(pages, g.prefix+l.Key)
+			if !g.feeds {
+				continue
+			}
+			for _, format := range feedFormats {
+				files = append(files, g.prefix+l.Key+"/feed."+format)
+			}
+		}
+	}
+
+	// The sitemap lists the home page, articles, categories, authors and
+	// tags
+	files = append(files, "/sitemap.xml")
+	if n := sitemap.Pages(1 + count + groups); n > 1 {
+		for page := 1; page <= n; page++ {
+			files = append(files, fmt.Sprintf("/sitemap-%d.xml", page))
+		}
+	}
+
+	// Uploaded files and the variants rendered of them are copied as they
+	// are served, so the images of articles show in the mirror. Variants no
+	// longer configured are not served, so are left out
+	variants, err := imaging.ParseVariants(viper.GetString("image_variants"))
+	if err != nil {
+		return err
+	}
+	configured := map[string]bool{}
+	for _, v := range variants {
+		configured[v.Name] = true
+	}
+	for offset := 0; ; offset += exportBatch {
+		library, _ := models.MediaList(offset, exportBatch, db)
+		for _, m := range library {
+			id := strconv.Itoa(m.ID)
+			files = append(files, "/media/"+id+"/file")
+			for _, v := range models.VariantList(m.ID, db) {
+				if !configured[v.Name] {
+					continue
+				}
+				files = append(files, "/media/"+id+"/variants/"+v.Name)
+			}
+		}
+		if len(library) < exportBatch {
+			break
+		}
+	}
+
+	for _, page := range pages {
+		if err := e.Page(page); err != nil {
+			return err
+		}
+	}
+	for _, file := range files {
+		if err := e.File(file); err != nil {
+			return err
+		}
+	}
+	if t.Static != "" {
+		if err := e.CopyDir(t.Static, "/static"); err != nil {
+			return err
+		}
+	}
+
+	report, err := e.Finish()
+	if err != nil {
+		return err
+	}
+
+	logs.Info("Exported pages", "pages", len(pages), "dir", dir, "written", report.Written, "unchanged", report.Unchanged, "removed", report.Removed)
+	return nil
+}
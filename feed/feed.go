@@ -0,0 +1,59 @@
+// Package feed renders lists of articles as RSS 2.0, Atom and JSON Feed
+// documents.
+package feed
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+)
+
+// Feed is a format independent description of a syndication feed
+type Feed struct {
+	Title       string
+	Description string
+	// Link is the page the feed describes
+	Link string
+	// Self is the URL the feed is served from, in its format
+	Self    string
+	Updated time.Time
+	Items   []Item
+}
+
+// Item is a single entry of a feed
+type Item struct {
+	// ID uniquely and permanently identifies the item
+	ID        string
+	Title     string
+	Link      string
+	Author    string
+	Category  string
+	Published time.Time
+	Updated   time.Time
+	// Content is the full HTML body, empty when only a summary is published
+	Content string
+	// Summary is a plain text excerpt
+	Summary string
+}
+
+// TagURI builds a tag URI (RFC 4151) for an item first published at date on
+// the site at base. Unlike the item's URL it survives renames.
+func TagURI(base string, date time.Time, specific string) string {
+	host := base
+	if u, err := url.Parse(base); err == nil && u.Host != "" {
+		host = u.Hostname()
+	}
+	return fmt.Sprintf("tag:%s,%s:%s", host, date.UTC().Format("2006-01-02"), specific)
+}
+
+// Latest returns the most recent update of any item, or the epoch for an
+// empty feed
+func Latest(items []Item) time.Time {
+	latest := time.Unix(0, 0).UTC()
+	for _, item := range items {
+		if item.Updated.After(latest) {
+			latest = item.Updated
+		}
+	}
+	return latest
+}
@@ -0,0 +1,210 @@
+package feed
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTagURI(t *testing.T) {
+	date := time.Date(2024, 3, 1, 23, 30, 0, 0, time.FixedZone("EST", -5*3600))
+	tests := []struct {
+		name string
+		base string
+		want string
+	}{
+		{"url", "https://example.com", "tag:example.com,2024-03-02:article:1"},
+		{"port", "https://example.com:8443/blog", "tag:example.com,2024-03-02:article:1"},
+		{"host", "example.com", "tag:example.com,2024-03-02:article:1"},
+		{"fixed", "localhost", "tag:localhost,2024-03-02:article:1"},
+	}
+	for _, test := range tests {
+		if got := TagURI(test.base, date, "article:1"); got != test.want {
+			t.Errorf("%s: TagURI = %s, want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestLatest(t *testing.T) {
+	first := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	second := first.Add(time.Hour)
+	tests := []struct {
+		name  string
+		items []Item
+		want  time.Time
+	}{
+		{"empty", nil, time.Unix(0, 0).UTC()},
+		{"one", []Item{{Updated: first}}, first},
+		{"newest last", []Item{{Updated: first}, {Updated: second}}, second},
+		{"newest first", []Item{{Updated: second}, {Updated: first}}, second},
+	}
+	for _, test := range tests {
+		if got := Latest(test.items); !got.Equal(test.want) {
+			t.Errorf("%s: Latest = %v, want %v", test.name, got, test.want)
+		}
+	}
+}
+
+// sample returns a feed of one full article and one summarised
+func sample() *Feed {
+	published := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	updated := published.Add(24 * time.Hour)
+	return &Feed{
+		Title:       "Blog",
+		Description: "Notes & thoughts",
+		Link:        "https://example.com/",
+		Self:        "https://example.com/feed.atom",
+		Updated:     updated,
+		Items: []Item{
+			{
+				ID:        "tag:example.com,2024-03-01:article:2",
+				Title:     "Second <post>",
+				Link:      "https://example.com/articles/second",
+				Author:    "matt",
+				Category:  "go",
+				Published: published,
+				Updated:   updated,
+				Summary:   "A summary",
+				Content:   "<p>The whole post</p>",
+			},
+			{
+				ID:        "tag:example.com,2024-03-01:article:1",
+				Title:     "First",
+				Link:      "https://example.com/articles/first",
+				Published: published,
+				Updated:   published,
+				Summary:   "Only a summary",
+			},
+		},
+	}
+}
+
+func TestAtom(t *testing.T) {
+	body, err := sample().Atom()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc atomFeed
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid Atom: %v", err)
+	}
+
+	if doc.ID != "https://example.com/feed.atom" || doc.Title != "Blog" || doc.Tagline != "Notes & thoughts" {
+		t.Errorf("feed = %+v", doc)
+	}
+	if doc.Updated != "2024-03-02T12:00:00Z" {
+		t.Errorf("updated = %s", doc.Updated)
+	}
+	if len(doc.Entries) != 2 {
+		t.Fatalf("%d entries, want 2", len(doc.Entries))
+	}
+
+	tests := []struct {
+		name                 string
+		entry                atomEntry
+		id, title, published string
+		author, category     bool
+		content              bool
+	}{
+		{"full", doc.Entries[0], "tag:example.com,2024-03-01:article:2", "Second <post>", "2024-03-01T12:00:00Z", true, true, true},
+		{"summary", doc.Entries[1], "tag:example.com,2024-03-01:article:1", "First", "2024-03-01T12:00:00Z", false, false, false},
+	}
+	for _, test := range tests {
+		e := test.entry
+		if e.ID != test.id || e.Title != test.title || e.Published != test.published {
+			t.Errorf("%s: entry = %+v", test.name, e)
+		}
+		if (e.Author != nil) != test.author || (e.Category != nil) != test.category || (e.Content != nil) != test.content {
+			t.Errorf("%s: author %v, category %v, content %v", test.name, e.Author, e.Category, e.Content)
+		}
+		if e.Summary == nil || e.Summary.Type != "text" {
+			t.Errorf("%s: summary = %+v", test.name, e.Summary)
+		}
+	}
+}
+
+func TestRSS(t *testing.T) {
+	body, err := sample().RSS()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Namespaced elements don't unmarshal into the prefixed names they are
+	// written with, so only the document itself is parsed
+	var doc struct {
+		Channel struct {
+			Items []struct {
+				GUID string `xml:"guid"`
+			} `xml:"item"`
+		} `xml:"channel"`
+	}
+	if err := xml.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid RSS: %v", err)
+	}
+	if len(doc.Channel.Items) != 2 {
+		t.Fatalf("%d items, want 2", len(doc.Channel.Items))
+	}
+
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"version", `<rss version="2.0"`},
+		{"self", `<atom:link href="https://example.com/feed.atom" rel="self" type="application/rss+xml"></atom:link>`},
+		{"build date", `<lastBuildDate>Sat, 02 Mar 2024 12:00:00 +0000</lastBuildDate>`},
+		{"escaped title", `<title>Second &lt;post&gt;</title>`},
+		{"guid", `<guid isPermaLink="false">tag:example.com,2024-03-01:article:2</guid>`},
+		{"published", `<pubDate>Fri, 01 Mar 2024 12:00:00 +0000</pubDate>`},
+		{"creator", `<dc:creator>matt</dc:creator>`},
+		{"content", `<content:encoded><![CDATA[<p>The whole post</p>]]></content:encoded>`},
+	}
+	for _, test := range tests {
+		if !strings.Contains(string(body), test.want) {
+			t.Errorf("%s: missing %s", test.name, test.want)
+		}
+	}
+	if strings.Count(string(body), "<content:encoded>") != 1 {
+		t.Error("summarised items shouldn't have content")
+	}
+}
+
+func TestJSON(t *testing.T) {
+	body, err := sample().JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var doc jsonFeed
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("invalid JSON Feed: %v", err)
+	}
+	if doc.Version != "https://jsonfeed.org/version/1.1" || doc.FeedURL != "https://example.com/feed.atom" {
+		t.Errorf("feed = %+v", doc)
+	}
+	if len(doc.Items) != 2 {
+		t.Fatalf("%d items, want 2", len(doc.Items))
+	}
+
+	tests := []struct {
+		name              string
+		item              jsonItem
+		html, text        string
+		authors, tags     int
+		published, edited string
+	}{
+		{"full", doc.Items[0], "<p>The whole post</p>", "", 1, 1, "2024-03-01T12:00:00Z", "2024-03-02T12:00:00Z"},
+		{"summary", doc.Items[1], "", "Only a summary", 0, 0, "2024-03-01T12:00:00Z", "2024-03-01T12:00:00Z"},
+	}
+	for _, test := range tests {
+		i := test.item
+		if i.ContentHTML != test.html || i.ContentText != test.text {
+			t.Errorf("%s: content %q, text %q", test.name, i.ContentHTML, i.ContentText)
+		}
+		if len(i.Authors) != test.authors || len(i.Tags) != test.tags {
+			t.Errorf("%s: authors %v, tags %v", test.name, i.Authors, i.Tags)
+		}
+		if i.DatePublished != test.published || i.DateModified != test.edited {
+			t.Errorf("%s: published %s, modified %s", test.name, i.DatePublished, i.DateModified)
+		}
+	}
+}
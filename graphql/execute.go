@@ -0,0 +1,359 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Request is a GraphQL request as posted to an endpoint
+type Request struct {
+	Query         string                 `json:"query"`
+	Variables     map[string]interface{} `json:"variables"`
+	OperationName string                 `json:"operationName"`
+}
+
+// Response is the result of a request. Data is nil when the request could
+// not be executed at all.
+type Response struct {
+	Data   interface{} `json:"data,omitempty"`
+	Errors []*Error    `json:"errors,omitempty"`
+}
+
+// Error is an error executing a request, with the path of response keys to
+// the field that failed
+type Error struct {
+	Message string   `json:"message"`
+	Path    []string `json:"path,omitempty"`
+}
+
+// Execute parses, validates and executes a request. Queries deeper or more
+// complex than the limits are rejected before anything is resolved, a limit
+// of 0 leaves it unchecked. Resolvers are given ctx.
+func (s *Schema) Execute(ctx context.Context, req Request, limits Limits) *Response {
+	doc, err := Parse(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	op, err := doc.operation(req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{{Message: err.Error()}}}
+	}
+
+	v := &validator{
+		schema:    s,
+		doc:       doc,
+		variables: make(map[string]interface{}),
+		declared:  make(map[string]bool),
+		args:      make(map[*FieldSelection]Args),
+		conds:     make(map[*Directive]bool),
+		spreading: make(map[string]bool),
+	}
+	v.coerceVariables(op, req.Variables)
+	if len(v.errors) > 0 {
+		return &Response{Errors: v.errors}
+	}
+	depth, complexity := v.selections(s.Query, op.Selections)
+	if len(v.errors) > 0 {
+		return &Response{Errors: v.errors}
+	}
+	if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+		return &Response{Errors: []*Error{{
+			Message: fmt.Sprintf("Query is nested %d levels deep, more than the limit of %d", depth, limits.MaxDepth),
+		}}}
+	}
+	if limits.MaxComplexity > 0 && complexity > limits.MaxComplexity {
+		return &Response{Errors: []*Error{{
+			Message: fmt.Sprintf("Query has a complexity of %d, more than the limit of %d", complexity, limits.MaxComplexity),
+		}}}
+	}
+
+	e := &executor{ctx: ctx, schema: s, doc: doc, args: v.args, conds: v.conds}
+	data := e.objects(s.Query, []interface{}{nil}, op.Selections, nil)[0]
+	if data == errPropagate {
+		data = nil
+	}
+	return &Response{Data: dataOrNull{data}, Errors: e.errors}
+}
+
+// dataOrNull marshals a nil result as null rather than leaving data out
+type dataOrNull struct {
+	value interface{}
+}
+
+func (d dataOrNull) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.value)
+}
+
+// operation returns the operation to execute
+func (doc *Document) operation(name string) (*Operation, error) {
+	if name == "" {
+		if len(doc.Operations) != 1 {
+			return nil, fmt.Errorf("An operation name is required for documents with %d operations", len(doc.Operations))
+		}
+		return doc.Operations[0], nil
+	}
+	for _, op := range doc.Operations {
+		if op.Name == name {
+			return op, nil
+		}
+	}
+	return nil, fmt.Errorf("Unknown operation %s", name)
+}
+
+// errPropagate stands in for a null in a non-null position, which makes the
+// nearest nullable parent null
+var errPropagate = &struct{}{}
+
+// executor resolves the fields of a validated operation a level at a time
+type executor struct {
+	ctx    context.Context
+	schema *Schema
+	doc    *Document
+	args   map[*FieldSelection]Args
+	conds  map[*Directive]bool
+	errors []*Error
+}
+
+func (e *executor) fail(path []string, message string) {
+	e.errors = append(e.errors, &Error{Message: message, Path: append([]string(nil), path...)})
+}
+
+// field is a response key with the selections merged into it
+type field struct {
+	key        string
+	selections []*FieldSelection
+}
+
+// collect flattens fragments into the fields selected, in order, leaving out
+// those skipped by directives
+func (e *executor) collect(selections []Selection, fields []*field, index map[string]*field) []*field {
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *FieldSelection:
+			if !e.included(sel.Directives) {
+				continue
+			}
+			f, ok := index[sel.Key()]
+			if !ok {
+				f = &field{key: sel.Key()}
+				index[f.key] = f
+				fields = append(fields, f)
+			}
+			f.selections = append(f.selections, sel)
+		case *InlineFragment:
+			if e.included(sel.Directives) {
+				fields = e.collect(sel.Selections, fields, index)
+			}
+		case *FragmentSpread:
+			if e.included(sel.Directives) {
+				fields = e.collect(e.doc.Fragments[sel.Name].Selections, fields, index)
+			}
+		}
+	}
+	return fields
+}
+
+// included evaluates @skip and @include
+func (e *executor) included(directives []*Directive) bool {
+	for _, d := range directives {
+		if d.Name == "skip" && e.conds[d] || d.Name == "include" && !e.conds[d] {
+			return false
+		}
+	}
+	return true
+}
+
+// objects resolves the selections of a batch of objects of the same type
+func (e *executor) objects(o *Object, parents []interface{}, selections []Selection, path []string) []interface{} {
+	results := make([]*orderedObject, len(parents))
+	for i := range results {
+		results[i] = &orderedObject{values: make(map[string]interface{})}
+	}
+
+	for _, f := range e.collect(selections, nil, make(map[string]*field)) {
+		sel := f.selections[0]
+		fieldPath := append(path[:len(path):len(path)], f.key)
+
+		if sel.Name == "__typename" {
+			for _, result := range results {
+				result.set(f.key, o.Name)
+			}
+			continue
+		}
+
+		def := o.Fields[sel.Name]
+		values, err := def.Resolve(e.ctx, parents, e.args[sel])
+		if err == nil && len(values) != len(parents) {
+			err = fmt.Errorf("resolved %d values for %d objects", len(values), len(parents))
+		}
+		if err != nil {
+			e.fail(fieldPath, err.Error())
+			values = make([]interface{}, len(parents))
+		}
+
+		var subselections []Selection
+		for _, s := range f.selections {
+			subselections = append(subselections, s.Selections...)
+		}
+
+		values = e.complete(def.Type, values, subselections, fieldPath)
+		for i, result := range results {
+			result.set(f.key, values[i])
+		}
+	}
+
+	out := make([]interface{}, len(results))
+	for i, result := range results {
+		out[i] = result
+		for _, value := range result.values {
+			if value == errPropagate {
+				out[i] = nil
+				break
+			}
+		}
+	}
+	return out
+}
+
+// complete turns the resolved values of a field into their response values
+func (e *executor) complete(t *TypeRef, values []interface{}, selections []Selection, path []string) []interface{} {
+	if t.NonNull {
+		for _, value := range values {
+			if isNil(value) {
+				e.fail(path, "Cannot return null for non-null field")
+				break
+			}
+		}
+		out := e.complete(t.Elem, values, selections, path)
+		for i, value := range out {
+			if value == nil {
+				out[i] = errPropagate
+			}
+		}
+		return out
+	}
+
+	if t.Elem != nil {
+		return e.completeLists(t, values, selections, path)
+	}
+
+	out := make([]interface{}, len(values))
+
+	if o, ok := e.schema.objects[t.Name]; ok {
+		var (
+			parents []interface{}
+			at      []int
+		)
+		for i, value := range values {
+			if !isNil(value) {
+				parents = append(parents, value)
+				at = append(at, i)
+			}
+		}
+		if len(parents) > 0 {
+			for j, value := range e.objects(o, parents, selections, path) {
+				out[at[j]] = value
+			}
+		}
+		return out
+	}
+
+	failed := false
+	for i, value := range values {
+		if isNil(value) {
+			continue
+		}
+		v, err := serialize(t.Name, value)
+		if err != nil && !failed {
+			e.fail(path, fmt.Sprintf("Cannot serialize %v as %s", value, t.Name))
+			failed = true
+		}
+		out[i] = v
+	}
+	return out
+}
+
+// completeLists completes every item of every list at once, so the objects
+// in all of them are resolved together
+func (e *executor) completeLists(t *TypeRef, values []interface{}, selections []Selection, path []string) []interface{} {
+	var (
+		items   []interface{}
+		lengths = make([]int, len(values))
+	)
+	for i, value := range values {
+		if isNil(value) {
+			lengths[i] = -1
+			continue
+		}
+		list := reflect.ValueOf(value)
+		if list.Kind() != reflect.Slice && list.Kind() != reflect.Array {
+			e.fail(path, "Expected a list")
+			lengths[i] = -1
+			continue
+		}
+		lengths[i] = list.Len()
+		for j := 0; j < list.Len(); j++ {
+			items = append(items, list.Index(j).Interface())
+		}
+	}
+
+	completed := e.complete(t.Elem, items, selections, path)
+
+	out := make([]interface{}, len(values))
+	for i, n := range lengths {
+		if n < 0 {
+			continue
+		}
+		list := completed[:n:n]
+		completed = completed[n:]
+		out[i] = list
+		for _, item := range list {
+			if item == errPropagate {
+				out[i] = nil
+				break
+			}
+		}
+	}
+	return out
+}
+
+// orderedObject is a response object, which keeps its keys in the order
+// they were selected
+type orderedObject struct {
+	keys   []string
+	values map[string]interface{}
+}
+
+func (o *orderedObject) set(key string, value interface{}) {
+	if _, ok := o.values[key]; !ok {
+		o.keys = append(o.keys, key)
+	}
+	o.values[key] = value
+}
+
+func (o *orderedObject) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, key := range o.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		k, err := json.Marshal(key)
+		if err != nil {
+			return nil, err
+		}
+		v, err := json.Marshal(o.values[key])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(k)
+		b.WriteByte(':')
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
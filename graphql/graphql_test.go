@@ -0,0 +1,270 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(`
+		# Articles with their comments
+		query Articles($first: Int = 2, $ids: [ID!]) {
+			latest: articles(first: $first, tags: ["go", "sql"], ratio: -1.5e2) @include(if: true) {
+				...fields
+				... on Article { title }
+			}
+		}
+		fragment fields on Article { id, title(format: PLAIN, quote: "say \"hi\"!") }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Operations) != 1 || doc.Operations[0].Name != "Articles" {
+		t.Fatalf("operations = %+v", doc.Operations)
+	}
+	op := doc.Operations[0]
+	if len(op.Variables) != 2 || op.Variables[0].Default != int64(2) || op.Variables[1].Type.String() != "[ID!]" {
+		t.Errorf("variables = %+v", op.Variables)
+	}
+
+	field := op.Selections[0].(*FieldSelection)
+	if field.Key() != "latest" || field.Name != "articles" {
+		t.Errorf("field %s is keyed %s", field.Name, field.Key())
+	}
+	args := map[string]Value{
+		"first": Variable("first"),
+		"tags":  []interface{}{"go", "sql"},
+		"ratio": -150.0,
+	}
+	if !reflect.DeepEqual(field.Arguments, args) {
+		t.Errorf("arguments = %#v, want %#v", field.Arguments, args)
+	}
+	if len(field.Directives) != 1 || field.Directives[0].Name != "include" {
+		t.Errorf("directives = %+v", field.Directives)
+	}
+	if spread, ok := field.Selections[0].(*FragmentSpread); !ok || spread.Name != "fields" {
+		t.Errorf("selection %#v isn't a spread of fields", field.Selections[0])
+	}
+	if inline, ok := field.Selections[1].(*InlineFragment); !ok || inline.On != "Article" {
+		t.Errorf("selection %#v isn't an inline fragment on Article", field.Selections[1])
+	}
+
+	title := doc.Fragments["fields"].Selections[1].(*FieldSelection)
+	if title.Arguments["format"] != Enum("PLAIN") || title.Arguments["quote"] != `say "hi"!` {
+		t.Errorf("arguments = %#v", title.Arguments)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		src, message string
+	}{
+		{`{ articles { title }`, "found the end of the document"},
+		{`{ }`, "empty selection set"},
+		{`mutation { delete }`, "mutation operations are not supported"},
+		{`subscription { articles }`, "subscription operations are not supported"},
+		{`{ a } fragment f on A { a } fragment f on A { a }`, "fragment f is defined more than once"},
+		{`fragment on on A { a }`, "a fragment can't be named on"},
+		{`{ a(x: 1, x: 2) }`, "argument x is given more than once"},
+		{`query ($x: Int = $y) { a }`, "variables are not allowed here"},
+		{`{ a(x: "open) }`, "unterminated string"},
+		{`{ a(x: "open\`, "unterminated string"},
+		{`{ a(x: """open) }`, "unterminated block string"},
+		{`{ a(x: "\u12") }`, "invalid unicode escape"},
+		{`{ a(x: 1.) }`, "invalid number"},
+		{`{ a(x: -) }`, "invalid number"},
+		{`{ a(x: 99999999999999999999) }`, "invalid integer"},
+		{`{ a ; }`, "unexpected character"},
+	}
+	for _, test := range tests {
+		_, err := Parse(test.src)
+		if _, ok := err.(*SyntaxError); !ok || !strings.Contains(err.Error(), test.message) {
+			t.Errorf("Parse(%q) = %v, want a syntax error about %q", test.src, err, test.message)
+		}
+	}
+}
+
+type testArticle struct {
+	ID    int
+	Title string
+}
+
+// testSchema returns a schema of articles and their comments, counting the
+// calls made to resolve comments
+func testSchema(t *testing.T, calls *int) *Schema {
+	comment := &Object{Name: "Comment", Fields: map[string]*Field{
+		"body": {Type: Type("String"), Resolve: Each(func(parent interface{}) interface{} {
+			return parent
+		})},
+	}}
+	article := &Object{Name: "Article", Fields: map[string]*Field{
+		"id":    {Type: Type("ID!"), Resolve: Each(func(parent interface{}) interface{} { return parent.(testArticle).ID })},
+		"title": {Type: Type("String"), Resolve: Each(func(parent interface{}) interface{} { return parent.(testArticle).Title })},
+		"comments": {
+			Type: Type("[Comment!]!"),
+			Args: map[string]*Argument{"first": {Type: Type("Int")}},
+			Resolve: func(ctx context.Context, parents []interface{}, args Args) ([]interface{}, error) {
+				*calls++
+				values := make([]interface{}, len(parents))
+				for i, parent := range parents {
+					values[i] = []interface{}{parent.(testArticle).Title + " is good"}
+				}
+				return values, nil
+			},
+		},
+	}}
+	articles := []interface{}{testArticle{1, "First"}, testArticle{2, "Second"}, testArticle{3, "Third"}}
+	query := &Object{Name: "Query", Fields: map[string]*Field{
+		"articles": {
+			Type: Type("[Article!]!"),
+			Args: map[string]*Argument{"first": {Type: Type("Int"), Default: 10}},
+			Resolve: func(ctx context.Context, parents []interface{}, args Args) ([]interface{}, error) {
+				first := args.Int("first")
+				if first > len(articles) {
+					first = len(articles)
+				}
+				return []interface{}{articles[:first]}, nil
+			},
+		},
+		"article": {
+			Type: Type("Article"),
+			Args: map[string]*Argument{"id": {Type: Type("ID!")}},
+			Resolve: func(ctx context.Context, parents []interface{}, args Args) ([]interface{}, error) {
+				for _, a := range articles {
+					if strconv.Itoa(a.(testArticle).ID) == args.String("id") {
+						return []interface{}{a}, nil
+					}
+				}
+				return []interface{}{nil}, nil
+			},
+		},
+	}}
+	s, err := NewSchema(query, article, comment)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		variables map[string]interface{}
+		response  string
+	}{
+		{
+			"aliases and fragments",
+			`query { top: articles(first: 2) { ...f } } fragment f on Article { id, name: title }`,
+			nil,
+			`{"data":{"top":[{"id":"1","name":"First"},{"id":"2","name":"Second"}]}}`,
+		},
+		{
+			"variables and directives",
+			`query ($n: Int!, $skip: Boolean = true) { articles(first: $n) { title @skip(if: $skip) __typename } }`,
+			map[string]interface{}{"n": 1.0},
+			`{"data":{"articles":[{"__typename":"Article"}]}}`,
+		},
+		{
+			"batched",
+			`{ articles { comments { body } } }`,
+			nil,
+			`{"data":{"articles":[{"comments":[{"body":"First is good"}]},{"comments":[{"body":"Second is good"}]},{"comments":[{"body":"Third is good"}]}]}}`,
+		},
+		{
+			"null object",
+			`{ article(id: 4) { title } }`,
+			nil,
+			`{"data":{"article":null}}`,
+		},
+		{
+			"unknown field",
+			`{ articles { body } }`,
+			nil,
+			`{"errors":[{"message":"Cannot query field body on type Article"}]}`,
+		},
+		{
+			"missing argument",
+			`{ article { title } }`,
+			nil,
+			`{"errors":[{"message":"Argument id of Query.article is required"}]}`,
+		},
+		{
+			"missing variable",
+			`query ($n: Int!) { articles(first: $n) { id } }`,
+			nil,
+			`{"errors":[{"message":"Variable $n of type Int! is required"}]}`,
+		},
+		{
+			"leaf with selections",
+			`{ articles { title { length } } }`,
+			nil,
+			`{"errors":[{"message":"Field Article.title of type String can't have selections"}]}`,
+		},
+		{
+			"object without selections",
+			`{ articles }`,
+			nil,
+			`{"errors":[{"message":"Field Query.articles of type [Article!]! must have selections"}]}`,
+		},
+		{
+			"recursive fragment",
+			`{ articles { ...f } } fragment f on Article { ...f }`,
+			nil,
+			`{"errors":[{"message":"Fragment f spreads itself"}]}`,
+		},
+	}
+	for _, test := range tests {
+		calls := 0
+		s := testSchema(t, &calls)
+		resp := s.Execute(context.Background(), Request{Query: test.query, Variables: test.variables}, Limits{})
+		body, err := json.Marshal(resp)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(body) != test.response {
+			t.Errorf("%s: responded %s, want %s", test.name, body, test.response)
+		}
+		if calls > 1 {
+			t.Errorf("%s: comments resolved in %d calls, want 1", test.name, calls)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		query  string
+		limits Limits
+		err    string
+	}{
+		{"unlimited", `{ articles { comments { body } } }`, Limits{}, ""},
+		{"within depth", `{ articles { comments { body } } }`, Limits{MaxDepth: 3}, ""},
+		{"too deep", `{ articles { comments { body } } }`, Limits{MaxDepth: 2}, "Query is nested 3 levels deep, more than the limit of 2"},
+		{"fragments count", `{ articles { ...f } } fragment f on Article { comments { body } }`, Limits{MaxDepth: 2}, "Query is nested 3 levels deep, more than the limit of 2"},
+		// 1 for articles, and 10 assumed articles of 1 for title
+		{"within complexity", `{ articles { title } }`, Limits{MaxComplexity: 11}, ""},
+		{"too complex", `{ articles { title id } }`, Limits{MaxComplexity: 11}, "Query has a complexity of 21, more than the limit of 11"},
+		// 1 for articles, and 2 articles of 1 for comments and 10 assumed
+		// comments of 1 for body
+		{"first bounds lists", `{ articles(first: 2) { comments { body } } }`, Limits{MaxComplexity: 23}, ""},
+		{"nested lists multiply", `{ articles { comments { body } } }`, Limits{MaxComplexity: 110}, "Query has a complexity of 111, more than the limit of 110"},
+		{"aliases count", `{ a: articles(first: 1) { id } b: articles(first: 1) { id } }`, Limits{MaxComplexity: 3}, "Query has a complexity of 4, more than the limit of 3"},
+	}
+	for _, test := range tests {
+		calls := 0
+		resp := testSchema(t, &calls).Execute(context.Background(), Request{Query: test.query}, test.limits)
+		switch {
+		case test.err == "" && len(resp.Errors) > 0:
+			t.Errorf("%s: failed with %s", test.name, resp.Errors[0].Message)
+		case test.err != "" && (len(resp.Errors) != 1 || resp.Errors[0].Message != test.err):
+			t.Errorf("%s: errors = %+v, want %s", test.name, resp.Errors, test.err)
+		case test.err != "" && calls > 0:
+			t.Errorf("%s: resolved fields of a rejected query", test.name)
+		}
+	}
+}
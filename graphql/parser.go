@@ -0,0 +1,537 @@
+package graphql
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// Document is a parsed GraphQL request document
+type Document struct {
+	Operations []*Operation
+	Fragments  map[string]*Fragment
+}
+
+// Operation is a query in a document, mutations and subscriptions are not
+// supported
+type Operation struct {
+	Name       string
+	Variables  []*VariableDefinition
+	Selections []Selection
+}
+
+// VariableDefinition declares a variable of an operation
+type VariableDefinition struct {
+	Name    string
+	Type    *TypeRef
+	Default Value
+}
+
+// Fragment is a named fragment
+type Fragment struct {
+	Name       string
+	On         string
+	Selections []Selection
+}
+
+// Selection is a field, fragment spread or inline fragment
+type Selection interface {
+	selection()
+}
+
+// FieldSelection selects a field, under an alias when given
+type FieldSelection struct {
+	Alias      string
+	Name       string
+	Arguments  map[string]Value
+	Directives []*Directive
+	Selections []Selection
+}
+
+// FragmentSpread includes a named fragment
+type FragmentSpread struct {
+	Name       string
+	Directives []*Directive
+}
+
+// InlineFragment includes selections, for objects of a type when On is set
+type InlineFragment struct {
+	On         string
+	Directives []*Directive
+	Selections []Selection
+}
+
+func (*FieldSelection) selection() {}
+func (*FragmentSpread) selection() {}
+func (*InlineFragment) selection() {}
+
+// Key is the name a field is returned under
+func (f *FieldSelection) Key() string {
+	if f.Alias != "" {
+		return f.Alias
+	}
+	return f.Name
+}
+
+// Directive annotates a selection, only @skip and @include are supported
+type Directive struct {
+	Name      string
+	Arguments map[string]Value
+}
+
+// Value is a literal in a document
+type Value interface{}
+
+// Variable refers to a variable of the operation
+type Variable string
+
+// Enum is an enum literal
+type Enum string
+
+// token kinds
+const (
+	tokenEOF = iota
+	tokenPunct
+	tokenName
+	tokenInt
+	tokenFloat
+	tokenString
+)
+
+type token struct {
+	kind  int
+	value string
+	pos   int
+}
+
+// SyntaxError reports where a document failed to parse
+type SyntaxError struct {
+	Pos     int
+	Message string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("syntax error at %d: %s", e.Pos, e.Message)
+}
+
+// parser is a recursive descent parser over a token stream
+type parser struct {
+	src string
+	pos int
+	tok token
+}
+
+// Parse parses a GraphQL document
+func Parse(src string) (doc *Document, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			syntax, ok := r.(*SyntaxError)
+			if !ok {
+				panic(r)
+			}
+			err = syntax
+		}
+	}()
+
+	p := &parser{src: src}
+	p.next()
+
+	doc = &Document{Fragments: make(map[string]*Fragment)}
+	for p.tok.kind != tokenEOF {
+		switch {
+		case p.is(tokenPunct, "{"):
+			doc.Operations = append(doc.Operations, &Operation{Selections: p.selectionSet()})
+		case p.is(tokenName, "query"):
+			doc.Operations = append(doc.Operations, p.operation())
+		case p.is(tokenName, "fragment"):
+			f := p.fragment()
+			if _, ok := doc.Fragments[f.Name]; ok {
+				p.fail("fragment %s is defined more than once", f.Name)
+			}
+			doc.Fragments[f.Name] = f
+		case p.is(tokenName, "mutation"), p.is(tokenName, "subscription"):
+			p.fail("%s operations are not supported", p.tok.value)
+		default:
+			p.fail("unexpected %s", p.found())
+		}
+	}
+	return doc, nil
+}
+
+func (p *parser) fail(format string, args ...interface{}) {
+	panic(&SyntaxError{Pos: p.tok.pos, Message: fmt.Sprintf(format, args...)})
+}
+
+// found describes the current token for errors
+func (p *parser) found() string {
+	if p.tok.kind == tokenEOF {
+		return "the end of the document"
+	}
+	return strconv.Quote(p.tok.value)
+}
+
+func (p *parser) is(kind int, value string) bool {
+	return p.tok.kind == kind && p.tok.value == value
+}
+
+func (p *parser) expect(kind int, value string) {
+	if !p.is(kind, value) {
+		p.fail("expected %q, found %s", value, p.found())
+	}
+	p.next()
+}
+
+func (p *parser) name() string {
+	if p.tok.kind != tokenName {
+		p.fail("expected a name, found %s", p.found())
+	}
+	name := p.tok.value
+	p.next()
+	return name
+}
+
+func (p *parser) operation() *Operation {
+	p.expect(tokenName, "query")
+	op := &Operation{}
+	if p.tok.kind == tokenName {
+		op.Name = p.name()
+	}
+	if p.is(tokenPunct, "(") {
+		p.next()
+		for !p.is(tokenPunct, ")") {
+			p.expect(tokenPunct, "$")
+			v := &VariableDefinition{Name: p.name()}
+			p.expect(tokenPunct, ":")
+			v.Type = p.typeRef()
+			if p.is(tokenPunct, "=") {
+				p.next()
+				v.Default = p.value(true)
+			}
+			op.Variables = append(op.Variables, v)
+		}
+		p.next()
+	}
+	p.directives()
+	op.Selections = p.selectionSet()
+	return op
+}
+
+func (p *parser) fragment() *Fragment {
+	p.expect(tokenName, "fragment")
+	f := &Fragment{Name: p.name()}
+	if f.Name == "on" {
+		p.fail("a fragment can't be named on")
+	}
+	p.expect(tokenName, "on")
+	f.On = p.name()
+	p.directives()
+	f.Selections = p.selectionSet()
+	return f
+}
+
+func (p *parser) typeRef() *TypeRef {
+	var t *TypeRef
+	if p.is(tokenPunct, "[") {
+		p.next()
+		t = &TypeRef{Elem: p.typeRef()}
+		p.expect(tokenPunct, "]")
+	} else {
+		t = &TypeRef{Name: p.name()}
+	}
+	if p.is(tokenPunct, "!") {
+		p.next()
+		t = &TypeRef{NonNull: true, Elem: t}
+	}
+	return t
+}
+
+func (p *parser) selectionSet() []Selection {
+	p.expect(tokenPunct, "{")
+	var selections []Selection
+	for !p.is(tokenPunct, "}") {
+		selections = append(selections, p.selection())
+	}
+	p.next()
+	if len(selections) == 0 {
+		p.fail("empty selection set")
+	}
+	return selections
+}
+
+func (p *parser) selection() Selection {
+	if p.is(tokenPunct, "...") {
+		p.next()
+		if p.tok.kind == tokenName && p.tok.value != "on" {
+			return &FragmentSpread{Name: p.name(), Directives: p.directives()}
+		}
+		f := &InlineFragment{}
+		if p.is(tokenName, "on") {
+			p.next()
+			f.On = p.name()
+		}
+		f.Directives = p.directives()
+		f.Selections = p.selectionSet()
+		return f
+	}
+
+	f := &FieldSelection{Name: p.name()}
+	if p.is(tokenPunct, ":") {
+		p.next()
+		f.Alias, f.Name = f.Name, p.name()
+	}
+	f.Arguments = p.arguments()
+	f.Directives = p.directives()
+	if p.is(tokenPunct, "{") {
+		f.Selections = p.selectionSet()
+	}
+	return f
+}
+
+func (p *parser) arguments() map[string]Value {
+	args := make(map[string]Value)
+	if !p.is(tokenPunct, "(") {
+		return args
+	}
+	p.next()
+	for !p.is(tokenPunct, ")") {
+		name := p.name()
+		p.expect(tokenPunct, ":")
+		if _, ok := args[name]; ok {
+			p.fail("argument %s is given more than once", name)
+		}
+		args[name] = p.value(false)
+	}
+	p.next()
+	return args
+}
+
+func (p *parser) directives() []*Directive {
+	var directives []*Directive
+	for p.is(tokenPunct, "@") {
+		p.next()
+		directives = append(directives, &Directive{Name: p.name(), Arguments: p.arguments()})
+	}
+	return directives
+}
+
+// value parses a literal, which may not refer to variables when constant
+func (p *parser) value(constant bool) Value {
+	tok := p.tok
+	switch tok.kind {
+	case tokenInt:
+		p.next()
+		n, err := strconv.ParseInt(tok.value, 10, 64)
+		if err != nil {
+			p.fail("invalid integer %s", tok.value)
+		}
+		return n
+	case tokenFloat:
+		p.next()
+		f, err := strconv.ParseFloat(tok.value, 64)
+		if err != nil {
+			p.fail("invalid float %s", tok.value)
+		}
+		return f
+	case tokenString:
+		p.next()
+		return tok.value
+	case tokenName:
+		p.next()
+		switch tok.value {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+		return Enum(tok.value)
+	}
+
+	switch {
+	case p.is(tokenPunct, "$"):
+		if constant {
+			p.fail("variables are not allowed here")
+		}
+		p.next()
+		return Variable(p.name())
+	case p.is(tokenPunct, "["):
+		p.next()
+		list := []interface{}{}
+		for !p.is(tokenPunct, "]") {
+			list = append(list, p.value(constant))
+		}
+		p.next()
+		return list
+	case p.is(tokenPunct, "{"):
+		p.next()
+		obj := make(map[string]interface{})
+		for !p.is(tokenPunct, "}") {
+			name := p.name()
+			p.expect(tokenPunct, ":")
+			obj[name] = p.value(constant)
+		}
+		p.next()
+		return obj
+	}
+	p.fail("expected a value, found %s", p.found())
+	return nil
+}
+
+// next advances to the next token, skipping whitespace, commas and comments
+func (p *parser) next() {
+	for p.pos < len(p.src) {
+		c := p.src[p.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			p.pos++
+			continue
+		}
+		if c == '#' {
+			for p.pos < len(p.src) && p.src[p.pos] != '\n' {
+				p.pos++
+			}
+			continue
+		}
+		if strings.HasPrefix(p.src[p.pos:], "\ufeff") {
+			p.pos += len("\ufeff")
+			continue
+		}
+		break
+	}
+
+	start := p.pos
+	if p.pos >= len(p.src) {
+		p.tok = token{kind: tokenEOF, pos: start}
+		return
+	}
+
+	c := p.src[p.pos]
+	switch {
+	case strings.HasPrefix(p.src[p.pos:], "..."):
+		p.pos += 3
+		p.tok = token{kind: tokenPunct, value: "...", pos: start}
+	case strings.IndexByte("!$()[]{}:=@|&", c) >= 0:
+		p.pos++
+		p.tok = token{kind: tokenPunct, value: string(c), pos: start}
+	case c == '_' || isLetter(c):
+		for p.pos < len(p.src) && (p.src[p.pos] == '_' || isLetter(p.src[p.pos]) || isDigit(p.src[p.pos])) {
+			p.pos++
+		}
+		p.tok = token{kind: tokenName, value: p.src[start:p.pos], pos: start}
+	case c == '-' || isDigit(c):
+		p.number()
+	case c == '"':
+		p.string()
+	default:
+		r, _ := utf8.DecodeRuneInString(p.src[p.pos:])
+		p.tok = token{kind: tokenPunct, value: string(r), pos: start}
+		p.fail("unexpected character %q", r)
+	}
+}
+
+func (p *parser) number() {
+	start := p.pos
+	kind := tokenInt
+	if p.src[p.pos] == '-' {
+		p.pos++
+	}
+	digits := func() {
+		begin := p.pos
+		for p.pos < len(p.src) && isDigit(p.src[p.pos]) {
+			p.pos++
+		}
+		if p.pos == begin {
+			p.tok = token{kind: tokenInt, value: p.src[start:p.pos], pos: start}
+			p.fail("invalid number")
+		}
+	}
+	digits()
+	if p.pos < len(p.src) && p.src[p.pos] == '.' {
+		kind = tokenFloat
+		p.pos++
+		digits()
+	}
+	if p.pos < len(p.src) && (p.src[p.pos] == 'e' || p.src[p.pos] == 'E') {
+		kind = tokenFloat
+		p.pos++
+		if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+			p.pos++
+		}
+		digits()
+	}
+	p.tok = token{kind: kind, value: p.src[start:p.pos], pos: start}
+}
+
+func (p *parser) string() {
+	start := p.pos
+	if strings.HasPrefix(p.src[p.pos:], `"""`) {
+		end := strings.Index(p.src[p.pos+3:], `"""`)
+		if end < 0 {
+			p.tok = token{kind: tokenString, pos: start}
+			p.fail("unterminated block string")
+		}
+		value := strings.Replace(p.src[p.pos+3:p.pos+3+end], `\"""`, `"""`, -1)
+		p.pos += end + 6
+		p.tok = token{kind: tokenString, value: value, pos: start}
+		return
+	}
+
+	var b strings.Builder
+	p.pos++
+	for {
+		if p.pos >= len(p.src) || p.src[p.pos] == '\n' {
+			p.tok = token{kind: tokenString, pos: start}
+			p.fail("unterminated string")
+		}
+		c := p.src[p.pos]
+		if c == '"' {
+			p.pos++
+			break
+		}
+		if c != '\\' {
+			b.WriteByte(c)
+			p.pos++
+			continue
+		}
+		if p.pos+1 >= len(p.src) {
+			p.tok = token{kind: tokenString, pos: start}
+			p.fail("unterminated string")
+		}
+		escape := p.src[p.pos+1]
+		p.pos += 2
+		switch escape {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'r':
+			b.WriteByte('\r')
+		case 'b':
+			b.WriteByte('\b')
+		case 'f':
+			b.WriteByte('\f')
+		case 'u':
+			if p.pos+4 > len(p.src) {
+				p.fail("invalid unicode escape")
+			}
+			r, err := strconv.ParseUint(p.src[p.pos:p.pos+4], 16, 32)
+			if err != nil {
+				p.fail("invalid unicode escape")
+			}
+			b.WriteRune(rune(r))
+			p.pos += 4
+		default:
+			b.WriteByte(escape)
+		}
+	}
+	p.tok = token{kind: tokenString, value: b.String(), pos: start}
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
@@ -0,0 +1,319 @@
+// Package graphql executes GraphQL queries against a schema of objects.
+//
+// It supports the query language a read only API needs: operations with
+// variables, aliases, named and inline fragments, @skip and @include, and
+// __typename. Mutations, subscriptions, interfaces, unions, enums, input
+// objects and introspection are not supported.
+//
+// Fields are resolved breadth first. Each resolver receives every object at
+// its place in the response at once and returns a value for each, which lets
+// resolvers load related data in one query per level instead of one per
+// object.
+package graphql
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"time"
+)
+
+// TypeRef is the type of a field, argument or variable. It is a named type,
+// a list of Elem or, when NonNull, Elem without null.
+type TypeRef struct {
+	Name    string
+	NonNull bool
+	Elem    *TypeRef
+}
+
+// List reports whether the type is a list, possibly non-null
+func (t *TypeRef) List() bool {
+	if t.NonNull {
+		return t.Elem.List()
+	}
+	return t.Elem != nil
+}
+
+// Named returns the name of the type with lists and non-null unwrapped
+func (t *TypeRef) Named() string {
+	if t.Elem != nil {
+		return t.Elem.Named()
+	}
+	return t.Name
+}
+
+func (t *TypeRef) String() string {
+	switch {
+	case t.NonNull:
+		return t.Elem.String() + "!"
+	case t.Elem != nil:
+		return "[" + t.Elem.String() + "]"
+	}
+	return t.Name
+}
+
+// Type parses a type written as in a schema, such as "[Article!]!"
+func Type(s string) *TypeRef {
+	p := &parser{src: s}
+	p.next()
+	t := p.typeRef()
+	if p.tok.kind != tokenEOF {
+		panic("graphql: invalid type " + s)
+	}
+	return t
+}
+
+// Scalars are the leaf types fields may have. DateTime is serialized as an
+// RFC 3339 string.
+var Scalars = []string{"String", "Int", "Float", "Boolean", "ID", "DateTime"}
+
+// Resolver resolves a field for a batch of parent objects at once, returning
+// one value per parent in the same order. Every object at the same place in
+// a response is resolved in one call, so a resolver can load what all of
+// them need with a single query. ctx is the context of the request being
+// executed.
+type Resolver func(ctx context.Context, parents []interface{}, args Args) ([]interface{}, error)
+
+// Each returns a resolver applying fn to every parent, for fields that need
+// nothing loaded
+func Each(fn func(parent interface{}) interface{}) Resolver {
+	return func(ctx context.Context, parents []interface{}, args Args) ([]interface{}, error) {
+		values := make([]interface{}, len(parents))
+		for i, parent := range parents {
+			values[i] = fn(parent)
+		}
+		return values, nil
+	}
+}
+
+// Args are the coerced arguments of a field, including defaults
+type Args map[string]interface{}
+
+// Int returns an Int argument, or 0 when it is null
+func (a Args) Int(name string) int {
+	n, _ := a[name].(int)
+	return n
+}
+
+// String returns a String or ID argument, or "" when it is null
+func (a Args) String(name string) string {
+	s, _ := a[name].(string)
+	return s
+}
+
+// Bool returns a Boolean argument, or false when it is null
+func (a Args) Bool(name string) bool {
+	b, _ := a[name].(bool)
+	return b
+}
+
+// Argument declares an argument of a field
+type Argument struct {
+	Type    *TypeRef
+	Default interface{}
+}
+
+// Field declares a field of an object
+type Field struct {
+	Type    *TypeRef
+	Args    map[string]*Argument
+	Resolve Resolver
+	// Cost is added to a query's complexity for each time the field may be
+	// resolved, 1 when unset. Lists multiply the cost of their selections by
+	// their "first" argument when they have one.
+	Cost int
+}
+
+// Object is an object type
+type Object struct {
+	Name   string
+	Fields map[string]*Field
+}
+
+// Schema is the types a query is executed against. Only queries are
+// supported.
+type Schema struct {
+	Query   *Object
+	objects map[string]*Object
+}
+
+// NewSchema returns a schema with the given query type, checking that every
+// type referred to is one of the objects or a scalar
+func NewSchema(query *Object, objects ...*Object) (*Schema, error) {
+	s := &Schema{Query: query, objects: make(map[string]*Object)}
+	for _, o := range append([]*Object{query}, objects...) {
+		s.objects[o.Name] = o
+	}
+	for _, o := range s.objects {
+		for name, f := range o.Fields {
+			if f.Resolve == nil {
+				return nil, fmt.Errorf("graphql: %s.%s has no resolver", o.Name, name)
+			}
+			if !s.known(f.Type.Named()) {
+				return nil, fmt.Errorf("graphql: %s.%s has unknown type %s", o.Name, name, f.Type)
+			}
+			for arg, a := range f.Args {
+				if !isScalar(a.Type.Named()) {
+					return nil, fmt.Errorf("graphql: argument %s of %s.%s must be a scalar", arg, o.Name, name)
+				}
+			}
+		}
+	}
+	return s, nil
+}
+
+func (s *Schema) known(name string) bool {
+	_, ok := s.objects[name]
+	return ok || isScalar(name)
+}
+
+func isScalar(name string) bool {
+	for _, scalar := range Scalars {
+		if scalar == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errCoerce is returned for input values that don't fit their type
+var errCoerce = errors.New("invalid value")
+
+// coerceInput converts an argument or variable value to its type
+func coerceInput(t *TypeRef, v interface{}) (interface{}, error) {
+	if t.NonNull {
+		if v == nil {
+			return nil, fmt.Errorf("expected %s, found null", t)
+		}
+		return coerceInput(t.Elem, v)
+	}
+	if v == nil {
+		return nil, nil
+	}
+	if t.Elem != nil {
+		list, ok := v.([]interface{})
+		if !ok {
+			list = []interface{}{v}
+		}
+		out := make([]interface{}, len(list))
+		for i, item := range list {
+			c, err := coerceInput(t.Elem, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+
+	switch t.Name {
+	case "Int":
+		switch n := v.(type) {
+		case int64:
+			if n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int(n), nil
+			}
+		case float64:
+			if n == math.Trunc(n) && n >= math.MinInt32 && n <= math.MaxInt32 {
+				return int(n), nil
+			}
+		case int:
+			return n, nil
+		}
+	case "Float":
+		switch n := v.(type) {
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		case int:
+			return float64(n), nil
+		}
+	case "String":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case "ID":
+		switch id := v.(type) {
+		case string:
+			return id, nil
+		case int64:
+			return strconv.FormatInt(id, 10), nil
+		case float64:
+			if id == math.Trunc(id) {
+				return strconv.FormatFloat(id, 'f', 0, 64), nil
+			}
+		}
+	case "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case "DateTime":
+		if s, ok := v.(string); ok {
+			if d, err := time.Parse(time.RFC3339, s); err == nil {
+				return d, nil
+			}
+		}
+	}
+	return nil, fmt.Errorf("%v is not a valid %s", v, t.Name)
+}
+
+// serialize converts a resolved leaf value to its scalar type
+func serialize(name string, v interface{}) (interface{}, error) {
+	if d, ok := v.(*time.Time); ok {
+		v = *d
+	}
+	switch name {
+	case "Int":
+		switch n := v.(type) {
+		case int, int32, int64:
+			return n, nil
+		}
+	case "Float":
+		switch n := v.(type) {
+		case float32, float64, int, int64:
+			return n, nil
+		}
+	case "String":
+		switch s := v.(type) {
+		case string:
+			return s, nil
+		case fmt.Stringer:
+			return s.String(), nil
+		}
+	case "ID":
+		switch id := v.(type) {
+		case string:
+			return id, nil
+		case int:
+			return strconv.Itoa(id), nil
+		case int64:
+			return strconv.FormatInt(id, 10), nil
+		}
+	case "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	case "DateTime":
+		if d, ok := v.(time.Time); ok {
+			return d.Format(time.RFC3339), nil
+		}
+	}
+	return nil, errCoerce
+}
+
+// isNil reports whether v is nil, including nil pointers and maps stored in
+// an interface. Nil slices are empty lists.
+func isNil(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	switch rv := reflect.ValueOf(v); rv.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
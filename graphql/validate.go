@@ -0,0 +1,244 @@
+package graphql
+
+import (
+	"fmt"
+)
+
+// Limits bound the queries a schema executes. Depth counts the levels of
+// nested fields. Complexity sums the cost of every field a query may resolve,
+// multiplying the cost under list fields by how many items they may return.
+type Limits struct {
+	MaxDepth      int
+	MaxComplexity int
+}
+
+// defaultListSize is how many items are assumed for lists without a "first"
+// argument when measuring complexity
+const defaultListSize = 10
+
+// validator checks an operation against the schema, coercing the arguments
+// of every field and measuring the depth and complexity of the operation
+type validator struct {
+	schema    *Schema
+	doc       *Document
+	variables map[string]interface{}
+	declared  map[string]bool
+	args      map[*FieldSelection]Args
+	conds     map[*Directive]bool
+	errors    []*Error
+	spreading map[string]bool
+}
+
+func (v *validator) fail(format string, args ...interface{}) {
+	v.errors = append(v.errors, &Error{Message: fmt.Sprintf(format, args...)})
+}
+
+// selections validates a selection set of an object type, returning its depth
+// and complexity
+func (v *validator) selections(o *Object, selections []Selection) (int, int) {
+	depth, complexity := 0, 0
+	measure := func(d, c int) {
+		if d > depth {
+			depth = d
+		}
+		complexity += c
+	}
+
+	for _, sel := range selections {
+		switch sel := sel.(type) {
+		case *FieldSelection:
+			measure(v.field(o, sel))
+		case *InlineFragment:
+			if sel.On != "" && sel.On != o.Name {
+				v.fail("Fragment on %s can't be spread within %s", sel.On, o.Name)
+				continue
+			}
+			v.directives(sel.Directives)
+			measure(v.selections(o, sel.Selections))
+		case *FragmentSpread:
+			f, ok := v.doc.Fragments[sel.Name]
+			if !ok {
+				v.fail("Unknown fragment %s", sel.Name)
+				continue
+			}
+			if f.On != o.Name {
+				v.fail("Fragment %s on %s can't be spread within %s", f.Name, f.On, o.Name)
+				continue
+			}
+			if v.spreading[f.Name] {
+				v.fail("Fragment %s spreads itself", f.Name)
+				continue
+			}
+			v.directives(sel.Directives)
+			v.spreading[f.Name] = true
+			measure(v.selections(o, f.Selections))
+			delete(v.spreading, f.Name)
+		}
+	}
+	return depth, complexity
+}
+
+// field validates a field selection, returning its depth and complexity
+func (v *validator) field(o *Object, sel *FieldSelection) (int, int) {
+	v.directives(sel.Directives)
+	if sel.Name == "__typename" {
+		if sel.Selections != nil {
+			v.fail("Field __typename can't have selections")
+		}
+		return 1, 0
+	}
+
+	f, ok := o.Fields[sel.Name]
+	if !ok {
+		v.fail("Cannot query field %s on type %s", sel.Name, o.Name)
+		return 0, 0
+	}
+	args, ok := v.arguments(fmt.Sprintf("%s.%s", o.Name, sel.Name), f.Args, sel.Arguments)
+	if !ok {
+		return 0, 0
+	}
+	v.args[sel] = args
+
+	cost := f.Cost
+	if cost == 0 {
+		cost = 1
+	}
+
+	child, ok := v.schema.objects[f.Type.Named()]
+	if !ok {
+		if sel.Selections != nil {
+			v.fail("Field %s.%s of type %s can't have selections", o.Name, sel.Name, f.Type)
+		}
+		return 1, cost
+	}
+	if sel.Selections == nil {
+		v.fail("Field %s.%s of type %s must have selections", o.Name, sel.Name, f.Type)
+		return 1, cost
+	}
+
+	depth, complexity := v.selections(child, sel.Selections)
+	if f.Type.List() {
+		size := defaultListSize
+		if first, ok := args["first"].(int); ok && first >= 0 {
+			size = first
+		}
+		complexity *= size
+	}
+	return depth + 1, cost + complexity
+}
+
+// arguments coerces the arguments given to a field or directive, adding
+// defaults and checking required ones are given
+func (v *validator) arguments(owner string, declared map[string]*Argument, given map[string]Value) (Args, bool) {
+	ok := true
+	for name := range given {
+		if _, known := declared[name]; !known {
+			v.fail("Unknown argument %s on %s", name, owner)
+			ok = false
+		}
+	}
+
+	args := make(Args)
+	for name, arg := range declared {
+		literal, present := given[name]
+		if variable, ok := literal.(Variable); ok && v.declared[string(variable)] {
+			_, present = v.variables[string(variable)]
+		}
+		if !present {
+			if arg.Default != nil {
+				args[name] = arg.Default
+			} else if arg.Type.NonNull {
+				v.fail("Argument %s of %s is required", name, owner)
+				ok = false
+			}
+			continue
+		}
+		value, err := v.value(literal)
+		if err == nil {
+			value, err = coerceInput(arg.Type, value)
+		}
+		if err != nil {
+			v.fail("Argument %s of %s: %s", name, owner, err)
+			ok = false
+			continue
+		}
+		args[name] = value
+	}
+	return args, ok
+}
+
+// value replaces the variables in a literal with their values
+func (v *validator) value(literal Value) (interface{}, error) {
+	switch literal := literal.(type) {
+	case Variable:
+		if !v.declared[string(literal)] {
+			return nil, fmt.Errorf("variable $%s is not defined", literal)
+		}
+		return v.variables[string(literal)], nil
+	case Enum:
+		return nil, fmt.Errorf("unexpected enum %s", literal)
+	case []interface{}:
+		list := make([]interface{}, len(literal))
+		for i, item := range literal {
+			value, err := v.value(item)
+			if err != nil {
+				return nil, err
+			}
+			list[i] = value
+		}
+		return list, nil
+	case map[string]interface{}:
+		return nil, fmt.Errorf("input objects are not supported")
+	}
+	return literal, nil
+}
+
+// directiveArgs are the arguments of @skip and @include
+var directiveArgs = map[string]*Argument{
+	"if": {Type: Type("Boolean!")},
+}
+
+// directives checks the directives of a selection are @skip or @include
+// with a condition, recording the condition
+func (v *validator) directives(directives []*Directive) {
+	for _, d := range directives {
+		if d.Name != "skip" && d.Name != "include" {
+			v.fail("Unknown directive @%s", d.Name)
+			continue
+		}
+		if args, ok := v.arguments("@"+d.Name, directiveArgs, d.Arguments); ok {
+			v.conds[d] = args.Bool("if")
+		}
+	}
+}
+
+// coerceVariables coerces the values given for the variables of an operation
+func (v *validator) coerceVariables(op *Operation, given map[string]interface{}) {
+	for _, def := range op.Variables {
+		if v.declared[def.Name] {
+			v.fail("Variable $%s is declared more than once", def.Name)
+			continue
+		}
+		v.declared[def.Name] = true
+		if !isScalar(def.Type.Named()) {
+			v.fail("Variable $%s must be a scalar or list of scalars", def.Name)
+			continue
+		}
+		value, present := given[def.Name]
+		if !present {
+			if def.Default == nil {
+				if def.Type.NonNull {
+					v.fail("Variable $%s of type %s is required", def.Name, def.Type)
+				}
+				continue
+			}
+			value = def.Default
+		}
+		coerced, err := coerceInput(def.Type, value)
+		if err != nil {
+			v.fail("Variable $%s: %s", def.Name, err)
+			continue
+		}
+		v.variables[def.Name] = coerced
+	}
+}
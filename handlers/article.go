@@ -1,13 +1,13 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
+	"strconv"
+	"time"
 
 	"github.com/gorilla/mux"
 
+	"github.com/mattgen88/blog/markdown"
 	"github.com/mattgen88/blog/models"
 	"github.com/mattgen88/haljson"
 )
@@ -16,15 +16,14 @@ const max_len = 500
 
 // ArticleListHandler handles requests for articles
 func (h *Handler) ArticleListHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
-	root.Self(r.URL.Path)
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
+	dependsOn(r, "article")
 
-	for _, article := range models.ArticleList(h.db) {
+	for _, article := range models.ArticleList(h.dbFor(r)) {
+		dependsOn(r, articleTags(article)...)
 
-		href := fmt.Sprintf("/articles/%s", article.Slug)
-
-		embeddedArticle := haljson.NewResource()
-		embeddedArticle.Self(href)
+		embeddedArticle := u.resource(u.href("article", "id", article.Slug))
 		embeddedArticle.Data["title"] = article.Title
 		embeddedArticle.Data["author"] = article.Author.Username
 		embeddedArticle.Data["date"] = article.Date
@@ -40,20 +39,20 @@ func (h *Handler) ArticleListHandler(w http.ResponseWriter, r *http.Request) {
 		embeddedArticle.Data["description"] = article.Body[0:trunc]
 		root.AddEmbed("articles", embeddedArticle)
 	}
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	w.Write(json)
+	write(w, r, http.StatusOK, representation{
+		resource: root,
+		items:    "articles",
+		modified: lastModified(models.LastUpdated(h.dbFor(r))),
+	})
 }
 
 // ArticleHandler handles requests for articles
 func (h *Handler) ArticleHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
-	root.Self(r.URL.Path)
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
 
-	article := models.NewSQLArticle(mux.Vars(r)["id"], h.db)
+	article := models.NewSQLArticle(mux.Vars(r)["id"], h.dbFor(r))
+	dependsOn(r, keyTag("article", article.Slug))
 
 	root.Data["article"] = article
 	root.Data["body"] = article.Body
@@ -66,11 +65,80 @@ func (h *Handler) ArticleHandler(w http.ResponseWriter, r *http.Request) {
 		root.Data["category"] = article.Category.Name
 	}
 	root.Data["slug"] = article.Slug
+	root.Data["tags"] = article.Tags
+
+	rep := representation{resource: root}
+	if article.Exists() {
+		dependsOn(r, articleTags(article)...)
+		link(root, "comments", &haljson.Link{Href: u.href("comments", "id", article.Slug)})
+		if article.Author != nil {
+			root.AddLink("author", &haljson.Link{Href: u.href("user", "id", article.Author.Username)})
+		}
+		if article.Category != nil {
+			link(root, "category", &haljson.Link{Href: u.href("category", "category", article.Category.Name)})
+		}
+		for _, tag := range article.Tags {
+			name := tag
+			link(root, "tag", &haljson.Link{Href: u.href("tag", "tag", tag), Title: &name})
+		}
+		// Media the body shows are linked while they exist, and embedded
+		// so the variants of images can be picked from their srcset
+		ids := referencedMedia(article.Body)
+		for _, id := range ids {
+			dependsOn(r, modelTag("media", id))
+		}
+		for _, m := range models.MediaByID(ids, h.dbFor(r)) {
+			alt := m.Alt
+			link(root, "media", &haljson.Link{Href: u.href("media", "media", strconv.Itoa(m.ID)), Title: &alt})
+			root.AddEmbed("media", h.mediaResource(u, m))
+		}
+		addTemplate(root, "default", h.commentTemplate(u, article.Slug, 0))
+		rep.modified = lastModified(article.Date, article.Updated)
+		rep.markdown = func() ([]byte, error) {
+			return articleMarkdown(article)
+		}
+	}
+	write(w, r, http.StatusOK, rep)
+}
 
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
+// articleTags tag a response showing an article with the article, its
+// author and its category
+func articleTags(article *models.SQLArticle) []string {
+	tags := []string{modelTag("article", article.ID)}
+	if article.Author != nil {
+		tags = append(tags, modelTag("user", article.Author.ID))
+	}
+	if article.Category != nil {
+		tags = append(tags, modelTag("category", article.Category.ID))
+	}
+	return tags
+}
+
+// articleFrontMatter is the metadata heading an article's Markdown form
+type articleFrontMatter struct {
+	Title    string     `yaml:"title"`
+	Slug     string     `yaml:"slug"`
+	Author   string     `yaml:"author,omitempty"`
+	Category string     `yaml:"category,omitempty"`
+	Date     *time.Time `yaml:"date,omitempty"`
+	Updated  *time.Time `yaml:"updated,omitempty"`
+	Tags     []string   `yaml:"tags,omitempty"`
+}
+
+// articleMarkdown renders an article as Markdown with YAML front matter
+func articleMarkdown(article *models.SQLArticle) ([]byte, error) {
+	meta := articleFrontMatter{
+		Title:   article.Title,
+		Slug:    article.Slug,
+		Date:    article.Date,
+		Updated: article.Updated,
+		Tags:    article.Tags,
+	}
+	if article.Author != nil {
+		meta.Author = article.Author.Username
+	}
+	if article.Category != nil {
+		meta.Category = article.Category.Name
 	}
-	w.Write(json)
+	return markdown.WithFrontMatter(meta, article.Body)
 }
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/mattgen88/blog/models"
+)
+
+// authenticate returns the user identified by the request's basic auth
+// credentials, or nil when none were sent. Wrong credentials are answered
+// with 401 and ok is false.
+func (h *Handler) authenticate(w http.ResponseWriter, r *http.Request) (user *models.SQLUser, ok bool) {
+	username, password, sent := r.BasicAuth()
+	if !sent {
+		return nil, true
+	}
+
+	user = models.NewSQLUser(username, h.dbFor(r))
+	if !user.Authenticate(password) {
+		unauthorized(w, r)
+		return nil, false
+	}
+	return user, true
+}
+
+// unauthorized challenges the client for credentials
+func unauthorized(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="blog"`)
+	writeError(w, r, http.StatusUnauthorized, "Authentication required")
+}
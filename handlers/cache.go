@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/cache"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/util"
+)
+
+// cachedRoutes are the routes whose API responses are cached, by name, with
+// whether each also offers Markdown. HTML pages aren't cached.
+var cachedRoutes = map[string]bool{
+	"articles":   false,
+	"article":    true,
+	"categories": false,
+	"category":   false,
+}
+
+// SetResponseCache caches the API responses of the article and category
+// routes in c. Cached responses are invalidated when the articles,
+// categories and users they were rendered from are written.
+func (h *Handler) SetResponseCache(c *cache.Cache) {
+	h.cache = c
+	if c != nil {
+		models.Listen(h.InvalidateCache)
+	}
+}
+
+// PurgeCache empties the response cache
+func (h *Handler) PurgeCache() {
+	if h.cache != nil {
+		h.cache.Purge()
+	}
+}
+
+// cacheTagsKey holds the tags of the response to a request in its context
+type cacheTagsKey struct{}
+
+// dependsOn records what the response to r is rendered from, so that a
+// cached copy is invalidated when any of it is written. Tags are made with
+// modelTag and keyTag, or are the name of a model for responses listing
+// every one of them.
+func dependsOn(r *http.Request, tags ...string) {
+	if deps, ok := r.Context().Value(cacheTagsKey{}).(*[]string); ok {
+		*deps = append(*deps, tags...)
+	}
+}
+
+// modelTag tags a response rendered from the model with the given id
+func modelTag(model string, id int) string {
+	return model + "#" + strconv.Itoa(id)
+}
+
+// keyTag tags a response looking up a model by its key, such as the slug of
+// an article, so a response for one which didn't exist is invalidated when
+// it is created
+func keyTag(model, key string) string {
+	return model + ":" + key
+}
+
+// InvalidateCache removes the cached responses rendered from a model which
+// has been written. Creating or deleting a model also invalidates the lists of
+// every one of them, and articles invalidate the category they are filed
+// under, which lists them.
+func (h *Handler) InvalidateCache(e models.Event) {
+	if h.cache == nil {
+		return
+	}
+	switch e.Model {
+	case "article", "category", "user", "media":
+	default:
+		return
+	}
+
+	tags := []string{modelTag(e.Model, e.ID), keyTag(e.Model, e.Key)}
+	if e.Action != models.Updated {
+		tags = append(tags, e.Model)
+	}
+	if article, ok := e.Object.(*models.SQLArticle); ok && article.Category != nil {
+		tags = append(tags, modelTag("category", article.Category.ID))
+	}
+	h.cache.Invalidate(tags...)
+}
+
+// ResponseCache is middleware serving the API responses of the cached routes
+// from the response cache. Responses are keyed by route, path, query and
+// the media type negotiated, and are rendered without the conditional
+// headers of the request so the whole response can be stored and the
+// conditions checked against it. Authenticated requests aren't cached.
+func (h *Handler) ResponseCache(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key, media, ok := h.cacheKey(r)
+		if !ok {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		res, hit := h.cache.Get(key)
+		if !hit {
+			generation := h.cache.Generation()
+			var tags []string
+			req := r.WithContext(context.WithValue(r.Context(), cacheTagsKey{}, &tags))
+			req.Header = r.Header.Clone()
+			for _, header := range []string{"If-None-Match", "If-Modified-Since"} {
+				req.Header.Del(header)
+			}
+
+			rec := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+			next.ServeHTTP(rec, req)
+			res = &cache.Response{Status: rec.status, Header: rec.header, Body: rec.body.Bytes()}
+
+			if res.Status == http.StatusOK && strings.HasPrefix(res.Header.Get("Content-Type"), media) {
+				h.cache.Set(key, res, tags, generation)
+			}
+		}
+
+		for name, values := range res.Header {
+			w.Header()[name] = append([]string(nil), values...)
+		}
+		if res.Status == http.StatusOK {
+			modified, _ := http.ParseTime(res.Header.Get("Last-Modified"))
+			if notModified(w, r, res.Header.Get("ETag"), modified) {
+				return
+			}
+		}
+		w.WriteHeader(res.Status)
+		w.Write(res.Body)
+	})
+}
+
+// cacheKey returns the key of the cached response to r and the media type
+// negotiated, and whether it may be cached
+func (h *Handler) cacheKey(r *http.Request) (string, string, bool) {
+	if h.cache == nil || (r.Method != http.MethodGet && r.Method != http.MethodHead) {
+		return "", "", false
+	}
+	if r.Header.Get("Authorization") != "" {
+		return "", "", false
+	}
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return "", "", false
+	}
+	markdown, ok := cachedRoutes[route.GetName()]
+	if !ok {
+		return "", "", false
+	}
+
+	// Negotiate as the route does, leaving pages to render themselves
+	accept := r.Header.Get("Accept")
+	if h.theme != nil && util.Negotiate(accept, append(append([]string{}, apiMediaTypes...), mediaHTML)) == mediaHTML {
+		return "", "", false
+	}
+	offers := apiMediaTypes
+	if markdown {
+		offers = append(offers[:len(offers):len(offers)], mediaMarkdown)
+	}
+	media := util.Negotiate(accept, offers)
+	if media == "" {
+		return "", "", false
+	}
+
+	key := []string{route.GetName(), media, r.URL.Path + "?" + r.URL.Query().Encode()}
+	if h.links.Absolute {
+		// Links are written with the public URL, which may come from the
+		// request
+		key = append(key, h.baseURL(r))
+	}
+	return strings.Join(key, "\x00"), media, true
+}
+
+// responseRecorder keeps a response to be cached
+type responseRecorder struct {
+	header      http.Header
+	status      int
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (rec *responseRecorder) Header() http.Header {
+	return rec.header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if !rec.wroteHeader {
+		rec.wroteHeader = true
+		rec.status = status
+	}
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	rec.WriteHeader(http.StatusOK)
+	return rec.body.Write(b)
+}
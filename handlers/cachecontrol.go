@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// CachePolicies are the Cache-Control headers sent with responses by the name
+// of their route. The policy named "*" applies to every other route.
+type CachePolicies map[string]string
+
+// ParseCachePolicies parses policies written as route=policy pairs separated
+// by semicolons, such as "feed=public, max-age=300; *=no-cache"
+func ParseCachePolicies(s string) (CachePolicies, error) {
+	policies := make(CachePolicies)
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" || strings.TrimSpace(kv[1]) == "" {
+			return nil, errors.New("cache policy must be written as route=policy: " + strings.TrimSpace(pair))
+		}
+		policies[strings.TrimSpace(kv[0])] = strings.TrimSpace(kv[1])
+	}
+	return policies, nil
+}
+
+// SetCachePolicies configures the Cache-Control headers of routes
+func (h *Handler) SetCachePolicies(policies CachePolicies) {
+	h.cachePolicies = policies
+}
+
+// CacheControl is middleware setting the Cache-Control header of successful
+// and not modified responses to GET and HEAD requests from the policy of
+// their route. Handlers setting the header themselves keep theirs.
+func (h *Handler) CacheControl(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		name := ""
+		if route := mux.CurrentRoute(r); route != nil {
+			name = route.GetName()
+		}
+		policy, ok := h.cachePolicies[name]
+		if !ok {
+			policy = h.cachePolicies["*"]
+		}
+		if policy == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(&cacheControlWriter{ResponseWriter: w, policy: policy}, r)
+	})
+}
+
+// cacheControlWriter sets the Cache-Control header when the status of the
+// response is written
+type cacheControlWriter struct {
+	http.ResponseWriter
+	policy      string
+	wroteHeader bool
+}
+
+func (w *cacheControlWriter) WriteHeader(status int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		ok := status >= 200 && status < 300 || status == http.StatusNotModified
+		if ok && w.Header().Get("Cache-Control") == "" {
+			w.Header().Set("Cache-Control", w.policy)
+		}
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *cacheControlWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b)
+}
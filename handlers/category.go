@@ -1,63 +1,59 @@
 package handlers
 
 import (
-	"encoding/json"
-	"fmt"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
 
 	"github.com/mattgen88/blog/models"
-	"github.com/mattgen88/haljson"
 )
 
 // CategoryHandler handles requests for categories
 func (h *Handler) CategoryHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
-	root.Self(r.URL.Path)
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
 
 	c := mux.Vars(r)["category"]
 
-	category := models.NewSQLCategory(c, h.db)
+	category := models.NewSQLCategory(c, h.dbFor(r))
+	dependsOn(r, keyTag("category", c))
+	if category.Exists() {
+		dependsOn(r, modelTag("category", category.ID))
+	}
 
 	root.Data["id"] = category.ID
 
-	categories := models.ArticleListByCategory(category.ID, h.db)
+	categories := models.ArticleListByCategory(category.ID, h.dbFor(r))
 
 	for _, article := range categories {
+		dependsOn(r, articleTags(article)...)
 
-		href := fmt.Sprintf("/articles/%s", article.Slug)
-		embeddedArticle := haljson.NewResource()
-		embeddedArticle.Self(href)
+		embeddedArticle := u.resource(u.href("article", "id", article.Slug))
 		embeddedArticle.Data["title"] = article.Title
 		embeddedArticle.Data["author"] = article.Author.Username
 		embeddedArticle.Data["date"] = article.Date
 		root.AddEmbed("articles", embeddedArticle)
 	}
 
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
+	rep := representation{resource: root}
+	if category.Exists() {
+		rep.modified = lastModified(category.Updated)
 	}
-	w.Write(json)
+	write(w, r, http.StatusOK, rep)
 }
 
 // CategoryListHandler requests a list of categories
 func (h *Handler) CategoryListHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
-	root.Self(r.URL.Path)
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
 
 	var categories []string
+	dependsOn(r, "category")
 
-	for _, category := range models.CategoryList(h.db) {
-
-		href := fmt.Sprintf("/categories/%s", category.Name)
+	for _, category := range models.CategoryList(h.dbFor(r)) {
+		dependsOn(r, modelTag("category", category.ID))
 
-		embeddedCategory := haljson.NewResource()
-
-		embeddedCategory.Self(href)
+		embeddedCategory := u.resource(u.href("category", "category", category.Name))
 
 		embeddedCategory.Data["name"] = category.Name
 		root.AddEmbed("categories", embeddedCategory)
@@ -65,10 +61,9 @@ func (h *Handler) CategoryListHandler(w http.ResponseWriter, r *http.Request) {
 	}
 	root.Data["categories"] = categories
 
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	w.Write(json)
+	write(w, r, http.StatusOK, representation{
+		resource: root,
+		items:    "categories",
+		modified: lastModified(models.LastUpdated(h.dbFor(r))),
+	})
 }
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/markdown"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/haljson"
+)
+
+// CommentOptions configures how readers may comment
+type CommentOptions struct {
+	// Anonymous allows commenting with a name and email instead of an account
+	Anonymous bool
+	// PerPage is the default number of threads on a page of comments
+	PerPage int
+}
+
+const maxPerPage = 100
+
+// SetCommentOptions configures commenting
+func (h *Handler) SetCommentOptions(opts CommentOptions) {
+	if opts.PerPage <= 0 {
+		opts.PerPage = 20
+	}
+	h.comments = opts
+}
+
+// commentRequest is the body accepted when creating or editing a comment
+type commentRequest struct {
+	Body   string `json:"body"`
+	Parent int    `json:"parent"`
+	Name   string `json:"name"`
+	Email  string `json:"email"`
+	// Website is a honeypot, hidden from people by clients, which only
+	// bots fill in
+	Website string `json:"website"`
+}
+
+// commentResource builds the representation of a comment and its replies
+func commentResource(u urls, slug string, c *models.SQLComment) *haljson.Resource {
+	res := u.resource(u.href("comment", "id", slug, "comment", strconv.Itoa(c.ID)))
+	link(res, "article", &haljson.Link{Href: u.href("article", "id", slug)})
+	if c.ParentID != 0 {
+		res.AddLink("up", &haljson.Link{Href: u.href("comment", "id", slug, "comment", strconv.Itoa(c.ParentID))})
+	}
+
+	res.Data["id"] = c.ID
+	res.Data["state"] = c.State
+	res.Data["created"] = c.Created
+	res.Data["replies"] = len(c.Replies)
+	res.Data["version"] = c.Version
+	if c.Updated != nil {
+		res.Data["updated"] = c.Updated
+	}
+
+	if c.State != models.StateDeleted {
+		res.Data["author"] = c.DisplayName()
+		res.Data["body"] = c.Body
+		res.Data["html"] = markdown.Render(c.Body)
+		if !c.Anonymous() {
+			res.AddLink("author", &haljson.Link{Href: u.href("user", "id", c.Author.Username)})
+		}
+	}
+
+	for _, reply := range c.Replies {
+		res.AddEmbed("replies", commentResource(u, slug, reply))
+	}
+	return res
+}
+
+// commentRepresentation is a comment with the requests that can be made on
+// it
+func (h *Handler) commentRepresentation(u urls, slug string, c *models.SQLComment) representation {
+	res := commentResource(u, slug, c)
+	h.addCommentTemplates(u, res, slug, c)
+	return representation{resource: res, version: c.Version}
+}
+
+// commentConflict responds to a change which lost the race with another,
+// with the comment as it is now
+func (h *Handler) commentConflict(w http.ResponseWriter, r *http.Request, article *models.SQLArticle, id int) {
+	c := models.NewSQLComment(id, h.dbFor(r))
+	if !c.Exists() {
+		ErrorHandler(w, r)
+		return
+	}
+	write(w, r, http.StatusPreconditionFailed, h.commentRepresentation(h.urls(r), article.Slug, c))
+}
+
+// canModify reports whether user may edit or delete the comment
+func canModify(user *models.SQLUser, c *models.SQLComment) bool {
+	if user == nil {
+		return false
+	}
+	if canModerate(user) {
+		return true
+	}
+	return !c.Anonymous() && c.Author.ID == user.ID
+}
+
+// article loads the article a comment route refers to, responding with 404
+// when it doesn't exist
+func (h *Handler) article(w http.ResponseWriter, r *http.Request) (*models.SQLArticle, bool) {
+	article := models.NewSQLArticle(mux.Vars(r)["id"], h.dbFor(r))
+	if !article.Exists() {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	return article, true
+}
+
+// comment loads the comment a route refers to, responding with 404 when it
+// doesn't exist on the article
+func (h *Handler) comment(w http.ResponseWriter, r *http.Request, article *models.SQLArticle) (*models.SQLComment, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["comment"])
+	if err != nil {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	c := models.NewSQLComment(id, h.dbFor(r))
+	if !c.Exists() || c.ArticleID != article.ID || !c.Visible() {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	return c, true
+}
+
+// CommentListHandler handles requests for a page of comment threads on an article
+func (h *Handler) CommentListHandler(w http.ResponseWriter, r *http.Request) {
+	article, ok := h.article(w, r)
+	if !ok {
+		return
+	}
+
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 {
+		perPage = h.comments.PerPage
+	}
+	if perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	threads := models.CommentList(article.ID, h.dbFor(r))
+	pages := (len(threads) + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	u := h.urls(r)
+	base := u.href("comments", "id", article.Slug)
+	pageHref := func(n int) string {
+		return fmt.Sprintf("%s?page=%d&per_page=%d", base, n, perPage)
+	}
+
+	root := u.document(pageHref(page))
+	link(root, "article", &haljson.Link{Href: u.href("article", "id", article.Slug)})
+	root.AddLink("first", &haljson.Link{Href: pageHref(1)})
+	root.AddLink("last", &haljson.Link{Href: pageHref(pages)})
+	if page > 1 {
+		root.AddLink("prev", &haljson.Link{Href: pageHref(page - 1)})
+	}
+	if page < pages {
+		root.AddLink("next", &haljson.Link{Href: pageHref(page + 1)})
+	}
+
+	root.Data["page"] = page
+	root.Data["pages"] = pages
+	root.Data["total"] = len(threads)
+
+	start := (page - 1) * perPage
+	for i := start; i < start+perPage && i < len(threads); i++ {
+		root.AddEmbed("comments", commentResource(u, article.Slug, threads[i]))
+	}
+	addTemplate(root, "default", h.commentTemplate(u, article.Slug, 0))
+
+	respond(w, r, http.StatusOK, root)
+}
+
+// CommentHandler handles requests for a single comment and its replies
+func (h *Handler) CommentHandler(w http.ResponseWriter, r *http.Request) {
+	article, ok := h.article(w, r)
+	if !ok {
+		return
+	}
+	c, ok := h.comment(w, r, article)
+	if !ok {
+		return
+	}
+
+	write(w, r, http.StatusOK, h.commentRepresentation(h.urls(r), article.Slug, c))
+}
+
+// CreateCommentHandler handles new comments and replies on an article
+func (h *Handler) CreateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	article, ok := h.article(w, r)
+	if !ok {
+		return
+	}
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if user == nil && !h.comments.Anonymous {
+		unauthorized(w, r)
+		return
+	}
+
+	var req commentRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	c := &models.SQLComment{
+		Db:        h.dbFor(r),
+		ArticleID: article.ID,
+		ParentID:  req.Parent,
+		Author:    user,
+		Body:      req.Body,
+	}
+	if user == nil {
+		c.Name = req.Name
+		c.Email = req.Email
+	}
+
+	if h.moderator != nil {
+		h.moderator.Assess(c, req.Website)
+	} else {
+		c.State = models.StateApproved
+	}
+
+	if err := c.Save(); err != nil {
+		if err == models.ErrValidation {
+			writeError(w, r, http.StatusUnprocessableEntity, "A comment needs a body, and a name and valid email when anonymous")
+			return
+		}
+		if err == models.ErrParent {
+			writeError(w, r, http.StatusUnprocessableEntity, "Replies can only be made to approved comments on the article")
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to save comment")
+		return
+	}
+
+	rep := h.commentRepresentation(h.urls(r), article.Slug, c)
+	w.Header().Set("Location", rep.resource.Links.Self.Href)
+	write(w, r, http.StatusCreated, rep)
+}
+
+// EditCommentHandler handles changes to the body of a comment by its author
+// or an admin
+func (h *Handler) EditCommentHandler(w http.ResponseWriter, r *http.Request) {
+	article, ok := h.article(w, r)
+	if !ok {
+		return
+	}
+	c, ok := h.comment(w, r, article)
+	if !ok {
+		return
+	}
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if user == nil {
+		unauthorized(w, r)
+		return
+	}
+	if !canModify(user, c) || c.State == models.StateDeleted {
+		writeError(w, r, http.StatusForbidden, "You may not edit this comment")
+		return
+	}
+	u := h.urls(r)
+	if !ifMatch(w, r, c.Version, h.commentRepresentation(u, article.Slug, c)) {
+		return
+	}
+
+	var req commentRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	c.Body = req.Body
+	if h.moderator != nil && !canModerate(user) {
+		// Edits could sneak in what review would have caught
+		h.moderator.Assess(c, "")
+	}
+
+	if err := c.Save(); err != nil {
+		if err == models.ErrValidation {
+			writeError(w, r, http.StatusUnprocessableEntity, "A comment needs a body")
+			return
+		}
+		if err == models.ErrConflict {
+			h.commentConflict(w, r, article, c.ID)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to save comment")
+		return
+	}
+
+	write(w, r, http.StatusOK, h.commentRepresentation(u, article.Slug, c))
+}
+
+// DeleteCommentHandler handles removal of a comment by its author or an admin
+func (h *Handler) DeleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	article, ok := h.article(w, r)
+	if !ok {
+		return
+	}
+	c, ok := h.comment(w, r, article)
+	if !ok {
+		return
+	}
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if user == nil {
+		unauthorized(w, r)
+		return
+	}
+	if !canModify(user, c) {
+		writeError(w, r, http.StatusForbidden, "You may not delete this comment")
+		return
+	}
+	if !ifMatch(w, r, c.Version, h.commentRepresentation(h.urls(r), article.Slug, c)) {
+		return
+	}
+
+	if err := c.Delete(); err != nil {
+		if err == models.ErrConflict {
+			h.commentConflict(w, r, article, c.ID)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to delete comment")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
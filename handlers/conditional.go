@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// etag returns a strong entity tag for a representation
+func etag(body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// versionTag returns a strong entity tag for a representation of a resource
+// at version. The tag leads with the version so that If-Match can be checked
+// against the version alone, whichever representation the tag came from.
+func versionTag(version int, body []byte) string {
+	sum := sha256.Sum256(body)
+	return `"` + strconv.Itoa(version) + "-" + hex.EncodeToString(sum[:16]) + `"`
+}
+
+// ifMatch checks the If-Match header of a request changing a resource at
+// version. It responds 428 Precondition Required when the header is missing,
+// and 412 Precondition Failed with current, the resource as it is, when none
+// of the tags listed are for its version. It reports whether the change may
+// go ahead.
+func ifMatch(w http.ResponseWriter, r *http.Request, version int, current representation) bool {
+	list := r.Header.Get("If-Match")
+	if list == "" {
+		writeError(w, r, http.StatusPreconditionRequired, "Changes must be made with If-Match set to the ETag of the resource")
+		return false
+	}
+	if !versionMatch(list, version) {
+		write(w, r, http.StatusPreconditionFailed, current)
+		return false
+	}
+	return true
+}
+
+// versionMatch reports whether a list of entity tags from If-Match includes
+// one for version. Weak tags never match.
+func versionMatch(list string, version int) bool {
+	want := strconv.Itoa(version)
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		if len(candidate) < 2 || !strings.HasPrefix(candidate, `"`) || !strings.HasSuffix(candidate, `"`) {
+			continue
+		}
+		tag := candidate[1 : len(candidate)-1]
+		if dash := strings.Index(tag, "-"); dash >= 0 {
+			tag = tag[:dash]
+		}
+		if tag == want {
+			return true
+		}
+	}
+	return false
+}
+
+// notModified sets the validators of a representation on the response and
+// reports whether the client's copy is still current, in which case 304 Not
+// Modified has been written. A zero modified time is not sent.
+func notModified(w http.ResponseWriter, r *http.Request, tag string, modified time.Time) bool {
+	if tag != "" {
+		w.Header().Set("ETag", tag)
+	}
+	if !modified.IsZero() {
+		w.Header().Set("Last-Modified", modified.UTC().Format(http.TimeFormat))
+	}
+
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		return false
+	}
+
+	// If-None-Match takes precedence over If-Modified-Since
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if tag == "" || !etagMatch(inm, tag) {
+			return false
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && !modified.IsZero() {
+		since, err := http.ParseTime(ims)
+		if err != nil || modified.Truncate(time.Second).After(since) {
+			return false
+		}
+	} else {
+		return false
+	}
+
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
+
+// lastModified returns the latest of the times which are set, zero when none
+// are
+func lastModified(times ...*time.Time) time.Time {
+	var latest time.Time
+	for _, t := range times {
+		if t != nil && t.After(latest) {
+			latest = *t
+		}
+	}
+	return latest
+}
+
+// etagMatch reports whether a list of entity tags from If-None-Match matches
+// tag, using weak comparison
+func etagMatch(list, tag string) bool {
+	tag = strings.TrimPrefix(tag, "W/")
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == tag {
+			return true
+		}
+	}
+	return false
+}
@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/mattgen88/haljson"
@@ -10,15 +8,14 @@ import (
 
 // ErrorHandler handles requests for users
 func ErrorHandler(w http.ResponseWriter, r *http.Request) {
+	writeError(w, r, http.StatusNotFound, "Resource not found")
+}
+
+// writeError responds with status and a message describing the error
+func writeError(w http.ResponseWriter, r *http.Request, status int, message string) {
 	root := haljson.NewResource()
 	root.Self(r.URL.Path)
-	root.Data["message"] = "Resource not found"
+	root.Data["message"] = message
 
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	w.WriteHeader(http.StatusNotFound)
-	w.Write(json)
+	respond(w, r, status, root)
 }
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/feed"
+	"github.com/mattgen88/blog/markdown"
+	"github.com/mattgen88/blog/models"
+)
+
+// FeedOptions configures the syndication feeds
+type FeedOptions struct {
+	// Full publishes the whole rendered article rather than an excerpt
+	Full bool
+	// Items is how many of the latest articles a feed holds
+	Items int
+}
+
+// excerptLength is the length of the plain text summary of an article
+const excerptLength = 300
+
+// SetFeedOptions configures the syndication feeds
+func (h *Handler) SetFeedOptions(opts FeedOptions) {
+	if opts.Items <= 0 {
+		opts.Items = 20
+	}
+	h.feeds = opts
+}
+
+// feedAuthority mints entry IDs when the blog has no base URL. IDs never
+// follow the requested host, which would change them with every name the
+// blog is reached by.
+const feedAuthority = "localhost"
+
+// FeedHandler handles requests for the feed of every article
+func (h *Handler) FeedHandler(w http.ResponseWriter, r *http.Request) {
+	articles, err := models.ArticlePage(0, h.feeds.Items, h.dbFor(r))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load articles")
+		return
+	}
+	link := h.absoluteURLs(r).href("root")
+	h.writeFeed(w, r, h.site.Title, link, articles)
+}
+
+// CategoryFeedHandler handles requests for the feed of a category's articles
+func (h *Handler) CategoryFeedHandler(w http.ResponseWriter, r *http.Request) {
+	category := models.NewSQLCategory(mux.Vars(r)["category"], h.dbFor(r))
+	if !category.Exists() {
+		ErrorHandler(w, r)
+		return
+	}
+
+	articles, err := models.ArticlesBy("category", []string{category.Name}, 0, h.feeds.Items, h.dbFor(r))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load articles")
+		return
+	}
+	title := fmt.Sprintf("%s: %s", h.site.Title, category.Name)
+	link := h.absoluteURLs(r).href("category", "category", category.Name)
+	h.writeFeed(w, r, title, link, articles[category.Name])
+}
+
+// UserFeedHandler handles requests for the feed of an author's articles
+func (h *Handler) UserFeedHandler(w http.ResponseWriter, r *http.Request) {
+	user := models.NewSQLUser(mux.Vars(r)["id"], h.dbFor(r))
+	if !user.Exists() {
+		ErrorHandler(w, r)
+		return
+	}
+
+	articles, err := models.ArticlesBy("author", []string{user.Username}, 0, h.feeds.Items, h.dbFor(r))
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load articles")
+		return
+	}
+	title := fmt.Sprintf("%s: %s", h.site.Title, user.Username)
+	link := h.absoluteURLs(r).href("user", "id", user.Username)
+	h.writeFeed(w, r, title, link, articles[user.Username])
+}
+
+// writeFeed renders the latest articles, loaded up to Items, in the format
+// named by the route, linking to the page at link
+func (h *Handler) writeFeed(w http.ResponseWriter, r *http.Request, title, link string, articles []*models.SQLArticle) {
+	u := h.absoluteURLs(r)
+
+	authority := h.site.BaseURL
+	if authority == "" {
+		authority = feedAuthority
+	}
+
+	f := &feed.Feed{
+		Title:       title,
+		Description: h.site.Description,
+		Link:        link,
+		Self:        u.path(r.URL.Path),
+	}
+
+	for _, article := range articles {
+		item := feed.Item{
+			Title:   article.Title,
+			Link:    u.href("article", "id", article.Slug),
+			Summary: markdown.Excerpt(article.Body, excerptLength),
+		}
+		if article.Date != nil {
+			item.Published = *article.Date
+		}
+		item.Updated = item.Published
+		if article.Updated != nil {
+			item.Updated = *article.Updated
+		}
+		item.ID = feed.TagURI(authority, item.Published, fmt.Sprintf("article:%d", article.ID))
+		if article.Author != nil {
+			item.Author = article.Author.Username
+		}
+		if article.Category != nil {
+			item.Category = article.Category.Name
+		}
+		if h.feeds.Full {
+			item.Content = string(markdown.Render(article.Body))
+		}
+		f.Items = append(f.Items, item)
+	}
+	f.Updated = feed.Latest(f.Items)
+
+	var (
+		body  []byte
+		ctype string
+		err   error
+	)
+	switch mux.Vars(r)["format"] {
+	case "atom":
+		body, err = f.Atom()
+		ctype = feed.ContentTypeAtom
+	case "json":
+		body, err = f.JSON()
+		ctype = feed.ContentTypeJSON
+	default:
+		body, err = f.RSS()
+		ctype = feed.ContentTypeRSS
+	}
+	if err != nil {
+		logger(r).Error("Failed to render feed", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ctype)
+	var modified time.Time
+	if len(f.Items) > 0 {
+		modified = f.Updated
+	}
+	if notModified(w, r, etag(body), modified) {
+		return
+	}
+	w.Write(body)
+}
@@ -0,0 +1,451 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/mattgen88/blog/graphql"
+	"github.com/mattgen88/blog/markdown"
+	"github.com/mattgen88/blog/models"
+)
+
+// SetGraphQLLimits sets how deep and complex GraphQL queries may be, zero
+// values are replaced by defaults
+func (h *Handler) SetGraphQLLimits(limits graphql.Limits) {
+	if limits.MaxDepth <= 0 {
+		limits.MaxDepth = 10
+	}
+	if limits.MaxComplexity <= 0 {
+		limits.MaxComplexity = 5000
+	}
+	h.graphLimits = limits
+}
+
+// GraphQLHandler executes GraphQL queries, posted as JSON or
+// application/graphql, or given in the query string of a GET
+func (h *Handler) GraphQLHandler(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch {
+	case r.Method == "GET":
+		q := r.URL.Query()
+		req.Query = q.Get("query")
+		req.OperationName = q.Get("operationName")
+		if variables := q.Get("variables"); variables != "" {
+			if err := json.Unmarshal([]byte(variables), &req.Variables); err != nil {
+				writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: "Variables must be a JSON object"}}})
+				return
+			}
+		}
+	case strings.HasPrefix(r.Header.Get("Content-Type"), "application/graphql"):
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxBodySize))
+		if err != nil {
+			writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: "Request body is too large"}}})
+			return
+		}
+		req.Query = string(body)
+	default:
+		if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(&req); err != nil {
+			writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: "Request body must be valid JSON"}}})
+			return
+		}
+	}
+
+	if req.Query == "" {
+		writeGraphQL(w, http.StatusBadRequest, &graphql.Response{Errors: []*graphql.Error{{Message: "A query is required"}}})
+		return
+	}
+
+	res := h.graph.Execute(r.Context(), req, h.graphLimits)
+	status := http.StatusOK
+	if res.Data == nil {
+		status = http.StatusBadRequest
+	}
+	writeGraphQL(w, status, res)
+}
+
+// writeGraphQL writes a GraphQL response
+func writeGraphQL(w http.ResponseWriter, status int, res *graphql.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// graphSchema returns the GraphQL schema of the blog. Every resolver loads
+// what a whole level of the response needs at once, so nested lists cost one
+// query per level rather than one per item.
+func (h *Handler) graphSchema() *graphql.Schema {
+	page := map[string]*graphql.Argument{
+		"first":  {Type: graphql.Type("Int"), Default: 20},
+		"offset": {Type: graphql.Type("Int"), Default: 0},
+	}
+	named := map[string]*graphql.Argument{"name": {Type: graphql.Type("String!")}}
+
+	query := &graphql.Object{Name: "Query", Fields: map[string]*graphql.Field{
+		"article": {
+			Type:    graphql.Type("Article"),
+			Args:    map[string]*graphql.Argument{"slug": {Type: graphql.Type("String!")}},
+			Resolve: h.resolveArticle,
+		},
+		"articles": {
+			Type:    graphql.Type("[Article!]!"),
+			Args:    page,
+			Resolve: h.resolveArticles,
+		},
+		"category": {
+			Type:    graphql.Type("Category"),
+			Args:    named,
+			Resolve: h.resolveCategory,
+		},
+		"categories": {
+			Type: graphql.Type("[Category!]!"),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				return []interface{}{models.CategoryList(h.dbWith(ctx))}, nil
+			},
+		},
+		"user": {
+			Type:    graphql.Type("User"),
+			Args:    map[string]*graphql.Argument{"username": {Type: graphql.Type("String!")}},
+			Resolve: h.resolveUser,
+		},
+		"users": {
+			Type: graphql.Type("[User!]!"),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				users, err := models.UserList(h.dbWith(ctx))
+				return []interface{}{users}, err
+			},
+		},
+		"tag": {
+			Type:    graphql.Type("Tag"),
+			Args:    named,
+			Resolve: h.resolveTag,
+		},
+		"tags": {
+			Type: graphql.Type("[Tag!]!"),
+			Resolve: func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+				tags, err := models.TagList(h.dbWith(ctx))
+				return []interface{}{tags}, err
+			},
+		},
+	}}
+
+	article := func(fn func(a *models.SQLArticle) interface{}) graphql.Resolver {
+		return graphql.Each(func(parent interface{}) interface{} {
+			return fn(parent.(*models.SQLArticle))
+		})
+	}
+	articleType := &graphql.Object{Name: "Article", Fields: map[string]*graphql.Field{
+		"id":    {Type: graphql.Type("ID!"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.ID })},
+		"slug":  {Type: graphql.Type("String!"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Slug })},
+		"url":   {Type: graphql.Type("String!"), Resolve: article(func(a *models.SQLArticle) interface{} { return h.paths().href("article", "id", a.Slug) })},
+		"title": {Type: graphql.Type("String!"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Title })},
+		"body":  {Type: graphql.Type("String!"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Body })},
+		"html": {Type: graphql.Type("String!"), Resolve: article(func(a *models.SQLArticle) interface{} {
+			return string(markdown.Render(a.Body))
+		})},
+		"date":    {Type: graphql.Type("DateTime"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Date })},
+		"updated": {Type: graphql.Type("DateTime"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Updated })},
+		"tags":    {Type: graphql.Type("[Tag!]!"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Tags })},
+		// Articles are loaded with the id and name of their category, which is
+		// all there is to a category
+		"category": {Type: graphql.Type("Category"), Resolve: article(func(a *models.SQLArticle) interface{} { return a.Category })},
+		"author":   {Type: graphql.Type("User"), Resolve: h.resolveAuthors},
+		"comments": {Type: graphql.Type("[Comment!]!"), Resolve: h.resolveComments},
+		"related": {
+			Type:    graphql.Type("[Article!]!"),
+			Args:    map[string]*graphql.Argument{"first": {Type: graphql.Type("Int"), Default: 5}},
+			Resolve: h.resolveRelated,
+		},
+	}}
+
+	categoryType := &graphql.Object{Name: "Category", Fields: map[string]*graphql.Field{
+		"id": {Type: graphql.Type("ID!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLCategory).ID
+		})},
+		"name": {Type: graphql.Type("String!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLCategory).Name
+		})},
+		"url": {Type: graphql.Type("String!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return h.paths().href("category", "category", parent.(*models.SQLCategory).Name)
+		})},
+		"articles": {
+			Type: graphql.Type("[Article!]!"),
+			Args: page,
+			Resolve: h.articlesBy("category", func(parent interface{}) string {
+				return parent.(*models.SQLCategory).Name
+			}),
+		},
+	}}
+
+	// Users are public, so their email addresses and roles are left out
+	userType := &graphql.Object{Name: "User", Fields: map[string]*graphql.Field{
+		"username": {Type: graphql.Type("String!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLUser).Username
+		})},
+		"realname": {Type: graphql.Type("String"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			if name := parent.(*models.SQLUser).Realname; name != "" {
+				return name
+			}
+			return nil
+		})},
+		"url": {Type: graphql.Type("String!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return h.paths().href("user", "id", parent.(*models.SQLUser).Username)
+		})},
+		"created": {Type: graphql.Type("DateTime"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLUser).Created
+		})},
+		"articles": {
+			Type: graphql.Type("[Article!]!"),
+			Args: page,
+			Resolve: h.articlesBy("author", func(parent interface{}) string {
+				return parent.(*models.SQLUser).Username
+			}),
+		},
+	}}
+
+	tagType := &graphql.Object{Name: "Tag", Fields: map[string]*graphql.Field{
+		"name": {Type: graphql.Type("String!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent
+		})},
+		"articles": {
+			Type: graphql.Type("[Article!]!"),
+			Args: page,
+			Resolve: h.articlesBy("tag", func(parent interface{}) string {
+				return parent.(string)
+			}),
+		},
+	}}
+
+	// Deleted comments only remain to hold their replies, so they have no
+	// author or body
+	comment := func(fn func(c *models.SQLComment) interface{}) graphql.Resolver {
+		return graphql.Each(func(parent interface{}) interface{} {
+			c := parent.(*models.SQLComment)
+			if c.State == models.StateDeleted {
+				return nil
+			}
+			return fn(c)
+		})
+	}
+	commentType := &graphql.Object{Name: "Comment", Fields: map[string]*graphql.Field{
+		"id": {Type: graphql.Type("ID!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLComment).ID
+		})},
+		"deleted": {Type: graphql.Type("Boolean!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLComment).State == models.StateDeleted
+		})},
+		"author": {Type: graphql.Type("String"), Resolve: comment(func(c *models.SQLComment) interface{} { return c.DisplayName() })},
+		"body":   {Type: graphql.Type("String"), Resolve: comment(func(c *models.SQLComment) interface{} { return c.Body })},
+		"html": {Type: graphql.Type("String"), Resolve: comment(func(c *models.SQLComment) interface{} {
+			return string(markdown.Render(c.Body))
+		})},
+		"created": {Type: graphql.Type("DateTime!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLComment).Created
+		})},
+		"updated": {Type: graphql.Type("DateTime"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLComment).Updated
+		})},
+		"user": {Type: graphql.Type("User"), Resolve: h.resolveCommenters},
+		"replies": {Type: graphql.Type("[Comment!]!"), Resolve: graphql.Each(func(parent interface{}) interface{} {
+			return parent.(*models.SQLComment).Replies
+		})},
+	}}
+
+	schema, err := graphql.NewSchema(query, articleType, categoryType, userType, tagType, commentType)
+	if err != nil {
+		panic(err)
+	}
+	return schema
+}
+
+// pageArgs returns the offset and limit asked for by first and offset
+// arguments, limited to maxPerPage
+func pageArgs(args graphql.Args) (int, int) {
+	first, offset := args.Int("first"), args.Int("offset")
+	if first < 0 {
+		first = 0
+	}
+	if first > maxPerPage {
+		first = maxPerPage
+	}
+	if offset < 0 {
+		offset = 0
+	}
+	return offset, first
+}
+
+func (h *Handler) resolveArticle(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	slug := args.String("slug")
+	articles, err := models.ArticlesBySlug([]string{slug}, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if a, ok := articles[slug]; ok {
+		return []interface{}{a}, nil
+	}
+	return []interface{}{nil}, nil
+}
+
+func (h *Handler) resolveArticles(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	offset, limit := pageArgs(args)
+	articles, err := models.ArticlePage(offset, limit, h.dbWith(ctx))
+	return []interface{}{articles}, err
+}
+
+func (h *Handler) resolveCategory(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	name := args.String("name")
+	categories, err := models.CategoriesByName([]string{name}, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if c, ok := categories[name]; ok {
+		return []interface{}{c}, nil
+	}
+	return []interface{}{nil}, nil
+}
+
+func (h *Handler) resolveUser(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	username := args.String("username")
+	users, err := models.UsersByName([]string{username}, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+	if u, ok := users[username]; ok {
+		return []interface{}{u}, nil
+	}
+	return []interface{}{nil}, nil
+}
+
+func (h *Handler) resolveTag(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	name := args.String("name")
+	tags, err := models.TagList(h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		if tag == name {
+			return []interface{}{tag}, nil
+		}
+	}
+	return []interface{}{nil}, nil
+}
+
+// articlesBy resolves a page of articles for each parent, grouped by the key
+// of the parent
+func (h *Handler) articlesBy(group string, key func(parent interface{}) string) graphql.Resolver {
+	return func(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+		keys := make([]string, len(parents))
+		for i, parent := range parents {
+			keys[i] = key(parent)
+		}
+
+		offset, limit := pageArgs(args)
+		byKey, err := models.ArticlesBy(group, keys, offset, limit, h.dbWith(ctx))
+		if err != nil {
+			return nil, err
+		}
+
+		values := make([]interface{}, len(parents))
+		for i, k := range keys {
+			values[i] = byKey[k]
+		}
+		return values, nil
+	}
+}
+
+// resolveAuthors loads the authors of every article at once
+func (h *Handler) resolveAuthors(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	var usernames []string
+	for _, parent := range parents {
+		if a := parent.(*models.SQLArticle); a.Author != nil {
+			usernames = append(usernames, a.Author.Username)
+		}
+	}
+
+	users, err := models.UsersByName(usernames, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(parents))
+	for i, parent := range parents {
+		if a := parent.(*models.SQLArticle); a.Author != nil {
+			if u, ok := users[a.Author.Username]; ok {
+				values[i] = u
+			}
+		}
+	}
+	return values, nil
+}
+
+// resolveComments loads the comment threads of every article at once
+func (h *Handler) resolveComments(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := make([]int, len(parents))
+	for i, parent := range parents {
+		ids[i] = parent.(*models.SQLArticle).ID
+	}
+
+	comments, err := models.CommentsByArticle(ids, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(parents))
+	for i, id := range ids {
+		values[i] = comments[id]
+	}
+	return values, nil
+}
+
+// resolveRelated loads the articles related to every article at once
+func (h *Handler) resolveRelated(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	ids := make([]int, len(parents))
+	for i, parent := range parents {
+		ids[i] = parent.(*models.SQLArticle).ID
+	}
+
+	_, limit := pageArgs(args)
+	related, err := models.RelatedArticles(ids, limit, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(parents))
+	for i, id := range ids {
+		values[i] = related[id]
+	}
+	return values, nil
+}
+
+// resolveCommenters loads the users who left every comment at once, which
+// is null for anonymous and deleted comments
+func (h *Handler) resolveCommenters(ctx context.Context, parents []interface{}, args graphql.Args) ([]interface{}, error) {
+	var usernames []string
+	for _, parent := range parents {
+		if c := parent.(*models.SQLComment); !c.Anonymous() {
+			usernames = append(usernames, c.Author.Username)
+		}
+	}
+	if len(usernames) == 0 {
+		return make([]interface{}, len(parents)), nil
+	}
+
+	users, err := models.UsersByName(usernames, h.dbWith(ctx))
+	if err != nil {
+		return nil, err
+	}
+
+	values := make([]interface{}, len(parents))
+	for i, parent := range parents {
+		c := parent.(*models.SQLComment)
+		if c.Anonymous() || c.State == models.StateDeleted {
+			continue
+		}
+		if u, ok := users[c.Author.Username]; ok {
+			values[i] = u
+		}
+	}
+	return values, nil
+}
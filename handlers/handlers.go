@@ -2,16 +2,77 @@ package handlers
 
 import (
 	"database/sql"
+	"strings"
+
 	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/cache"
+	"github.com/mattgen88/blog/graphql"
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/moderation"
+	"github.com/mattgen88/blog/search"
+	"github.com/mattgen88/blog/theme"
+	"github.com/mattgen88/blog/webhooks"
 )
 
 // Handler provides various http handlers
 type Handler struct {
-	r  *mux.Router
-	db *sql.DB
+	r             *mux.Router
+	db            *sql.DB
+	index         *search.Index
+	comments      CommentOptions
+	moderator     *moderation.Moderator
+	site          Site
+	feeds         FeedOptions
+	robots        RobotsOptions
+	theme         *theme.Theme
+	webhooks      *webhooks.Dispatcher
+	links         LinkOptions
+	cachePolicies CachePolicies
+	cache         *cache.Cache
+	idempotency   IdempotencyOptions
+	store         media.Store
+	library       MediaOptions
+	stopping      <-chan struct{}
+	meters        *httpMetrics
+
+	graph       *graphql.Schema
+	graphLimits graphql.Limits
+}
+
+// Site describes the blog as a whole
+type Site struct {
+	Title       string
+	Description string
+	// BaseURL is the public URL of the blog, used where absolute links are
+	// required. When empty it is derived from each request.
+	BaseURL string
 }
 
 // New returns a configured handler struct
 func New(r *mux.Router, db *sql.DB) *Handler {
-	return &Handler{r, db}
+	h := &Handler{r: r, db: db}
+	h.SetCommentOptions(CommentOptions{})
+	h.SetFeedOptions(FeedOptions{})
+	h.SetIdempotencyOptions(IdempotencyOptions{})
+	h.SetMediaOptions(MediaOptions{})
+	h.SetGraphQLLimits(graphql.Limits{})
+	h.graph = h.graphSchema()
+	return h
+}
+
+// SetSearchIndex sets the index used to answer search requests
+func (h *Handler) SetSearchIndex(index *search.Index) {
+	h.index = index
+}
+
+// SetModerator sets the moderator deciding which new comments are published
+func (h *Handler) SetModerator(m *moderation.Moderator) {
+	h.moderator = m
+}
+
+// SetSite sets the description of the blog
+func (h *Handler) SetSite(site Site) {
+	site.BaseURL = strings.TrimSuffix(site.BaseURL, "/")
+	h.site = site
 }
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/mattgen88/blog/models"
+)
+
+// healthTimeout bounds how long a health check waits on the database
+const healthTimeout = 2 * time.Second
+
+// health is the body of health check responses, with the result of each
+// check by name
+type health struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks"`
+}
+
+// SetStopping sets a channel closed when the server begins shutting down,
+// from which point it reports it isn't ready for requests
+func (h *Handler) SetStopping(stopping <-chan struct{}) {
+	h.stopping = stopping
+}
+
+// checkDatabase checks the database answers and every migration has been
+// applied to it
+func (h *Handler) checkDatabase(r *http.Request, checks map[string]string) {
+	ctx, cancel := context.WithTimeout(r.Context(), healthTimeout)
+	defer cancel()
+
+	if err := h.db.PingContext(ctx); err != nil {
+		logger(r).Warn("Health check failed to reach the database", "err", err)
+		checks["database"] = "unreachable"
+		return
+	}
+	checks["database"] = "ok"
+
+	pending, err := models.PendingMigrations(h.dbFor(r))
+	switch {
+	case err != nil:
+		logger(r).Warn("Health check failed to read migrations", "err", err)
+		checks["migrations"] = "unknown"
+	case pending > 0:
+		checks["migrations"] = strconv.Itoa(pending) + " pending"
+	default:
+		checks["migrations"] = "ok"
+	}
+}
+
+// writeHealth responds with the result of health checks, which failed
+// unless every check is ok. Responses are never cached.
+func writeHealth(w http.ResponseWriter, checks map[string]string) {
+	status := http.StatusOK
+	res := health{Status: "ok", Checks: checks}
+	for _, result := range checks {
+		if result != "ok" {
+			status = http.StatusServiceUnavailable
+			res.Status = "unavailable"
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res)
+}
+
+// HealthHandler handles liveness checks, which pass while the server can
+// reach the database and every migration has been applied
+func (h *Handler) HealthHandler(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	h.checkDatabase(r, checks)
+	writeHealth(w, checks)
+}
+
+// ReadyHandler handles readiness checks, which pass as liveness checks do
+// until the server begins shutting down, so load balancers stop sending it
+// requests while those in flight finish
+func (h *Handler) ReadyHandler(w http.ResponseWriter, r *http.Request) {
+	checks := make(map[string]string)
+	h.checkDatabase(r, checks)
+	checks["server"] = "ok"
+	select {
+	case <-h.stopping:
+		checks["server"] = "stopping"
+	default:
+	}
+	writeHealth(w, checks)
+}
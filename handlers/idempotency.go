@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/ioutil"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/mattgen88/blog/models"
+)
+
+// IdempotencyOptions configures how requests made with an Idempotency-Key
+// are replayed
+type IdempotencyOptions struct {
+	// Window is how long the response to a request is replayed to retries
+	Window time.Duration
+}
+
+// maxIdempotencyKey is the longest key accepted
+const maxIdempotencyKey = 255
+
+// SetIdempotencyOptions configures idempotency keys
+func (h *Handler) SetIdempotencyOptions(opts IdempotencyOptions) {
+	if opts.Window <= 0 {
+		opts.Window = 24 * time.Hour
+	}
+	h.idempotency = opts
+}
+
+// Idempotency is middleware making POST requests sent with an
+// Idempotency-Key safe to retry. The first request with a key is handled and
+// its response stored, and retries within the window are answered with the
+// stored response. A key reused for a different request is rejected with 422
+// and one whose request is still being handled with 409. Keys are scoped to
+// the credentials the request was made with, so anonymous requests, which
+// would all share a scope, are handled as if sent without a key. Server
+// errors aren't stored, so the retry is handled afresh.
+func (h *Handler) Idempotency(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get("Idempotency-Key")
+		credentials := r.Header.Get("Authorization")
+		if r.Method != http.MethodPost || key == "" || credentials == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKey {
+			writeError(w, r, http.StatusBadRequest, "Idempotency-Key must be at most 255 characters")
+			return
+		}
+
+		limit := int64(maxBodySize)
+		if h.uploadLimit() > limit {
+			// Uploads to the media library are the largest requests
+			limit = h.uploadLimit()
+		}
+		body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, limit))
+		if err != nil {
+			writeError(w, r, http.StatusBadRequest, "Request body could not be read")
+			return
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+		// The key is claimed, completed and released on a database which
+		// isn't cancelled with the request, as clients which go away are the
+		// ones likely to retry and a key left claimed would turn every retry
+		// away
+		requestPrint := fingerprint(r, body)
+		req, claimed, err := models.ClaimIdempotencyKey(digest(credentials), key, requestPrint, h.idempotency.Window, h.detachedDBFor(r))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Failed to check the Idempotency-Key")
+			return
+		}
+		if !claimed {
+			replay(w, r, req, requestPrint)
+			return
+		}
+
+		rec := &responseRecorder{header: make(http.Header), status: http.StatusOK}
+		completed := false
+		defer func() {
+			// Free the key of a request whose handler panicked
+			if !completed {
+				req.Release()
+			}
+		}()
+		next.ServeHTTP(rec, r)
+		completed = true
+
+		// A response which couldn't be stored frees the key too, rather than
+		// leaving retries turned away as still being handled
+		if rec.status >= 500 || req.Complete(rec.status, rec.header, rec.body.Bytes()) != nil {
+			req.Release()
+		}
+
+		for name, values := range rec.header {
+			w.Header()[name] = values
+		}
+		w.WriteHeader(rec.status)
+		w.Write(rec.body.Bytes())
+	})
+}
+
+// replay answers a retry with the response stored for the key it was sent
+// with
+func replay(w http.ResponseWriter, r *http.Request, req *models.IdempotentRequest, fingerprint string) {
+	if req.Fingerprint != fingerprint {
+		writeError(w, r, http.StatusUnprocessableEntity, "Idempotency-Key was already used for a different request")
+		return
+	}
+	if req.Status == 0 {
+		w.Header().Set("Retry-After", "1")
+		writeError(w, r, http.StatusConflict, "The request made with this Idempotency-Key is still being handled")
+		return
+	}
+
+	for name, values := range req.Header {
+		w.Header()[name] = values
+	}
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(req.Status)
+	w.Write(req.Body)
+}
+
+// fingerprint identifies a request by its method, URL and body. Multipart
+// bodies are identified by their fields and the hashes of their files, as
+// the boundary between the parts is chosen afresh for every request.
+func fingerprint(r *http.Request, body []byte) string {
+	if parts, ok := multipartPrint(r, body); ok {
+		body = []byte(parts)
+	}
+	return digest(r.Method + " " + r.URL.RequestURI() + "\x00" + string(body))
+}
+
+// multipartPrint describes the parts of a multipart body in order, leaving
+// out the boundary
+func multipartPrint(r *http.Request, body []byte) (string, bool) {
+	mediaType, params, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(mediaType, "multipart/") || params["boundary"] == "" {
+		return "", false
+	}
+
+	var parts []string
+	reader := multipart.NewReader(bytes.NewReader(body), params["boundary"])
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return "", false
+		}
+		hash := sha256.New()
+		if _, err := io.Copy(hash, part); err != nil {
+			return "", false
+		}
+		parts = append(parts, strings.Join([]string{
+			part.FormName(),
+			part.FileName(),
+			part.Header.Get("Content-Type"),
+			hex.EncodeToString(hash.Sum(nil)),
+		}, "\x00"))
+	}
+	return mediaType + "\x00" + strings.Join(parts, "\x00\x00"), true
+}
+
+// digest hashes s, so credentials aren't stored
+func digest(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
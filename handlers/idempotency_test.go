@@ -0,0 +1,64 @@
+package handlers
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http/httptest"
+	"testing"
+)
+
+// upload returns a multipart request uploading file, with a boundary of its
+// own
+func upload(t *testing.T, alt string, file []byte) (string, []byte) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	if err := w.WriteField("alt", alt); err != nil {
+		t.Fatal(err)
+	}
+	part, err := w.CreateFormFile("file", "photo.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	part.Write(file)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return w.FormDataContentType(), body.Bytes()
+}
+
+func TestFingerprintMultipart(t *testing.T) {
+	print := func(alt string, file []byte) string {
+		contentType, body := upload(t, alt, file)
+		r := httptest.NewRequest("POST", "/media", bytes.NewReader(body))
+		r.Header.Set("Content-Type", contentType)
+		return fingerprint(r, body)
+	}
+
+	first := print("A cat", []byte("cat"))
+	if retry := print("A cat", []byte("cat")); retry != first {
+		t.Error("a retry with a new boundary has a different fingerprint")
+	}
+	if other := print("A cat", []byte("dog")); other == first {
+		t.Error("a different file has the same fingerprint")
+	}
+	if other := print("A dog", []byte("cat")); other == first {
+		t.Error("a different field has the same fingerprint")
+	}
+}
+
+func TestFingerprintBody(t *testing.T) {
+	print := func(target, body string) string {
+		r := httptest.NewRequest("POST", target, nil)
+		r.Header.Set("Content-Type", "application/json")
+		return fingerprint(r, []byte(body))
+	}
+	if print("/articles", `{"title":"a"}`) != print("/articles", `{"title":"a"}`) {
+		t.Error("the same request has different fingerprints")
+	}
+	if print("/articles", `{"title":"a"}`) == print("/articles", `{"title":"b"}`) {
+		t.Error("different bodies have the same fingerprint")
+	}
+	if print("/articles", `{}`) == print("/categories", `{}`) {
+		t.Error("different URLs have the same fingerprint")
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/haljson"
+)
+
+// LinkOptions configures how links in responses are written
+type LinkOptions struct {
+	// Absolute writes links as absolute URLs on the public URL of the blog,
+	// rather than as paths
+	Absolute bool
+	// TrustForwarded derives the public URL from the Forwarded or
+	// X-Forwarded-Proto and X-Forwarded-Host headers set by a proxy, when no
+	// base URL is configured. Only enable it behind a proxy that sets them.
+	TrustForwarded bool
+}
+
+// SetLinkOptions configures how links are written
+func (h *Handler) SetLinkOptions(opts LinkOptions) {
+	h.links = opts
+}
+
+// urls builds links from the named routes of the router, so they follow
+// the routes wherever the router is mounted
+type urls struct {
+	router *mux.Router
+	// base is prepended to every link, empty for links relative to the host
+	base string
+}
+
+// urls returns the links of a response to r, which are absolute when
+// configured so
+func (h *Handler) urls(r *http.Request) urls {
+	u := urls{router: h.r}
+	if h.links.Absolute {
+		u.base = h.baseURL(r)
+	}
+	return u
+}
+
+// absoluteURLs returns links which are always absolute, for feeds and
+// sitemaps
+func (h *Handler) absoluteURLs(r *http.Request) urls {
+	return urls{router: h.r, base: h.baseURL(r)}
+}
+
+// paths returns links as paths, for when there is no request to make them
+// absolute with
+func (h *Handler) paths() urls {
+	return urls{router: h.r}
+}
+
+// href returns the URL of a named route with its variables filled in from
+// pairs of names and values
+func (u urls) href(name string, pairs ...string) string {
+	route := u.router.Get(name)
+	if route == nil {
+		logs.Error("No route named", "route", name)
+		return ""
+	}
+	url, err := route.URL(pairs...)
+	if err != nil {
+		logs.Error("Failed to build the URL of route", "route", name, "err", err)
+		return ""
+	}
+	return u.base + url.String()
+}
+
+// template returns the URI template of a named route, with the patterns of
+// its variables removed and the query parameters given added
+func (u urls) template(name string, query ...string) string {
+	route := u.router.Get(name)
+	if route == nil {
+		logs.Error("No route named", "route", name)
+		return ""
+	}
+	tpl, err := route.GetPathTemplate()
+	if err != nil {
+		logs.Error("Failed to get the template of route", "route", name, "err", err)
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(u.base)
+	depth, pattern := 0, false
+	for _, c := range tpl {
+		switch {
+		case c == '{':
+			depth++
+			if depth == 1 {
+				b.WriteRune(c)
+			}
+		case c == '}':
+			depth--
+			if depth == 0 {
+				b.WriteRune(c)
+				pattern = false
+			}
+		case c == ':' && depth == 1:
+			// The pattern of the variable follows
+			pattern = true
+		case depth == 0 || !pattern:
+			b.WriteRune(c)
+		}
+	}
+	if len(query) > 0 {
+		b.WriteString("{?" + strings.Join(query, ",") + "}")
+	}
+	return b.String()
+}
+
+// path returns a path on the blog as a link, such as the path a request was
+// made to
+func (u urls) path(p string) string {
+	return u.base + p
+}
+
+// document returns the top level resource of a response with its self link.
+// It declares the blog's curie, which is left out when written unless
+// something in the document links with it.
+func (u urls) document(self string) *haljson.Resource {
+	res := haljson.NewResource()
+	res.Self(self)
+	res.AddCurie(&haljson.Curie{Name: curieName, Href: u.template("relation"), Templated: true})
+	return res
+}
+
+// resource returns an embedded resource with its self link
+func (u urls) resource(self string) *haljson.Resource {
+	res := haljson.NewResource()
+	res.Self(self)
+	return res
+}
+
+// baseURL returns the public URL of the blog without a trailing slash
+func (h *Handler) baseURL(r *http.Request) string {
+	if h.site.BaseURL != "" {
+		return h.site.BaseURL
+	}
+
+	scheme, host := "http", r.Host
+	if r.TLS != nil {
+		scheme = "https"
+	}
+	if h.links.TrustForwarded {
+		if proto, fhost := forwarded(r); fhost != "" {
+			host = fhost
+			if proto == "http" || proto == "https" {
+				scheme = proto
+			}
+		}
+	}
+	return scheme + "://" + host
+}
+
+// forwarded returns the protocol and host the client connected to a proxy
+// with, from the first proxy listed in the Forwarded header, or else from
+// X-Forwarded-Proto and X-Forwarded-Host
+func forwarded(r *http.Request) (proto, host string) {
+	if header := r.Header.Get("Forwarded"); header != "" {
+		first := strings.Split(header, ",")[0]
+		for _, pair := range strings.Split(first, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			value := strings.Trim(kv[1], `"`)
+			switch strings.ToLower(kv[0]) {
+			case "proto":
+				proto = strings.ToLower(value)
+			case "host":
+				host = value
+			}
+		}
+		if host != "" {
+			return proto, host
+		}
+	}
+
+	first := func(header string) string {
+		return strings.TrimSpace(strings.Split(r.Header.Get(header), ",")[0])
+	}
+	return strings.ToLower(first("X-Forwarded-Proto")), first("X-Forwarded-Host")
+}
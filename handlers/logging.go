@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/models"
+)
+
+// logs is the logger of the handlers, and access the logger of the requests
+// served
+var (
+	logs   = logging.For("handlers")
+	access = logging.For("http")
+)
+
+// requestIDPattern matches the request IDs accepted from clients and
+// proxies, anything else is replaced so logs can't be forged through it
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// RequestID is middleware giving every request an ID, taken from the
+// X-Request-ID header when a proxy has already given it one, which is sent
+// back in the response and logged with everything done for the request
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = logging.NewRequestID()
+		}
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+	})
+}
+
+// AccessLog is middleware logging every request served, replacing the
+// access log of Gorilla. Requests which fail are logged as warnings, so the
+// http subsystem can be set to warn to only log those.
+func AccessLog(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		mw := &meteredWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(mw, r)
+
+		logAt := access.Info
+		if mw.status >= http.StatusInternalServerError {
+			logAt = access.Warn
+		}
+		logAt("Served request",
+			"request_id", logging.RequestID(r.Context()),
+			"method", r.Method,
+			"path", r.URL.RequestURI(),
+			"status", mw.status,
+			"size", mw.size,
+			"duration", time.Since(start),
+			"remote", r.RemoteAddr,
+			"user_agent", r.UserAgent(),
+		)
+	})
+}
+
+// dbFor returns the database bound to a request, so queries are abandoned
+// when the client goes away and models log with the ID of the request
+func (h *Handler) dbFor(r *http.Request) models.DB {
+	return h.dbWith(r.Context())
+}
+
+// dbWith returns the database bound to the context of a request, where the
+// request itself isn't at hand
+func (h *Handler) dbWith(ctx context.Context) models.DB {
+	return models.WithContext(ctx, h.db)
+}
+
+// detachedDBFor returns the database bound to the values of a request but
+// not its cancellation, for writes which must finish even when the client
+// goes away
+func (h *Handler) detachedDBFor(r *http.Request) models.DB {
+	return models.WithContext(detached{r.Context()}, h.db)
+}
+
+// detached is a context keeping the values of its parent, such as the
+// request ID, without being cancelled with it
+type detached struct {
+	context.Context
+}
+
+func (detached) Deadline() (time.Time, bool) { return time.Time{}, false }
+func (detached) Done() <-chan struct{}       { return nil }
+func (detached) Err() error                  { return nil }
+
+// logger returns the logger of the handlers for a request
+func logger(r *http.Request) *logging.Logger {
+	return logs.Ctx(r.Context())
+}
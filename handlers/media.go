@@ -0,0 +1,506 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/imaging"
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/haljson"
+)
+
+// MediaOptions configures uploads to the media library
+type MediaOptions struct {
+	// MaxSize is the largest file which may be uploaded
+	MaxSize int64
+	// Quota is how many bytes of files each user may upload, zero for no
+	// limit
+	Quota int64
+	// Variants are the sizes images are rendered at
+	Variants []imaging.Variant
+	// Eager renders the variants of an image when it is uploaded, rather
+	// than on the first request for each
+	Eager bool
+	// Format is the format variants are written in, one of the imaging
+	// formats
+	Format string
+	// Quality is the JPEG quality of variants and of images turned upright
+	Quality int
+}
+
+// multipartOverhead allows for the form an upload is sent in around the
+// file
+const multipartOverhead = 1 << 20
+
+// maxFilename is the longest filename kept, longer ones are cut short
+const maxFilename = 255
+
+// mediaRequest is the body accepted when changing media, fields left out
+// are unchanged
+type mediaRequest struct {
+	Alt     *string  `json:"alt"`
+	Caption *string  `json:"caption"`
+	FocusX  *float64 `json:"focusX"`
+	FocusY  *float64 `json:"focusY"`
+}
+
+// mediaReference matches links to media in the body of an article, to the
+// media or its file
+var mediaReference = regexp.MustCompile(`/media/([0-9]+)\b`)
+
+// SetMediaStore sets the backend uploaded files are stored by, uploads are
+// refused when it is nil
+func (h *Handler) SetMediaStore(store media.Store) {
+	h.store = store
+}
+
+// SetMediaOptions configures the media library
+func (h *Handler) SetMediaOptions(opts MediaOptions) {
+	if opts.MaxSize <= 0 {
+		opts.MaxSize = 10 << 20
+	}
+	if opts.Format == "" {
+		opts.Format = imaging.FormatAuto
+	}
+	if opts.Quality <= 0 || opts.Quality > 100 {
+		opts.Quality = 85
+	}
+	h.library = opts
+}
+
+// uploadLimit is the largest request body an upload may have
+func (h *Handler) uploadLimit() int64 {
+	return h.library.MaxSize + multipartOverhead
+}
+
+// mediaResource builds the representation of media, linking to its file and
+// the variants of images
+func (h *Handler) mediaResource(u urls, m *models.SQLMedia) *haljson.Resource {
+	id := strconv.Itoa(m.ID)
+	res := u.resource(u.href("media", "media", id))
+	contentType := m.ContentType
+	res.AddLink("enclosure", &haljson.Link{Href: u.href("media-file", "media", id), Type: &contentType})
+	res.AddLink("author", &haljson.Link{Href: u.href("user", "id", m.Owner)})
+
+	res.Data["id"] = m.ID
+	res.Data["filename"] = m.Filename
+	res.Data["contentType"] = m.ContentType
+	res.Data["size"] = m.Size
+	if m.Width > 0 && m.Height > 0 {
+		res.Data["width"] = m.Width
+		res.Data["height"] = m.Height
+		res.Data["focusX"] = m.FocusX
+		res.Data["focusY"] = m.FocusY
+	}
+	if resizable(m) {
+		h.addVariants(u, res, m)
+	}
+	res.Data["alt"] = m.Alt
+	res.Data["caption"] = m.Caption
+	res.Data["owner"] = m.Owner
+	res.Data["created"] = m.Created
+	res.Data["version"] = m.Version
+	return res
+}
+
+// mediaRepresentation is media with the requests that can be made on it
+func (h *Handler) mediaRepresentation(u urls, m *models.SQLMedia) representation {
+	res := h.mediaResource(u, m)
+	addMediaTemplates(u, res, m)
+	return representation{resource: res, version: m.Version}
+}
+
+// mediaConflict responds to a change which lost the race with another, with
+// the media as it is now
+func (h *Handler) mediaConflict(w http.ResponseWriter, r *http.Request, id int) {
+	m := models.NewSQLMedia(id, h.dbFor(r))
+	if !m.Exists() {
+		ErrorHandler(w, r)
+		return
+	}
+	write(w, r, http.StatusPreconditionFailed, h.mediaRepresentation(h.urls(r), m))
+}
+
+// mediaItem finds the media named by the route
+func (h *Handler) mediaItem(w http.ResponseWriter, r *http.Request) (*models.SQLMedia, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["media"])
+	if err != nil {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	m := models.NewSQLMedia(id, h.dbFor(r))
+	if !m.Exists() {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	return m, true
+}
+
+// requireMediaOwner authenticates the request as the user who uploaded
+// media or an admin, responding with an error and returning false otherwise
+func (h *Handler) requireMediaOwner(w http.ResponseWriter, r *http.Request, m *models.SQLMedia) bool {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return false
+	}
+	if user == nil {
+		unauthorized(w, r)
+		return false
+	}
+	if user.ID != m.OwnerID && !user.HasRole("admin") {
+		writeError(w, r, http.StatusForbidden, "Only the user who uploaded a file or an admin may change it")
+		return false
+	}
+	return true
+}
+
+// referencedMedia returns the ids of the media an article's body links to
+func referencedMedia(body string) []int {
+	seen := make(map[int]bool)
+	var ids []int
+	for _, match := range mediaReference.FindAllStringSubmatch(body, -1) {
+		id, err := strconv.Atoi(match[1])
+		if err != nil || seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	sort.Ints(ids)
+	return ids
+}
+
+// MediaListHandler handles requests for a page of the media library, newest
+// first
+func (h *Handler) MediaListHandler(w http.ResponseWriter, r *http.Request) {
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 || perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	items, total := models.MediaList((page-1)*perPage, perPage, h.dbFor(r))
+	pages := (total + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	u := h.urls(r)
+	base := u.href("library")
+	pageHref := func(n int) string {
+		return fmt.Sprintf("%s?page=%d&per_page=%d", base, n, perPage)
+	}
+
+	root := u.document(pageHref(page))
+	root.AddLink("first", &haljson.Link{Href: pageHref(1)})
+	root.AddLink("last", &haljson.Link{Href: pageHref(pages)})
+	if page > 1 {
+		root.AddLink("prev", &haljson.Link{Href: pageHref(page - 1)})
+	}
+	if page < pages {
+		root.AddLink("next", &haljson.Link{Href: pageHref(page + 1)})
+	}
+
+	root.Data["page"] = page
+	root.Data["pages"] = pages
+	root.Data["total"] = total
+
+	for _, m := range items {
+		root.AddEmbed("media", h.mediaResource(u, m))
+	}
+	addTemplate(root, "default", &halTemplate{
+		Title:       "Upload",
+		Method:      http.MethodPost,
+		ContentType: "multipart/form-data",
+		Target:      u.href("upload-media"),
+		Properties: []halProperty{
+			{Name: "file", Prompt: "File", Type: "file", Required: true},
+			{Name: "alt", Prompt: "Alt text, describing an image to those who can't see it", Type: "text"},
+			{Name: "caption", Prompt: "Caption", Type: "text"},
+		},
+	})
+
+	respondList(w, r, http.StatusOK, root, "media")
+}
+
+// UploadMediaHandler handles files uploaded to the media library, sent as
+// multipart/form-data with the file in the file field and optionally alt
+// and caption fields. The type of the file is sniffed from its contents,
+// whatever it was sent as.
+func (h *Handler) UploadMediaHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return
+	}
+	if user == nil {
+		unauthorized(w, r)
+		return
+	}
+	if h.store == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "Media isn't being stored")
+		return
+	}
+
+	tooLarge := fmt.Sprintf("Files may be at most %d bytes", h.library.MaxSize)
+	if r.ContentLength > h.uploadLimit() {
+		writeError(w, r, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, h.uploadLimit())
+	if err := r.ParseMultipartForm(multipartOverhead); err != nil {
+		writeError(w, r, http.StatusBadRequest, "Uploads must be sent as multipart/form-data")
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Uploads need a file in the file field")
+		return
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, h.library.MaxSize+1))
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "The file could not be read")
+		return
+	}
+	if int64(len(data)) > h.library.MaxSize {
+		writeError(w, r, http.StatusRequestEntityTooLarge, tooLarge)
+		return
+	}
+	if len(data) == 0 {
+		writeError(w, r, http.StatusUnprocessableEntity, "The file is empty")
+		return
+	}
+	contentType, ok := media.Sniff(data)
+	if !ok {
+		writeError(w, r, http.StatusUnsupportedMediaType, "Files must be JPEG, PNG, GIF or WebP images, or PDFs")
+		return
+	}
+	// Images are stored without the metadata which could say where they
+	// were taken or by what
+	data, err = imaging.Clean(data, contentType, h.library.Quality)
+	if err != nil {
+		writeError(w, r, http.StatusUnprocessableEntity, "The image could not be read")
+		return
+	}
+
+	if h.library.Quota > 0 {
+		usage, err := models.MediaUsage(user.ID, h.dbFor(r))
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Failed to check your quota")
+			return
+		}
+		if usage+int64(len(data)) > h.library.Quota {
+			writeError(w, r, http.StatusForbidden, fmt.Sprintf("The file would take you over your quota of %d bytes, of which %d are used", h.library.Quota, usage))
+			return
+		}
+	}
+
+	key, err := media.NewKey(contentType)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to name the file")
+		return
+	}
+	if err := h.store.Put(key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		logger(r).Error("Failed to store media", "key", key, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to store the file")
+		return
+	}
+
+	m := &models.SQLMedia{
+		Db:          h.dbFor(r),
+		Key:         key,
+		Filename:    uploadFilename(header.Filename, key),
+		ContentType: contentType,
+		Size:        int64(len(data)),
+		Alt:         r.FormValue("alt"),
+		Caption:     r.FormValue("caption"),
+		FocusX:      imaging.Center.X,
+		FocusY:      imaging.Center.Y,
+		OwnerID:     user.ID,
+		Owner:       user.Username,
+	}
+	m.Width, m.Height = media.Dimensions(data)
+	if err := m.Save(); err != nil {
+		if err := h.store.Delete(key); err != nil {
+			logger(r).Error("Failed to remove unsaved media", "key", key, "err", err)
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to save the file")
+		return
+	}
+	if h.library.Eager && resizable(m) {
+		h.renderVariants(m, data)
+	}
+
+	rep := h.mediaRepresentation(h.urls(r), m)
+	w.Header().Set("Location", rep.resource.Links.Self.Href)
+	write(w, r, http.StatusCreated, rep)
+}
+
+// uploadFilename returns the name a file was uploaded with, without any
+// directories, or its key when it had none
+func uploadFilename(name, key string) string {
+	name = path.Base(strings.Replace(name, `\`, "/", -1))
+	if name == "." || name == "/" {
+		return key
+	}
+	if len(name) > maxFilename {
+		name = name[:maxFilename]
+	}
+	return name
+}
+
+// MediaHandler handles requests for what is known about a file in the media
+// library
+func (h *Handler) MediaHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.mediaItem(w, r)
+	if !ok {
+		return
+	}
+	write(w, r, http.StatusOK, h.mediaRepresentation(h.urls(r), m))
+}
+
+// MediaFileHandler serves a file in the media library. Files are never
+// changed once uploaded, so are tagged by their key.
+func (h *Handler) MediaFileHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.mediaItem(w, r)
+	if !ok {
+		return
+	}
+	if h.store == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "Media isn't being stored")
+		return
+	}
+
+	h.serveStored(w, r, m.Key, m.ContentType, m.Size, m.Filename, m.Created)
+}
+
+// serveStored serves a file from storage, tagged by its key as files are
+// never changed once stored
+func (h *Handler) serveStored(w http.ResponseWriter, r *http.Request, key, contentType string, size int64, filename string, created *time.Time) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if notModified(w, r, `"`+key+`"`, lastModified(created)) {
+		return
+	}
+
+	file, err := h.store.Open(key)
+	if err != nil {
+		logger(r).Error("Failed to open media", "key", key, "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to read the file")
+		return
+	}
+	defer file.Close()
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(size, 10))
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("inline", map[string]string{"filename": filename}))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, file); err != nil {
+		logger(r).Warn("Failed to send media", "key", key, "err", err)
+	}
+}
+
+// EditMediaHandler handles changes to the alt text and caption of a file and
+// the focus of an image. Moving the focus drops the variants rendered around
+// the old one.
+func (h *Handler) EditMediaHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.mediaItem(w, r)
+	if !ok {
+		return
+	}
+	if !h.requireMediaOwner(w, r, m) {
+		return
+	}
+	u := h.urls(r)
+	if !ifMatch(w, r, m.Version, h.mediaRepresentation(u, m)) {
+		return
+	}
+
+	var req mediaRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.Alt != nil {
+		m.Alt = *req.Alt
+	}
+	if req.Caption != nil {
+		m.Caption = *req.Caption
+	}
+	focus := imaging.Focus{X: m.FocusX, Y: m.FocusY}
+	if req.FocusX != nil {
+		m.FocusX = *req.FocusX
+	}
+	if req.FocusY != nil {
+		m.FocusY = *req.FocusY
+	}
+	if m.FocusX < 0 || m.FocusX > 1 || m.FocusY < 0 || m.FocusY > 1 {
+		writeError(w, r, http.StatusUnprocessableEntity, "focusX and focusY must be from 0 to 1")
+		return
+	}
+
+	if err := m.Save(); err != nil {
+		if err == models.ErrConflict {
+			h.mediaConflict(w, r, m.ID)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to save the file")
+		return
+	}
+	if focus != (imaging.Focus{X: m.FocusX, Y: m.FocusY}) {
+		h.dropVariants(m)
+	}
+	write(w, r, http.StatusOK, h.mediaRepresentation(u, m))
+}
+
+// DeleteMediaHandler handles removal of a file from the media library and
+// from storage
+func (h *Handler) DeleteMediaHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.mediaItem(w, r)
+	if !ok {
+		return
+	}
+	if !h.requireMediaOwner(w, r, m) {
+		return
+	}
+	if !ifMatch(w, r, m.Version, h.mediaRepresentation(h.urls(r), m)) {
+		return
+	}
+	// The rows of the variants go with the media, so their files are found
+	// first
+	variants := models.VariantList(m.ID, h.dbFor(r))
+	if err := m.Delete(); err != nil {
+		if err == models.ErrConflict {
+			h.mediaConflict(w, r, m.ID)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to delete the file")
+		return
+	}
+	if h.store != nil {
+		if err := h.store.Delete(m.Key); err != nil {
+			logger(r).Error("Failed to remove deleted media from storage", "key", m.Key, "err", err)
+		}
+		for _, v := range variants {
+			h.removeStored(v.Key)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
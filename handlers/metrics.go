@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/metrics"
+)
+
+// httpMetrics are the metrics of the requests served
+type httpMetrics struct {
+	registry *metrics.Registry
+	token    string
+	requests *metrics.Counter
+	duration *metrics.Histogram
+	size     *metrics.Histogram
+}
+
+// SetMetrics registers the metrics of the requests served with registry,
+// which is served at /metrics to scrapes sending token as a bearer token, or
+// to every scrape when token is empty
+func (h *Handler) SetMetrics(registry *metrics.Registry, token string) {
+	h.meters = &httpMetrics{
+		registry: registry,
+		token:    token,
+		requests: registry.Counter("blog_http_requests_total", "Requests served, by route template, method and status.", "route", "method", "status"),
+		duration: registry.Histogram("blog_http_request_duration_seconds", "Time taken to serve requests, by route template and method.", metrics.DurationBuckets, "route", "method"),
+		size:     registry.Histogram("blog_http_response_size_bytes", "Size of response bodies, by route template and method.", metrics.SizeBuckets, "route", "method"),
+	}
+}
+
+// meteredWriter records the status and size of a response
+type meteredWriter struct {
+	http.ResponseWriter
+	status int
+	size   int
+}
+
+func (m *meteredWriter) WriteHeader(status int) {
+	m.status = status
+	m.ResponseWriter.WriteHeader(status)
+}
+
+func (m *meteredWriter) Write(b []byte) (int, error) {
+	n, err := m.ResponseWriter.Write(b)
+	m.size += n
+	return n, err
+}
+
+// Metrics is middleware recording the count, latency and response size of
+// requests by the template of their route, so requests for every article
+// are counted together
+func (h *Handler) Metrics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if h.meters == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		start := time.Now()
+		mw := &meteredWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(mw, r)
+
+		route := "unmatched"
+		if current := mux.CurrentRoute(r); current != nil {
+			if template, err := current.GetPathTemplate(); err == nil {
+				route = template
+			}
+		}
+		method := metricMethod(r.Method)
+		h.meters.requests.Inc(route, method, strconv.Itoa(mw.status))
+		h.meters.duration.Observe(time.Since(start).Seconds(), route, method)
+		h.meters.size.Observe(float64(mw.size), route, method)
+	})
+}
+
+// metricMethod returns the method requests are counted under. Methods
+// clients make up are counted together, so they can't add series without
+// bound.
+func metricMethod(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodOptions, http.MethodConnect, http.MethodTrace:
+		return method
+	}
+	return "other"
+}
+
+// MetricsHandler serves metrics in the Prometheus text format
+func (h *Handler) MetricsHandler(w http.ResponseWriter, r *http.Request) {
+	if h.meters == nil {
+		ErrorHandler(w, r)
+		return
+	}
+	if h.meters.token != "" {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(token), []byte(h.meters.token)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="metrics"`)
+			writeError(w, r, http.StatusUnauthorized, "Scrapes need the metrics token")
+			return
+		}
+	}
+	h.meters.registry.ServeHTTP(w, r)
+}
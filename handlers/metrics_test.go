@@ -0,0 +1,21 @@
+package handlers
+
+import "testing"
+
+func TestMetricMethod(t *testing.T) {
+	tests := []struct {
+		method, want string
+	}{
+		{"GET", "GET"},
+		{"POST", "POST"},
+		{"OPTIONS", "OPTIONS"},
+		{"get", "other"},
+		{"BREW", "other"},
+		{"", "other"},
+	}
+	for _, test := range tests {
+		if got := metricMethod(test.method); got != test.want {
+			t.Errorf("metricMethod(%q) = %q, want %q", test.method, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,229 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/haljson"
+)
+
+// moderationRequest is the body accepted when moderating comments, IDs is
+// only used for bulk actions
+type moderationRequest struct {
+	State string `json:"state"`
+	IDs   []int  `json:"ids"`
+}
+
+// canModerate reports whether user may review the moderation queue
+func canModerate(user *models.SQLUser) bool {
+	return user != nil && (user.HasRole("admin") || user.HasRole("moderator"))
+}
+
+// requireModerator authenticates the request as a moderator, responding with an
+// error and returning false otherwise
+func (h *Handler) requireModerator(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return false
+	}
+	if user == nil {
+		unauthorized(w, r)
+		return false
+	}
+	if !canModerate(user) {
+		writeError(w, r, http.StatusForbidden, "Only moderators may moderate comments")
+		return false
+	}
+	return true
+}
+
+// queuedCommentResource builds the moderator's view of a comment, which
+// includes what readers never see
+func queuedCommentResource(u urls, c *models.SQLComment) *haljson.Resource {
+	res := u.resource(u.href("moderate-comment", "comment", strconv.Itoa(c.ID)))
+	link(res, "article", &haljson.Link{Href: u.href("article", "id", c.ArticleSlug)})
+	if c.ParentID != 0 {
+		res.AddLink("up", &haljson.Link{Href: u.href("comment", "id", c.ArticleSlug, "comment", strconv.Itoa(c.ParentID))})
+	}
+
+	res.Data["id"] = c.ID
+	res.Data["state"] = c.State
+	res.Data["author"] = c.DisplayName()
+	res.Data["anonymous"] = c.Anonymous()
+	res.Data["email"] = c.Email
+	res.Data["body"] = c.Body
+	res.Data["created"] = c.Created
+	res.Data["spamScore"] = c.SpamScore
+	res.Data["version"] = c.Version
+	return res
+}
+
+// moderationRepresentation is a comment awaiting moderation with the
+// decision that can be made on it
+func moderationRepresentation(u urls, c *models.SQLComment) representation {
+	res := queuedCommentResource(u, c)
+	addModerationTemplate(u, res, c)
+	return representation{resource: res, version: c.Version}
+}
+
+// decide applies a moderation decision to a comment
+func (h *Handler) decide(c *models.SQLComment, state string) error {
+	if h.moderator != nil {
+		return h.moderator.Decide(c, state)
+	}
+	return c.SetState(state)
+}
+
+// ModerationQueueHandler handles requests for comments in a moderation state,
+// pending by default
+func (h *Handler) ModerationQueueHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireModerator(w, r) {
+		return
+	}
+
+	state := r.URL.Query().Get("state")
+	if state == "" {
+		state = models.StatePending
+	}
+	if !models.ValidState(state) {
+		writeError(w, r, http.StatusBadRequest, "Unknown moderation state")
+		return
+	}
+
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 || perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	comments, total := models.CommentQueue(state, (page-1)*perPage, perPage, h.dbFor(r))
+	pages := (total + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	u := h.urls(r)
+	base := u.href("moderation")
+	pageHref := func(n int) string {
+		return fmt.Sprintf("%s?state=%s&page=%d&per_page=%d", base, state, n, perPage)
+	}
+
+	root := u.document(pageHref(page))
+	root.AddLink("first", &haljson.Link{Href: pageHref(1)})
+	root.AddLink("last", &haljson.Link{Href: pageHref(pages)})
+	if page > 1 {
+		root.AddLink("prev", &haljson.Link{Href: pageHref(page - 1)})
+	}
+	if page < pages {
+		root.AddLink("next", &haljson.Link{Href: pageHref(page + 1)})
+	}
+
+	root.Data["state"] = state
+	root.Data["page"] = page
+	root.Data["pages"] = pages
+	root.Data["total"] = total
+
+	for _, c := range comments {
+		root.AddEmbed("comments", queuedCommentResource(u, c))
+	}
+	addTemplate(root, "default", &halTemplate{
+		Title:  "Moderate",
+		Method: http.MethodPost,
+		Target: u.href("bulk-moderate"),
+		Properties: []halProperty{
+			{Name: "state", Prompt: "State", Required: true, Options: stateOptions()},
+			{Name: "ids", Prompt: "IDs of the comments", Required: true},
+		},
+	})
+
+	respond(w, r, http.StatusOK, root)
+}
+
+// ModerateCommentHandler handles a moderator's decision on a single comment
+func (h *Handler) ModerateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireModerator(w, r) {
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["comment"])
+	if err != nil {
+		ErrorHandler(w, r)
+		return
+	}
+	c := models.NewSQLComment(id, h.dbFor(r))
+	if !c.Exists() {
+		ErrorHandler(w, r)
+		return
+	}
+	u := h.urls(r)
+	if !ifMatch(w, r, c.Version, moderationRepresentation(u, c)) {
+		return
+	}
+
+	var req moderationRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if !models.ValidState(req.State) {
+		writeError(w, r, http.StatusUnprocessableEntity, "Unknown moderation state")
+		return
+	}
+
+	if err := h.decide(c, req.State); err != nil {
+		if err == models.ErrValidation {
+			writeError(w, r, http.StatusConflict, "Deleted comments can't be restored")
+			return
+		}
+		if err == models.ErrConflict {
+			write(w, r, http.StatusPreconditionFailed, moderationRepresentation(u, models.NewSQLComment(id, h.dbFor(r))))
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to moderate comment")
+		return
+	}
+
+	write(w, r, http.StatusOK, moderationRepresentation(u, c))
+}
+
+// BulkModerateHandler handles a moderator's decision on many comments at once
+func (h *Handler) BulkModerateHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireModerator(w, r) {
+		return
+	}
+
+	var req moderationRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if !models.ValidState(req.State) {
+		writeError(w, r, http.StatusUnprocessableEntity, "Unknown moderation state")
+		return
+	}
+
+	updated := []int{}
+	failed := []int{}
+	for _, id := range req.IDs {
+		c := models.NewSQLComment(id, h.dbFor(r))
+		if !c.Exists() || h.decide(c, req.State) != nil {
+			failed = append(failed, id)
+			continue
+		}
+		updated = append(updated, id)
+	}
+
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
+	link(root, "moderation", &haljson.Link{Href: u.href("moderation")})
+	root.Data["state"] = req.State
+	root.Data["updated"] = updated
+	root.Data["failed"] = failed
+
+	respond(w, r, http.StatusOK, root)
+}
@@ -0,0 +1,981 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/feed"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/openapi"
+	"github.com/mattgen88/blog/sitemap"
+)
+
+// apiVersion is the version of the API given in its description
+const apiVersion = "1.0.0"
+
+// Security requirements of operations
+var (
+	requiresAuth = []map[string][]string{{"basicAuth": {}}}
+	optionalAuth = []map[string][]string{{}, {"basicAuth": {}}}
+)
+
+// OpenAPIHandler serves the OpenAPI description of every route
+func (h *Handler) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc, report, err := Describe(h.r, h.site)
+	if err != nil {
+		logger(r).Error("Failed to describe the API", "err", err)
+		writeError(w, r, http.StatusInternalServerError, "Failed to describe the API")
+		return
+	}
+	if len(report.Missing) > 0 {
+		logger(r).Warn("Routes missing from the API description", "routes", report.Missing)
+	}
+
+	body, err := json.Marshal(doc)
+	if err != nil {
+		logger(r).Error("Failed to encode the API description", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if notModified(w, r, etag(body), time.Time{}) {
+		return
+	}
+	w.Write(body)
+}
+
+// Describe returns the OpenAPI description of the routes of r, reporting
+// routes that have no operation described for them
+func Describe(r *mux.Router, site Site) (*openapi.Document, openapi.Report, error) {
+	doc := &openapi.Document{
+		OpenAPI: openapi.Version,
+		Info: openapi.Info{
+			Title:       site.Title,
+			Version:     apiVersion,
+			Description: site.Description,
+		},
+		Tags: []openapi.Tag{
+			{Name: "articles", Description: "Articles, their categories and authors"},
+			{Name: "comments", Description: "Threaded comments on articles"},
+			{Name: "moderation", Description: "Moderating comments, for moderators and admins"},
+			{Name: "webhooks", Description: "Webhook subscriptions and their deliveries, for admins"},
+			{Name: "media", Description: "The media library of uploaded files"},
+			{Name: "search", Description: "Full text search over articles"},
+			{Name: "feeds", Description: "Feeds, sitemaps and robots.txt"},
+			{Name: "graphql", Description: "The GraphQL endpoint"},
+			{Name: "health", Description: "Liveness and readiness checks and metrics, for operators"},
+		},
+		Components: components(),
+	}
+	// The root is at the prefix the router is mounted under
+	prefix := strings.TrimSuffix(urls{router: r}.href("root"), "/")
+	if site.BaseURL != "" || prefix != "" {
+		doc.Servers = []openapi.Server{{URL: site.BaseURL + prefix}}
+	}
+
+	report, err := openapi.Build(doc, r, prefix, operations())
+	if err != nil {
+		return nil, report, err
+	}
+
+	// Theme assets are only routed when the theme has any
+	unused := report.Unused[:0]
+	for _, op := range report.Unused {
+		if op != "GET /static/{path}" {
+			unused = append(unused, op)
+		}
+	}
+	report.Unused = unused
+	return doc, report, nil
+}
+
+// Helpers building schemas
+func object(props map[string]openapi.Schema, required ...string) openapi.Schema {
+	s := openapi.Schema{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
+
+func array(items openapi.Schema) openapi.Schema {
+	return openapi.Schema{"type": "array", "items": items}
+}
+
+func str(description string) openapi.Schema {
+	s := openapi.Schema{"type": "string"}
+	if description != "" {
+		s["description"] = description
+	}
+	return s
+}
+
+var (
+	integer  = openapi.Schema{"type": "integer"}
+	number   = openapi.Schema{"type": "number"}
+	boolean  = openapi.Schema{"type": "boolean"}
+	dateTime = openapi.Schema{"type": "string", "format": "date-time"}
+	// version is incremented by every change, and is the first part of the
+	// ETag given to If-Match
+	version = openapi.Schema{"type": "integer", "description": "Incremented by every change"}
+)
+
+// nullable allows null in place of a schema
+func nullable(s openapi.Schema) openapi.Schema {
+	return openapi.Schema{"oneOf": []openapi.Schema{s, {"type": "null"}}}
+}
+
+// hal describes a HAL resource with the given properties and embedded
+// resources, by relation
+func hal(props map[string]openapi.Schema, embedded map[string]string) openapi.Schema {
+	s := openapi.Schema{
+		"allOf": []openapi.Schema{openapi.Ref("Resource"), object(props)},
+	}
+	if len(embedded) > 0 {
+		rels := make(map[string]openapi.Schema)
+		for rel, schema := range embedded {
+			rels[rel] = array(openapi.Ref(schema))
+		}
+		s["allOf"] = append(s["allOf"].([]openapi.Schema), object(map[string]openapi.Schema{
+			"_embedded": object(rels),
+		}))
+	}
+	return s
+}
+
+// paging are the properties of pages of a collection
+var paging = map[string]openapi.Schema{
+	"page":  integer,
+	"pages": integer,
+	"total": integer,
+}
+
+func withPaging(props map[string]openapi.Schema) map[string]openapi.Schema {
+	for k, v := range paging {
+		props[k] = v
+	}
+	return props
+}
+
+// components returns the schemas, responses and security schemes operations
+// refer to
+func components() openapi.Components {
+	states := []interface{}{models.StatePending, models.StateApproved, models.StateSpam, models.StateDeleted}
+	var events []interface{}
+	for _, e := range models.WebhookEvents {
+		events = append(events, e)
+	}
+
+	link := object(map[string]openapi.Schema{
+		"href":      str(""),
+		"templated": boolean,
+		"title":     str(""),
+		"type":      str(""),
+	}, "href")
+
+	schemas := map[string]openapi.Schema{
+		"Link": link,
+		"Curie": object(map[string]openapi.Schema{
+			"name":      str("Prefix of the relations"),
+			"href":      str("Template of the documentation of the relations"),
+			"templated": boolean,
+		}, "name", "href"),
+		"Resource": object(map[string]openapi.Schema{
+			"_links": {
+				"type": "object",
+				"properties": map[string]openapi.Schema{
+					"self":   openapi.Ref("Link"),
+					"curies": array(openapi.Ref("Curie")),
+				},
+				"additionalProperties": array(openapi.Ref("Link")),
+				"description":          "Links by relation. The blog's own relations are prefixed with blog: and documented at /rels/{rel}.",
+			},
+			"_embedded": {
+				"type":                 "object",
+				"additionalProperties": array(openapi.Ref("Resource")),
+			},
+			"_templates": {
+				"type":                 "object",
+				"additionalProperties": openapi.Ref("Template"),
+				"description":          "HAL-FORMS templates of the requests that can be made, the first named default. Only at the top level of a document.",
+			},
+		}),
+		"Template": object(map[string]openapi.Schema{
+			"title":       str(""),
+			"method":      str(""),
+			"contentType": str(""),
+			"target":      str(""),
+			"properties": array(object(map[string]openapi.Schema{
+				"name":      str(""),
+				"prompt":    str(""),
+				"type":      str(""),
+				"required":  boolean,
+				"value":     {},
+				"maxLength": integer,
+				"options": object(map[string]openapi.Schema{
+					"inline":   array(str("")),
+					"minItems": integer,
+					"maxItems": integer,
+				}),
+			}, "name")),
+		}, "method", "properties"),
+		"Relation": hal(map[string]openapi.Schema{
+			"name":        str(""),
+			"title":       str(""),
+			"description": str(""),
+			"methods":     array(str("")),
+		}, nil),
+		"Error": hal(map[string]openapi.Schema{
+			"message": str("What went wrong"),
+		}, nil),
+		"JSONAPIDocument": {
+			"type":        "object",
+			"description": "The resource as a JSON:API document, with its type and id taken from its self link",
+			"properties": map[string]openapi.Schema{
+				"data":     {},
+				"included": array(openapi.Schema{"type": "object"}),
+				"errors":   array(object(map[string]openapi.Schema{"status": str(""), "title": str("")})),
+				"meta":     openapi.Schema{"type": "object"},
+				"links":    openapi.Schema{"type": "object", "additionalProperties": str("")},
+			},
+		},
+		"Root": hal(nil, nil),
+
+		"ArticleSummary": hal(map[string]openapi.Schema{
+			"title":       str(""),
+			"author":      str("Username of the author"),
+			"date":        dateTime,
+			"category":    str(""),
+			"slug":        str(""),
+			"description": str("The beginning of the body"),
+		}, nil),
+		"ArticleList": hal(nil, map[string]string{"articles": "ArticleSummary"}),
+		"Article": hal(map[string]openapi.Schema{
+			"title":    str(""),
+			"body":     str("Markdown"),
+			"author":   str("Username of the author"),
+			"date":     dateTime,
+			"category": str(""),
+			"slug":     str(""),
+			"tags":     array(str("")),
+			"article":  openapi.Schema{"type": "object", "description": "The article as stored"},
+		}, map[string]string{"media": "Media"}),
+
+		"CategorySummary": hal(map[string]openapi.Schema{"name": str("")}, nil),
+		"CategoryList": hal(map[string]openapi.Schema{
+			"categories": array(openapi.Schema{"type": "object"}),
+		}, map[string]string{"categories": "CategorySummary"}),
+		"Category": hal(map[string]openapi.Schema{"id": integer}, map[string]string{"articles": "ArticleSummary"}),
+		"Tag":      hal(map[string]openapi.Schema{"name": str("")}, map[string]string{"articles": "ArticleSummary"}),
+
+		"User":     hal(map[string]openapi.Schema{"username": str("")}, nil),
+		"UserList": hal(nil, map[string]string{"users": "User"}),
+
+		"Comment": hal(map[string]openapi.Schema{
+			"id":      integer,
+			"state":   openapi.Schema{"type": "string", "enum": states},
+			"created": dateTime,
+			"updated": dateTime,
+			"replies": openapi.Schema{"type": "integer", "description": "How many replies are embedded"},
+			"version": version,
+			"author":  str("Display name, left out of deleted comments"),
+			"body":    str("Markdown, left out of deleted comments"),
+			"html":    str("The body rendered, left out of deleted comments"),
+		}, map[string]string{"replies": "Comment"}),
+		"CommentPage": hal(withPaging(map[string]openapi.Schema{}), map[string]string{"comments": "Comment"}),
+		"CommentRequest": object(map[string]openapi.Schema{
+			"body":    str("Markdown"),
+			"parent":  openapi.Schema{"type": "integer", "description": "The comment replied to"},
+			"name":    str("Required for anonymous comments"),
+			"email":   openapi.Schema{"type": "string", "format": "email", "description": "Required for anonymous comments, never shown"},
+			"website": str("Left empty by people, comments filling it in are spam"),
+		}, "body"),
+
+		"QueuedComment": hal(map[string]openapi.Schema{
+			"id":        integer,
+			"state":     openapi.Schema{"type": "string", "enum": states},
+			"author":    str(""),
+			"anonymous": boolean,
+			"email":     str(""),
+			"body":      str(""),
+			"created":   dateTime,
+			"spamScore": number,
+			"version":   version,
+		}, nil),
+		"ModerationQueue": hal(withPaging(map[string]openapi.Schema{
+			"state": openapi.Schema{"type": "string", "enum": states},
+		}), map[string]string{"comments": "QueuedComment"}),
+		"ModerationRequest": object(map[string]openapi.Schema{
+			"state": openapi.Schema{"type": "string", "enum": states},
+			"ids":   openapi.Schema{"type": "array", "items": integer, "description": "Comments to moderate, only in bulk"},
+		}, "state"),
+		"ModerationResult": hal(map[string]openapi.Schema{
+			"state":   openapi.Schema{"type": "string", "enum": states},
+			"updated": array(integer),
+			"failed":  array(integer),
+		}, nil),
+
+		"Webhook": hal(map[string]openapi.Schema{
+			"id":      integer,
+			"url":     openapi.Schema{"type": "string", "format": "uri"},
+			"events":  array(openapi.Schema{"type": "string", "enum": events}),
+			"active":  boolean,
+			"created": dateTime,
+			"secret":  str("Only returned when the webhook is created"),
+			"version": version,
+		}, nil),
+		"WebhookList": hal(map[string]openapi.Schema{
+			"events": array(str("")),
+		}, map[string]string{"webhooks": "Webhook"}),
+		"WebhookRequest": object(map[string]openapi.Schema{
+			"url":    openapi.Schema{"type": "string", "format": "uri"},
+			"secret": str("Generated when left out of a new webhook"),
+			"events": array(openapi.Schema{"type": "string", "enum": events}),
+			"active": boolean,
+		}),
+		"Delivery": hal(map[string]openapi.Schema{
+			"id":             integer,
+			"event":          str(""),
+			"payload":        str("The JSON body posted"),
+			"state":          openapi.Schema{"type": "string", "enum": []interface{}{models.DeliveryPending, models.DeliveryDelivered, models.DeliveryFailed}},
+			"attempts":       integer,
+			"created":        dateTime,
+			"nextAttempt":    dateTime,
+			"responseStatus": integer,
+			"error":          str(""),
+			"delivered":      dateTime,
+		}, nil),
+		"DeliveryPage": hal(withPaging(map[string]openapi.Schema{}), map[string]string{"deliveries": "Delivery"}),
+
+		"Media": hal(map[string]openapi.Schema{
+			"id":          integer,
+			"filename":    str("The name the file was uploaded with"),
+			"contentType": str("Sniffed from the file"),
+			"size":        integer,
+			"width":       openapi.Schema{"type": "integer", "description": "Left out of files which aren't images of a known format"},
+			"height":      openapi.Schema{"type": "integer", "description": "Left out of files which aren't images of a known format"},
+			"focusX":      openapi.Schema{"type": "number", "description": "Where crops of an image are centred across, from 0 at the left to 1 at the right"},
+			"focusY":      openapi.Schema{"type": "number", "description": "Where crops of an image are centred down, from 0 at the top to 1 at the bottom"},
+			"variants": array(object(map[string]openapi.Schema{
+				"name":   str(""),
+				"href":   str(""),
+				"width":  integer,
+				"height": integer,
+			})),
+			"srcset":  str("The variants keeping the aspect of the image, for the srcset of an img element"),
+			"alt":     str(""),
+			"caption": str(""),
+			"owner":   str("Username of the uploader"),
+			"created": dateTime,
+			"version": version,
+		}, nil),
+		"MediaPage": hal(withPaging(map[string]openapi.Schema{}), map[string]string{"media": "Media"}),
+		"MediaUpload": object(map[string]openapi.Schema{
+			"file":    openapi.Schema{"type": "string", "format": "binary"},
+			"alt":     str(""),
+			"caption": str(""),
+		}),
+		"MediaRequest": object(map[string]openapi.Schema{
+			"alt":     str(""),
+			"caption": str(""),
+			"focusX":  openapi.Schema{"type": "number", "minimum": 0, "maximum": 1},
+			"focusY":  openapi.Schema{"type": "number", "minimum": 0, "maximum": 1},
+		}),
+
+		"Health": object(map[string]openapi.Schema{
+			"status": openapi.Schema{"type": "string", "enum": []interface{}{"ok", "unavailable"}},
+			"checks": openapi.Schema{"type": "object", "description": "The result of each check by name, ok when it passed", "additionalProperties": str("")},
+		}),
+
+		"SearchResult": hal(map[string]openapi.Schema{
+			"title":    str(""),
+			"author":   str(""),
+			"date":     dateTime,
+			"category": str(""),
+			"slug":     str(""),
+			"score":    number,
+		}, nil),
+		"SearchResults": hal(map[string]openapi.Schema{
+			"query": str(""),
+			"count": integer,
+		}, map[string]string{"articles": "SearchResult"}),
+		"Suggestions": hal(map[string]openapi.Schema{
+			"query":       str(""),
+			"suggestions": array(str("")),
+		}, nil),
+
+		"GraphQLRequest": object(map[string]openapi.Schema{
+			"query":         str(""),
+			"variables":     openapi.Schema{"type": "object"},
+			"operationName": str(""),
+		}, "query"),
+		"GraphQLResponse": object(map[string]openapi.Schema{
+			"data": nullable(openapi.Schema{"type": "object"}),
+			"errors": array(object(map[string]openapi.Schema{
+				"message": str(""),
+				"path":    array(str("")),
+			}, "message")),
+		}),
+	}
+
+	errorResponse := func(description string) *openapi.Response {
+		return &openapi.Response{Description: description, Content: apiContent("Error")}
+	}
+	return openapi.Components{
+		Schemas: schemas,
+		Responses: map[string]*openapi.Response{
+			"BadRequest":          errorResponse("The request is malformed"),
+			"Unauthorized":        errorResponse("Authentication is required, or failed"),
+			"Forbidden":           errorResponse("The user may not do this"),
+			"NotFound":            errorResponse("The resource doesn't exist"),
+			"Conflict":            errorResponse("The change conflicts with the state of the resource"),
+			"UnprocessableEntity": errorResponse("The request body is not valid"),
+			"ServiceUnavailable":  errorResponse("The service needed is not running"),
+			"PreconditionFailed": {
+				Description: "The resource has changed since the ETag given, the body is the resource as it is now",
+				Content:     apiContent("Resource"),
+			},
+			"PreconditionRequired": errorResponse("Changes must be made with If-Match"),
+			"PayloadTooLarge":      errorResponse("The file is larger than uploads may be"),
+			"UnsupportedMediaType": errorResponse("Files of the type uploaded aren't accepted"),
+			"NotModified": {
+				Description: "The client's copy, named by If-None-Match or dated by If-Modified-Since, is current",
+			},
+			"NotAcceptable": {
+				Description: "None of the representations asked for are available",
+				Content:     map[string]openapi.MediaType{"text/plain": {Schema: str("")}},
+			},
+		},
+		SecuritySchemes: map[string]openapi.SecurityScheme{
+			"basicAuth": {Type: "http", Scheme: "basic", Description: "Username and password of a blog user"},
+		},
+	}
+}
+
+// apiContent offers a schema in each of the API representations
+func apiContent(schema string) map[string]openapi.MediaType {
+	return map[string]openapi.MediaType{
+		mediaHAL:      {Schema: openapi.Ref(schema)},
+		mediaHALForms: {Schema: openapi.Ref(schema)},
+		mediaJSON:     {Schema: openapi.Schema{"type": "object", "description": "The HAL representation without links, with embedded resources as properties"}},
+		mediaJSONAPI:  {Schema: openapi.Ref("JSONAPIDocument")},
+	}
+}
+
+// ok is a successful response with a schema in the API representations,
+// and an HTML page when page is set
+func ok(description, schema string, page bool) *openapi.Response {
+	res := &openapi.Response{Description: description, Content: apiContent(schema)}
+	if page {
+		res.Content[mediaHTML] = openapi.MediaType{Schema: str("")}
+	}
+	return res
+}
+
+// responses merges a successful response with references to the error
+// responses in the components
+func responses(status string, res *openapi.Response, errors ...string) map[string]*openapi.Response {
+	out := map[string]*openapi.Response{status: res}
+	codes := map[string]string{
+		"NotModified":          "304",
+		"BadRequest":           "400",
+		"Unauthorized":         "401",
+		"Forbidden":            "403",
+		"NotFound":             "404",
+		"NotAcceptable":        "406",
+		"Conflict":             "409",
+		"PreconditionFailed":   "412",
+		"PayloadTooLarge":      "413",
+		"UnsupportedMediaType": "415",
+		"UnprocessableEntity":  "422",
+		"PreconditionRequired": "428",
+		"ServiceUnavailable":   "503",
+	}
+	for _, name := range append(errors, "NotAcceptable") {
+		out[codes[name]] = openapi.ResponseRef(name)
+	}
+	return out
+}
+
+// jsonBody is a required JSON request body
+func jsonBody(schema string) *openapi.RequestBody {
+	return &openapi.RequestBody{
+		Required: true,
+		Content:  map[string]openapi.MediaType{mediaJSON: {Schema: openapi.Ref(schema)}},
+	}
+}
+
+func query(name, description string, schema openapi.Schema) openapi.Parameter {
+	return openapi.Parameter{Name: name, In: "query", Description: description, Schema: schema}
+}
+
+// idempotencyKey makes a POST safe to retry
+var idempotencyKey = openapi.Parameter{
+	Name:        "Idempotency-Key",
+	In:          "header",
+	Description: "A unique key for the request. Retries sent with the same key are answered with the response to the first, and the key can't be reused for a different request. Ignored on requests made without credentials.",
+	Schema:      str(""),
+}
+
+// ifMatchHeader is the header changes to a resource are made with
+var ifMatchHeader = openapi.Parameter{
+	Name:        "If-Match",
+	In:          "header",
+	Required:    true,
+	Description: "The ETag of the resource, or its version in quotes",
+	Schema:      str(""),
+}
+
+var pageParams = []openapi.Parameter{
+	query("page", "Page to return, from 1", integer),
+	query("per_page", "Items on each page, at most 100", integer),
+}
+
+// feedResponse describes a feed in the format named by the route
+func feedResponse() map[string]*openapi.Response {
+	return map[string]*openapi.Response{
+		"200": {
+			Description: "The feed in the format of the extension",
+			Content: map[string]openapi.MediaType{
+				feed.ContentTypeRSS:  {Schema: str("")},
+				feed.ContentTypeAtom: {Schema: str("")},
+				feed.ContentTypeJSON: {Schema: openapi.Schema{"type": "object"}},
+			},
+		},
+		"304": {Description: "The feed hasn't changed"},
+		"404": {Description: "The category or user doesn't exist"},
+	}
+}
+
+// operations describes every route, by method and path
+func operations() map[string]*openapi.Operation {
+	xml := map[string]openapi.MediaType{sitemap.ContentType: {Schema: str("")}}
+
+	return map[string]*openapi.Operation{
+		"GET /": {
+			Summary:     "API root",
+			Description: "Links to the collections of the API. Browsers get the home page.",
+			Responses:   responses("200", ok("Links to the collections", "Root", true)),
+		},
+		"GET /rels/{rel}": {
+			Summary:    "Documentation of a link relation",
+			Parameters: []openapi.Parameter{{Name: "rel", In: "path", Required: true, Description: "Name of the relation without its blog: prefix", Schema: str("")}},
+			Responses:  responses("200", ok("The relation", "Relation", true), "NotFound"),
+		},
+		"GET /openapi.json": {
+			Summary:   "This description of the API",
+			Responses: map[string]*openapi.Response{"200": {Description: "The OpenAPI document", Content: map[string]openapi.MediaType{mediaJSON: {Schema: openapi.Schema{"type": "object"}}}}},
+		},
+
+		"GET /articles": {
+			Summary:   "List articles",
+			Tags:      []string{"articles"},
+			Responses: responses("200", ok("Every article, newest first", "ArticleList", true), "NotModified"),
+		},
+		"GET /articles/{id}": {
+			Summary:     "Get an article",
+			Description: "Also available as text/markdown with YAML front matter.",
+			Tags:        []string{"articles"},
+			Parameters:  []openapi.Parameter{{Name: "id", In: "path", Required: true, Description: "Slug of the article", Schema: str("")}},
+			Responses: func() map[string]*openapi.Response {
+				res := ok("The article", "Article", true)
+				res.Content[mediaMarkdown] = openapi.MediaType{Schema: str("")}
+				return responses("200", res, "NotModified", "NotFound")
+			}(),
+		},
+		"GET /categories": {
+			Summary:   "List categories",
+			Tags:      []string{"articles"},
+			Responses: responses("200", ok("Every category", "CategoryList", false), "NotModified"),
+		},
+		"GET /categories/{category}": {
+			Summary:   "Get a category and its articles",
+			Tags:      []string{"articles"},
+			Responses: responses("200", ok("The category", "Category", true), "NotModified", "NotFound"),
+		},
+		"GET /tags/{tag}": {
+			Summary:   "Get the articles with a tag",
+			Tags:      []string{"articles"},
+			Responses: responses("200", ok("The tag", "Tag", true), "NotModified", "NotFound"),
+		},
+		"GET /users": {
+			Summary:   "List users",
+			Tags:      []string{"articles"},
+			Responses: responses("200", ok("Every user", "UserList", false)),
+		},
+		"GET /users/{id}": {
+			Summary:    "Get a user",
+			Tags:       []string{"articles"},
+			Parameters: []openapi.Parameter{{Name: "id", In: "path", Required: true, Description: "Username", Schema: str("")}},
+			Responses:  responses("200", ok("The user", "User", true), "NotFound"),
+		},
+
+		"GET /articles/{id}/comments": {
+			Summary:    "List the comments on an article",
+			Tags:       []string{"comments"},
+			Parameters: pageParams,
+			Responses:  responses("200", ok("A page of comment threads, oldest first", "CommentPage", false), "NotFound"),
+		},
+		"POST /articles/{id}/comments": {
+			Summary:     "Comment on an article",
+			Description: "Anonymous comments need a name and email when they are allowed. New comments may be held for moderation.",
+			Tags:        []string{"comments"},
+			Parameters:  []openapi.Parameter{idempotencyKey},
+			Security:    optionalAuth,
+			RequestBody: jsonBody("CommentRequest"),
+			Responses:   responses("201", ok("The comment", "Comment", false), "BadRequest", "Unauthorized", "NotFound", "Conflict", "UnprocessableEntity"),
+		},
+		"GET /articles/{id}/comments/{comment}": {
+			Summary:   "Get a comment and its replies",
+			Tags:      []string{"comments"},
+			Responses: responses("200", ok("The comment", "Comment", false), "NotFound"),
+		},
+		"PUT /articles/{id}/comments/{comment}": {
+			Summary:     "Edit a comment",
+			Description: "Authors may edit their own comments, moderators any comment.",
+			Tags:        []string{"comments"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("CommentRequest"),
+			Responses:   responses("200", ok("The comment", "Comment", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "UnprocessableEntity", "PreconditionRequired"),
+		},
+		"PATCH /articles/{id}/comments/{comment}": {
+			Summary:     "Edit a comment",
+			Description: "The same as PUT.",
+			Tags:        []string{"comments"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("CommentRequest"),
+			Responses:   responses("200", ok("The comment", "Comment", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "UnprocessableEntity", "PreconditionRequired"),
+		},
+		"DELETE /articles/{id}/comments/{comment}": {
+			Summary:     "Delete a comment",
+			Description: "Deleted comments with replies remain, without their author and body, to hold the thread together.",
+			Tags:        []string{"comments"},
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			Security:    requiresAuth,
+			Responses: map[string]*openapi.Response{
+				"204": {Description: "The comment was deleted"},
+				"401": openapi.ResponseRef("Unauthorized"),
+				"403": openapi.ResponseRef("Forbidden"),
+				"404": openapi.ResponseRef("NotFound"),
+				"412": openapi.ResponseRef("PreconditionFailed"),
+				"428": openapi.ResponseRef("PreconditionRequired"),
+			},
+		},
+
+		"GET /moderation/comments": {
+			Summary:  "List comments awaiting moderation",
+			Tags:     []string{"moderation"},
+			Security: requiresAuth,
+			Parameters: append([]openapi.Parameter{
+				query("state", "State of the comments to list, pending by default", openapi.Schema{"type": "string", "enum": []interface{}{models.StatePending, models.StateApproved, models.StateSpam, models.StateDeleted}}),
+			}, pageParams...),
+			Responses: responses("200", ok("A page of comments, oldest first", "ModerationQueue", false), "BadRequest", "Unauthorized", "Forbidden"),
+		},
+		"POST /moderation/comments": {
+			Summary:     "Moderate comments in bulk",
+			Tags:        []string{"moderation"},
+			Parameters:  []openapi.Parameter{idempotencyKey},
+			Security:    requiresAuth,
+			RequestBody: jsonBody("ModerationRequest"),
+			Responses:   responses("200", ok("Which comments were moderated", "ModerationResult", false), "BadRequest", "Unauthorized", "Forbidden", "Conflict", "UnprocessableEntity"),
+		},
+		"PUT /moderation/comments/{comment}": {
+			Summary:     "Moderate a comment",
+			Tags:        []string{"moderation"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("ModerationRequest"),
+			Responses:   responses("200", ok("The comment", "QueuedComment", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "Conflict", "UnprocessableEntity", "PreconditionRequired"),
+		},
+		"PATCH /moderation/comments/{comment}": {
+			Summary:     "Moderate a comment",
+			Description: "The same as PUT.",
+			Tags:        []string{"moderation"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("ModerationRequest"),
+			Responses:   responses("200", ok("The comment", "QueuedComment", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "Conflict", "UnprocessableEntity", "PreconditionRequired"),
+		},
+
+		"GET /webhooks": {
+			Summary:   "List webhooks",
+			Tags:      []string{"webhooks"},
+			Security:  requiresAuth,
+			Responses: responses("200", ok("Every webhook and the events they may subscribe to", "WebhookList", false), "Unauthorized", "Forbidden"),
+		},
+		"POST /webhooks": {
+			Summary:     "Subscribe a webhook",
+			Description: "The response is the only time the secret deliveries are signed with is shown.",
+			Tags:        []string{"webhooks"},
+			Parameters:  []openapi.Parameter{idempotencyKey},
+			Security:    requiresAuth,
+			RequestBody: jsonBody("WebhookRequest"),
+			Responses:   responses("201", ok("The webhook", "Webhook", false), "BadRequest", "Unauthorized", "Forbidden", "Conflict", "UnprocessableEntity"),
+		},
+		"GET /webhooks/{webhook}": {
+			Summary:   "Get a webhook",
+			Tags:      []string{"webhooks"},
+			Security:  requiresAuth,
+			Responses: responses("200", ok("The webhook", "Webhook", false), "Unauthorized", "Forbidden", "NotFound"),
+		},
+		"PUT /webhooks/{webhook}": {
+			Summary:     "Change a webhook",
+			Description: "Fields left out are unchanged.",
+			Tags:        []string{"webhooks"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("WebhookRequest"),
+			Responses:   responses("200", ok("The webhook", "Webhook", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "UnprocessableEntity", "PreconditionRequired"),
+		},
+		"PATCH /webhooks/{webhook}": {
+			Summary:     "Change a webhook",
+			Description: "The same as PUT.",
+			Tags:        []string{"webhooks"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("WebhookRequest"),
+			Responses:   responses("200", ok("The webhook", "Webhook", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "UnprocessableEntity", "PreconditionRequired"),
+		},
+		"DELETE /webhooks/{webhook}": {
+			Summary:    "Delete a webhook and its delivery log",
+			Tags:       []string{"webhooks"},
+			Parameters: []openapi.Parameter{ifMatchHeader},
+			Security:   requiresAuth,
+			Responses: map[string]*openapi.Response{
+				"204": {Description: "The webhook was deleted"},
+				"401": openapi.ResponseRef("Unauthorized"),
+				"403": openapi.ResponseRef("Forbidden"),
+				"404": openapi.ResponseRef("NotFound"),
+				"412": openapi.ResponseRef("PreconditionFailed"),
+				"428": openapi.ResponseRef("PreconditionRequired"),
+			},
+		},
+		"POST /webhooks/{webhook}/test": {
+			Summary:    "Send a ping to a webhook",
+			Tags:       []string{"webhooks"},
+			Parameters: []openapi.Parameter{idempotencyKey},
+			Security:   requiresAuth,
+			Responses:  responses("202", ok("The queued delivery", "Delivery", false), "Unauthorized", "Forbidden", "NotFound", "Conflict", "UnprocessableEntity", "ServiceUnavailable"),
+		},
+		"GET /webhooks/{webhook}/deliveries": {
+			Summary:    "List the deliveries to a webhook",
+			Tags:       []string{"webhooks"},
+			Security:   requiresAuth,
+			Parameters: pageParams,
+			Responses:  responses("200", ok("A page of deliveries, newest first", "DeliveryPage", false), "Unauthorized", "Forbidden", "NotFound"),
+		},
+		"GET /webhooks/{webhook}/deliveries/{delivery}": {
+			Summary:   "Get a delivery",
+			Tags:      []string{"webhooks"},
+			Security:  requiresAuth,
+			Responses: responses("200", ok("The delivery", "Delivery", false), "Unauthorized", "Forbidden", "NotFound"),
+		},
+		"POST /webhooks/{webhook}/deliveries/{delivery}/redeliver": {
+			Summary:    "Send a delivery again",
+			Tags:       []string{"webhooks"},
+			Parameters: []openapi.Parameter{idempotencyKey},
+			Security:   requiresAuth,
+			Responses:  responses("202", ok("The new delivery", "Delivery", false), "Unauthorized", "Forbidden", "NotFound", "Conflict", "UnprocessableEntity", "ServiceUnavailable"),
+		},
+
+		"GET /search": {
+			Summary: "Search articles",
+			Tags:    []string{"search"},
+			Parameters: []openapi.Parameter{
+				query("q", "What to search for", str("")),
+				query("limit", "Most results to return", integer),
+				query("prefix", "Match the last word as a prefix", boolean),
+				query("fuzzy", "Match words with typos, true by default", boolean),
+			},
+			Responses: responses("200", ok("The best matching articles", "SearchResults", false)),
+		},
+		"GET /search/suggest": {
+			Summary:    "Suggest searches",
+			Tags:       []string{"search"},
+			Parameters: []openapi.Parameter{query("q", "What has been typed so far", str(""))},
+			Responses:  responses("200", ok("Completions of the query", "Suggestions", false)),
+		},
+
+		"GET /graphql": {
+			Summary:     "Execute a GraphQL query",
+			Description: "Queries are limited in depth and complexity.",
+			Tags:        []string{"graphql"},
+			Parameters: []openapi.Parameter{
+				{Name: "query", In: "query", Required: true, Schema: str("")},
+				query("variables", "Variables as a JSON object", str("")),
+				query("operationName", "Operation to execute", str("")),
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The result", Content: map[string]openapi.MediaType{mediaJSON: {Schema: openapi.Ref("GraphQLResponse")}}},
+				"400": {Description: "The query is invalid or over the limits", Content: map[string]openapi.MediaType{mediaJSON: {Schema: openapi.Ref("GraphQLResponse")}}},
+			},
+		},
+		"GET /media": {
+			Summary:    "List the media library",
+			Tags:       []string{"media"},
+			Parameters: pageParams,
+			Responses:  responses("200", ok("A page of media, newest first", "MediaPage", false)),
+		},
+		"POST /media": {
+			Summary:     "Upload a file",
+			Description: "JPEG, PNG, GIF and WebP images and PDFs are accepted, whatever type they are sent as. Uploads count toward the quota of the uploader. Metadata such as EXIF and GPS is stripped from images, and JPEGs shot on their side are turned upright.",
+			Tags:        []string{"media"},
+			Parameters:  []openapi.Parameter{idempotencyKey},
+			Security:    requiresAuth,
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content:  map[string]openapi.MediaType{"multipart/form-data": {Schema: openapi.Ref("MediaUpload")}},
+			},
+			Responses: responses("201", ok("The media", "Media", false), "BadRequest", "Unauthorized", "Forbidden", "Conflict", "PayloadTooLarge", "UnsupportedMediaType", "UnprocessableEntity", "ServiceUnavailable"),
+		},
+		"GET /media/{media}": {
+			Summary:   "Get what is known about a file",
+			Tags:      []string{"media"},
+			Responses: responses("200", ok("The media", "Media", false), "NotModified", "NotFound"),
+		},
+		"PUT /media/{media}": {
+			Summary:     "Change the alt text, caption or focus of a file",
+			Description: "Only the uploader or an admin may. Fields left out are unchanged. Moving the focus of an image renders its variants again.",
+			Tags:        []string{"media"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("MediaRequest"),
+			Responses:   responses("200", ok("The media", "Media", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "PreconditionRequired"),
+		},
+		"PATCH /media/{media}": {
+			Summary:     "Change the alt text, caption or focus of a file",
+			Description: "The same as PUT.",
+			Tags:        []string{"media"},
+			Security:    requiresAuth,
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			RequestBody: jsonBody("MediaRequest"),
+			Responses:   responses("200", ok("The media", "Media", false), "BadRequest", "Unauthorized", "Forbidden", "NotFound", "PreconditionFailed", "PreconditionRequired"),
+		},
+		"DELETE /media/{media}": {
+			Summary:     "Delete a file",
+			Description: "Only the uploader or an admin may. Articles showing the file aren't changed.",
+			Tags:        []string{"media"},
+			Parameters:  []openapi.Parameter{ifMatchHeader},
+			Security:    requiresAuth,
+			Responses: map[string]*openapi.Response{
+				"204": {Description: "The file was deleted"},
+				"401": openapi.ResponseRef("Unauthorized"),
+				"403": openapi.ResponseRef("Forbidden"),
+				"404": openapi.ResponseRef("NotFound"),
+				"412": openapi.ResponseRef("PreconditionFailed"),
+				"428": openapi.ResponseRef("PreconditionRequired"),
+			},
+		},
+		"GET /media/{media}/file": {
+			Summary: "Download a file",
+			Tags:    []string{"media"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The file, with the type it was sniffed as", Content: map[string]openapi.MediaType{"*/*": {Schema: openapi.Schema{"type": "string", "format": "binary"}}}},
+				"304": {Description: "The file is unchanged, as files always are"},
+				"404": openapi.ResponseRef("NotFound"),
+			},
+		},
+		"GET /media/{media}/variants/{variant}": {
+			Summary:     "Download a variant of an image",
+			Description: "Variants are rendered on the first request for them unless they were rendered on upload. Those of a fixed aspect are cropped around the focus of the image.",
+			Tags:        []string{"media"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The variant", Content: map[string]openapi.MediaType{
+					"image/jpeg": {Schema: openapi.Schema{"type": "string", "format": "binary"}},
+					"image/png":  {Schema: openapi.Schema{"type": "string", "format": "binary"}},
+				}},
+				"304": {Description: "The variant is unchanged"},
+				"404": openapi.ResponseRef("NotFound"),
+				"503": openapi.ResponseRef("ServiceUnavailable"),
+			},
+		},
+
+		"POST /graphql": {
+			Summary:     "Execute a GraphQL query",
+			Description: "Queries are limited in depth and complexity.",
+			Tags:        []string{"graphql"},
+			RequestBody: &openapi.RequestBody{
+				Required: true,
+				Content: map[string]openapi.MediaType{
+					mediaJSON:             {Schema: openapi.Ref("GraphQLRequest")},
+					"application/graphql": {Schema: str("The query")},
+				},
+			},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The result", Content: map[string]openapi.MediaType{mediaJSON: {Schema: openapi.Ref("GraphQLResponse")}}},
+				"400": {Description: "The query is invalid or over the limits", Content: map[string]openapi.MediaType{mediaJSON: {Schema: openapi.Ref("GraphQLResponse")}}},
+			},
+		},
+
+		"GET /feed.{format}": {
+			Summary:   "Feed of the newest articles",
+			Tags:      []string{"feeds"},
+			Responses: feedResponse(),
+		},
+		"GET /categories/{category}/feed.{format}": {
+			Summary:   "Feed of the newest articles in a category",
+			Tags:      []string{"feeds"},
+			Responses: feedResponse(),
+		},
+		"GET /users/{id}/feed.{format}": {
+			Summary:   "Feed of the newest articles by a user",
+			Tags:      []string{"feeds"},
+			Responses: feedResponse(),
+		},
+		"GET /sitemap.xml": {
+			Summary:   "Sitemap, or sitemap index when the blog has too many pages for one",
+			Tags:      []string{"feeds"},
+			Responses: map[string]*openapi.Response{"200": {Description: "The sitemap", Content: xml}},
+		},
+		"GET /sitemap-{page}.xml": {
+			Summary: "A page of the sitemap",
+			Tags:    []string{"feeds"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The sitemap page", Content: xml},
+				"404": {Description: "There is no such page"},
+			},
+		},
+		"GET /robots.txt": {
+			Summary:   "Rules for crawlers",
+			Tags:      []string{"feeds"},
+			Responses: map[string]*openapi.Response{"200": {Description: "robots.txt", Content: map[string]openapi.MediaType{"text/plain": {Schema: str("")}}}},
+		},
+		"GET /healthz": {
+			Summary:     "Check the server is live",
+			Description: "Checks the database answers and every migration has been applied.",
+			Tags:        []string{"health"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "Every check passed", Content: map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("Health")}}},
+				"503": {Description: "A check failed", Content: map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("Health")}}},
+			},
+		},
+		"GET /readyz": {
+			Summary:     "Check the server is ready for requests",
+			Description: "Checks as /healthz does, and fails once the server begins shutting down.",
+			Tags:        []string{"health"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "Every check passed", Content: map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("Health")}}},
+				"503": {Description: "A check failed", Content: map[string]openapi.MediaType{"application/json": {Schema: openapi.Ref("Health")}}},
+			},
+		},
+		"GET /metrics": {
+			Summary:     "Metrics for Prometheus",
+			Description: "Counts and latencies of requests by route, database pool and query statistics, response cache hit rates and the work of background workers, in the Prometheus text format. Scrapes need the metrics token as a bearer token when one is set.",
+			Tags:        []string{"health"},
+			Responses: map[string]*openapi.Response{
+				"200": {Description: "The metrics", Content: map[string]openapi.MediaType{"text/plain": {Schema: str("")}}},
+				"401": openapi.ResponseRef("Unauthorized"),
+			},
+		},
+		"GET /static/{path}": {
+			Summary:   "Theme assets",
+			Responses: map[string]*openapi.Response{"200": {Description: "The file"}, "404": {Description: "There is no such file"}},
+		},
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/theme"
+	"github.com/mattgen88/blog/util"
+)
+
+// homeArticles is how many of the latest articles the home page shows
+const homeArticles = 10
+
+// page is the data every template is rendered with
+type page struct {
+	Site     Site
+	Articles []*models.SQLArticle
+	Article  *models.SQLArticle
+	Comments []*models.SQLComment
+	Category *models.SQLCategory
+	Tag      string
+	Author   *models.SQLUser
+	Months   []month
+	Relation *relation
+}
+
+// month groups the archive by when articles were published
+type month struct {
+	Name     string
+	Articles []*models.SQLArticle
+}
+
+// SetTheme sets the templates pages are rendered with, nil disables HTML
+func (h *Handler) SetTheme(t *theme.Theme) {
+	h.theme = t
+}
+
+// Negotiate serves the HTML page to clients preferring text/html, and the
+// API representations to everyone else
+func (h *Handler) Negotiate(api, html http.HandlerFunc) http.HandlerFunc {
+	offers := append(append([]string{}, apiMediaTypes...), mediaHTML)
+	return func(w http.ResponseWriter, r *http.Request) {
+		vary(w, "Accept")
+		if h.theme != nil && util.Negotiate(r.Header.Get("Accept"), offers) == mediaHTML {
+			html(w, r)
+			return
+		}
+		api(w, r)
+	}
+}
+
+// render writes a page of the theme
+func (h *Handler) render(w http.ResponseWriter, status int, name string, data *page) {
+	data.Site = h.site
+
+	var buf bytes.Buffer
+	if err := h.theme.Render(&buf, name, data); err != nil {
+		logs.Error("Failed to render page", "page", name, "err", err)
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte("Internal server error\n"))
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+// NotFoundPage handles requests for pages that don't exist
+func (h *Handler) NotFoundPage(w http.ResponseWriter, r *http.Request) {
+	h.render(w, http.StatusNotFound, theme.NotFound, &page{})
+}
+
+// HomePage renders the latest articles
+func (h *Handler) HomePage(w http.ResponseWriter, r *http.Request) {
+	articles := models.ArticleList(h.dbFor(r))
+	if len(articles) > homeArticles {
+		articles = articles[:homeArticles]
+	}
+	h.render(w, http.StatusOK, theme.Home, &page{Articles: articles})
+}
+
+// ArticlePage renders an article with its comments
+func (h *Handler) ArticlePage(w http.ResponseWriter, r *http.Request) {
+	article := models.NewSQLArticle(mux.Vars(r)["id"], h.dbFor(r))
+	if !article.Exists() {
+		h.NotFoundPage(w, r)
+		return
+	}
+	h.render(w, http.StatusOK, theme.Article, &page{
+		Article:  article,
+		Comments: models.CommentList(article.ID, h.dbFor(r)),
+	})
+}
+
+// CategoryPage renders the articles in a category
+func (h *Handler) CategoryPage(w http.ResponseWriter, r *http.Request) {
+	category := models.NewSQLCategory(mux.Vars(r)["category"], h.dbFor(r))
+	if !category.Exists() {
+		h.NotFoundPage(w, r)
+		return
+	}
+	h.render(w, http.StatusOK, theme.Category, &page{
+		Category: category,
+		Articles: models.ArticleListByCategory(category.ID, h.dbFor(r)),
+	})
+}
+
+// TagPage renders the articles with a tag
+func (h *Handler) TagPage(w http.ResponseWriter, r *http.Request) {
+	tag := mux.Vars(r)["tag"]
+	articles := models.ArticleListByTag(tag, h.dbFor(r))
+	if len(articles) == 0 {
+		h.NotFoundPage(w, r)
+		return
+	}
+	h.render(w, http.StatusOK, theme.Tag, &page{Tag: tag, Articles: articles})
+}
+
+// AuthorPage renders the articles written by a user
+func (h *Handler) AuthorPage(w http.ResponseWriter, r *http.Request) {
+	user := models.NewSQLUser(mux.Vars(r)["id"], h.dbFor(r))
+	if !user.Exists() {
+		h.NotFoundPage(w, r)
+		return
+	}
+	h.render(w, http.StatusOK, theme.Author, &page{
+		Author:   user,
+		Articles: models.ArticleListByAuthor(user.Username, h.dbFor(r)),
+	})
+}
+
+// ArchivePage renders every article grouped by the month it was published
+func (h *Handler) ArchivePage(w http.ResponseWriter, r *http.Request) {
+	var months []month
+	for _, article := range models.ArticleList(h.dbFor(r)) {
+		name := "Undated"
+		if article.Date != nil {
+			name = article.Date.Format("January 2006")
+		}
+		if len(months) == 0 || months[len(months)-1].Name != name {
+			months = append(months, month{Name: name})
+		}
+		last := &months[len(months)-1]
+		last.Articles = append(last.Articles, article)
+	}
+	h.render(w, http.StatusOK, theme.Archive, &page{Months: months})
+}
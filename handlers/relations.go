@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/theme"
+	"github.com/mattgen88/haljson"
+)
+
+// curieName prefixes the blog's own link relations, which are documented on
+// the relation route. Registered relations such as self, up and author are
+// used without a prefix.
+const curieName = "blog"
+
+// relation documents one of the blog's link relations
+type relation struct {
+	Name        string
+	Title       string
+	Description string
+	// Methods are those the target of a link of the relation supports
+	Methods []string
+}
+
+// relations are the blog's own link relations by name
+var relations = map[string]*relation{
+	"articles": {
+		Title:       "Articles",
+		Description: "Every article published on the blog, newest first. Each embedded article links to the full article.",
+		Methods:     []string{"GET"},
+	},
+	"article": {
+		Title:       "Article",
+		Description: "An article with its title, author, category, tags and body in Markdown. Templated links take the slug of the article.",
+		Methods:     []string{"GET"},
+	},
+	"categories": {
+		Title:       "Categories",
+		Description: "Every category articles are filed under.",
+		Methods:     []string{"GET"},
+	},
+	"category": {
+		Title:       "Category",
+		Description: "A category and the articles filed under it. Templated links take the name of the category.",
+		Methods:     []string{"GET"},
+	},
+	"tag": {
+		Title:       "Tag",
+		Description: "The articles with a tag, newest first. Templated links take the name of the tag.",
+		Methods:     []string{"GET"},
+	},
+	"users": {
+		Title:       "Users",
+		Description: "Everyone with an account on the blog.",
+		Methods:     []string{"GET"},
+	},
+	"user": {
+		Title:       "User",
+		Description: "A user of the blog. Templated links take the username.",
+		Methods:     []string{"GET"},
+	},
+	"comments": {
+		Title:       "Comments",
+		Description: "The comment threads on an article, a page at a time. Posting to the collection adds a comment, or a reply when it names a parent.",
+		Methods:     []string{"GET", "POST"},
+	},
+	"search": {
+		Title:       "Search",
+		Description: "Full text search over articles. The link is templated with the query q, and optionally the limit on results and whether to match prefixes and typos.",
+		Methods:     []string{"GET"},
+	},
+	"suggest": {
+		Title:       "Search suggestions",
+		Description: "Completions of a partly typed search query. The link is templated with the query q.",
+		Methods:     []string{"GET"},
+	},
+	"moderation": {
+		Title:       "Moderation queue",
+		Description: "Comments awaiting moderation, for moderators. Posting to the queue moderates many comments at once.",
+		Methods:     []string{"GET", "POST"},
+	},
+	"webhooks": {
+		Title:       "Webhooks",
+		Description: "Subscriptions to events on the blog, for admins. Posting to the collection subscribes a new webhook.",
+		Methods:     []string{"GET", "POST"},
+	},
+	"webhook": {
+		Title:       "Webhook",
+		Description: "A webhook subscription, which may be changed or deleted.",
+		Methods:     []string{"GET", "PUT", "PATCH", "DELETE"},
+	},
+	"deliveries": {
+		Title:       "Deliveries",
+		Description: "The log of events delivered to a webhook, newest first.",
+		Methods:     []string{"GET"},
+	},
+	"test": {
+		Title:       "Test webhook",
+		Description: "Posting sends a ping event to the webhook.",
+		Methods:     []string{"POST"},
+	},
+	"redeliver": {
+		Title:       "Redeliver",
+		Description: "Posting sends the payload of a delivery to its webhook again.",
+		Methods:     []string{"POST"},
+	},
+	"library": {
+		Title:       "Media library",
+		Description: "Files uploaded to the blog, such as images, newest first. Posting a file to the collection as multipart/form-data uploads it.",
+		Methods:     []string{"GET", "POST"},
+	},
+	"media": {
+		Title:       "Media",
+		Description: "A file in the media library, with its alt text, caption and dimensions. The enclosure link is the file itself. Articles link to and embed the media they show.",
+		Methods:     []string{"GET", "PUT", "PATCH", "DELETE"},
+	},
+	"variant": {
+		Title:       "Image variant",
+		Description: "An image rendered at one of the sizes set up for the blog, titled with the name of the size. Variants with a fixed aspect are cropped around the focus of the image. The srcset of the media lists the variants keeping the aspect of the image.",
+		Methods:     []string{"GET"},
+	},
+	"graphql": {
+		Title:       "GraphQL",
+		Description: "The GraphQL endpoint, which answers queries over articles, categories, users, tags and comments.",
+		Methods:     []string{"GET", "POST"},
+	},
+}
+
+func init() {
+	for name, rel := range relations {
+		rel.Name = name
+	}
+}
+
+// link adds a link of one of the blog's relations to a resource. The curie
+// the relation is prefixed with is declared by the document, so links may be
+// added to embedded resources too.
+func link(res *haljson.Resource, rel string, l *haljson.Link) {
+	rel = curieName + ":" + rel
+	res.Links.Relations[rel] = append(res.Links.Relations[rel], l)
+}
+
+// trimCurie removes the blog's curie from a document which doesn't link
+// with it
+func trimCurie(res *haljson.Resource) {
+	if res.Links != nil && res.Links.Curies != nil && !curied(res) {
+		res.Links.Curies = nil
+	}
+}
+
+// curied reports whether a resource or those embedded in it link with the
+// blog's relations
+func curied(res *haljson.Resource) bool {
+	if res.Links != nil {
+		for rel := range res.Links.Relations {
+			if strings.HasPrefix(rel, curieName+":") {
+				return true
+			}
+		}
+	}
+	if res.Embeds != nil {
+		for _, embeds := range res.Embeds.Relations {
+			for i := range embeds {
+				if curied(&embeds[i]) {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// RelationHandler handles requests for the documentation of a link relation
+func (h *Handler) RelationHandler(w http.ResponseWriter, r *http.Request) {
+	rel, ok := relations[mux.Vars(r)["rel"]]
+	if !ok {
+		ErrorHandler(w, r)
+		return
+	}
+
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
+	root.Data["name"] = rel.Name
+	root.Data["title"] = rel.Title
+	root.Data["description"] = rel.Description
+	root.Data["methods"] = rel.Methods
+
+	respond(w, r, http.StatusOK, root)
+}
+
+// RelationPage renders the documentation of a link relation
+func (h *Handler) RelationPage(w http.ResponseWriter, r *http.Request) {
+	rel, ok := relations[mux.Vars(r)["rel"]]
+	if !ok {
+		h.NotFoundPage(w, r)
+		return
+	}
+	h.render(w, http.StatusOK, theme.Relation, &page{Relation: rel})
+}
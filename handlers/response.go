@@ -0,0 +1,309 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/mattgen88/blog/util"
+	"github.com/mattgen88/haljson"
+)
+
+// maxBodySize is the largest request body accepted for writes
+const maxBodySize = 1 << 20
+
+// Media types resources can be represented as
+const (
+	mediaHAL      = "application/hal+json"
+	mediaHALForms = "application/prs.hal-forms+json"
+	mediaJSON     = "application/json"
+	mediaJSONAPI  = "application/vnd.api+json"
+	mediaMarkdown = "text/markdown"
+	mediaHTML     = "text/html"
+)
+
+// apiMediaTypes are offered for every resource, in order of preference.
+// HAL-FORMS documents are HAL documents, which always include their
+// templates.
+var apiMediaTypes = []string{mediaHAL, mediaHALForms, mediaJSON, mediaJSONAPI}
+
+// representation is a resource ready to be written in whichever format the
+// client prefers
+type representation struct {
+	resource *haljson.Resource
+	// items names the embedded relation holding the members of a collection,
+	// empty for single resources
+	items string
+	// markdown renders the resource as text/markdown, nil when it has no
+	// Markdown form
+	markdown func() ([]byte, error)
+	// modified is when the resource last changed, zero when unknown
+	modified time.Time
+	// version is the version of a resource which may be changed, zero for
+	// those which can't. It leads the entity tag so If-Match can be checked.
+	version int
+}
+
+// respond writes a single resource with the given status
+func respond(w http.ResponseWriter, r *http.Request, status int, root *haljson.Resource) {
+	write(w, r, status, representation{resource: root})
+}
+
+// respondList writes a collection whose members are embedded under items
+func respondList(w http.ResponseWriter, r *http.Request, status int, root *haljson.Resource, items string) {
+	write(w, r, status, representation{resource: root, items: items})
+}
+
+// write negotiates the format of a representation and writes it. Clients
+// accepting none of the formats get 406 Not Acceptable, unless the response
+// is an error, which is then sent as HAL anyway. Successful responses carry
+// a strong ETag over the body written, and are answered with 304 Not
+// Modified when the client's copy is current. Every response of a resource
+// with a version carries its ETag.
+func write(w http.ResponseWriter, r *http.Request, status int, rep representation) {
+	offers := apiMediaTypes
+	if rep.markdown != nil {
+		offers = append(offers[:len(offers):len(offers)], mediaMarkdown)
+	}
+
+	vary(w, "Accept")
+	media := util.Negotiate(r.Header.Get("Accept"), offers)
+	if media == "" {
+		if status < http.StatusBadRequest {
+			notAcceptable(w, offers)
+			return
+		}
+		media = mediaHAL
+	}
+
+	var (
+		body []byte
+		err  error
+	)
+	switch media {
+	case mediaJSON:
+		body, err = json.Marshal(plain(rep.resource))
+	case mediaJSONAPI:
+		body, err = json.Marshal(jsonAPI(rep, status))
+	case mediaMarkdown:
+		body, err = rep.markdown()
+		media += "; charset=utf-8"
+	default:
+		trimCurie(rep.resource)
+		body, err = json.Marshal(rep.resource)
+	}
+	if err != nil {
+		logger(r).Error("Failed to encode response", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", media)
+	tag := etag(body)
+	if rep.version > 0 {
+		tag = versionTag(rep.version, body)
+		w.Header().Set("ETag", tag)
+	}
+	if status == http.StatusOK && notModified(w, r, tag, rep.modified) {
+		return
+	}
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// vary adds header to the Vary response header unless already listed
+func vary(w http.ResponseWriter, header string) {
+	for _, v := range w.Header()["Vary"] {
+		for _, name := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(name), header) {
+				return
+			}
+		}
+	}
+	w.Header().Add("Vary", header)
+}
+
+// notAcceptable tells the client which media types it could have asked for
+func notAcceptable(w http.ResponseWriter, offers []string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(http.StatusNotAcceptable)
+	w.Write([]byte("Not Acceptable, available representations are: " + strings.Join(offers, ", ") + "\n"))
+}
+
+// plain converts a HAL resource to plain JSON, dropping links and nesting
+// embedded resources under their relation
+func plain(res *haljson.Resource) map[string]interface{} {
+	out := attributes(res)
+	if res.Embeds != nil {
+		for rel, embeds := range res.Embeds.Relations {
+			items := make([]map[string]interface{}, 0, len(embeds))
+			for i := range embeds {
+				items = append(items, plain(&embeds[i]))
+			}
+			out[rel] = items
+		}
+	}
+	return out
+}
+
+// jsonAPIResource is a JSON:API resource object
+type jsonAPIResource struct {
+	Type          string                         `json:"type"`
+	ID            string                         `json:"id"`
+	Attributes    map[string]interface{}         `json:"attributes,omitempty"`
+	Relationships map[string]jsonAPIRelationship `json:"relationships,omitempty"`
+	Links         map[string]string              `json:"links,omitempty"`
+}
+
+// jsonAPIRelationship lists the identifiers of related resources
+type jsonAPIRelationship struct {
+	Data []jsonAPIIdentifier `json:"data"`
+}
+
+// jsonAPIIdentifier identifies a resource
+type jsonAPIIdentifier struct {
+	Type string `json:"type"`
+	ID   string `json:"id"`
+}
+
+// jsonAPIError is a JSON:API error object
+type jsonAPIError struct {
+	Status string `json:"status"`
+	Title  string `json:"title"`
+}
+
+// jsonAPIDocument is a JSON:API top level document
+type jsonAPIDocument struct {
+	Data     interface{}            `json:"data,omitempty"`
+	Errors   []jsonAPIError         `json:"errors,omitempty"`
+	Included []jsonAPIResource      `json:"included,omitempty"`
+	Meta     map[string]interface{} `json:"meta,omitempty"`
+	Links    map[string]string      `json:"links,omitempty"`
+}
+
+// jsonAPI converts a representation to a JSON:API document. The type and id
+// of each resource are the last two segments of its self link.
+func jsonAPI(rep representation, status int) jsonAPIDocument {
+	res := rep.resource
+	var doc jsonAPIDocument
+
+	// Failed preconditions are answered with the resource as it is
+	if status >= http.StatusBadRequest && status != http.StatusPreconditionFailed {
+		message, _ := res.Data["message"].(string)
+		doc.Errors = []jsonAPIError{{Status: strconv.Itoa(status), Title: message}}
+		return doc
+	}
+
+	doc.Links = jsonAPILinks(res)
+
+	if rep.items != "" {
+		data := []jsonAPIResource{}
+		for i := range res.Embeds.Relations[rep.items] {
+			obj, included := jsonAPIObject(&res.Embeds.Relations[rep.items][i])
+			data = append(data, obj)
+			doc.Included = append(doc.Included, included...)
+		}
+		doc.Data = data
+		doc.Meta = attributes(res)
+		return doc
+	}
+
+	if _, id := identify(res); id == "" {
+		// Resources without an identity, like the API root, only have
+		// links and metadata
+		doc.Meta = attributes(res)
+		return doc
+	}
+
+	obj, included := jsonAPIObject(res)
+	doc.Data = obj
+	doc.Included = included
+	return doc
+}
+
+// jsonAPIObject converts a resource to a resource object, returning the
+// objects of its embedded resources to be included alongside it
+func jsonAPIObject(res *haljson.Resource) (jsonAPIResource, []jsonAPIResource) {
+	typ, id := identify(res)
+	obj := jsonAPIResource{
+		Type:       typ,
+		ID:         id,
+		Attributes: make(map[string]interface{}),
+		Links:      jsonAPILinks(res),
+	}
+	for k, v := range attributes(res) {
+		if k != "id" {
+			obj.Attributes[k] = v
+		}
+	}
+
+	var included []jsonAPIResource
+	if res.Embeds != nil {
+		for rel, embeds := range res.Embeds.Relations {
+			if obj.Relationships == nil {
+				obj.Relationships = make(map[string]jsonAPIRelationship)
+			}
+			rs := jsonAPIRelationship{Data: []jsonAPIIdentifier{}}
+			for i := range embeds {
+				child, more := jsonAPIObject(&embeds[i])
+				rs.Data = append(rs.Data, jsonAPIIdentifier{Type: child.Type, ID: child.ID})
+				included = append(included, child)
+				included = append(included, more...)
+			}
+			obj.Relationships[rel] = rs
+		}
+	}
+	return obj, included
+}
+
+// jsonAPILinks flattens the untemplated HAL links of a resource, dropping
+// the curie from the blog's own relations
+func jsonAPILinks(res *haljson.Resource) map[string]string {
+	links := make(map[string]string)
+	if res.Links == nil {
+		return links
+	}
+	if res.Links.Self != nil {
+		links["self"] = res.Links.Self.Href
+	}
+	for rel, ls := range res.Links.Relations {
+		if len(ls) > 0 && !ls[0].Templated {
+			links[strings.TrimPrefix(rel, curieName+":")] = ls[0].Href
+		}
+	}
+	return links
+}
+
+// identify derives the type and id of a resource from its self link
+func identify(res *haljson.Resource) (string, string) {
+	if res.Links == nil || res.Links.Self == nil {
+		return "", ""
+	}
+	u, err := url.Parse(res.Links.Self.Href)
+	if err != nil {
+		return "", ""
+	}
+	segments := strings.Split(strings.Trim(u.Path, "/"), "/")
+	if len(segments) < 2 {
+		return "", ""
+	}
+	id, err := url.PathUnescape(segments[len(segments)-1])
+	if err != nil {
+		id = segments[len(segments)-1]
+	}
+	return segments[len(segments)-2], id
+}
+
+// decode reads a JSON request body into v, responding with an error and
+// returning false when it can't
+func decode(w http.ResponseWriter, r *http.Request, v interface{}) bool {
+	err := json.NewDecoder(http.MaxBytesReader(w, r.Body, maxBodySize)).Decode(v)
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, "Request body must be valid JSON")
+		return false
+	}
+	return true
+}
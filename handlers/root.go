@@ -1,8 +1,6 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/mattgen88/haljson"
@@ -10,19 +8,21 @@ import (
 
 // RootHandler handles requests for the root of the API
 func (h *Handler) RootHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
+	u := h.urls(r)
+	root := u.document(u.href("root"))
 
-	root.Self("/")
-	root.AddLink("Users", &haljson.Link{Href: "/users"})
-	root.AddLink("User", &haljson.Link{Href: "/users/{user}", Templated: true})
-	root.AddLink("Article", &haljson.Link{Href: "/articles/{id:[a-zA-Z-_]+}", Templated: true})
-	root.AddLink("Articles", &haljson.Link{Href: "/articles"})
-	root.AddLink("Article for Category", &haljson.Link{Href: "/categories/{category}", Templated: true})
-	root.AddLink("Categories", &haljson.Link{Href: "/categories"})
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	w.Write(json)
+	link(root, "articles", &haljson.Link{Href: u.href("articles")})
+	link(root, "article", &haljson.Link{Href: u.template("article"), Templated: true})
+	link(root, "categories", &haljson.Link{Href: u.href("categories")})
+	link(root, "category", &haljson.Link{Href: u.template("category"), Templated: true})
+	link(root, "users", &haljson.Link{Href: u.href("users")})
+	link(root, "user", &haljson.Link{Href: u.template("user"), Templated: true})
+	link(root, "search", &haljson.Link{Href: u.template("search", "q", "limit", "prefix", "fuzzy"), Templated: true})
+	link(root, "suggest", &haljson.Link{Href: u.template("suggest", "q"), Templated: true})
+	link(root, "graphql", &haljson.Link{Href: u.href("graphql")})
+	link(root, "moderation", &haljson.Link{Href: u.href("moderation")})
+	link(root, "webhooks", &haljson.Link{Href: u.href("webhooks")})
+	link(root, "library", &haljson.Link{Href: u.href("library")})
+	root.AddLink("service-desc", &haljson.Link{Href: u.href("openapi")})
+	respond(w, r, http.StatusOK, root)
 }
@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mattgen88/blog/search"
+)
+
+const (
+	searchLimit  = 20
+	suggestLimit = 10
+)
+
+// SearchHandler handles full text searches over articles
+func (h *Handler) SearchHandler(w http.ResponseWriter, r *http.Request) {
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.RequestURI()))
+
+	q := r.URL.Query().Get("q")
+	root.Data["query"] = q
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = searchLimit
+	}
+
+	var results []search.Result
+	if h.index != nil && q != "" {
+		results = h.index.Search(q, search.Options{
+			Limit:  limit,
+			Prefix: r.URL.Query().Get("prefix") == "true",
+			Fuzzy:  r.URL.Query().Get("fuzzy") != "false",
+		})
+	}
+	root.Data["count"] = len(results)
+
+	for _, result := range results {
+
+		embeddedArticle := u.resource(u.href("article", "id", result.Slug))
+		embeddedArticle.Data["title"] = result.Title
+		embeddedArticle.Data["author"] = result.Author
+		embeddedArticle.Data["date"] = result.Date
+		embeddedArticle.Data["category"] = result.Category
+		embeddedArticle.Data["slug"] = result.Slug
+		embeddedArticle.Data["score"] = result.Score
+		root.AddEmbed("articles", embeddedArticle)
+	}
+
+	respondList(w, r, http.StatusOK, root, "articles")
+}
+
+// SuggestHandler handles autocompletion of search queries
+func (h *Handler) SuggestHandler(w http.ResponseWriter, r *http.Request) {
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.RequestURI()))
+
+	q := r.URL.Query().Get("q")
+	root.Data["query"] = q
+
+	suggestions := []string{}
+	if h.index != nil && q != "" {
+		suggestions = append(suggestions, h.index.Suggest(q, suggestLimit)...)
+	}
+	root.Data["suggestions"] = suggestions
+
+	respond(w, r, http.StatusOK, root)
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/sitemap"
+)
+
+// RobotsOptions configures robots.txt
+type RobotsOptions struct {
+	// Disallow lists what crawlers are asked to stay out of: named routes,
+	// up to their first variable, or paths beginning with a slash under the
+	// path the blog is served at
+	Disallow []string
+	// Body replaces the generated robots.txt entirely when set
+	Body string
+}
+
+// SetRobotsOptions configures robots.txt
+func (h *Handler) SetRobotsOptions(opts RobotsOptions) {
+	h.robots = opts
+}
+
+// sitemapGroups are the routes of the pages listing the articles of a
+// category, author or tag, by the group of ArticlesBy, in the order they are
+// listed after the articles
+var sitemapGroups = []struct{ group, route, key string }{
+	{"category", "category", "category"},
+	{"author", "user", "id"},
+	{"tag", "tag", "tag"},
+}
+
+// siteMap is what the sitemaps list: the root, every article, and the
+// categories, authors and tags of articles. Articles are counted here and
+// loaded a page at a time, as there may be too many to hold at once.
+type siteMap struct {
+	articles int
+	latest   time.Time
+	groups   []sitemap.URL
+}
+
+// loadSitemap counts the articles and lists the categories, authors and
+// tags of the sitemaps
+func (h *Handler) loadSitemap(r *http.Request, u urls) (*siteMap, error) {
+	count, latest, err := models.ListedArticleCount(h.dbFor(r))
+	if err != nil {
+		return nil, err
+	}
+	s := &siteMap{articles: count, latest: latest}
+	for _, g := range sitemapGroups {
+		listed, err := models.ListedGroups(g.group, h.dbFor(r))
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range listed {
+			s.groups = append(s.groups, sitemap.URL{Loc: u.href(g.route, g.key, l.Key), LastMod: l.Modified})
+		}
+	}
+	return s, nil
+}
+
+// total returns how many URLs the sitemaps list
+func (s *siteMap) total() int {
+	return 1 + s.articles + len(s.groups)
+}
+
+// span returns what a one-based page of the sitemaps lists: whether it
+// lists the root, the offset and number of the articles on it and the range
+// of the groups on it. The root comes first, then the articles and then the
+// groups.
+func (s *siteMap) span(page int) (root bool, offset, count, from, to int) {
+	start, end := (page-1)*sitemap.MaxURLs, page*sitemap.MaxURLs
+	if end > s.total() {
+		end = s.total()
+	}
+	if start == 0 {
+		root = true
+		start++
+	}
+	articlesEnd := end
+	if articlesEnd > 1+s.articles {
+		articlesEnd = 1 + s.articles
+	}
+	if start < articlesEnd {
+		offset, count = start-1, articlesEnd-start
+		start = articlesEnd
+	}
+	if start < end {
+		from, to = start-1-s.articles, end-1-s.articles
+	}
+	return root, offset, count, from, to
+}
+
+// sitemapPage returns the URLs listed on a one-based page of the sitemaps,
+// loading only the articles on it
+func (h *Handler) sitemapPage(r *http.Request, u urls, s *siteMap, page int) ([]sitemap.URL, error) {
+	root, offset, count, from, to := s.span(page)
+
+	var urls []sitemap.URL
+	if root {
+		urls = append(urls, sitemap.URL{Loc: u.href("root"), LastMod: s.latest})
+	}
+	if count > 0 {
+		listed, err := models.ListedArticles(offset, count, h.dbFor(r))
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range listed {
+			urls = append(urls, sitemap.URL{Loc: u.href("article", "id", l.Key), LastMod: l.Modified})
+		}
+	}
+	return append(urls, s.groups[from:to]...), nil
+}
+
+// SitemapHandler handles requests for sitemap.xml, which becomes an index of
+// numbered sitemaps once there are too many URLs for one
+func (h *Handler) SitemapHandler(w http.ResponseWriter, r *http.Request) {
+	u := h.absoluteURLs(r)
+	s, err := h.loadSitemap(r, u)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load the sitemap")
+		return
+	}
+
+	pages := sitemap.Pages(s.total())
+	if pages == 1 {
+		urls, err := h.sitemapPage(r, u, s, 1)
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Failed to load the sitemap")
+			return
+		}
+		h.writeSitemap(w, r, urls, sitemap.URLSet)
+		return
+	}
+
+	// Articles change more than anything else, so each sitemap is dated by
+	// the latest change to anything, rather than loading every page
+	var sitemaps []sitemap.URL
+	for page := 1; page <= pages; page++ {
+		sitemaps = append(sitemaps, sitemap.URL{
+			Loc:     u.href("sitemap-page", "page", strconv.Itoa(page)),
+			LastMod: s.latest,
+		})
+	}
+	h.writeSitemap(w, r, sitemaps, sitemap.Index)
+}
+
+// SitemapPageHandler handles requests for one of the sitemaps listed in the
+// sitemap index
+func (h *Handler) SitemapPageHandler(w http.ResponseWriter, r *http.Request) {
+	u := h.absoluteURLs(r)
+	s, err := h.loadSitemap(r, u)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load the sitemap")
+		return
+	}
+	page, err := strconv.Atoi(mux.Vars(r)["page"])
+	if err != nil || sitemap.Pages(s.total()) < 2 || page < 1 || page > sitemap.Pages(s.total()) {
+		ErrorHandler(w, r)
+		return
+	}
+	urls, err := h.sitemapPage(r, u, s, page)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to load the sitemap")
+		return
+	}
+	h.writeSitemap(w, r, urls, sitemap.URLSet)
+}
+
+// writeSitemap renders urls with render
+func (h *Handler) writeSitemap(w http.ResponseWriter, r *http.Request, urls []sitemap.URL, render func([]sitemap.URL) ([]byte, error)) {
+	body, err := render(urls)
+	if err != nil {
+		logger(r).Error("Failed to render sitemap", "err", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", sitemap.ContentType)
+	if notModified(w, r, etag(body), sitemap.Latest(urls)) {
+		return
+	}
+	w.Write(body)
+}
+
+// RobotsHandler handles requests for robots.txt
+func (h *Handler) RobotsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+
+	if h.robots.Body != "" {
+		w.Write([]byte(h.robots.Body))
+		return
+	}
+
+	var b strings.Builder
+	b.WriteString("User-agent: *\n")
+	if len(h.robots.Disallow) == 0 {
+		b.WriteString("Disallow:\n")
+	}
+	for _, entry := range h.robots.Disallow {
+		if path := h.paths().disallowed(entry); path != "" {
+			fmt.Fprintf(&b, "Disallow: %s\n", path)
+		}
+	}
+	fmt.Fprintf(&b, "\nSitemap: %s\n", h.absoluteURLs(r).href("sitemap"))
+	w.Write([]byte(b.String()))
+}
+
+// disallowed returns the path robots.txt disallows for an entry of
+// RobotsOptions.Disallow, built from the router so it follows wherever the
+// blog is mounted
+func (u urls) disallowed(entry string) string {
+	if strings.HasPrefix(entry, "/") {
+		return strings.TrimSuffix(u.href("root"), "/") + entry
+	}
+	tpl := u.template(entry)
+	if i := strings.Index(tpl, "{"); i >= 0 {
+		tpl = tpl[:i]
+	}
+	return tpl
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/sitemap"
+)
+
+func TestSitemapSpan(t *testing.T) {
+	type span struct {
+		root                    bool
+		offset, count, from, to int
+	}
+	tests := []struct {
+		name             string
+		articles, groups int
+		page             int
+		want             span
+	}{
+		{"small", 10, 5, 1, span{true, 0, 10, 0, 5}},
+		{"no articles", 0, 2, 1, span{true, 0, 0, 0, 2}},
+		{"empty", 0, 0, 1, span{true, 0, 0, 0, 0}},
+		{"exactly full", 49999, 0, 1, span{true, 0, 49999, 0, 0}},
+		{"first of two", 50000, 3, 1, span{true, 0, 49999, 0, 0}},
+		{"second of two", 50000, 3, 2, span{false, 49999, 1, 0, 3}},
+		{"articles and groups", 100000, 70000, 3, span{false, 99999, 1, 0, 49999}},
+		{"groups only", 100000, 70000, 4, span{false, 0, 0, 49999, 70000}},
+	}
+	for _, test := range tests {
+		s := &siteMap{articles: test.articles, groups: make([]sitemap.URL, test.groups)}
+		var got span
+		got.root, got.offset, got.count, got.from, got.to = s.span(test.page)
+		if got != test.want {
+			t.Errorf("%s: span(%d) = %+v, want %+v", test.name, test.page, got, test.want)
+		}
+	}
+}
+
+func TestSitemapSpansCover(t *testing.T) {
+	tests := []struct {
+		articles, groups int
+	}{
+		{0, 0},
+		{49999, 1},
+		{50000, 0},
+		{123456, 7890},
+		{10, 150000},
+	}
+	for _, test := range tests {
+		s := &siteMap{articles: test.articles, groups: make([]sitemap.URL, test.groups)}
+		roots, articles, groups := 0, 0, 0
+		for page := 1; page <= sitemap.Pages(s.total()); page++ {
+			root, offset, count, from, to := s.span(page)
+			if root {
+				roots++
+			}
+			if count > 0 && offset != articles {
+				t.Errorf("%d articles, %d groups: page %d starts at article %d, want %d", test.articles, test.groups, page, offset, articles)
+			}
+			if to > from && from != groups {
+				t.Errorf("%d articles, %d groups: page %d starts at group %d, want %d", test.articles, test.groups, page, from, groups)
+			}
+			if n := count + to - from; root {
+				n++
+			} else if n > sitemap.MaxURLs {
+				t.Errorf("%d articles, %d groups: page %d lists %d URLs", test.articles, test.groups, page, n)
+			}
+			articles += count
+			groups += to - from
+		}
+		if roots != 1 || articles != test.articles || groups != test.groups {
+			t.Errorf("%d articles, %d groups: listed %d roots, %d articles and %d groups", test.articles, test.groups, roots, articles, groups)
+		}
+	}
+}
+
+func TestDisallowed(t *testing.T) {
+	noop := func(w http.ResponseWriter, r *http.Request) {}
+	tests := []struct {
+		prefix, entry, want string
+	}{
+		{"", "moderation", "/moderation"},
+		{"", "article", "/articles/"},
+		{"", "/drafts/", "/drafts/"},
+		{"/blog", "moderation", "/blog/moderation"},
+		{"/blog", "article", "/blog/articles/"},
+		{"/blog", "/drafts/", "/blog/drafts/"},
+	}
+	for _, test := range tests {
+		r := mux.NewRouter()
+		if test.prefix != "" {
+			r = r.PathPrefix(test.prefix).Subrouter()
+		}
+		r.HandleFunc("/", noop).Name("root")
+		r.HandleFunc("/moderation", noop).Name("moderation")
+		r.HandleFunc("/articles/{id}", noop).Name("article")
+
+		u := urls{router: r}
+		if got := u.disallowed(test.entry); got != test.want {
+			t.Errorf("%s: disallowed(%q) = %q, want %q", test.prefix, test.entry, got, test.want)
+		}
+	}
+}
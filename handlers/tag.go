@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/models"
+)
+
+// TagHandler handles requests for the articles with a tag
+func (h *Handler) TagHandler(w http.ResponseWriter, r *http.Request) {
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
+
+	tag := mux.Vars(r)["tag"]
+	articles := models.ArticleListByTag(tag, h.dbFor(r))
+	if len(articles) == 0 {
+		writeError(w, r, http.StatusNotFound, "No article has the tag")
+		return
+	}
+
+	root.Data["name"] = tag
+	var dates []*time.Time
+	for _, article := range articles {
+		embeddedArticle := u.resource(u.href("article", "id", article.Slug))
+		embeddedArticle.Data["title"] = article.Title
+		embeddedArticle.Data["author"] = article.Author.Username
+		embeddedArticle.Data["date"] = article.Date
+		root.AddEmbed("articles", embeddedArticle)
+		dates = append(dates, article.Date, article.Updated)
+	}
+
+	write(w, r, http.StatusOK, representation{
+		resource: root,
+		modified: lastModified(dates...),
+	})
+}
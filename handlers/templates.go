@@ -0,0 +1,185 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/haljson"
+)
+
+// halTemplate is a HAL-FORMS template, describing a request a client may
+// make on a resource. Templates describe what the API supports rather than
+// what the current user may do, the request may still be refused.
+type halTemplate struct {
+	Title       string        `json:"title,omitempty"`
+	Method      string        `json:"method"`
+	ContentType string        `json:"contentType,omitempty"`
+	Target      string        `json:"target,omitempty"`
+	Properties  []halProperty `json:"properties"`
+}
+
+// halProperty is a field of a HAL-FORMS template
+type halProperty struct {
+	Name      string      `json:"name"`
+	Prompt    string      `json:"prompt,omitempty"`
+	Type      string      `json:"type,omitempty"`
+	Required  bool        `json:"required,omitempty"`
+	Value     interface{} `json:"value,omitempty"`
+	MaxLength int         `json:"maxLength,omitempty"`
+	Options   *halOptions `json:"options,omitempty"`
+}
+
+// halOptions lists the values a property may take
+type halOptions struct {
+	Inline   []string `json:"inline"`
+	MinItems int      `json:"minItems,omitempty"`
+	MaxItems int      `json:"maxItems,omitempty"`
+}
+
+// addTemplate adds a template to a resource. The first template of a
+// resource must be named "default". Templates are only read from the top
+// level of a document, so aren't added to embedded resources.
+func addTemplate(res *haljson.Resource, name string, t *halTemplate) {
+	templates, ok := res.Data["_templates"].(map[string]*halTemplate)
+	if !ok {
+		templates = make(map[string]*halTemplate)
+		res.Data["_templates"] = templates
+	}
+	if t.Properties == nil {
+		t.Properties = []halProperty{}
+	}
+	if t.Method != http.MethodGet && t.Method != http.MethodDelete && len(t.Properties) > 0 && t.ContentType == "" {
+		t.ContentType = mediaJSON
+	}
+	templates[name] = t
+}
+
+// attributes returns the data of a resource without the HAL-FORMS templates,
+// for representations which have no place for them
+func attributes(res *haljson.Resource) map[string]interface{} {
+	out := make(map[string]interface{}, len(res.Data))
+	for k, v := range res.Data {
+		if k != "_templates" {
+			out[k] = v
+		}
+	}
+	return out
+}
+
+// commentTemplate describes posting a comment on an article, or a reply when
+// parent is set
+func (h *Handler) commentTemplate(u urls, slug string, parent int) *halTemplate {
+	t := &halTemplate{
+		Title:  "Comment",
+		Method: http.MethodPost,
+		Target: u.href("create-comment", "id", slug),
+		Properties: []halProperty{
+			{Name: "body", Prompt: "Comment, in Markdown", Type: "textarea", Required: true},
+		},
+	}
+	if parent != 0 {
+		t.Title = "Reply"
+		t.Properties = append(t.Properties, halProperty{Name: "parent", Type: "hidden", Value: parent})
+	}
+	if h.comments.Anonymous {
+		t.Properties = append(t.Properties,
+			halProperty{Name: "name", Prompt: "Name, unless signed in", Type: "text"},
+			halProperty{Name: "email", Prompt: "Email, unless signed in. It is never shown.", Type: "email"},
+		)
+	}
+	return t
+}
+
+// addCommentTemplates adds the requests that can be made on a comment
+func (h *Handler) addCommentTemplates(u urls, res *haljson.Resource, slug string, c *models.SQLComment) {
+	id := strconv.Itoa(c.ID)
+	if c.State == models.StateDeleted {
+		addTemplate(res, "default", h.commentTemplate(u, slug, c.ID))
+		return
+	}
+	addTemplate(res, "default", &halTemplate{
+		Title:  "Edit",
+		Method: http.MethodPut,
+		Target: u.href("edit-comment", "id", slug, "comment", id),
+		Properties: []halProperty{
+			{Name: "body", Prompt: "Comment, in Markdown", Type: "textarea", Required: true, Value: c.Body},
+		},
+	})
+	addTemplate(res, "reply", h.commentTemplate(u, slug, c.ID))
+	addTemplate(res, "delete", &halTemplate{Title: "Delete", Method: http.MethodDelete, Target: u.href("delete-comment", "id", slug, "comment", id)})
+}
+
+// stateOptions offers the moderation states
+func stateOptions() *halOptions {
+	return &halOptions{
+		Inline:   []string{models.StatePending, models.StateApproved, models.StateSpam, models.StateDeleted},
+		MinItems: 1,
+		MaxItems: 1,
+	}
+}
+
+// addModerationTemplate adds moderating a single comment
+func addModerationTemplate(u urls, res *haljson.Resource, c *models.SQLComment) {
+	addTemplate(res, "default", &halTemplate{
+		Title:  "Moderate",
+		Method: http.MethodPut,
+		Target: u.href("moderate-comment", "comment", strconv.Itoa(c.ID)),
+		Properties: []halProperty{
+			{Name: "state", Prompt: "State", Required: true, Value: c.State, Options: stateOptions()},
+		},
+	})
+}
+
+// webhookProperties are the fields of a webhook, with the values of hook
+// when it is set
+func webhookProperties(hook *models.SQLWebhook) []halProperty {
+	props := []halProperty{
+		{Name: "url", Prompt: "URL events are posted to", Type: "url", Required: hook == nil},
+		{Name: "secret", Prompt: "Secret deliveries are signed with, generated when left empty", Type: "text"},
+		{Name: "events", Prompt: "Events", Options: &halOptions{Inline: models.WebhookEvents, MinItems: 1}},
+		{Name: "active", Prompt: "Active", Type: "checkbox"},
+	}
+	if hook != nil {
+		props[0].Value = hook.URL
+		props[1].Prompt = "Secret deliveries are signed with, unchanged when left empty"
+		props[2].Value = hook.Events
+		props[3].Value = hook.Active
+	}
+	return props
+}
+
+// addWebhookTemplates adds the requests that can be made on a webhook
+func addWebhookTemplates(u urls, res *haljson.Resource, hook *models.SQLWebhook) {
+	id := strconv.Itoa(hook.ID)
+	addTemplate(res, "default", &halTemplate{
+		Title:      "Edit",
+		Method:     http.MethodPut,
+		Target:     u.href("edit-webhook", "webhook", id),
+		Properties: webhookProperties(hook),
+	})
+	addTemplate(res, "test", &halTemplate{Title: "Send a ping", Method: http.MethodPost, Target: u.href("test-webhook", "webhook", id)})
+	addTemplate(res, "delete", &halTemplate{Title: "Delete", Method: http.MethodDelete, Target: u.href("delete-webhook", "webhook", id)})
+}
+
+// addMediaTemplates adds the requests that can be made on media
+func addMediaTemplates(u urls, res *haljson.Resource, m *models.SQLMedia) {
+	id := strconv.Itoa(m.ID)
+	edit := &halTemplate{
+		Title:  "Edit",
+		Method: http.MethodPut,
+		Target: u.href("edit-media", "media", id),
+		Properties: []halProperty{
+			{Name: "alt", Prompt: "Alt text, describing an image to those who can't see it", Type: "text", Value: m.Alt},
+			{Name: "caption", Prompt: "Caption", Type: "text", Value: m.Caption},
+		},
+	}
+	if m.Width > 0 && m.Height > 0 {
+		edit.Properties = append(edit.Properties,
+			halProperty{Name: "focusX", Prompt: "Focus across, from 0 at the left to 1 at the right", Type: "number", Value: m.FocusX},
+			halProperty{Name: "focusY", Prompt: "Focus down, from 0 at the top to 1 at the bottom", Type: "number", Value: m.FocusY},
+		)
+	}
+	addTemplate(res, "default", edit)
+	addTemplate(res, "delete", &halTemplate{Title: "Delete", Method: http.MethodDelete, Target: u.href("delete-media", "media", id)})
+}
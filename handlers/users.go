@@ -1,26 +1,21 @@
 package handlers
 
 import (
-	"encoding/json"
-	"log"
 	"net/http"
 
 	"github.com/gorilla/mux"
-
-	"github.com/mattgen88/haljson"
 )
 
 // UsersListHandler handles requests for users
 func (h *Handler) UsersListHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
-
-	root.Self(r.URL.Path)
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
 
-	rows, err := h.db.Query(`SELECT Username
+	rows, err := h.dbFor(r).Query(`SELECT Username
 		FROM Users`)
 
 	if err != nil {
-		log.Println(err)
+		logger(r).Error("Error querying for users", "err", err)
 	}
 
 	defer rows.Close()
@@ -28,38 +23,25 @@ func (h *Handler) UsersListHandler(w http.ResponseWriter, r *http.Request) {
 	for rows.Next() {
 		var username string
 		if scanErr := rows.Scan(&username); scanErr != nil {
-			log.Println(scanErr)
+			logger(r).Error("Failed to scan user", "err", scanErr)
 			continue
 		}
 
-		href := "/users/" + username
-
-		embeddedUser := haljson.NewResource()
-		embeddedUser.Self(href)
+		embeddedUser := u.resource(u.href("user", "id", username))
 		embeddedUser.Data["username"] = username
 		root.AddEmbed("users", embeddedUser)
 
 	}
 
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	w.Write(json)
+	respondList(w, r, http.StatusOK, root, "users")
 }
 
 // UserHandler handles requests for users
 func (h *Handler) UserHandler(w http.ResponseWriter, r *http.Request) {
-	root := haljson.NewResource()
-	root.Self(r.URL.Path)
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
 
 	root.Data["username"] = mux.Vars(r)["id"]
 
-	json, err := json.Marshal(root)
-	if err != nil {
-		log.Println(err)
-		return
-	}
-	w.Write(json)
+	respond(w, r, http.StatusOK, root)
 }
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/imaging"
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/haljson"
+)
+
+// resizable reports whether variants can be rendered of media. WebP images
+// are kept as they were uploaded, as there is nothing to decode them with.
+func resizable(m *models.SQLMedia) bool {
+	switch m.ContentType {
+	case "image/jpeg", "image/png", "image/gif":
+		return m.Width > 0 && m.Height > 0
+	}
+	return false
+}
+
+// variant returns the size set up with the given name
+func (h *Handler) variant(name string) (imaging.Variant, bool) {
+	for _, v := range h.library.Variants {
+		if v.Name == name {
+			return v, true
+		}
+	}
+	return imaging.Variant{}, false
+}
+
+// addVariants links to the variants of an image and describes their sizes,
+// with those keeping the aspect of the image gathered into a srcset
+func (h *Handler) addVariants(u urls, res *haljson.Resource, m *models.SQLMedia) {
+	id := strconv.Itoa(m.ID)
+	variants := []map[string]interface{}{}
+	var srcset []string
+	widths := make(map[int]bool)
+	for _, v := range h.library.Variants {
+		href := u.href("media-variant", "media", id, "variant", v.Name)
+		width, height := imaging.Size(v, m.Width, m.Height)
+		name := v.Name
+		link(res, "variant", &haljson.Link{Href: href, Title: &name})
+		variants = append(variants, map[string]interface{}{
+			"name":   v.Name,
+			"href":   href,
+			"width":  width,
+			"height": height,
+		})
+		// Variants narrower than they are set up for are as large as the
+		// image, so only the first of the same width is a candidate
+		if v.Height == 0 && !widths[width] {
+			widths[width] = true
+			srcset = append(srcset, href+" "+strconv.Itoa(width)+"w")
+		}
+	}
+	res.Data["variants"] = variants
+	res.Data["srcset"] = strings.Join(srcset, ", ")
+}
+
+// variantKey returns the key a variant of media is stored under, beside the
+// key of the media. The version of the media is part of it so a variant
+// rendered after the focus is moved never has the key of one before.
+func variantKey(m *models.SQLMedia, v imaging.Variant, contentType string) string {
+	base := strings.TrimSuffix(m.Key, path.Ext(m.Key))
+	return "variants/" + base + "/" + v.Name + "-" + v.Spec() + "-" + strconv.Itoa(m.Version) + media.Types[contentType]
+}
+
+// variantFilename returns the name a variant is served with, after the name
+// of the file it was rendered from
+func variantFilename(m *models.SQLMedia, v *models.SQLVariant) string {
+	base := strings.TrimSuffix(m.Filename, path.Ext(m.Filename))
+	return base + "-" + v.Name + media.Types[v.ContentType]
+}
+
+// original reads and decodes the file of an image
+func (h *Handler) original(m *models.SQLMedia) (image.Image, error) {
+	file, err := h.store.Open(m.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	data, err := ioutil.ReadAll(io.LimitReader(file, m.Size))
+	if err != nil {
+		return nil, err
+	}
+	return imaging.Decode(data)
+}
+
+// renderVariant renders a variant of an image around its focus, storing it
+// and saving it to the database
+func (h *Handler) renderVariant(m *models.SQLMedia, v imaging.Variant, img image.Image) (*models.SQLVariant, error) {
+	out := imaging.Render(img, v, imaging.Focus{X: m.FocusX, Y: m.FocusY})
+	data, contentType, err := imaging.Encode(out, h.library.Format, h.library.Quality)
+	if err != nil {
+		return nil, err
+	}
+
+	key := variantKey(m, v, contentType)
+	if err := h.store.Put(key, bytes.NewReader(data), int64(len(data)), contentType); err != nil {
+		return nil, err
+	}
+	rendered := &models.SQLVariant{
+		MediaID:     m.ID,
+		Name:        v.Name,
+		Spec:        v.Spec(),
+		Key:         key,
+		ContentType: contentType,
+		Width:       out.Bounds().Dx(),
+		Height:      out.Bounds().Dy(),
+		Size:        int64(len(data)),
+		Db:          m.Db,
+	}
+	if err := rendered.Save(); err != nil {
+		h.removeStored(key)
+		return nil, err
+	}
+	return rendered, nil
+}
+
+// renderVariants renders every variant of an image just uploaded. Those
+// which fail are rendered again when they are first requested.
+func (h *Handler) renderVariants(m *models.SQLMedia, data []byte) {
+	img, err := imaging.Decode(data)
+	if err != nil {
+		logs.Error("Failed to decode image for variants", "media", m.ID, "err", err)
+		return
+	}
+	for _, v := range h.library.Variants {
+		if _, err := h.renderVariant(m, v, img); err != nil {
+			logs.Error("Failed to render variant", "media", m.ID, "variant", v.Name, "err", err)
+		}
+	}
+}
+
+// dropVariants deletes the variants of media and their files, so they are
+// rendered again
+func (h *Handler) dropVariants(m *models.SQLMedia) {
+	variants, err := models.DeleteVariants(m.ID, m.Db)
+	if err != nil {
+		return
+	}
+	for _, v := range variants {
+		h.removeStored(v.Key)
+	}
+}
+
+// removeStored removes a file from storage which is no longer needed
+func (h *Handler) removeStored(key string) {
+	if h.store == nil {
+		return
+	}
+	if err := h.store.Delete(key); err != nil {
+		logs.Error("Failed to remove media from storage", "key", key, "err", err)
+	}
+}
+
+// MediaVariantHandler serves a variant of an image in the media library,
+// rendering it on the first request for it or when its size has been
+// changed since it was rendered
+func (h *Handler) MediaVariantHandler(w http.ResponseWriter, r *http.Request) {
+	m, ok := h.mediaItem(w, r)
+	if !ok {
+		return
+	}
+	v, ok := h.variant(mux.Vars(r)["variant"])
+	if !ok || !resizable(m) {
+		ErrorHandler(w, r)
+		return
+	}
+	if h.store == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "Media isn't being stored")
+		return
+	}
+
+	rendered := models.NewSQLVariant(m.ID, v.Name, h.dbFor(r))
+	if !rendered.Exists() || rendered.Spec != v.Spec() {
+		img, err := h.original(m)
+		if err != nil {
+			logger(r).Error("Failed to read image for variant", "media", m.ID, "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Failed to read the image")
+			return
+		}
+		fresh, err := h.renderVariant(m, v, img)
+		if err != nil {
+			logger(r).Error("Failed to render variant", "media", m.ID, "variant", v.Name, "err", err)
+			writeError(w, r, http.StatusInternalServerError, "Failed to render the variant")
+			return
+		}
+		if rendered.Exists() && rendered.Key != fresh.Key {
+			h.removeStored(rendered.Key)
+		}
+		rendered = fresh
+	}
+	h.serveStored(w, r, rendered.Key, rendered.ContentType, rendered.Size, variantFilename(m, rendered), rendered.Created)
+}
@@ -0,0 +1,439 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/webhooks"
+	"github.com/mattgen88/haljson"
+)
+
+// webhookRequest is the body accepted when creating or changing a webhook,
+// fields left out are unchanged
+type webhookRequest struct {
+	URL    *string  `json:"url"`
+	Secret *string  `json:"secret"`
+	Events []string `json:"events"`
+	Active *bool    `json:"active"`
+}
+
+// SetWebhooks sets the dispatcher delivering webhooks
+func (h *Handler) SetWebhooks(d *webhooks.Dispatcher) {
+	h.webhooks = d
+}
+
+// requireAdmin authenticates the request as an admin, responding with an
+// error and returning false otherwise
+func (h *Handler) requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	user, ok := h.authenticate(w, r)
+	if !ok {
+		return false
+	}
+	if user == nil {
+		unauthorized(w, r)
+		return false
+	}
+	if !user.HasRole("admin") {
+		writeError(w, r, http.StatusForbidden, "Only admins may manage webhooks")
+		return false
+	}
+	return true
+}
+
+// webhookResource builds the representation of a webhook, which never
+// includes its secret
+func webhookResource(u urls, hook *models.SQLWebhook) *haljson.Resource {
+	id := strconv.Itoa(hook.ID)
+	res := u.resource(u.href("webhook", "webhook", id))
+	link(res, "deliveries", &haljson.Link{Href: u.href("deliveries", "webhook", id)})
+	link(res, "test", &haljson.Link{Href: u.href("test-webhook", "webhook", id)})
+
+	res.Data["id"] = hook.ID
+	res.Data["url"] = hook.URL
+	res.Data["events"] = hook.Events
+	res.Data["active"] = hook.Active
+	res.Data["version"] = hook.Version
+	res.Data["created"] = hook.Created
+	return res
+}
+
+// deliveryResource builds the representation of a delivery
+func deliveryResource(u urls, d *models.SQLDelivery) *haljson.Resource {
+	webhook, id := strconv.Itoa(d.WebhookID), strconv.Itoa(d.ID)
+	res := u.resource(u.href("delivery", "webhook", webhook, "delivery", id))
+	link(res, "webhook", &haljson.Link{Href: u.href("webhook", "webhook", webhook)})
+	link(res, "redeliver", &haljson.Link{Href: u.href("redeliver", "webhook", webhook, "delivery", id)})
+
+	res.Data["id"] = d.ID
+	res.Data["event"] = d.Event
+	res.Data["payload"] = d.Payload
+	res.Data["state"] = d.State
+	res.Data["attempts"] = d.Attempts
+	res.Data["created"] = d.Created
+	if d.State == models.DeliveryPending {
+		res.Data["nextAttempt"] = d.NextAttempt
+	}
+	if d.ResponseStatus != 0 {
+		res.Data["responseStatus"] = d.ResponseStatus
+	}
+	if d.Error != "" {
+		res.Data["error"] = d.Error
+	}
+	if d.Delivered != nil {
+		res.Data["delivered"] = d.Delivered
+	}
+	return res
+}
+
+// webhook finds the webhook named by the route
+func (h *Handler) webhook(w http.ResponseWriter, r *http.Request) (*models.SQLWebhook, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["webhook"])
+	if err != nil {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	hook := models.NewSQLWebhook(id, h.dbFor(r))
+	if !hook.Exists() {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	return hook, true
+}
+
+// webhookRepresentation is a webhook with the requests that can be made on
+// it
+func webhookRepresentation(u urls, hook *models.SQLWebhook) representation {
+	res := webhookResource(u, hook)
+	addWebhookTemplates(u, res, hook)
+	return representation{resource: res, version: hook.Version}
+}
+
+// webhookConflict responds to a change which lost the race with another,
+// with the webhook as it is now
+func (h *Handler) webhookConflict(w http.ResponseWriter, r *http.Request, id int) {
+	hook := models.NewSQLWebhook(id, h.dbFor(r))
+	if !hook.Exists() {
+		ErrorHandler(w, r)
+		return
+	}
+	write(w, r, http.StatusPreconditionFailed, webhookRepresentation(h.urls(r), hook))
+}
+
+// generateSecret returns a random secret for webhooks created without one
+func generateSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// WebhookListHandler handles requests for every webhook
+func (h *Handler) WebhookListHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	u := h.urls(r)
+	root := u.document(u.path(r.URL.Path))
+	root.Data["events"] = models.WebhookEvents
+
+	for _, hook := range models.WebhookList(h.dbFor(r)) {
+		root.AddEmbed("webhooks", webhookResource(u, hook))
+	}
+	addTemplate(root, "default", &halTemplate{
+		Title:      "Subscribe",
+		Method:     http.MethodPost,
+		Target:     u.href("create-webhook"),
+		Properties: webhookProperties(nil),
+	})
+
+	respondList(w, r, http.StatusOK, root, "webhooks")
+}
+
+// CreateWebhookHandler handles new webhook subscriptions. The secret is only
+// ever shown in the response to this request.
+func (h *Handler) CreateWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+
+	var req webhookRequest
+	if !decode(w, r, &req) {
+		return
+	}
+
+	hook := &models.SQLWebhook{Db: h.dbFor(r), Events: req.Events, Active: true}
+	if req.URL != nil {
+		hook.URL = *req.URL
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	} else {
+		secret, err := generateSecret()
+		if err != nil {
+			writeError(w, r, http.StatusInternalServerError, "Failed to generate a secret")
+			return
+		}
+		hook.Secret = secret
+	}
+
+	if !h.saveWebhook(w, r, hook) {
+		return
+	}
+
+	rep := webhookRepresentation(h.urls(r), hook)
+	rep.resource.Data["secret"] = hook.Secret
+	w.Header().Set("Location", rep.resource.Links.Self.Href)
+	write(w, r, http.StatusCreated, rep)
+}
+
+// WebhookHandler handles requests for a webhook
+func (h *Handler) WebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	write(w, r, http.StatusOK, webhookRepresentation(h.urls(r), hook))
+}
+
+// EditWebhookHandler handles changes to a webhook
+func (h *Handler) EditWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	u := h.urls(r)
+	if !ifMatch(w, r, hook.Version, webhookRepresentation(u, hook)) {
+		return
+	}
+
+	var req webhookRequest
+	if !decode(w, r, &req) {
+		return
+	}
+	if req.URL != nil {
+		hook.URL = *req.URL
+	}
+	if req.Secret != nil {
+		hook.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		hook.Events = req.Events
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+
+	if !h.saveWebhook(w, r, hook) {
+		return
+	}
+	write(w, r, http.StatusOK, webhookRepresentation(u, hook))
+}
+
+// saveWebhook saves a webhook, responding with an error and returning false
+// when it can't
+func (h *Handler) saveWebhook(w http.ResponseWriter, r *http.Request, hook *models.SQLWebhook) bool {
+	err := hook.Save()
+	if err == models.ErrValidation {
+		writeError(w, r, http.StatusUnprocessableEntity, "A webhook needs an http or https url, a secret and one or more known events")
+		return false
+	}
+	if err == models.ErrConflict {
+		h.webhookConflict(w, r, hook.ID)
+		return false
+	}
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to save webhook")
+		return false
+	}
+	return true
+}
+
+// DeleteWebhookHandler handles removal of a webhook and its delivery log
+func (h *Handler) DeleteWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	if !ifMatch(w, r, hook.Version, webhookRepresentation(h.urls(r), hook)) {
+		return
+	}
+	if err := hook.Delete(); err != nil {
+		if err == models.ErrConflict {
+			h.webhookConflict(w, r, hook.ID)
+			return
+		}
+		writeError(w, r, http.StatusInternalServerError, "Failed to delete webhook")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// TestWebhookHandler queues a ping delivery to a webhook
+func (h *Handler) TestWebhookHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	if h.webhooks == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "Webhooks are not being delivered")
+		return
+	}
+
+	delivery, err := h.webhooks.Enqueue(hook, models.EventPing, map[string]interface{}{
+		"webhook": hook.ID,
+		"events":  hook.Events,
+	})
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to queue delivery")
+		return
+	}
+	h.webhooks.Wake()
+
+	res := deliveryResource(h.urls(r), delivery)
+	w.Header().Set("Location", res.Links.Self.Href)
+	respond(w, r, http.StatusAccepted, res)
+}
+
+// DeliveryListHandler handles requests for a page of a webhook's delivery
+// log, newest first
+func (h *Handler) DeliveryListHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+
+	perPage, err := strconv.Atoi(r.URL.Query().Get("per_page"))
+	if err != nil || perPage <= 0 || perPage > maxPerPage {
+		perPage = maxPerPage
+	}
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	deliveries, total := models.DeliveryList(hook.ID, (page-1)*perPage, perPage, h.dbFor(r))
+	pages := (total + perPage - 1) / perPage
+	if pages == 0 {
+		pages = 1
+	}
+
+	u := h.urls(r)
+	base := u.href("deliveries", "webhook", strconv.Itoa(hook.ID))
+	pageHref := func(n int) string {
+		return fmt.Sprintf("%s?page=%d&per_page=%d", base, n, perPage)
+	}
+
+	root := u.document(pageHref(page))
+	link(root, "webhook", &haljson.Link{Href: u.href("webhook", "webhook", strconv.Itoa(hook.ID))})
+	root.AddLink("first", &haljson.Link{Href: pageHref(1)})
+	root.AddLink("last", &haljson.Link{Href: pageHref(pages)})
+	if page > 1 {
+		root.AddLink("prev", &haljson.Link{Href: pageHref(page - 1)})
+	}
+	if page < pages {
+		root.AddLink("next", &haljson.Link{Href: pageHref(page + 1)})
+	}
+
+	root.Data["page"] = page
+	root.Data["pages"] = pages
+	root.Data["total"] = total
+
+	for _, d := range deliveries {
+		root.AddEmbed("deliveries", deliveryResource(u, d))
+	}
+
+	respondList(w, r, http.StatusOK, root, "deliveries")
+}
+
+// delivery finds the delivery of a webhook named by the route
+func (h *Handler) delivery(w http.ResponseWriter, r *http.Request, hook *models.SQLWebhook) (*models.SQLDelivery, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["delivery"])
+	if err != nil {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	d := models.NewSQLDelivery(id, h.dbFor(r))
+	if !d.Exists() || d.WebhookID != hook.ID {
+		ErrorHandler(w, r)
+		return nil, false
+	}
+	return d, true
+}
+
+// DeliveryHandler handles requests for a single delivery
+func (h *Handler) DeliveryHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	d, ok := h.delivery(w, r, hook)
+	if !ok {
+		return
+	}
+	u := h.urls(r)
+	res := deliveryResource(u, d)
+	addTemplate(res, "default", &halTemplate{
+		Title:  "Redeliver",
+		Method: http.MethodPost,
+		Target: u.href("redeliver", "webhook", strconv.Itoa(d.WebhookID), "delivery", strconv.Itoa(d.ID)),
+	})
+	respond(w, r, http.StatusOK, res)
+}
+
+// RedeliverHandler queues a delivery's payload to be sent again
+func (h *Handler) RedeliverHandler(w http.ResponseWriter, r *http.Request) {
+	if !h.requireAdmin(w, r) {
+		return
+	}
+	hook, ok := h.webhook(w, r)
+	if !ok {
+		return
+	}
+	d, ok := h.delivery(w, r, hook)
+	if !ok {
+		return
+	}
+	if h.webhooks == nil {
+		writeError(w, r, http.StatusServiceUnavailable, "Webhooks are not being delivered")
+		return
+	}
+
+	again, err := h.webhooks.Redeliver(d)
+	if err != nil {
+		writeError(w, r, http.StatusInternalServerError, "Failed to queue delivery")
+		return
+	}
+
+	res := deliveryResource(h.urls(r), again)
+	w.Header().Set("Location", res.Links.Self.Href)
+	respond(w, r, http.StatusAccepted, res)
+}
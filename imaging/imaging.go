@@ -0,0 +1,239 @@
+// Package imaging makes uploaded images ready for the web.
+//
+// Images are stripped of the metadata cameras and editors embed in them,
+// such as where a photo was taken, and turned upright when their EXIF
+// orientation says they were shot on their side. Variants of each image
+// are rendered at the sizes set up for the blog, cropped around the point
+// of the image which matters most when a variant has a different aspect.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/jpeg"
+	"image/png"
+	"regexp"
+	"strconv"
+	"strings"
+
+	// register GIF with image.Decode
+	_ "image/gif"
+)
+
+// MaxPixels bounds the size of the images decoded, so a small file can't
+// claim the memory of an enormous image
+const MaxPixels = 50000000
+
+// Error messages
+var (
+	ErrTooLarge = errors.New("the image has too many pixels to be processed")
+	ErrVariant  = errors.New("variants must be written as name=width or name=widthxheight, named with letters, digits, - and _")
+)
+
+// Variant is a size images are rendered at
+type Variant struct {
+	Name string
+	// Width bounds the width of the variant. Images narrower than it are
+	// never enlarged.
+	Width int
+	// Height crops the variant to the aspect of Width by Height, unless it
+	// is zero in which case the aspect of the image is kept
+	Height int
+}
+
+// variantName matches the names variants may have, which appear in URLs and
+// the keys variants are stored under
+var variantName = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// Spec describes the variant, so a variant rendered before the sizes were
+// changed can be told apart
+func (v Variant) Spec() string {
+	return strconv.Itoa(v.Width) + "x" + strconv.Itoa(v.Height)
+}
+
+// ParseVariants parses variants written as name=size pairs separated by
+// semicolons, such as "thumbnail=200x200; small=480"
+func ParseVariants(s string) ([]Variant, error) {
+	var variants []Variant
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || !variantName.MatchString(strings.TrimSpace(kv[0])) {
+			return nil, ErrVariant
+		}
+		v := Variant{Name: strings.TrimSpace(kv[0])}
+		size := strings.SplitN(strings.ToLower(strings.TrimSpace(kv[1])), "x", 2)
+		width, err := strconv.Atoi(size[0])
+		if err != nil || width <= 0 {
+			return nil, ErrVariant
+		}
+		v.Width = width
+		if len(size) == 2 {
+			height, err := strconv.Atoi(size[1])
+			if err != nil || height <= 0 {
+				return nil, ErrVariant
+			}
+			v.Height = height
+		}
+		variants = append(variants, v)
+	}
+	return variants, nil
+}
+
+// Focus is the point of an image which matters most, which crops keep in
+// view. Each coordinate runs from 0 at the left or top to 1 at the right or
+// bottom.
+type Focus struct {
+	X, Y float64
+}
+
+// Center is the focus of images which haven't been given one
+var Center = Focus{X: 0.5, Y: 0.5}
+
+// Size returns the size of a variant of an image of the given size
+func Size(v Variant, width, height int) (int, int) {
+	if v.Height > 0 {
+		crop := cropRect(image.Rect(0, 0, width, height), v.Width, v.Height, Center)
+		width, height = crop.Dx(), crop.Dy()
+	}
+	if width <= v.Width {
+		return width, height
+	}
+	if v.Height > 0 {
+		return v.Width, v.Height
+	}
+	h := (height*v.Width + width/2) / width
+	if h < 1 {
+		h = 1
+	}
+	return v.Width, h
+}
+
+// Decode decodes an image, turning it upright as its EXIF orientation says
+func Decode(data []byte) (image.Image, error) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	if o := Orientation(data); o > 1 {
+		return orient(toRGBA(img, img.Bounds()), o), nil
+	}
+	return img, nil
+}
+
+// Clean removes the metadata of an image, turning JPEGs upright first when
+// their EXIF orientation says they are on their side, which re-encodes
+// them at quality
+func Clean(data []byte, contentType string, quality int) ([]byte, error) {
+	if contentType != "image/jpeg" || Orientation(data) <= 1 {
+		return Strip(data, contentType)
+	}
+	img, err := Decode(data)
+	if err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: quality})
+	return buf.Bytes(), err
+}
+
+// Render renders a variant of an image, cropped around focus when the
+// variant has a different aspect
+func Render(img image.Image, v Variant, focus Focus) *image.RGBA {
+	bounds := img.Bounds()
+	crop := bounds
+	if v.Height > 0 {
+		crop = cropRect(bounds, v.Width, v.Height, focus)
+	}
+	width, height := Size(v, bounds.Dx(), bounds.Dy())
+	src := toRGBA(img, crop)
+	if width == crop.Dx() && height == crop.Dy() {
+		return src
+	}
+	return resample(src, width, height)
+}
+
+// Formats images are converted to
+const (
+	// FormatAuto writes opaque images as JPEG and others as PNG
+	FormatAuto = "auto"
+	FormatJPEG = "jpeg"
+	FormatPNG  = "png"
+)
+
+// Encode writes an image in a format, returning its content type. Images
+// with transparency written as JPEG are laid on white.
+func Encode(img *image.RGBA, format string, quality int) ([]byte, string, error) {
+	if format == FormatAuto {
+		format = FormatJPEG
+		if !img.Opaque() {
+			format = FormatPNG
+		}
+	}
+
+	var buf bytes.Buffer
+	if format == FormatPNG {
+		err := png.Encode(&buf, img)
+		return buf.Bytes(), "image/png", err
+	}
+
+	var out image.Image = img
+	if !img.Opaque() {
+		flat := image.NewRGBA(img.Bounds())
+		draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+		draw.Draw(flat, flat.Bounds(), img, img.Bounds().Min, draw.Over)
+		out = flat
+	}
+	err := jpeg.Encode(&buf, out, &jpeg.Options{Quality: quality})
+	return buf.Bytes(), "image/jpeg", err
+}
+
+// cropRect returns the largest rectangle of the aspect width by height
+// within bounds, centred on focus as far as the bounds allow
+func cropRect(bounds image.Rectangle, width, height int, focus Focus) image.Rectangle {
+	w, h := bounds.Dx(), bounds.Dy()
+	cw, ch := w, h
+	if w*height > h*width {
+		cw = h * width / height
+	} else {
+		ch = w * height / width
+	}
+	if cw < 1 {
+		cw = 1
+	}
+	if ch < 1 {
+		ch = 1
+	}
+	x := clamp(int(focus.X*float64(w))-cw/2, 0, w-cw)
+	y := clamp(int(focus.Y*float64(h))-ch/2, 0, h-ch)
+	return image.Rect(x, y, x+cw, y+ch).Add(bounds.Min)
+}
+
+func clamp(v, min, max int) int {
+	if v < min {
+		return min
+	}
+	if v > max {
+		return max
+	}
+	return v
+}
+
+// toRGBA copies part of an image to a new image at the origin
+func toRGBA(img image.Image, r image.Rectangle) *image.RGBA {
+	out := image.NewRGBA(image.Rect(0, 0, r.Dx(), r.Dy()))
+	draw.Draw(out, out.Bounds(), img, r.Min, draw.Src)
+	return out
+}
@@ -0,0 +1,97 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+)
+
+// orientationTag is the EXIF tag of the orientation of an image
+const orientationTag = 0x0112
+
+// Orientation returns the EXIF orientation of a JPEG, from 1 for upright to
+// 8, or 0 when it has none
+func Orientation(data []byte) int {
+	exif := jpegExif(data)
+	if len(exif) < 8 {
+		return 0
+	}
+
+	var order binary.ByteOrder
+	switch string(exif[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0
+	}
+
+	ifd := int(order.Uint32(exif[4:8]))
+	if ifd < 8 || ifd+2 > len(exif) {
+		return 0
+	}
+	entries := int(order.Uint16(exif[ifd:]))
+	for i := 0; i < entries; i++ {
+		entry := ifd + 2 + i*12
+		if entry+12 > len(exif) {
+			return 0
+		}
+		if order.Uint16(exif[entry:]) == orientationTag {
+			o := int(order.Uint16(exif[entry+8:]))
+			if o < 1 || o > 8 {
+				return 0
+			}
+			return o
+		}
+	}
+	return 0
+}
+
+// jpegExif returns the TIFF structure of the EXIF segment of a JPEG
+func jpegExif(data []byte) []byte {
+	var found []byte
+	walkJPEG(data, func(marker byte, segment []byte) bool {
+		if marker == 0xE1 && len(segment) > 10 && bytes.HasPrefix(segment[4:], []byte("Exif\x00\x00")) {
+			found = segment[10:]
+		}
+		return true
+	})
+	return found
+}
+
+// orient turns an image upright from an EXIF orientation
+func orient(src *image.RGBA, o int) *image.RGBA {
+	w, h := src.Bounds().Dx(), src.Bounds().Dy()
+	dw, dh := w, h
+	if o >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < dh; y++ {
+		for x := 0; x < dw; x++ {
+			var sx, sy int
+			switch o {
+			case 2:
+				sx, sy = w-1-x, y
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sx, sy = x, h-1-y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, h-1-x
+			case 7:
+				sx, sy = w-1-y, h-1-x
+			case 8:
+				sx, sy = w-1-y, x
+			default:
+				sx, sy = x, y
+			}
+			copy(dst.Pix[y*dst.Stride+x*4:y*dst.Stride+x*4+4], src.Pix[sy*src.Stride+sx*4:])
+		}
+	}
+	return dst
+}
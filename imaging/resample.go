@@ -0,0 +1,71 @@
+package imaging
+
+import (
+	"image"
+	"math"
+)
+
+// weight is how much a source pixel contributes to a target pixel
+type weight struct {
+	index  int
+	amount float64
+}
+
+// weights returns the source pixels each target pixel covers when a line of
+// from pixels is scaled to to pixels, weighted by how much of each is
+// covered
+func weights(from, to int) [][]weight {
+	scale := float64(from) / float64(to)
+	out := make([][]weight, to)
+	for i := range out {
+		start, end := float64(i)*scale, float64(i+1)*scale
+		for j := int(start); j < from && float64(j) < end; j++ {
+			lo, hi := math.Max(start, float64(j)), math.Min(end, float64(j+1))
+			if hi > lo {
+				out[i] = append(out[i], weight{index: j, amount: (hi - lo) / scale})
+			}
+		}
+	}
+	return out
+}
+
+// resample scales an image to width by height by averaging the area of the
+// source each pixel covers, which keeps detail when images are made smaller
+func resample(src *image.RGBA, width, height int) *image.RGBA {
+	sw, sh := src.Bounds().Dx(), src.Bounds().Dy()
+	xs, ys := weights(sw, width), weights(sh, height)
+
+	// Scale each row, then each column of the result
+	rows := make([]float64, width*sh*4)
+	for y := 0; y < sh; y++ {
+		line := src.Pix[y*src.Stride:]
+		for x, ws := range xs {
+			out := rows[(y*width+x)*4:]
+			for _, w := range ws {
+				p := line[w.index*4:]
+				out[0] += float64(p[0]) * w.amount
+				out[1] += float64(p[1]) * w.amount
+				out[2] += float64(p[2]) * w.amount
+				out[3] += float64(p[3]) * w.amount
+			}
+		}
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y, ws := range ys {
+		line := dst.Pix[y*dst.Stride:]
+		for x := 0; x < width; x++ {
+			var sum [4]float64
+			for _, w := range ws {
+				p := rows[(w.index*width+x)*4:]
+				for c := range sum {
+					sum[c] += p[c] * w.amount
+				}
+			}
+			for c, v := range sum {
+				line[x*4+c] = uint8(math.Min(255, math.Max(0, math.Round(v))))
+			}
+		}
+	}
+	return dst
+}
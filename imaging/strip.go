@@ -0,0 +1,163 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+)
+
+// ErrMalformed is returned for images whose structure can't be read
+var ErrMalformed = errors.New("the image is malformed")
+
+// Strip removes the metadata of an image without decoding it, so the image
+// itself is untouched: EXIF, XMP, IPTC and comments from JPEGs, EXIF and
+// text chunks from PNGs and EXIF and XMP from WebP. Colour profiles are
+// kept. Other types are returned as they are.
+func Strip(data []byte, contentType string) ([]byte, error) {
+	switch contentType {
+	case "image/jpeg":
+		return stripJPEG(data)
+	case "image/png":
+		return stripPNG(data)
+	case "image/webp":
+		return stripWebP(data)
+	}
+	return data, nil
+}
+
+// strippedJPEG are the markers of the JPEG segments removed: APP1 holding
+// EXIF and XMP, the application segments other than JFIF, the colour
+// profile and Adobe's, and comments
+func strippedJPEG(marker byte) bool {
+	switch {
+	case marker == 0xE1, marker >= 0xE3 && marker <= 0xED, marker == 0xEF, marker == 0xFE:
+		return true
+	}
+	return false
+}
+
+// walkJPEG calls fn with each segment of a JPEG before its image data, from
+// its marker on. It returns where the image data starts, or -1 when the
+// JPEG is malformed.
+func walkJPEG(data []byte, fn func(marker byte, segment []byte) bool) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return -1
+	}
+	i := 2
+	for i+4 <= len(data) {
+		if data[i] != 0xFF {
+			return -1
+		}
+		marker := data[i+1]
+		switch {
+		case marker == 0xFF:
+			// Markers may be preceded by fill bytes
+			i++
+			continue
+		case marker == 0xDA:
+			// Start of scan, which the image data follows
+			return i
+		case marker >= 0xD0 && marker <= 0xD7, marker == 0x01:
+			// Markers standing alone, without a length
+			fn(marker, data[i:i+2])
+			i += 2
+			continue
+		}
+		length := int(data[i+2])<<8 | int(data[i+3])
+		if length < 2 || i+2+length > len(data) {
+			return -1
+		}
+		if !fn(marker, data[i:i+2+length]) {
+			return i
+		}
+		i += 2 + length
+	}
+	return -1
+}
+
+func stripJPEG(data []byte) ([]byte, error) {
+	out := append(make([]byte, 0, len(data)), 0xFF, 0xD8)
+	start := walkJPEG(data, func(marker byte, segment []byte) bool {
+		if !strippedJPEG(marker) {
+			out = append(out, segment...)
+		}
+		return true
+	})
+	if start < 0 {
+		return nil, ErrMalformed
+	}
+	return append(out, data[start:]...), nil
+}
+
+// strippedPNG are the types of the PNG chunks removed
+var strippedPNG = map[string]bool{
+	"eXIf": true,
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"tIME": true,
+}
+
+var pngSignature = []byte("\x89PNG\r\n\x1a\n")
+
+func stripPNG(data []byte) ([]byte, error) {
+	if !bytes.HasPrefix(data, pngSignature) {
+		return nil, ErrMalformed
+	}
+	out := append(make([]byte, 0, len(data)), pngSignature...)
+	for i := len(pngSignature); i+12 <= len(data); {
+		length := int64(binary.BigEndian.Uint32(data[i:]))
+		if length > int64(len(data)-i-12) {
+			return nil, ErrMalformed
+		}
+		kind := string(data[i+4 : i+8])
+		end := i + 12 + int(length)
+		if !strippedPNG[kind] {
+			out = append(out, data[i:end]...)
+		}
+		if kind == "IEND" {
+			return out, nil
+		}
+		i = end
+	}
+	return nil, ErrMalformed
+}
+
+// VP8X flags saying a WebP has EXIF and XMP chunks
+const (
+	webpEXIF = 0x08
+	webpXMP  = 0x04
+)
+
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrMalformed
+	}
+	out := append(make([]byte, 0, len(data)), data[:12]...)
+	for i := 12; i+8 <= len(data); {
+		kind := string(data[i : i+4])
+		size := int64(binary.LittleEndian.Uint32(data[i+4:]))
+		if size > int64(len(data)-i-8) {
+			return nil, ErrMalformed
+		}
+		// Chunks are padded to an even size
+		end := i + 8 + int(size) + int(size%2)
+		if end > len(data) {
+			end = len(data)
+		}
+		switch kind {
+		case "EXIF", "XMP ":
+		case "VP8X":
+			chunk := append([]byte(nil), data[i:end]...)
+			if size > 0 {
+				chunk[8] &^= webpEXIF | webpXMP
+			}
+			out = append(out, chunk...)
+		default:
+			out = append(out, data[i:end]...)
+		}
+		i = end
+	}
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(out)-8))
+	return out, nil
+}
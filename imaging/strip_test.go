@@ -0,0 +1,152 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"testing"
+)
+
+// sample returns a small image to encode
+func sample() image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, 4, 4))
+	for i := range img.Pix {
+		img.Pix[i] = byte(i * 7)
+	}
+	return img
+}
+
+// segment returns a JPEG segment with its marker and length
+func segment(marker byte, payload string) []byte {
+	s := []byte{0xFF, marker, 0, 0}
+	binary.BigEndian.PutUint16(s[2:], uint16(len(payload)+2))
+	return append(s, payload...)
+}
+
+// chunk returns a PNG chunk with its length and checksum
+func chunk(kind, payload string) []byte {
+	c := make([]byte, 4, 12+len(payload))
+	binary.BigEndian.PutUint32(c, uint32(len(payload)))
+	c = append(c, kind...)
+	c = append(c, payload...)
+	sum := make([]byte, 4)
+	binary.BigEndian.PutUint32(sum, crc32.ChecksumIEEE(c[4:]))
+	return append(c, sum...)
+}
+
+// riff returns a WebP chunk with its size and padding
+func riff(kind string, payload []byte) []byte {
+	c := append([]byte(kind), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(c[4:], uint32(len(payload)))
+	c = append(c, payload...)
+	if len(payload)%2 == 1 {
+		c = append(c, 0)
+	}
+	return c
+}
+
+// webp returns a WebP file made of chunks
+func webp(chunks ...[]byte) []byte {
+	data := []byte("RIFF\x00\x00\x00\x00WEBP")
+	for _, c := range chunks {
+		data = append(data, c...)
+	}
+	binary.LittleEndian.PutUint32(data[4:], uint32(len(data)-8))
+	return data
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
+
+func TestStrip(t *testing.T) {
+	var jpg, pngData bytes.Buffer
+	if err := jpeg.Encode(&jpg, sample(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := png.Encode(&pngData, sample()); err != nil {
+		t.Fatal(err)
+	}
+	profile := segment(0xE2, "ICC_PROFILE\x00profile")
+	iend := pngData.Len() - 12
+	vp8x := []byte{webpEXIF | webpXMP | 0x10, 0, 0, 0, 3, 0, 0, 3, 0, 0}
+	frame := riff("VP8L", []byte("image data"))
+
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+		stripped    []byte
+	}{
+		{
+			"jpeg",
+			concat(jpg.Bytes()[:2], segment(0xE1, "Exif\x00\x00camera"), profile, segment(0xED, "Photoshop 3.0"), segment(0xFE, "comment"), jpg.Bytes()[2:]),
+			"image/jpeg",
+			concat(jpg.Bytes()[:2], profile, jpg.Bytes()[2:]),
+		},
+		{
+			"jpeg without metadata",
+			jpg.Bytes(),
+			"image/jpeg",
+			jpg.Bytes(),
+		},
+		{
+			"png",
+			concat(pngData.Bytes()[:iend], chunk("tEXt", "Author\x00me"), chunk("eXIf", "camera"), chunk("tIME", "1234567"), pngData.Bytes()[iend:]),
+			"image/png",
+			pngData.Bytes(),
+		},
+		{
+			"webp",
+			webp(riff("VP8X", vp8x), frame, riff("EXIF", []byte("odd")), riff("XMP ", []byte("<x/>"))),
+			"image/webp",
+			webp(riff("VP8X", []byte{0x10, 0, 0, 0, 3, 0, 0, 3, 0, 0}), frame),
+		},
+		{
+			"other type",
+			[]byte("GIF89a"),
+			"image/gif",
+			[]byte("GIF89a"),
+		},
+	}
+	for _, test := range tests {
+		stripped, err := Strip(test.data, test.contentType)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !bytes.Equal(stripped, test.stripped) {
+			t.Errorf("%s: stripped to % x, want % x", test.name, stripped, test.stripped)
+		}
+	}
+
+	stripped, _ := Strip(tests[0].data, "image/jpeg")
+	if _, err := jpeg.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped jpeg doesn't decode: %v", err)
+	}
+}
+
+func TestStripMalformed(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        []byte
+		contentType string
+	}{
+		{"jpeg without start", []byte("not a jpeg"), "image/jpeg"},
+		{"jpeg segment too long", concat([]byte{0xFF, 0xD8}, []byte{0xFF, 0xE1, 0xFF, 0xFF, 0}), "image/jpeg"},
+		{"jpeg without scan", concat([]byte{0xFF, 0xD8}, segment(0xE0, "JFIF")), "image/jpeg"},
+		{"png signature", []byte("GIF89a"), "image/png"},
+		{"png without end", concat(pngSignature, chunk("IHDR", "header")), "image/png"},
+		{"png chunk too long", concat(pngSignature, []byte{0, 0, 1, 0}, []byte("IDATdata1234")), "image/png"},
+		{"webp header", []byte("RIFF\x00\x00\x00\x00WAVE"), "image/webp"},
+		{"webp chunk too long", concat([]byte("RIFF\x00\x00\x00\x00WEBP"), []byte("VP8L\xff\x00\x00\x00data")), "image/webp"},
+	}
+	for _, test := range tests {
+		if _, err := Strip(test.data, test.contentType); err != ErrMalformed {
+			t.Errorf("%s: err = %v, want ErrMalformed", test.name, err)
+		}
+	}
+}
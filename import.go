@@ -0,0 +1,100 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/spf13/viper"
+
+	"github.com/mattgen88/blog/importer"
+	"github.com/mattgen88/blog/models"
+)
+
+// importPosts reads WordPress exports and directories of Markdown posts named
+// on the command line and reports how they would be imported, importing them
+// only when asked to commit
+func importPosts(db *sql.DB) error {
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	commit := flags.Bool("commit", false, "import the posts rather than only reporting the plan")
+	skipConflicts := flags.Bool("skip-conflicts", false, "commit even if some posts conflict, skipping them")
+	author := flags.String("author", "", "username of posts without an author")
+	category := flags.String("category", "Uncategorized", "category of posts without one")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: blog import [flags] <export.xml|directory>...")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		return errors.New("nothing to import")
+	}
+
+	var (
+		posts   []importer.Post
+		authors []importer.Author
+	)
+	for _, source := range flags.Args() {
+		info, err := os.Stat(source)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			read, err := importer.ReadMarkdownDir(source)
+			if err != nil {
+				return err
+			}
+			posts = append(posts, read...)
+			continue
+		}
+
+		f, err := os.Open(source)
+		if err != nil {
+			return err
+		}
+		read, wxrAuthors, err := importer.ReadWXR(f, source)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %v", source, err)
+		}
+		posts = append(posts, read...)
+		authors = append(authors, wxrAuthors...)
+	}
+
+	if err := models.Migrate(db); err != nil {
+		return err
+	}
+
+	report := importer.Plan(posts, authors, importer.Options{
+		Author:   *author,
+		Category: *category,
+	}, db)
+	report.Write(os.Stdout)
+
+	if !*commit {
+		fmt.Println("\nDry run, nothing was imported. Run again with -commit to import.")
+		return nil
+	}
+	if report.Conflicts() > 0 && !*skipConflicts {
+		return errors.New("not importing with conflicts, resolve them or use -skip-conflicts")
+	}
+
+	// Running instances are told of every article imported
+	if node := clusterNode(db); node != nil {
+		node.Publish()
+	}
+	imported, err := report.Apply(db)
+	if err != nil {
+		return err
+	}
+	logs.Info("Imported articles", "articles", imported)
+
+	if viper.GetString("search_index") != "" {
+		return reindex(db)
+	}
+	return nil
+}
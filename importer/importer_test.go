@@ -0,0 +1,165 @@
+package importer
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		title, want string
+	}{
+		{"Hello, World!", "hello-world"},
+		{"  Leading and trailing  ", "leading-and-trailing"},
+		{"Crème brûlée", "creme-brulee"},
+		{"Go 1.12 released", "go-1-12-released"},
+		{"日本語", ""},
+		{"C++ & Go", "c-go"},
+	}
+	for _, test := range tests {
+		if got := Slugify(test.title); got != test.want {
+			t.Errorf("Slugify(%q) = %q, want %q", test.title, got, test.want)
+		}
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"2024-03-01T12:00:00Z", "2024-03-01T12:00:00Z"},
+		{"2024-03-01 12:00:00 +0100", "2024-03-01T11:00:00Z"},
+		{"2024-03-01 12:00:00 +01:00", "2024-03-01T11:00:00Z"},
+		{"2024-03-01 12:00:00", "2024-03-01T12:00:00Z"},
+		{" 2024-03-01 ", "2024-03-01T00:00:00Z"},
+		{"0000-00-00 00:00:00", ""},
+		{"yesterday", ""},
+	}
+	for _, test := range tests {
+		got := ""
+		if d := parseDate(test.in); d != nil {
+			got = d.UTC().Format(time.RFC3339)
+		}
+		if got != test.want {
+			t.Errorf("parseDate(%q) = %q, want %q", test.in, got, test.want)
+		}
+	}
+}
+
+func TestReadMarkdown(t *testing.T) {
+	tests := []struct {
+		name, file, doc string
+		want            Post
+	}{
+		{"hugo", "content/posts/first.md",
+			"---\ntitle: First\ndate: 2024-03-01\ncategories: [Go, News]\ntags: [go, go]\ndraft: true\n---\nBody\n",
+			Post{Title: "First", Slug: "first", Categories: []string{"Go", "News"}, Tags: []string{"go"}, Draft: true, Body: "Body"}},
+		{"jekyll", "_posts/2024-03-01-second-post.markdown",
+			"---\ntitle: Second\ncategory: Go\ntags: go testing\npublished: false\n---\n\nBody\n",
+			Post{Title: "Second", Slug: "second-post", Categories: []string{"Go"}, Tags: []string{"go", "testing"}, Draft: true, Body: "Body"}},
+		{"bundle", "content/posts/third/index.md",
+			"---\ntitle: Third\nslug: custom\ndate: 2024-03-01\ntags: a, b\nauthor: matt\n---\nBody",
+			Post{Title: "Third", Slug: "custom", Author: "matt", Tags: []string{"a", "b"}, Body: "Body"}},
+	}
+	for _, test := range tests {
+		post, err := ReadMarkdown([]byte(test.doc), test.file)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if post.Date == nil || post.Date.Format("2006-01-02") != "2024-03-01" {
+			t.Errorf("%s: date %v", test.name, post.Date)
+		}
+		test.want.Source, test.want.Date = test.file, post.Date
+		if !reflect.DeepEqual(post, test.want) {
+			t.Errorf("%s: post = %+v, want %+v", test.name, post, test.want)
+		}
+	}
+
+	if _, err := ReadMarkdown([]byte("+++\ntitle = \"TOML\"\n+++\n"), "toml.md"); err == nil {
+		t.Error("TOML front matter was accepted")
+	}
+}
+
+const export = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:content="http://purl.org/rss/1.0/modules/content/"
+	xmlns:excerpt="http://wordpress.org/export/1.2/excerpt/"
+	xmlns:dc="http://purl.org/dc/elements/1.1/"
+	xmlns:wp="http://wordpress.org/export/1.2/">
+<channel>
+	<wp:author>
+		<wp:author_login>matt</wp:author_login>
+		<wp:author_email>matt@example.com</wp:author_email>
+		<wp:author_display_name>Matt</wp:author_display_name>
+	</wp:author>
+	<item>
+		<title>Caf&eacute; post</title>
+		<dc:creator>matt</dc:creator>
+		<content:encoded><![CDATA[<p>Hello <strong>world</strong></p>]]></content:encoded>
+		<excerpt:encoded><![CDATA[Not the body]]></excerpt:encoded>
+		<wp:post_name>caf%c3%a9-post</wp:post_name>
+		<wp:post_date>2024-03-01 13:00:00</wp:post_date>
+		<wp:post_date_gmt>2024-03-01 12:00:00</wp:post_date_gmt>
+		<wp:status>publish</wp:status>
+		<wp:post_type>post</wp:post_type>
+		<category domain="category">News</category>
+		<category domain="post_tag">go</category>
+		<category domain="post_tag">go</category>
+	</item>
+	<item>
+		<title>Draft</title>
+		<wp:post_name></wp:post_name>
+		<wp:post_date>2024-03-02 09:00:00</wp:post_date>
+		<wp:post_date_gmt>0000-00-00 00:00:00</wp:post_date_gmt>
+		<wp:status>draft</wp:status>
+		<wp:post_type>post</wp:post_type>
+	</item>
+	<item>
+		<title>About</title>
+		<wp:post_type>page</wp:post_type>
+	</item>
+</channel>
+</rss>`
+
+func TestReadWXR(t *testing.T) {
+	posts, authors, err := ReadWXR(strings.NewReader(export), "export.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []Author{{Username: "matt", Name: "Matt", Email: "matt@example.com"}}; !reflect.DeepEqual(authors, want) {
+		t.Errorf("authors = %+v, want %+v", authors, want)
+	}
+	if len(posts) != 2 {
+		t.Fatalf("%d posts, want 2", len(posts))
+	}
+
+	tests := []struct {
+		name             string
+		post             Post
+		title, slug      string
+		date             string
+		draft            bool
+		categories, tags []string
+	}{
+		{"published", posts[0], "Café post", "café-post", "2024-03-01T12:00:00Z", false, []string{"News"}, []string{"go"}},
+		{"draft", posts[1], "Draft", "", "2024-03-02T09:00:00Z", true, nil, nil},
+	}
+	for _, test := range tests {
+		p := test.post
+		if p.Title != test.title || p.Slug != test.slug || p.Draft != test.draft {
+			t.Errorf("%s: post = %+v", test.name, p)
+		}
+		if p.Date == nil || p.Date.UTC().Format(time.RFC3339) != test.date {
+			t.Errorf("%s: date %v, want %s", test.name, p.Date, test.date)
+		}
+		if !reflect.DeepEqual(p.Categories, test.categories) || !reflect.DeepEqual(p.Tags, test.tags) {
+			t.Errorf("%s: categories %q, tags %q", test.name, p.Categories, p.Tags)
+		}
+	}
+	if body := posts[0].Body; !strings.Contains(body, "**world**") || strings.Contains(body, "Not the body") {
+		t.Errorf("body = %q", body)
+	}
+}
@@ -0,0 +1,125 @@
+package importer
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mattgen88/blog/markdown"
+)
+
+// datePrefixRegexp matches the date Jekyll prefixes post file names with
+var datePrefixRegexp = regexp.MustCompile(`^(\d{4}-\d{2}-\d{2})-`)
+
+// frontMatter holds the metadata Hugo and Jekyll posts are described with
+type frontMatter struct {
+	Title string `yaml:"title"`
+	Date  string `yaml:"date"`
+	Slug  string `yaml:"slug"`
+	// Categories and Tags are either lists or, in Jekyll, space separated
+	Categories interface{} `yaml:"categories"`
+	Category   string      `yaml:"category"`
+	Tags       interface{} `yaml:"tags"`
+	Author     string      `yaml:"author"`
+	Draft      bool        `yaml:"draft"`
+	// Published is Jekyll's inverse of Draft
+	Published *bool `yaml:"published"`
+}
+
+// ReadMarkdownDir reads every Markdown post below dir. Hugo section pages,
+// _index.md, are skipped.
+func ReadMarkdownDir(dir string) ([]Post, error) {
+	var posts []Post
+	err := filepath.Walk(dir, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		name := info.Name()
+		if info.IsDir() || name == "_index.md" {
+			return nil
+		}
+		if ext := filepath.Ext(name); ext != ".md" && ext != ".markdown" {
+			return nil
+		}
+
+		doc, err := ioutil.ReadFile(file)
+		if err != nil {
+			return err
+		}
+		post, err := ReadMarkdown(doc, file)
+		if err != nil {
+			return fmt.Errorf("%s: %v", file, err)
+		}
+		posts = append(posts, post)
+		return nil
+	})
+	return posts, err
+}
+
+// ReadMarkdown reads a post from a Markdown document with YAML front matter.
+// The slug and date fall back to those in the file name, for page bundles the
+// name of the directory.
+func ReadMarkdown(doc []byte, file string) (Post, error) {
+	if bytes.HasPrefix(doc, []byte("+++")) {
+		return Post{}, fmt.Errorf("TOML front matter is not supported")
+	}
+
+	var meta frontMatter
+	body, err := markdown.SplitFrontMatter(doc, &meta)
+	if err != nil {
+		return Post{}, err
+	}
+
+	name := strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	if name == "index" {
+		name = filepath.Base(filepath.Dir(file))
+	}
+
+	post := Post{
+		Source: file,
+		Title:  strings.TrimSpace(meta.Title),
+		Slug:   strings.TrimSpace(meta.Slug),
+		Date:   parseDate(meta.Date),
+		Author: strings.TrimSpace(meta.Author),
+		Draft:  meta.Draft || (meta.Published != nil && !*meta.Published),
+		Body:   strings.TrimSpace(body),
+	}
+
+	if m := datePrefixRegexp.FindStringSubmatch(name); m != nil {
+		name = name[len(m[0]):]
+		if post.Date == nil {
+			post.Date = parseDate(m[1])
+		}
+	}
+	if post.Slug == "" {
+		post.Slug = name
+	}
+
+	post.Categories = addUnique(post.Categories, list(meta.Categories)...)
+	post.Categories = addUnique(post.Categories, meta.Category)
+	post.Tags = addUnique(post.Tags, list(meta.Tags)...)
+	return post, nil
+}
+
+// list reads a front matter field given as either a list or a string of
+// space or comma separated values
+func list(v interface{}) []string {
+	switch v := v.(type) {
+	case string:
+		if strings.Contains(v, ",") {
+			return strings.Split(v, ",")
+		}
+		return strings.Fields(v)
+	case []interface{}:
+		values := make([]string, 0, len(v))
+		for _, value := range v {
+			values = append(values, fmt.Sprint(value))
+		}
+		return values
+	}
+	return nil
+}
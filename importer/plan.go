@@ -0,0 +1,251 @@
+package importer
+
+import (
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"io"
+
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/models"
+)
+
+// logs is the logger of imports
+var logs = logging.For("importer")
+
+// Options fills in what posts leave out
+type Options struct {
+	// Author is the username posts without an author are attributed to
+	Author string
+	// Category is the category of posts without one
+	Category string
+}
+
+// Entry is the plan for a single post
+type Entry struct {
+	Post     Post
+	Author   string
+	Category string
+	// Skip explains why the post won't be imported, empty if it will be
+	Skip string
+	// Conflict marks skips that need attention, as opposed to drafts
+	Conflict bool
+	Notes    []string
+}
+
+// Report is the plan of an import, which is applied as is
+type Report struct {
+	Entries    []Entry
+	Users      []Author
+	Categories []string
+}
+
+// Plan decides how posts map onto the blog's users, categories and articles
+// without writing anything
+func Plan(posts []Post, authors []Author, opts Options, Db *sql.DB) *Report {
+	report := &Report{}
+
+	known := make(map[string]Author)
+	for _, a := range authors {
+		known[a.Username] = a
+	}
+	users := make(map[string]bool)
+	categories := make(map[string]bool)
+	slugs := make(map[string]string)
+
+	for _, post := range posts {
+		e := Entry{Post: post, Author: post.Author, Category: opts.Category}
+		if e.Author == "" {
+			e.Author = opts.Author
+		}
+		if len(post.Categories) > 0 {
+			e.Category = post.Categories[0]
+		}
+		if e.Post.Slug == "" {
+			e.Post.Slug = Slugify(post.Title)
+		}
+
+		switch {
+		case post.Draft:
+			e.Skip = "draft"
+		case post.Title == "":
+			e.Skip, e.Conflict = "no title", true
+		case !validSlug(e.Post.Slug):
+			e.Skip, e.Conflict = fmt.Sprintf("invalid slug %q", e.Post.Slug), true
+		case slugs[e.Post.Slug] != "":
+			e.Skip, e.Conflict = fmt.Sprintf("slug %q is also used by %s", e.Post.Slug, slugs[e.Post.Slug]), true
+		case models.NewSQLArticle(e.Post.Slug, Db).Exists():
+			e.Skip, e.Conflict = fmt.Sprintf("an article with slug %q already exists", e.Post.Slug), true
+		case e.Author == "":
+			e.Skip, e.Conflict = "no author", true
+		case e.Category == "":
+			e.Skip, e.Conflict = "no category", true
+		}
+
+		if e.Skip == "" {
+			slugs[e.Post.Slug] = post.Source
+
+			if !users[e.Author] && !models.NewSQLUser(e.Author, Db).Exists() {
+				a, ok := known[e.Author]
+				if !ok {
+					a = Author{Username: e.Author}
+				}
+				report.Users = append(report.Users, a)
+				e.Notes = append(e.Notes, fmt.Sprintf("creates user %q", e.Author))
+			}
+			users[e.Author] = true
+
+			if !categories[e.Category] && !models.NewSQLCategory(e.Category, Db).Exists() {
+				report.Categories = append(report.Categories, e.Category)
+				e.Notes = append(e.Notes, fmt.Sprintf("creates category %q", e.Category))
+			}
+			categories[e.Category] = true
+
+			// Articles have a single category, the rest are kept as tags
+			if len(post.Categories) > 1 {
+				e.Post.Tags = addUnique(e.Post.Tags, post.Categories[1:]...)
+				e.Notes = append(e.Notes, fmt.Sprintf("categories %q become tags", post.Categories[1:]))
+			}
+		}
+
+		report.Entries = append(report.Entries, e)
+	}
+	return report
+}
+
+// Conflicts counts the posts skipped for reasons other than being drafts
+func (r *Report) Conflicts() int {
+	n := 0
+	for _, e := range r.Entries {
+		if e.Conflict {
+			n++
+		}
+	}
+	return n
+}
+
+// Imports counts the posts which will be imported
+func (r *Report) Imports() int {
+	n := 0
+	for _, e := range r.Entries {
+		if e.Skip == "" {
+			n++
+		}
+	}
+	return n
+}
+
+// Write describes the plan to w, conflicts first
+func (r *Report) Write(w io.Writer) {
+	if n := r.Conflicts(); n > 0 {
+		fmt.Fprintf(w, "Conflicts (%d):\n", n)
+		for _, e := range r.Entries {
+			if e.Conflict {
+				fmt.Fprintf(w, "  %s: %s\n", e.Post.Source, e.Skip)
+			}
+		}
+		fmt.Fprintln(w)
+	}
+
+	fmt.Fprintf(w, "Articles (%d):\n", r.Imports())
+	for _, e := range r.Entries {
+		if e.Skip == "" {
+			fmt.Fprintf(w, "  %s -> /articles/%s by %s in %s\n", e.Post.Source, e.Post.Slug, e.Author, e.Category)
+			for _, note := range e.Notes {
+				fmt.Fprintf(w, "    %s\n", note)
+			}
+		}
+	}
+
+	var drafts int
+	for _, e := range r.Entries {
+		if e.Skip != "" && !e.Conflict {
+			drafts++
+		}
+	}
+	if drafts > 0 {
+		fmt.Fprintf(w, "\nSkipped drafts (%d):\n", drafts)
+		for _, e := range r.Entries {
+			if e.Skip != "" && !e.Conflict {
+				fmt.Fprintf(w, "  %s\n", e.Post.Source)
+			}
+		}
+	}
+
+	if len(r.Users) > 0 {
+		fmt.Fprintf(w, "\nNew users (%d), with random passwords:\n", len(r.Users))
+		for _, u := range r.Users {
+			fmt.Fprintf(w, "  %s\n", u.Username)
+		}
+	}
+	if len(r.Categories) > 0 {
+		fmt.Fprintf(w, "\nNew categories (%d):\n", len(r.Categories))
+		for _, c := range r.Categories {
+			fmt.Fprintf(w, "  %s\n", c)
+		}
+	}
+}
+
+// Apply carries out the plan, returning how many articles were imported
+func (r *Report) Apply(Db *sql.DB) (int, error) {
+	for _, a := range r.Users {
+		user := models.NewSQLUser(a.Username, Db)
+		if user.Exists() {
+			continue
+		}
+		password, err := randomPassword()
+		if err != nil {
+			return 0, err
+		}
+		user.SetPassword(password)
+		user.SetRealName(a.Name)
+		user.SetEmail(a.Email)
+		if err := user.Save(); err != nil {
+			return 0, fmt.Errorf("user %s: %v", a.Username, err)
+		}
+	}
+
+	for _, name := range r.Categories {
+		category := models.NewSQLCategory(name, Db)
+		if category.Exists() {
+			continue
+		}
+		if err := category.Save(); err != nil {
+			return 0, fmt.Errorf("category %s: %v", name, err)
+		}
+	}
+
+	imported := 0
+	for _, e := range r.Entries {
+		if e.Skip != "" {
+			continue
+		}
+		article := &models.SQLArticle{
+			Db:       Db,
+			Title:    e.Post.Title,
+			Slug:     e.Post.Slug,
+			Body:     e.Post.Body,
+			Date:     e.Post.Date,
+			Tags:     e.Post.Tags,
+			Author:   models.NewSQLUser(e.Author, Db),
+			Category: models.NewSQLCategory(e.Category, Db),
+		}
+		if err := article.Save(); err != nil {
+			return imported, fmt.Errorf("%s: %v", e.Post.Source, err)
+		}
+		logs.Info("Imported post", "source", e.Post.Source, "slug", article.Slug)
+		imported++
+	}
+	return imported, nil
+}
+
+// randomPassword generates a password nobody knows, for users created on
+// import
+func randomPassword() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
@@ -0,0 +1,111 @@
+// Package importer moves content from other blogging software into the
+// blog. Posts are read from WordPress WXR exports or directories of Markdown
+// files with front matter, as written by Hugo and Jekyll, then planned against
+// the database so conflicts can be reviewed before anything is written.
+package importer
+
+import (
+	"strings"
+	"time"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Post is an article read from another blog
+type Post struct {
+	// Source is where the post was read from, for reporting
+	Source     string
+	Title      string
+	Slug       string
+	Date       *time.Time
+	Author     string
+	Categories []string
+	Tags       []string
+	Draft      bool
+	// Body is Markdown
+	Body string
+}
+
+// Author describes the author of posts, when the source describes them
+type Author struct {
+	Username string
+	Name     string
+	Email    string
+}
+
+// dateLayouts are the date formats accepted from front matter and exports
+var dateLayouts = []string{
+	time.RFC3339,
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05 -07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04",
+	"2006-01-02",
+}
+
+// parseDate parses a date in any of the accepted layouts, returning nil for
+// dates it can't make sense of
+func parseDate(s string) *time.Time {
+	s = strings.TrimSpace(s)
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return &t
+		}
+	}
+	return nil
+}
+
+// Slugify derives a slug from a title, dropping accents and anything else
+// outside ASCII letters and digits
+func Slugify(title string) string {
+	var b strings.Builder
+	dash := false
+	for _, r := range norm.NFD.String(strings.ToLower(title)) {
+		if unicode.Is(unicode.Mn, r) {
+			continue
+		}
+		if r < unicode.MaxASCII && (unicode.IsLetter(r) || unicode.IsDigit(r)) {
+			if dash && b.Len() > 0 {
+				b.WriteByte('-')
+			}
+			b.WriteRune(r)
+			dash = false
+			continue
+		}
+		dash = true
+	}
+	return b.String()
+}
+
+// validSlug reports whether an article may be saved with slug
+func validSlug(slug string) bool {
+	for _, r := range slug {
+		if unicode.IsLetter(r) {
+			return !strings.ContainsAny(slug, "/?# ")
+		}
+	}
+	return false
+}
+
+// addUnique appends the values not already in list
+func addUnique(list []string, values ...string) []string {
+	for _, v := range values {
+		v = strings.TrimSpace(v)
+		if v == "" {
+			continue
+		}
+		found := false
+		for _, existing := range list {
+			if existing == v {
+				found = true
+				break
+			}
+		}
+		if !found {
+			list = append(list, v)
+		}
+	}
+	return list
+}
@@ -0,0 +1,98 @@
+package importer
+
+import (
+	"encoding/xml"
+	"io"
+	"net/url"
+	"strings"
+
+	"github.com/mattgen88/blog/markdown"
+)
+
+// wxr is the subset of a WordPress eXtended RSS export that is imported.
+// WordPress elements are matched by local name as their namespace changes
+// with the export version.
+type wxr struct {
+	Channel struct {
+		Authors []struct {
+			Login       string `xml:"author_login"`
+			Email       string `xml:"author_email"`
+			DisplayName string `xml:"author_display_name"`
+		} `xml:"author"`
+		Items []wxrItem `xml:"item"`
+	} `xml:"channel"`
+}
+
+type wxrItem struct {
+	Title   string `xml:"title"`
+	Creator string `xml:"creator"`
+	// Content is qualified as the excerpt shares its local name
+	Content    string `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Name       string `xml:"post_name"`
+	Date       string `xml:"post_date"`
+	DateGMT    string `xml:"post_date_gmt"`
+	Status     string `xml:"status"`
+	Type       string `xml:"post_type"`
+	Categories []struct {
+		Domain string `xml:"domain,attr"`
+		Name   string `xml:",chardata"`
+	} `xml:"category"`
+}
+
+// ReadWXR reads the posts and authors of a WordPress export. Pages,
+// attachments and other item types are ignored, and post bodies are converted
+// from HTML to Markdown.
+func ReadWXR(r io.Reader, source string) ([]Post, []Author, error) {
+	var doc wxr
+	d := xml.NewDecoder(r)
+	d.Entity = xml.HTMLEntity
+	if err := d.Decode(&doc); err != nil {
+		return nil, nil, err
+	}
+
+	var authors []Author
+	for _, a := range doc.Channel.Authors {
+		authors = append(authors, Author{
+			Username: strings.TrimSpace(a.Login),
+			Name:     strings.TrimSpace(a.DisplayName),
+			Email:    strings.TrimSpace(a.Email),
+		})
+	}
+
+	var posts []Post
+	for _, item := range doc.Channel.Items {
+		if item.Type != "post" {
+			continue
+		}
+
+		slug, err := url.PathUnescape(strings.TrimSpace(item.Name))
+		if err != nil {
+			slug = item.Name
+		}
+		post := Post{
+			Source: source + ": " + item.Title,
+			Title:  strings.TrimSpace(item.Title),
+			Slug:   slug,
+			Author: strings.TrimSpace(item.Creator),
+			Draft:  item.Status != "publish",
+			Body:   markdown.FromHTML(item.Content),
+		}
+
+		// Drafts have a zero GMT date
+		post.Date = parseDate(item.DateGMT)
+		if post.Date == nil {
+			post.Date = parseDate(item.Date)
+		}
+
+		for _, c := range item.Categories {
+			switch c.Domain {
+			case "category":
+				post.Categories = addUnique(post.Categories, c.Name)
+			case "post_tag":
+				post.Tags = addUnique(post.Tags, c.Name)
+			}
+		}
+		posts = append(posts, post)
+	}
+	return posts, authors, nil
+}
@@ -0,0 +1,314 @@
+// Package logging writes leveled, structured logs.
+//
+// Each record is a message with key value pairs, written as a line of JSON
+// or logfmt. Loggers are named after the subsystem they log for, such as
+// models or webhooks, and the level logged at can be set for each subsystem
+// so one can be debugged without the noise of the others. Records logged
+// with the context of a request carry its request ID.
+package logging
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Level is how severe a record is
+type Level int
+
+// Levels, from least to most severe
+const (
+	Debug Level = iota
+	Info
+	Warn
+	Error
+)
+
+var levelNames = []string{"debug", "info", "warn", "error"}
+
+func (l Level) String() string {
+	if l < Debug || l > Error {
+		return strconv.Itoa(int(l))
+	}
+	return levelNames[l]
+}
+
+// ParseLevel parses the name of a level
+func ParseLevel(s string) (Level, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	if s == "warning" {
+		return Warn, nil
+	}
+	for i, name := range levelNames {
+		if s == name {
+			return Level(i), nil
+		}
+	}
+	return Info, errors.New("log level must be debug, info, warn or error: " + s)
+}
+
+// ParseLevels parses the levels of subsystems written as subsystem=level
+// pairs separated by semicolons, such as "models=debug; http=warn"
+func ParseLevels(s string) (map[string]Level, error) {
+	levels := make(map[string]Level)
+	for _, pair := range strings.Split(s, ";") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		kv := strings.SplitN(pair, "=", 2)
+		if len(kv) != 2 || strings.TrimSpace(kv[0]) == "" {
+			return nil, errors.New("log levels must be written as subsystem=level: " + strings.TrimSpace(pair))
+		}
+		level, err := ParseLevel(kv[1])
+		if err != nil {
+			return nil, err
+		}
+		levels[strings.TrimSpace(kv[0])] = level
+	}
+	return levels, nil
+}
+
+// Formats records are written in
+const (
+	FormatJSON   = "json"
+	FormatLogfmt = "logfmt"
+)
+
+// Options configures logging
+type Options struct {
+	// Format is FormatJSON or FormatLogfmt
+	Format string
+	// Level is the least severe level logged by subsystems not in Levels
+	Level  Level
+	Levels map[string]Level
+	// Output is where records are written, os.Stdout when nil
+	Output io.Writer
+}
+
+var (
+	mu      sync.Mutex
+	options = Options{Format: FormatJSON, Level: Info, Output: os.Stdout}
+)
+
+// Configure sets how every logger writes records
+func Configure(opts Options) error {
+	if opts.Format == "" {
+		opts.Format = FormatJSON
+	}
+	if opts.Format != FormatJSON && opts.Format != FormatLogfmt {
+		return errors.New("log format must be json or logfmt")
+	}
+	if opts.Output == nil {
+		opts.Output = os.Stdout
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	options = opts
+	return nil
+}
+
+// Logger writes records for a subsystem, with fields added to every record
+type Logger struct {
+	subsystem string
+	fields    []interface{}
+}
+
+// For returns the logger of a subsystem
+func For(subsystem string) *Logger {
+	return &Logger{subsystem: subsystem}
+}
+
+// With returns a logger adding key value pairs to every record
+func (l *Logger) With(keyvals ...interface{}) *Logger {
+	fields := make([]interface{}, 0, len(l.fields)+len(keyvals))
+	fields = append(append(fields, l.fields...), keyvals...)
+	return &Logger{subsystem: l.subsystem, fields: fields}
+}
+
+// Ctx returns a logger adding the request ID of ctx, if any, to every
+// record
+func (l *Logger) Ctx(ctx context.Context) *Logger {
+	if id := RequestID(ctx); id != "" {
+		return l.With("request_id", id)
+	}
+	return l
+}
+
+// Enabled reports whether records of a level are written
+func (l *Logger) Enabled(level Level) bool {
+	mu.Lock()
+	defer mu.Unlock()
+	return level >= levelOf(l.subsystem)
+}
+
+// levelOf returns the level of a subsystem, with mu held
+func levelOf(subsystem string) Level {
+	if level, ok := options.Levels[subsystem]; ok {
+		return level
+	}
+	return options.Level
+}
+
+// Debug logs detail useful when looking into a problem
+func (l *Logger) Debug(msg string, keyvals ...interface{}) {
+	l.log(Debug, msg, keyvals)
+}
+
+// Info logs what the blog is doing
+func (l *Logger) Info(msg string, keyvals ...interface{}) {
+	l.log(Info, msg, keyvals)
+}
+
+// Warn logs something unexpected which was recovered from
+func (l *Logger) Warn(msg string, keyvals ...interface{}) {
+	l.log(Warn, msg, keyvals)
+}
+
+// Error logs a failure
+func (l *Logger) Error(msg string, keyvals ...interface{}) {
+	l.log(Error, msg, keyvals)
+}
+
+// log writes a record unless its level is below that of the subsystem
+func (l *Logger) log(level Level, msg string, keyvals []interface{}) {
+	mu.Lock()
+	defer mu.Unlock()
+	if level < levelOf(l.subsystem) {
+		return
+	}
+
+	fields := []interface{}{
+		"time", time.Now().UTC().Format(time.RFC3339Nano),
+		"level", level.String(),
+		"subsystem", l.subsystem,
+		"msg", msg,
+	}
+	fields = append(append(fields, l.fields...), keyvals...)
+	if len(fields)%2 != 0 {
+		fields = append(fields, "(missing)")
+	}
+
+	var buf bytes.Buffer
+	if options.Format == FormatLogfmt {
+		writeLogfmt(&buf, fields)
+	} else {
+		writeJSON(&buf, fields)
+	}
+	buf.WriteByte('\n')
+	options.Output.Write(buf.Bytes())
+}
+
+// value returns what is written for a field
+func value(v interface{}) interface{} {
+	switch v := v.(type) {
+	case error:
+		return v.Error()
+	case time.Duration:
+		return v.String()
+	case fmt.Stringer:
+		return v.String()
+	}
+	return v
+}
+
+func writeJSON(buf *bytes.Buffer, fields []interface{}) {
+	buf.WriteByte('{')
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, _ := json.Marshal(fmt.Sprint(fields[i]))
+		buf.Write(key)
+		buf.WriteByte(':')
+		val, err := json.Marshal(value(fields[i+1]))
+		if err != nil {
+			val, _ = json.Marshal(fmt.Sprint(fields[i+1]))
+		}
+		buf.Write(val)
+	}
+	buf.WriteByte('}')
+}
+
+func writeLogfmt(buf *bytes.Buffer, fields []interface{}) {
+	for i := 0; i < len(fields); i += 2 {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(logfmtKey(fmt.Sprint(fields[i])))
+		buf.WriteByte('=')
+		buf.WriteString(logfmtValue(fmt.Sprint(value(fields[i+1]))))
+	}
+}
+
+// logfmtKey replaces the characters keys may not have
+func logfmtKey(key string) string {
+	return strings.Map(func(r rune) rune {
+		if r <= ' ' || r == '=' || r == '"' {
+			return '_'
+		}
+		return r
+	}, key)
+}
+
+// logfmtValue quotes values with spaces, quotes or equals signs
+func logfmtValue(v string) string {
+	if v == "" || strings.ContainsAny(v, " =\"\\\t\r\n") {
+		return strconv.Quote(v)
+	}
+	return v
+}
+
+// requestIDKey is the context key of the request ID
+type requestIDKey struct{}
+
+// WithRequestID returns a context carrying a request ID
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID carried by a context, or ""
+func RequestID(ctx context.Context) string {
+	if ctx == nil {
+		return ""
+	}
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// NewRequestID returns a random request ID
+func NewRequestID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 36)
+	}
+	return hex.EncodeToString(b)
+}
+
+// Writer returns a writer logging each line written to it, so the log
+// package of the standard library and the libraries using it write
+// records too
+func Writer(subsystem string, level Level) io.Writer {
+	return &lineWriter{logger: For(subsystem), level: level}
+}
+
+type lineWriter struct {
+	logger *Logger
+	level  Level
+}
+
+func (w *lineWriter) Write(p []byte) (int, error) {
+	for _, line := range strings.Split(strings.TrimRight(string(p), "\n"), "\n") {
+		w.logger.log(w.level, line, nil)
+	}
+	return len(p), nil
+}
@@ -1,11 +1,19 @@
 package main
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"io/ioutil"
 	"log"
 	"net"
 	"net/http"
 	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 
 	Gorilla "github.com/gorilla/handlers"
 	"github.com/gorilla/mux"
@@ -14,58 +22,661 @@ import (
 	_ "github.com/lib/pq"
 	"github.com/spf13/viper"
 
+	"github.com/mattgen88/blog/cache"
+	"github.com/mattgen88/blog/cluster"
+	"github.com/mattgen88/blog/graphql"
 	"github.com/mattgen88/blog/handlers"
-	"github.com/mattgen88/blog/util"
+	"github.com/mattgen88/blog/imaging"
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/media"
+	"github.com/mattgen88/blog/metrics"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/moderation"
+	"github.com/mattgen88/blog/search"
+	"github.com/mattgen88/blog/theme"
+	"github.com/mattgen88/blog/webhooks"
 )
 
 func main() {
+	configure()
+
+	if err := configureLogging(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+
+	db, err := sql.Open("postgres", viper.GetString("dsn"))
+	if err != nil {
+		logs.Error("Failed to open the database", "err", err)
+		os.Exit(1)
+	}
+
+	defer db.Close()
+
+	command := "serve"
+	if len(os.Args) > 1 {
+		command = os.Args[1]
+	}
+
+	switch command {
+	case "serve":
+		err = serve(db)
+	case "migrate":
+		if err = waitForDatabase(db); err == nil {
+			err = models.Migrate(db)
+		}
+	case "reindex":
+		err = reindex(db)
+	case "export-static":
+		err = exportStatic(db)
+	case "import":
+		err = importPosts(db)
+	case "backup":
+		err = backupBlog(db)
+	case "restore":
+		err = restoreBlog(db)
+	case "openapi":
+		err = describeAPI(db)
+	default:
+		err = errors.New("unknown command " + command)
+	}
+
+	if err != nil {
+		logs.Error("Command failed", "command", command, "err", err)
+		os.Exit(1)
+	}
+}
+
+// configure gathers the configuration from the environment, with its
+// defaults
+func configure() {
 	viper.AutomaticEnv()
 
-	// Gather configuration
 	viper.BindEnv("dsn")
-	dsn := viper.GetString("dsn")
 
 	viper.BindEnv("port")
 	viper.SetDefault("port", "8088")
-	port := viper.GetString("port")
 
 	viper.BindEnv("host")
 	viper.SetDefault("host", "127.0.0.1")
+
+	// Path the search index is persisted to, empty to keep it in memory only
+	viper.BindEnv("search_index")
+	viper.SetDefault("search_index", "search.idx")
+
+	viper.BindEnv("site_title")
+	viper.SetDefault("site_title", "Blog")
+
+	viper.BindEnv("site_description")
+
+	// Public URL of the blog for absolute links, derived from requests if
+	// empty. Feed entry IDs are minted under its host, or under localhost when
+	// empty, so it should be set before a feed is first published.
+	viper.BindEnv("base_url")
+
+	// Path the blog is served under, such as /blog, empty to serve it at the
+	// root. The public URL doesn't include it.
+	viper.BindEnv("path_prefix")
+
+	// Write links in API responses as absolute URLs rather than paths
+	viper.BindEnv("absolute_links")
+	viper.SetDefault("absolute_links", false)
+
+	// Derive the public URL from the Forwarded or X-Forwarded-Proto and
+	// X-Forwarded-Host headers when base_url is empty, only safe behind a proxy
+	// setting them
+	viper.BindEnv("trust_forwarded")
+	viper.SetDefault("trust_forwarded", false)
+
+	// Cache-Control headers of GET responses by route name, as route=policy
+	// pairs separated by semicolons, such as "static=public, max-age=3600;
+	// *=no-cache". The policy of * applies to routes not listed.
+	viper.BindEnv("cache_control")
+	viper.SetDefault("cache_control", "*=no-cache")
+
+	// Memory held by cached API responses of articles and categories, such as
+	// 16MB, 0 to disable the cache, and how long each is served for at most
+	viper.BindEnv("response_cache_size")
+	viper.SetDefault("response_cache_size", "16MB")
+
+	viper.BindEnv("response_cache_ttl")
+	viper.SetDefault("response_cache_ttl", "5m")
+
+	// Publish writes to the other instances sharing the database and apply
+	// theirs to the response cache and search index, through LISTEN/NOTIFY
+	viper.BindEnv("cluster")
+	viper.SetDefault("cluster", true)
+
+	// How long responses to POST requests made with an Idempotency-Key are
+	// replayed to retries
+	viper.BindEnv("idempotency_window")
+	viper.SetDefault("idempotency_window", "24h")
+
+	// Where uploaded media is stored, either local to keep it in media_dir
+	// or s3 to keep it in a bucket of an S3 compatible service
+	viper.BindEnv("media_storage")
+	viper.SetDefault("media_storage", "local")
+
+	viper.BindEnv("media_dir")
+	viper.SetDefault("media_dir", "data/media")
+
+	// The bucket media is stored in, on AWS in the region unless an endpoint
+	// is given. Stand-ins such as MinIO usually need path style addressing,
+	// which names the bucket in the path rather than the host.
+	viper.BindEnv("media_s3_endpoint")
+	viper.BindEnv("media_s3_region")
+	viper.SetDefault("media_s3_region", "us-east-1")
+	viper.BindEnv("media_s3_bucket")
+	viper.BindEnv("media_s3_access_key")
+	viper.BindEnv("media_s3_secret_key")
+	viper.BindEnv("media_s3_path_style")
+	viper.SetDefault("media_s3_path_style", false)
+
+	// Largest file which may be uploaded, and how much each user may upload
+	// in all, 0 for no quota
+	viper.BindEnv("media_max_size")
+	viper.SetDefault("media_max_size", "10MB")
+
+	viper.BindEnv("media_quota")
+	viper.SetDefault("media_quota", "100MB")
+
+	// Sizes images are rendered at, as name=width or name=widthxheight to crop
+	// to an aspect, rendered on upload when eager or else on first request
+	viper.BindEnv("image_variants")
+	viper.SetDefault("image_variants", "thumbnail=200x200; small=480; medium=960; large=1920")
+
+	viper.BindEnv("image_variants_eager")
+	viper.SetDefault("image_variants_eager", false)
+
+	// Format of variants, auto for JPEG unless an image has transparency,
+	// jpeg or png, and the quality of JPEGs
+	viper.BindEnv("image_format")
+	viper.SetDefault("image_format", "auto")
+
+	viper.BindEnv("image_quality")
+	viper.SetDefault("image_quality", 85)
+
+	// Either full, to publish whole articles in feeds, or excerpt
+	viper.BindEnv("feed_content")
+	viper.SetDefault("feed_content", "full")
+
+	viper.BindEnv("feed_items")
+	viper.SetDefault("feed_items", 20)
+
+	// Comma separated route names, or paths beginning with a slash under
+	// path_prefix, robots.txt asks crawlers to stay out of
+	viper.BindEnv("robots_disallow")
+	viper.SetDefault("robots_disallow", "moderation")
+
+	// File served as robots.txt instead of the generated one
+	viper.BindEnv("robots_txt")
+
+	// Directory of templates overriding the built in HTML theme
+	viper.BindEnv("theme_dir")
+
+	// Directory export-static writes the static mirror to, unless given as
+	// an argument
+	viper.BindEnv("export_dir")
+	viper.SetDefault("export_dir", "public")
+
+	// Whether readers without an account may comment with a name and email
+	viper.BindEnv("comments_anonymous")
+	viper.SetDefault("comments_anonymous", false)
+
+	viper.BindEnv("comments_per_page")
+	viper.SetDefault("comments_per_page", 20)
+
+	// Approved comments after which a signed in commenter skips the
+	// moderation queue, zero holds every comment for review. Anonymous
+	// comments are always reviewed.
+	viper.BindEnv("comments_trust_after")
+	viper.SetDefault("comments_trust_after", 2)
+
+	// Links a comment may contain before being held, twice as many is spam
+	viper.BindEnv("comments_max_links")
+	viper.SetDefault("comments_max_links", 2)
+
+	// Classifier probability at which a comment is treated as spam
+	viper.BindEnv("spam_threshold")
+	viper.SetDefault("spam_threshold", 0.9)
+
+	// Attempts at delivering a webhook before giving up on it
+	viper.BindEnv("webhook_attempts")
+	viper.SetDefault("webhook_attempts", 8)
+
+	viper.BindEnv("webhook_timeout")
+	viper.SetDefault("webhook_timeout", "10s")
+
+	// Limits on how deeply nested and how costly GraphQL queries may be
+	viper.BindEnv("graphql_max_depth")
+	viper.SetDefault("graphql_max_depth", 10)
+
+	viper.BindEnv("graphql_max_complexity")
+	viper.SetDefault("graphql_max_complexity", 5000)
+
+	// How long to keep retrying the database when starting before giving up
+	viper.BindEnv("db_connect_timeout")
+	viper.SetDefault("db_connect_timeout", "60s")
+
+	// Timeouts of the server reading requests, writing responses and
+	// keeping idle connections open
+	viper.BindEnv("server_read_header_timeout")
+	viper.SetDefault("server_read_header_timeout", "10s")
+
+	viper.BindEnv("server_read_timeout")
+	viper.SetDefault("server_read_timeout", "60s")
+
+	viper.BindEnv("server_write_timeout")
+	viper.SetDefault("server_write_timeout", "60s")
+
+	viper.BindEnv("server_idle_timeout")
+	viper.SetDefault("server_idle_timeout", "120s")
+
+	// On SIGTERM or SIGINT, how long readiness checks fail before the server
+	// stops accepting connections, so load balancers notice, and how long
+	// requests in flight are given to finish
+	viper.BindEnv("shutdown_delay")
+	viper.SetDefault("shutdown_delay", "0s")
+
+	viper.BindEnv("shutdown_timeout")
+	viper.SetDefault("shutdown_timeout", "30s")
+
+	// Bearer token scrapes of /metrics must send, empty to serve anyone
+	viper.BindEnv("metrics_token")
+
+	// Logs are written to stdout as json or logfmt. Subsystems log at
+	// log_level and above unless given their own level in log_levels, as
+	// subsystem=level pairs separated by semicolons, such as "models=debug;
+	// http=warn". The subsystems are http, handlers, models, webhooks,
+	// cluster, search, moderation, importer and main.
+	viper.BindEnv("log_format")
+	viper.SetDefault("log_format", logging.FormatJSON)
+
+	viper.BindEnv("log_level")
+	viper.SetDefault("log_level", "info")
+
+	viper.BindEnv("log_levels")
+}
+
+// logs is the logger of the commands
+var logs = logging.For("main")
+
+// configureLogging sets how logs are written. What the log package of the
+// standard library is given, such as by libraries, is logged by main.
+func configureLogging() error {
+	level, err := logging.ParseLevel(viper.GetString("log_level"))
+	if err != nil {
+		return err
+	}
+	levels, err := logging.ParseLevels(viper.GetString("log_levels"))
+	if err != nil {
+		return err
+	}
+	err = logging.Configure(logging.Options{
+		Format: viper.GetString("log_format"),
+		Level:  level,
+		Levels: levels,
+	})
+	if err != nil {
+		return err
+	}
+	log.SetFlags(0)
+	log.SetOutput(logging.Writer("main", logging.Info))
+	return nil
+}
+
+// serve runs the blog http server
+func serve(db *sql.DB) error {
 	host := viper.GetString("host")
-	log.Println("Starting on ", host, " port ", port, " dsn ", dsn)
+	port := viper.GetString("port")
+	logs.Info("Starting", "host", host, "port", port)
+
+	if err := waitForDatabase(db); err != nil {
+		return err
+	}
+	if err := models.Migrate(db); err != nil {
+		return err
+	}
 
-	db, err := sql.Open("postgres", dsn)
+	index := search.Open(viper.GetString("search_index"), db)
+	indexer := search.NewSyncer(index, viper.GetString("search_index"), db)
+	indexer.Listen()
+	indexer.Start()
+	defer indexer.Stop()
+
+	hooks := webhooks.New(db, webhooks.Options{
+		MaxAttempts: viper.GetInt("webhook_attempts"),
+		Timeout:     viper.GetDuration("webhook_timeout"),
+	})
+	hooks.Listen()
+	hooks.Start()
+	defer hooks.Stop()
+
+	var responses *cache.Cache
+	if size := viper.GetSizeInBytes("response_cache_size"); size > 0 {
+		responses = cache.New(cache.Options{
+			MaxBytes: int(size),
+			TTL:      viper.GetDuration("response_cache_ttl"),
+		})
+	}
+
+	node := clusterNode(db)
+	if node != nil {
+		node.OnWrite(indexer.Apply)
+		node.OnResync(indexer.Resync)
+	}
+
+	stopping := make(chan struct{})
+	r, _, err := router(db, index, hooks, responses, node, stopping, viper.GetString("path_prefix"))
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	defer db.Close()
+	if node != nil {
+		node.Publish()
+		node.Start()
+		defer node.Stop()
+	}
 
+	// The webhook dispatcher, cluster node and search syncer are stopped
+	// once the server has shut down, finishing the deliveries in flight and
+	// saving the index
+	return run(&http.Server{
+		Addr:              net.JoinHostPort(host, port),
+		Handler:           handlers.RequestID(handlers.AccessLog(Gorilla.CORS()(r))),
+		ErrorLog:          log.New(logging.Writer("http", logging.Warn), "", 0),
+		ReadHeaderTimeout: viper.GetDuration("server_read_header_timeout"),
+		ReadTimeout:       viper.GetDuration("server_read_timeout"),
+		WriteTimeout:      viper.GetDuration("server_write_timeout"),
+		IdleTimeout:       viper.GetDuration("server_idle_timeout"),
+	}, stopping)
+}
+
+// run serves until SIGTERM or SIGINT, then closes stopping so readiness
+// checks fail, waits shutdown_delay and shuts the server down, giving the
+// requests in flight shutdown_timeout to finish
+func run(srv *http.Server, stopping chan struct{}) error {
+	errs := make(chan error, 1)
+	go func() {
+		errs <- srv.ListenAndServe()
+	}()
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, syscall.SIGINT)
+	defer signal.Stop(signals)
+
+	select {
+	case err := <-errs:
+		return err
+	case sig := <-signals:
+		logs.Info("Shutting down", "signal", sig)
+	}
+
+	close(stopping)
+	time.Sleep(viper.GetDuration("shutdown_delay"))
+
+	ctx, cancel := context.WithTimeout(context.Background(), viper.GetDuration("shutdown_timeout"))
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		return err
+	}
+	logs.Info("Server stopped")
+	return nil
+}
+
+// waitForDatabase pings the database until it answers, backing off between
+// attempts, so the blog can start before the database is up. It gives up
+// after db_connect_timeout.
+func waitForDatabase(db *sql.DB) error {
+	deadline := time.Now().Add(viper.GetDuration("db_connect_timeout"))
+	backoff := 500 * time.Millisecond
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		err := db.PingContext(ctx)
+		cancel()
+		if err == nil {
+			return nil
+		}
+		if time.Now().Add(backoff).After(deadline) {
+			return err
+		}
+		logs.Warn("Waiting for the database", "err", err, "retry", backoff)
+		time.Sleep(backoff)
+		if backoff *= 2; backoff > 10*time.Second {
+			backoff = 10 * time.Second
+		}
+	}
+}
+
+// clusterNode returns the node keeping instances in step, or nil when the
+// blog isn't clustered
+func clusterNode(db *sql.DB) *cluster.Node {
+	if !viper.GetBool("cluster") {
+		return nil
+	}
+	return cluster.New(db, viper.GetString("dsn"), cluster.Options{})
+}
+
+// router configures the handlers and routes of the blog under a path prefix,
+// returning the theme pages are rendered with. Every route is named so links
+// to it can be built. Responses are cached in responses unless it is nil,
+// and invalidated by the writes of other instances when node is set.
+// Readiness checks fail once stopping is closed.
+func router(db *sql.DB, index *search.Index, hooks *webhooks.Dispatcher, responses *cache.Cache, node *cluster.Node, stopping <-chan struct{}, prefix string) (*mux.Router, *theme.Theme, error) {
 	r := mux.NewRouter()
+	if prefix = strings.TrimSuffix(prefix, "/"); prefix != "" {
+		r = r.PathPrefix(prefix).Subrouter()
+	}
 
 	h := handlers.New(r, db)
+	h.SetSearchIndex(index)
+	h.SetWebhooks(hooks)
+	h.SetResponseCache(responses)
+	h.SetStopping(stopping)
+	registry := metrics.NewRegistry()
+	instrument(registry, db, hooks, responses, node)
+	h.SetMetrics(registry, viper.GetString("metrics_token"))
+	if node != nil {
+		node.OnWrite(h.InvalidateCache)
+		node.OnResync(h.PurgeCache)
+	}
+	h.SetCommentOptions(handlers.CommentOptions{
+		Anonymous: viper.GetBool("comments_anonymous"),
+		PerPage:   viper.GetInt("comments_per_page"),
+	})
+	h.SetModerator(moderation.New(db, moderation.Options{
+		TrustAfter:    viper.GetInt("comments_trust_after"),
+		MaxLinks:      viper.GetInt("comments_max_links"),
+		SpamThreshold: viper.GetFloat64("spam_threshold"),
+	}))
+	h.SetSite(handlers.Site{
+		Title:       viper.GetString("site_title"),
+		Description: viper.GetString("site_description"),
+		BaseURL:     viper.GetString("base_url"),
+	})
+	h.SetLinkOptions(handlers.LinkOptions{
+		Absolute:       viper.GetBool("absolute_links"),
+		TrustForwarded: viper.GetBool("trust_forwarded"),
+	})
+	policies, err := handlers.ParseCachePolicies(viper.GetString("cache_control"))
+	if err != nil {
+		return nil, nil, err
+	}
+	h.SetCachePolicies(policies)
+	h.SetIdempotencyOptions(handlers.IdempotencyOptions{
+		Window: viper.GetDuration("idempotency_window"),
+	})
+	store, err := mediaStore()
+	if err != nil {
+		return nil, nil, err
+	}
+	h.SetMediaStore(store)
+	variants, err := imaging.ParseVariants(viper.GetString("image_variants"))
+	if err != nil {
+		return nil, nil, err
+	}
+	switch viper.GetString("image_format") {
+	case imaging.FormatAuto, imaging.FormatJPEG, imaging.FormatPNG:
+	default:
+		return nil, nil, errors.New("image_format must be auto, jpeg or png")
+	}
+	h.SetMediaOptions(handlers.MediaOptions{
+		MaxSize:  int64(viper.GetSizeInBytes("media_max_size")),
+		Quota:    int64(viper.GetSizeInBytes("media_quota")),
+		Variants: variants,
+		Eager:    viper.GetBool("image_variants_eager"),
+		Format:   viper.GetString("image_format"),
+		Quality:  viper.GetInt("image_quality"),
+	})
+	h.SetFeedOptions(handlers.FeedOptions{
+		Full:  viper.GetString("feed_content") == "full",
+		Items: viper.GetInt("feed_items"),
+	})
+	h.SetGraphQLLimits(graphql.Limits{
+		MaxDepth:      viper.GetInt("graphql_max_depth"),
+		MaxComplexity: viper.GetInt("graphql_max_complexity"),
+	})
+
+	robots := handlers.RobotsOptions{}
+	for _, path := range strings.Split(viper.GetString("robots_disallow"), ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			robots.Disallow = append(robots.Disallow, path)
+		}
+	}
+	if file := viper.GetString("robots_txt"); file != "" {
+		body, err := ioutil.ReadFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		robots.Body = string(body)
+	}
+	h.SetRobotsOptions(robots)
+
+	t, err := theme.Load(viper.GetString("theme_dir"))
+	if err != nil {
+		return nil, nil, err
+	}
+	h.SetTheme(t)
+
+	// Feeds, sitemaps, robots.txt and theme assets are served in their own
+	// formats, everything else negotiates between the API representations and
+	// HTML pages
+	r.HandleFunc("/feed.{format:rss|atom|json}", h.FeedHandler).Name("feed")
+	r.HandleFunc("/categories/{category}/feed.{format:rss|atom|json}", h.CategoryFeedHandler).Name("category-feed")
+	r.HandleFunc("/users/{id}/feed.{format:rss|atom|json}", h.UserFeedHandler).Name("user-feed")
+
+	r.HandleFunc("/sitemap.xml", h.SitemapHandler).Name("sitemap")
+	r.HandleFunc("/sitemap-{page:[0-9]+}.xml", h.SitemapPageHandler).Name("sitemap-page")
+	r.HandleFunc("/robots.txt", h.RobotsHandler).Name("robots")
+
+	// Liveness and readiness checks for load balancers and orchestrators, and
+	// metrics for Prometheus
+	r.HandleFunc("/healthz", h.HealthHandler).Name("healthz")
+	r.HandleFunc("/readyz", h.ReadyHandler).Name("readyz")
+	r.HandleFunc("/metrics", h.MetricsHandler).Name("metrics")
+
+	if t.Static != "" {
+		r.PathPrefix("/static/").Handler(http.StripPrefix(prefix+"/static/", http.FileServer(http.Dir(t.Static)))).Name("static")
+	}
 
-	r.HandleFunc("/", h.RootHandler).Name("root")
+	r.HandleFunc("/", h.Negotiate(h.RootHandler, h.HomePage)).Name("root")
 
-	r.HandleFunc("/articles", h.ArticleListHandler)
-	r.HandleFunc("/articles/", h.ArticleListHandler)
+	// Paths ending in a slash are served the same as those without, only
+	// the latter are named as links are built to them
+	r.HandleFunc("/articles", h.Negotiate(h.ArticleListHandler, h.ArchivePage)).Name("articles")
+	r.HandleFunc("/articles/", h.Negotiate(h.ArticleListHandler, h.ArchivePage))
 
-	r.HandleFunc("/categories", h.CategoryListHandler)
+	r.HandleFunc("/categories", h.CategoryListHandler).Name("categories")
 	r.HandleFunc("/categories/", h.CategoryListHandler)
 
-	r.HandleFunc("/categories/{category}", h.CategoryHandler)
-	r.HandleFunc("/categories/{category}/", h.CategoryHandler)
+	r.HandleFunc("/categories/{category}", h.Negotiate(h.CategoryHandler, h.CategoryPage)).Name("category")
+	r.HandleFunc("/categories/{category}/", h.Negotiate(h.CategoryHandler, h.CategoryPage))
+
+	r.HandleFunc("/tags/{tag}", h.Negotiate(h.TagHandler, h.TagPage)).Name("tag")
+	r.HandleFunc("/tags/{tag}/", h.Negotiate(h.TagHandler, h.TagPage))
+
+	r.HandleFunc("/articles/{id}", h.Negotiate(h.ArticleHandler, h.ArticlePage)).Name("article")
+	r.HandleFunc("/articles/{id}/", h.Negotiate(h.ArticleHandler, h.ArticlePage))
+
+	r.HandleFunc("/articles/{id}/comments", h.CommentListHandler).Methods("GET").Name("comments")
+	r.HandleFunc("/articles/{id}/comments", h.CreateCommentHandler).Methods("POST").Name("create-comment")
+
+	r.HandleFunc("/articles/{id}/comments/{comment:[0-9]+}", h.CommentHandler).Methods("GET").Name("comment")
+	r.HandleFunc("/articles/{id}/comments/{comment:[0-9]+}", h.EditCommentHandler).Methods("PUT", "PATCH").Name("edit-comment")
+	r.HandleFunc("/articles/{id}/comments/{comment:[0-9]+}", h.DeleteCommentHandler).Methods("DELETE").Name("delete-comment")
+
+	r.HandleFunc("/moderation/comments", h.ModerationQueueHandler).Methods("GET").Name("moderation")
+	r.HandleFunc("/moderation/comments", h.BulkModerateHandler).Methods("POST").Name("bulk-moderate")
+	r.HandleFunc("/moderation/comments/{comment:[0-9]+}", h.ModerateCommentHandler).Methods("PUT", "PATCH").Name("moderate-comment")
+
+	r.HandleFunc("/webhooks", h.WebhookListHandler).Methods("GET").Name("webhooks")
+	r.HandleFunc("/webhooks", h.CreateWebhookHandler).Methods("POST").Name("create-webhook")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}", h.WebhookHandler).Methods("GET").Name("webhook")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}", h.EditWebhookHandler).Methods("PUT", "PATCH").Name("edit-webhook")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}", h.DeleteWebhookHandler).Methods("DELETE").Name("delete-webhook")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}/test", h.TestWebhookHandler).Methods("POST").Name("test-webhook")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}/deliveries", h.DeliveryListHandler).Methods("GET").Name("deliveries")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}/deliveries/{delivery:[0-9]+}", h.DeliveryHandler).Methods("GET").Name("delivery")
+	r.HandleFunc("/webhooks/{webhook:[0-9]+}/deliveries/{delivery:[0-9]+}/redeliver", h.RedeliverHandler).Methods("POST").Name("redeliver")
+
+	r.HandleFunc("/media", h.MediaListHandler).Methods("GET").Name("library")
+	r.HandleFunc("/media", h.UploadMediaHandler).Methods("POST").Name("upload-media")
+	r.HandleFunc("/media/{media:[0-9]+}", h.MediaHandler).Methods("GET").Name("media")
+	r.HandleFunc("/media/{media:[0-9]+}", h.EditMediaHandler).Methods("PUT", "PATCH").Name("edit-media")
+	r.HandleFunc("/media/{media:[0-9]+}", h.DeleteMediaHandler).Methods("DELETE").Name("delete-media")
+	r.HandleFunc("/media/{media:[0-9]+}/file", h.MediaFileHandler).Methods("GET").Name("media-file")
+	r.HandleFunc("/media/{media:[0-9]+}/variants/{variant}", h.MediaVariantHandler).Methods("GET").Name("media-variant")
+
+	r.HandleFunc("/graphql", h.GraphQLHandler).Methods("GET", "POST").Name("graphql")
 
-	r.HandleFunc("/articles/{id}", h.ArticleHandler)
-	r.HandleFunc("/articles/{id}/", h.ArticleHandler)
+	r.HandleFunc("/openapi.json", h.OpenAPIHandler).Name("openapi")
+	r.HandleFunc("/rels/{rel}", h.Negotiate(h.RelationHandler, h.RelationPage)).Name("relation")
 
-	r.HandleFunc("/users", h.UsersListHandler)
+	r.HandleFunc("/users", h.UsersListHandler).Name("users")
 	r.HandleFunc("/users/", h.UsersListHandler)
 
-	r.HandleFunc("/users/{id}", h.UserHandler)
-	r.HandleFunc("/users/{id}/", h.UserHandler)
+	r.HandleFunc("/users/{id}", h.Negotiate(h.UserHandler, h.AuthorPage)).Name("user")
+	r.HandleFunc("/users/{id}/", h.Negotiate(h.UserHandler, h.AuthorPage))
 
-	r.NotFoundHandler = http.HandlerFunc(handlers.ErrorHandler)
+	r.HandleFunc("/search", h.SearchHandler).Name("search")
+	r.HandleFunc("/search/", h.SearchHandler)
 
-	log.Fatal(http.ListenAndServe(net.JoinHostPort(host, port), util.ContentType(Gorilla.LoggingHandler(os.Stdout, Gorilla.CORS()(r)), "application/hal+json")))
+	r.HandleFunc("/search/suggest", h.SuggestHandler).Name("suggest")
+	r.HandleFunc("/search/suggest/", h.SuggestHandler)
+
+	// Middleware only wraps matched routes, so requests matching none are
+	// metered here
+	r.NotFoundHandler = h.Metrics(h.Negotiate(handlers.ErrorHandler, h.NotFoundPage))
+
+	for name := range policies {
+		if name != "*" && r.Get(name) == nil {
+			logs.Warn("No route named for its cache policy", "route", name)
+		}
+	}
+	for _, entry := range robots.Disallow {
+		if !strings.HasPrefix(entry, "/") && r.Get(entry) == nil {
+			logs.Warn("No route named to disallow in robots.txt", "route", entry)
+		}
+	}
+	r.Use(h.Metrics, h.CacheControl, h.ResponseCache, h.Idempotency)
+
+	return r, t, nil
+}
+
+// mediaStore returns the backend uploaded media is stored by
+func mediaStore() (media.Store, error) {
+	switch viper.GetString("media_storage") {
+	case "local":
+		return media.NewLocal(viper.GetString("media_dir")), nil
+	case "s3":
+		return media.NewS3(media.S3Options{
+			Endpoint:  viper.GetString("media_s3_endpoint"),
+			Region:    viper.GetString("media_s3_region"),
+			Bucket:    viper.GetString("media_s3_bucket"),
+			AccessKey: viper.GetString("media_s3_access_key"),
+			SecretKey: viper.GetString("media_s3_secret_key"),
+			PathStyle: viper.GetBool("media_s3_path_style"),
+		})
+	}
+	return nil, errors.New("media_storage must be local or s3")
 }
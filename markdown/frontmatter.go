@@ -0,0 +1,68 @@
+package markdown
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+
+	yaml "gopkg.in/yaml.v2"
+)
+
+// frontMatterDelimiter opens and closes YAML front matter
+const frontMatterDelimiter = "---"
+
+// ErrFrontMatter is returned for front matter that is opened but never closed
+var ErrFrontMatter = errors.New("front matter is not terminated")
+
+// WithFrontMatter renders a Markdown document whose metadata is given as YAML
+// front matter ahead of the body
+func WithFrontMatter(meta interface{}, body string) ([]byte, error) {
+	front, err := yaml.Marshal(meta)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(frontMatterDelimiter + "\n")
+	buf.Write(front)
+	buf.WriteString(frontMatterDelimiter + "\n\n")
+	buf.WriteString(strings.TrimSpace(body))
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+// SplitFrontMatter separates YAML front matter, decoded into meta, from the
+// body of a Markdown document. Documents without front matter are returned
+// whole and meta is left untouched.
+func SplitFrontMatter(doc []byte, meta interface{}) (string, error) {
+	text := strings.Replace(string(doc), "\r\n", "\n", -1)
+	text = strings.TrimPrefix(text, "\ufeff")
+	if !strings.HasPrefix(text, frontMatterDelimiter+"\n") {
+		return text, nil
+	}
+	rest := text[len(frontMatterDelimiter)+1:]
+
+	var front, body string
+	if strings.HasPrefix(rest, frontMatterDelimiter) {
+		body = rest[len(frontMatterDelimiter):]
+	} else {
+		end := strings.Index(rest, "\n"+frontMatterDelimiter)
+		if end < 0 {
+			return "", ErrFrontMatter
+		}
+		front = rest[:end]
+		body = rest[end+len(frontMatterDelimiter)+1:]
+	}
+
+	if err := yaml.Unmarshal([]byte(front), meta); err != nil {
+		return "", err
+	}
+
+	// Drop the remainder of the closing delimiter's line
+	if nl := strings.Index(body, "\n"); nl >= 0 {
+		body = body[nl+1:]
+	} else {
+		body = ""
+	}
+	return strings.TrimLeft(body, "\n"), nil
+}
@@ -0,0 +1,257 @@
+package markdown
+
+import (
+	"html"
+	"regexp"
+	"strings"
+)
+
+var (
+	htmlTokenRegexp = regexp.MustCompile(`(?s)<!--.*?-->|<(/?)([a-zA-Z][a-zA-Z0-9]*)((?:[^>"']|"[^"]*"|'[^']*')*)>`)
+	attrRegexp      = regexp.MustCompile(`([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'>]+))`)
+	blankLineRegexp = regexp.MustCompile(`\n[ \t]*\n`)
+	extraLineRegexp = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlFrame collects the Markdown of an element whose content has to be
+// rewritten once it is closed
+type htmlFrame struct {
+	tag  string
+	href string
+	out  strings.Builder
+}
+
+// htmlConverter converts HTML to Markdown one token at a time
+type htmlConverter struct {
+	frames []*htmlFrame
+	lists  []string
+	pre    int
+	skip   string
+}
+
+// FromHTML converts HTML, such as posts exported from other blogging
+// software, to Markdown. Elements without a Markdown equivalent are dropped,
+// keeping their text. Blank lines in text are treated as paragraph breaks,
+// as WordPress stores posts without paragraph tags.
+func FromHTML(src string) string {
+	c := &htmlConverter{frames: []*htmlFrame{{}}}
+
+	last := 0
+	for _, m := range htmlTokenRegexp.FindAllStringSubmatchIndex(src, -1) {
+		c.text(src[last:m[0]])
+		last = m[1]
+		if m[4] < 0 {
+			// Comment
+			continue
+		}
+		name := strings.ToLower(src[m[4]:m[5]])
+		if m[3] > m[2] {
+			c.close(name)
+		} else {
+			c.open(name, attributes(src[m[6]:m[7]]))
+		}
+	}
+	c.text(src[last:])
+
+	for len(c.frames) > 1 {
+		c.close(c.top().tag)
+	}
+
+	out := extraLineRegexp.ReplaceAllString(c.top().out.String(), "\n\n")
+	lines := strings.Split(out, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(line, " \t")
+	}
+	return strings.TrimSpace(strings.Join(lines, "\n"))
+}
+
+// attributes parses the attributes of a tag
+func attributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for _, m := range attrRegexp.FindAllStringSubmatch(s, -1) {
+		attrs[strings.ToLower(m[1])] = html.UnescapeString(m[2] + m[3] + m[4])
+	}
+	return attrs
+}
+
+func (c *htmlConverter) top() *htmlFrame {
+	return c.frames[len(c.frames)-1]
+}
+
+func (c *htmlConverter) write(s string) {
+	c.top().out.WriteString(s)
+}
+
+// block starts a new block unless one has just been started
+func (c *htmlConverter) block() {
+	out := c.top().out.String()
+	if out != "" && !strings.HasSuffix(out, "\n\n") {
+		if strings.HasSuffix(out, "\n") {
+			c.write("\n")
+		} else {
+			c.write("\n\n")
+		}
+	}
+}
+
+// text writes the text between tags
+func (c *htmlConverter) text(s string) {
+	if c.skip != "" || s == "" {
+		return
+	}
+	s = html.UnescapeString(s)
+	if c.pre > 0 {
+		c.write(s)
+		return
+	}
+
+	for i, para := range blankLineRegexp.Split(s, -1) {
+		if i > 0 && len(c.lists) == 0 {
+			c.block()
+		}
+		para = spaceRegexp.ReplaceAllString(para, " ")
+		if out := c.top().out.String(); out == "" || strings.HasSuffix(out, "\n") || strings.HasSuffix(out, " ") {
+			para = strings.TrimLeft(para, " ")
+		}
+		c.write(para)
+	}
+}
+
+// open handles a start tag
+func (c *htmlConverter) open(tag string, attrs map[string]string) {
+	if c.skip != "" {
+		return
+	}
+	if c.pre > 0 && tag != "pre" {
+		return
+	}
+
+	switch tag {
+	case "script", "style", "head", "title":
+		c.skip = tag
+	case "p", "div", "section", "article", "figure", "figcaption", "table", "tr", "dl":
+		c.block()
+	case "br":
+		c.write("\n")
+	case "hr":
+		c.block()
+		c.write("---\n\n")
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.block()
+		c.write(strings.Repeat("#", int(tag[1]-'0')) + " ")
+	case "strong", "b":
+		c.write("**")
+	case "em", "i":
+		c.write("*")
+	case "code":
+		c.write("`")
+	case "img":
+		if src := attrs["src"]; src != "" {
+			c.write("![" + attrs["alt"] + "](" + src + ")")
+		}
+	case "ul", "ol":
+		if len(c.lists) == 0 {
+			c.block()
+		}
+		c.lists = append(c.lists, tag)
+	case "li":
+		if out := c.top().out.String(); out != "" && !strings.HasSuffix(out, "\n") {
+			c.write("\n")
+		}
+		if len(c.lists) > 0 && c.lists[len(c.lists)-1] == "ol" {
+			c.write("1. ")
+		} else {
+			c.write("- ")
+		}
+	case "pre":
+		c.pre++
+		if c.pre == 1 {
+			c.frames = append(c.frames, &htmlFrame{tag: tag})
+		}
+	case "a", "blockquote":
+		c.frames = append(c.frames, &htmlFrame{tag: tag, href: attrs["href"]})
+	}
+}
+
+// close handles an end tag
+func (c *htmlConverter) close(tag string) {
+	if c.skip != "" {
+		if tag == c.skip {
+			c.skip = ""
+		}
+		return
+	}
+	if c.pre > 0 && tag != "pre" {
+		return
+	}
+
+	switch tag {
+	case "p", "div", "section", "article", "figure", "figcaption", "table", "tr", "dl":
+		c.block()
+	case "h1", "h2", "h3", "h4", "h5", "h6":
+		c.write("\n\n")
+	case "strong", "b":
+		c.write("**")
+	case "em", "i":
+		c.write("*")
+	case "code":
+		c.write("`")
+	case "ul", "ol":
+		if len(c.lists) > 0 {
+			c.lists = c.lists[:len(c.lists)-1]
+		}
+		if len(c.lists) == 0 {
+			c.write("\n\n")
+		}
+	case "pre":
+		if c.pre == 0 {
+			return
+		}
+		c.pre--
+		if c.pre > 0 {
+			return
+		}
+		code := strings.Trim(c.pop("pre").out.String(), "\n")
+		c.block()
+		c.write("```\n" + code + "\n```\n\n")
+	case "a":
+		frame := c.pop(tag)
+		if frame == nil {
+			return
+		}
+		text := strings.TrimSpace(frame.out.String())
+		if frame.href == "" || text == "" {
+			c.write(text)
+			return
+		}
+		c.write("[" + text + "](" + frame.href + ")")
+	case "blockquote":
+		frame := c.pop(tag)
+		if frame == nil {
+			return
+		}
+		c.block()
+		lines := strings.Split(strings.TrimSpace(frame.out.String()), "\n")
+		for _, line := range lines {
+			c.write(strings.TrimRight("> "+line, " ") + "\n")
+		}
+		c.write("\n")
+	}
+}
+
+// pop closes the innermost frame for tag along with any left open inside it,
+// returning nil if tag isn't open
+func (c *htmlConverter) pop(tag string) *htmlFrame {
+	for i := len(c.frames) - 1; i > 0; i-- {
+		if c.frames[i].tag != tag {
+			continue
+		}
+		for len(c.frames)-1 > i {
+			c.close(c.top().tag)
+		}
+		frame := c.top()
+		c.frames = c.frames[:i]
+		return frame
+	}
+	return nil
+}
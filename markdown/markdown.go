@@ -0,0 +1,220 @@
+// Package markdown renders a small, safe subset of Markdown to HTML.
+//
+// Raw HTML in the source is always escaped, and links are only emitted for
+// http, https, mailto and relative URLs, so the output can be embedded in a
+// page without further sanitization.
+package markdown
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+var (
+	headingRegexp = regexp.MustCompile(`^(#{1,6})\s+(.*?)\s*#*$`)
+	bulletRegexp  = regexp.MustCompile(`^[-*+]\s+(.*)$`)
+	orderedRegexp = regexp.MustCompile(`^\d+[.)]\s+(.*)$`)
+)
+
+// Render converts Markdown source into sanitized HTML
+func Render(src string) template.HTML {
+	lines := strings.Split(strings.Replace(src, "\r\n", "\n", -1), "\n")
+
+	var out strings.Builder
+	for i := 0; i < len(lines); {
+		line := strings.TrimRight(lines[i], " \t")
+		trimmed := strings.TrimSpace(line)
+
+		switch {
+		case trimmed == "":
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			// Fenced code block, runs until the closing fence or the end
+			i++
+			var code []string
+			for ; i < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[i]), "```"); i++ {
+				code = append(code, lines[i])
+			}
+			i++
+			out.WriteString("<pre><code>")
+			out.WriteString(html.EscapeString(strings.Join(code, "\n")))
+			out.WriteString("</code></pre>\n")
+
+		case headingRegexp.MatchString(trimmed):
+			m := headingRegexp.FindStringSubmatch(trimmed)
+			level := string('0' + rune(len(m[1])))
+			out.WriteString("<h" + level + ">" + inline(m[2]) + "</h" + level + ">\n")
+			i++
+
+		case strings.HasPrefix(trimmed, ">"):
+			var quoted []string
+			for ; i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">"); i++ {
+				q := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(q, " "))
+			}
+			out.WriteString("<blockquote>\n")
+			out.WriteString(string(Render(strings.Join(quoted, "\n"))))
+			out.WriteString("</blockquote>\n")
+
+		case bulletRegexp.MatchString(trimmed):
+			i = list(&out, lines, i, bulletRegexp, "ul")
+
+		case orderedRegexp.MatchString(trimmed):
+			i = list(&out, lines, i, orderedRegexp, "ol")
+
+		default:
+			var para []string
+			for ; i < len(lines) && !blockStart(lines[i]); i++ {
+				para = append(para, strings.TrimSpace(lines[i]))
+			}
+			out.WriteString("<p>" + inline(strings.Join(para, "\n")) + "</p>\n")
+		}
+	}
+	return template.HTML(out.String())
+}
+
+// blockStart reports whether line ends a paragraph
+func blockStart(line string) bool {
+	trimmed := strings.TrimSpace(line)
+	return trimmed == "" ||
+		strings.HasPrefix(trimmed, "```") ||
+		strings.HasPrefix(trimmed, ">") ||
+		headingRegexp.MatchString(trimmed) ||
+		bulletRegexp.MatchString(trimmed) ||
+		orderedRegexp.MatchString(trimmed)
+}
+
+// list renders consecutive items matching item as a list, returning the index
+// of the first line after it
+func list(out *strings.Builder, lines []string, i int, item *regexp.Regexp, tag string) int {
+	out.WriteString("<" + tag + ">\n")
+	for i < len(lines) {
+		m := item.FindStringSubmatch(strings.TrimSpace(lines[i]))
+		if m == nil {
+			break
+		}
+		out.WriteString("<li>" + inline(m[1]) + "</li>\n")
+		i++
+	}
+	out.WriteString("</" + tag + ">\n")
+	return i
+}
+
+// inline renders emphasis, code spans and links within a block, escaping
+// everything else
+func inline(s string) string {
+	var out strings.Builder
+	for i := 0; i < len(s); {
+		rest := s[i:]
+		switch {
+		case rest[0] == '`':
+			if end := strings.IndexByte(rest[1:], '`'); end >= 0 {
+				out.WriteString("<code>" + html.EscapeString(rest[1:end+1]) + "</code>")
+				i += end + 2
+				continue
+			}
+
+		case strings.HasPrefix(rest, "**"):
+			if end := strings.Index(rest[2:], "**"); end > 0 {
+				out.WriteString("<strong>" + inline(rest[2:end+2]) + "</strong>")
+				i += end + 4
+				continue
+			}
+
+		case rest[0] == '*' || (rest[0] == '_' && (i == 0 || !isWordByte(s[i-1]))):
+			if end := strings.IndexByte(rest[1:], rest[0]); end > 0 {
+				out.WriteString("<em>" + inline(rest[1:end+1]) + "</em>")
+				i += end + 2
+				continue
+			}
+
+		case rest[0] == '[':
+			if text, href, n, ok := link(rest); ok {
+				out.WriteString(`<a href="` + html.EscapeString(href) + `" rel="nofollow ugc">` + inline(text) + "</a>")
+				i += n
+				continue
+			}
+
+		case rest[0] == '\n':
+			out.WriteString("<br>\n")
+			i++
+			continue
+		}
+		out.WriteString(html.EscapeString(rest[:1]))
+		i++
+	}
+	return out.String()
+}
+
+// link parses a [text](href) link at the start of s, returning the number
+// of bytes consumed. Links with unsafe URLs are not recognized.
+func link(s string) (text, href string, n int, ok bool) {
+	closeText := strings.Index(s, "](")
+	if closeText < 0 {
+		return "", "", 0, false
+	}
+	closeHref := strings.IndexByte(s[closeText+2:], ')')
+	if closeHref < 0 {
+		return "", "", 0, false
+	}
+	text = s[1:closeText]
+	href = strings.TrimSpace(s[closeText+2 : closeText+2+closeHref])
+	if text == "" || !SafeURL(href) {
+		return "", "", 0, false
+	}
+	return text, href, closeText + 3 + closeHref, true
+}
+
+// SafeURL reports whether href may be linked to from rendered content
+func SafeURL(href string) bool {
+	u, err := url.Parse(href)
+	if err != nil || href == "" {
+		return false
+	}
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https", "mailto":
+		return true
+	case "":
+		return u.Host == "" && !strings.Contains(href, ":")
+	}
+	return false
+}
+
+// isWordByte reports whether c is an ascii letter or digit
+func isWordByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+var (
+	tagRegexp   = regexp.MustCompile(`<[^>]*>`)
+	spaceRegexp = regexp.MustCompile(`\s+`)
+)
+
+// Text renders Markdown source as plain text
+func Text(src string) string {
+	text := tagRegexp.ReplaceAllString(string(Render(src)), " ")
+	return strings.TrimSpace(spaceRegexp.ReplaceAllString(html.UnescapeString(text), " "))
+}
+
+// Excerpt returns at most max bytes of the plain text of src, cut at a word
+// boundary and marked with an ellipsis when shortened
+func Excerpt(src string, max int) string {
+	text := Text(src)
+	if len(text) <= max {
+		return text
+	}
+	cut := strings.LastIndex(text[:max], " ")
+	if cut <= 0 {
+		cut = max
+		// Don't split a multi-byte character
+		for cut > 0 && !utf8.RuneStart(text[cut]) {
+			cut--
+		}
+	}
+	return strings.TrimRight(text[:cut], " .,;:") + "…"
+}
@@ -0,0 +1,76 @@
+package markdown
+
+import "testing"
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name, src, html string
+	}{
+		{"paragraph", "Hello\nworld", "<p>Hello<br>\nworld</p>\n"},
+		{"heading", "## Title ##", "<h2>Title</h2>\n"},
+		{"emphasis", "**bold** and *em* and _em_", "<p><strong>bold</strong> and <em>em</em> and <em>em</em></p>\n"},
+		{"underscores within words", "snake_case_name", "<p>snake_case_name</p>\n"},
+		{"code span", "`<b>`", "<p><code>&lt;b&gt;</code></p>\n"},
+		{"fenced code", "```\n<script>\n```", "<pre><code>&lt;script&gt;</code></pre>\n"},
+		{"list", "- one\n- two", "<ul>\n<li>one</li>\n<li>two</li>\n</ul>\n"},
+		{"ordered list", "1. one\n2) two", "<ol>\n<li>one</li>\n<li>two</li>\n</ol>\n"},
+		{"quote", "> quoted", "<blockquote>\n<p>quoted</p>\n</blockquote>\n"},
+		{"link", "[site](https://example.com/?a=1&b=2)", `<p><a href="https://example.com/?a=1&amp;b=2" rel="nofollow ugc">site</a></p>` + "\n"},
+		{"relative link", "[post](/articles/1)", `<p><a href="/articles/1" rel="nofollow ugc">post</a></p>` + "\n"},
+		{"raw html", `<script>alert("x")</script>`, "<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>\n"},
+		{"html attribute", `<img src=x onerror='alert(1)'>`, "<p>&lt;img src=x onerror=&#39;alert(1)&#39;&gt;</p>\n"},
+		{"javascript link", "[click](javascript:alert(1))", "<p>[click](javascript:alert(1))</p>\n"},
+		{"javascript link in capitals", "[click](JavaScript:alert(1))", "<p>[click](JavaScript:alert(1))</p>\n"},
+		{"data link", "[click](data:text/html,x)", "<p>[click](data:text/html,x)</p>\n"},
+		{"protocol relative link", "[click](//evil.example)", "<p>[click](//evil.example)</p>\n"},
+		{"quote in link", `[x](/a"onmouseover="alert(1))`, `<p><a href="/a&#34;onmouseover=&#34;alert(1" rel="nofollow ugc">x</a>)</p>` + "\n"},
+		{"html in link text", "[<b>x</b>](/a)", `<p><a href="/a" rel="nofollow ugc">&lt;b&gt;x&lt;/b&gt;</a></p>` + "\n"},
+	}
+	for _, test := range tests {
+		if html := string(Render(test.src)); html != test.html {
+			t.Errorf("%s: Render(%q) = %q, want %q", test.name, test.src, html, test.html)
+		}
+	}
+}
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		href string
+		safe bool
+	}{
+		{"https://example.com", true},
+		{"http://example.com", true},
+		{"mailto:me@example.com", true},
+		{"/articles/1", true},
+		{"#comments", true},
+		{"", false},
+		{"javascript:alert(1)", false},
+		{"vbscript:msgbox", false},
+		{"data:text/html,x", false},
+		{"//example.com", false},
+		{"ftp://example.com", false},
+	}
+	for _, test := range tests {
+		if safe := SafeURL(test.href); safe != test.safe {
+			t.Errorf("SafeURL(%q) = %v, want %v", test.href, safe, test.safe)
+		}
+	}
+}
+
+func TestExcerpt(t *testing.T) {
+	tests := []struct {
+		src     string
+		max     int
+		excerpt string
+	}{
+		{"# Title\n\nShort", 20, "Title Short"},
+		{"One two three four", 10, "One two…"},
+		{"Sentence one. Sentence two", 15, "Sentence one…"},
+		{"ééééé", 5, "éé…"},
+	}
+	for _, test := range tests {
+		if excerpt := Excerpt(test.src, test.max); excerpt != test.excerpt {
+			t.Errorf("Excerpt(%q, %d) = %q, want %q", test.src, test.max, excerpt, test.excerpt)
+		}
+	}
+}
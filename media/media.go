@@ -0,0 +1,77 @@
+// Package media stores the files uploaded to the blog.
+//
+// Files are kept by a Store, either a directory on the local filesystem or
+// a bucket of an S3 compatible service, under keys generated when they are
+// uploaded. What a file is, such as its type, dimensions and alt text, is
+// kept in the database, so stores only hold bytes.
+package media
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"image"
+	"io"
+	"net/http"
+
+	// register image formats with image.DecodeConfig
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+)
+
+// Error messages
+var (
+	ErrNotFound = errors.New("no file is stored under the key")
+	ErrKey      = errors.New("the key of a file must be a relative path")
+)
+
+// Store keeps files by key
+type Store interface {
+	// Put stores size bytes read from body under key, replacing any file
+	// already stored there
+	Put(key string, body io.Reader, size int64, contentType string) error
+	// Open returns the file stored under key, or ErrNotFound
+	Open(key string) (io.ReadCloser, error)
+	// Delete removes the file stored under key, if there is one
+	Delete(key string) error
+}
+
+// Types are the types of file which may be uploaded, by their extension.
+// Types browsers could run script from, such as SVG and HTML, aren't
+// accepted as files are served from the blog's own origin.
+var Types = map[string]string{
+	"image/jpeg":      ".jpg",
+	"image/png":       ".png",
+	"image/gif":       ".gif",
+	"image/webp":      ".webp",
+	"application/pdf": ".pdf",
+}
+
+// Sniff returns the type of a file from its first bytes, and whether it may
+// be uploaded
+func Sniff(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	_, ok := Types[contentType]
+	return contentType, ok
+}
+
+// Dimensions returns the width and height of an image, zero for files which
+// aren't images or are in a format which can't be decoded
+func Dimensions(data []byte) (int, int) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0
+	}
+	return config.Width, config.Height
+}
+
+// NewKey returns a random key for a file of the given type
+func NewKey(contentType string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b) + Types[contentType], nil
+}
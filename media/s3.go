@@ -0,0 +1,220 @@
+package media
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+// S3Options configures a store in a bucket of an S3 compatible service
+type S3Options struct {
+	// Endpoint is the URL of the service, such as http://localhost:9000 for
+	// a stand-in running locally. It defaults to AWS in Region.
+	Endpoint string
+	Region   string
+	Bucket   string
+	// AccessKey and SecretKey sign requests, which are sent unsigned when
+	// there is no access key
+	AccessKey string
+	SecretKey string
+	// PathStyle names the bucket in the path rather than the host name, as
+	// most stand-ins require
+	PathStyle bool
+	// Timeout bounds each request
+	Timeout time.Duration
+}
+
+// unsignedPayload is sent in place of the hash of a body, which is streamed
+const unsignedPayload = "UNSIGNED-PAYLOAD"
+
+// S3 stores files in a bucket of an S3 compatible service, signing requests
+// with AWS Signature Version 4
+type S3 struct {
+	opts     S3Options
+	endpoint *url.URL
+	client   *http.Client
+}
+
+// NewS3 returns a store keeping files in a bucket
+func NewS3(opts S3Options) (*S3, error) {
+	if opts.Bucket == "" {
+		return nil, errors.New("a bucket is required to store media in S3")
+	}
+	if opts.Region == "" {
+		opts.Region = "us-east-1"
+	}
+	if opts.Endpoint == "" {
+		opts.Endpoint = "https://s3." + opts.Region + ".amazonaws.com"
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = time.Minute
+	}
+
+	endpoint, err := url.Parse(strings.TrimSuffix(opts.Endpoint, "/"))
+	if err != nil {
+		return nil, err
+	}
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, errors.New("the S3 endpoint must be an http or https URL: " + opts.Endpoint)
+	}
+	return &S3{opts: opts, endpoint: endpoint, client: &http.Client{Timeout: opts.Timeout}}, nil
+}
+
+// Put uploads the file
+func (s *S3) Put(key string, body io.Reader, size int64, contentType string) error {
+	res, err := s.do(http.MethodPut, key, io.LimitReader(body, size), size, contentType)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return s.failed(http.MethodPut, key, res)
+	}
+	return nil
+}
+
+// Open downloads the file, which is read from the response as it arrives
+func (s *S3) Open(key string) (io.ReadCloser, error) {
+	res, err := s.do(http.MethodGet, key, nil, 0, "")
+	if err != nil {
+		return nil, err
+	}
+	switch res.StatusCode {
+	case http.StatusOK:
+		return res.Body, nil
+	case http.StatusNotFound:
+		res.Body.Close()
+		return nil, ErrNotFound
+	}
+	defer res.Body.Close()
+	return nil, s.failed(http.MethodGet, key, res)
+}
+
+// Delete removes the file
+func (s *S3) Delete(key string) error {
+	res, err := s.do(http.MethodDelete, key, nil, 0, "")
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusNoContent && res.StatusCode != http.StatusOK && res.StatusCode != http.StatusNotFound {
+		return s.failed(http.MethodDelete, key, res)
+	}
+	return nil
+}
+
+// failed describes a request the service refused
+func (s *S3) failed(method, key string, res *http.Response) error {
+	detail, _ := ioutil.ReadAll(io.LimitReader(res.Body, 512))
+	return fmt.Errorf("S3 %s of %s failed with %s: %s", method, key, res.Status, strings.TrimSpace(string(detail)))
+}
+
+// do sends a signed request for the object stored under key
+func (s *S3) do(method, key string, body io.Reader, size int64, contentType string) (*http.Response, error) {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return nil, ErrKey
+	}
+
+	host, path := s.endpoint.Host, s.endpoint.Path+"/"+escapePath(key)
+	if s.opts.PathStyle {
+		path = s.endpoint.Path + "/" + escapePath(s.opts.Bucket) + "/" + escapePath(key)
+	} else {
+		host = s.opts.Bucket + "." + host
+	}
+
+	req, err := http.NewRequest(method, s.endpoint.Scheme+"://"+host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	// Send the path exactly as it is signed
+	req.URL.Opaque = "//" + host + path
+	if body != nil {
+		req.ContentLength = size
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if s.opts.AccessKey != "" {
+		s.sign(req, host, path, time.Now())
+	}
+	return s.client.Do(req)
+}
+
+// sign adds the headers of Signature Version 4 to a request
+func (s *S3) sign(req *http.Request, host, path string, t time.Time) {
+	t = t.UTC()
+	req.Header.Set("X-Amz-Date", t.Format("20060102T150405Z"))
+	req.Header.Set("X-Amz-Content-Sha256", unsignedPayload)
+
+	headers := map[string]string{"host": host}
+	for name := range req.Header {
+		lower := strings.ToLower(name)
+		if lower == "content-type" || strings.HasPrefix(lower, "x-amz-") {
+			headers[lower] = strings.TrimSpace(req.Header.Get(name))
+		}
+	}
+	scope, signed, signature := s.signature(req.Method, path, "", headers, unsignedPayload, t)
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+s.opts.AccessKey+"/"+scope+", SignedHeaders="+signed+", Signature="+signature)
+}
+
+// signature signs a canonical request, returning the credential scope, the
+// headers signed and the signature
+func (s *S3) signature(method, path, query string, headers map[string]string, payloadHash string, t time.Time) (string, string, string) {
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	canonical.WriteString(method + "\n" + path + "\n" + query + "\n")
+	for _, name := range names {
+		canonical.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signed := strings.Join(names, ";")
+	canonical.WriteString("\n" + signed + "\n" + payloadHash)
+
+	date := t.Format("20060102")
+	scope := date + "/" + s.opts.Region + "/s3/aws4_request"
+	hash := sha256.Sum256([]byte(canonical.String()))
+	toSign := "AWS4-HMAC-SHA256\n" + t.Format("20060102T150405Z") + "\n" + scope + "\n" + hex.EncodeToString(hash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.opts.SecretKey), date)
+	key = hmacSHA256(key, s.opts.Region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return scope, signed, hex.EncodeToString(hmacSHA256(key, toSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// escapePath escapes each segment of a path as S3 expects, leaving only
+// unreserved characters as they are
+func escapePath(p string) string {
+	segments := strings.Split(p, "/")
+	for i, segment := range segments {
+		var b strings.Builder
+		for _, c := range []byte(segment) {
+			if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+				b.WriteByte(c)
+			} else {
+				fmt.Fprintf(&b, "%%%02X", c)
+			}
+		}
+		segments[i] = b.String()
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/mattgen88/blog/cache"
+	"github.com/mattgen88/blog/cluster"
+	"github.com/mattgen88/blog/metrics"
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/webhooks"
+)
+
+// instrument registers the metrics of the database pool, model operations,
+// response cache and background workers, leaving out those of the cache,
+// dispatcher and node when they are nil
+func instrument(registry *metrics.Registry, db *sql.DB, hooks *webhooks.Dispatcher, responses *cache.Cache, node *cluster.Node) {
+	registry.GaugeFunc("blog_db_max_open_connections", "Most connections the database pool may open, 0 for no limit.", func() float64 {
+		return float64(db.Stats().MaxOpenConnections)
+	})
+	registry.GaugeFunc("blog_db_open_connections", "Connections open to the database.", func() float64 {
+		return float64(db.Stats().OpenConnections)
+	})
+	registry.GaugeFunc("blog_db_in_use_connections", "Connections to the database in use.", func() float64 {
+		return float64(db.Stats().InUse)
+	})
+	registry.GaugeFunc("blog_db_idle_connections", "Idle connections to the database.", func() float64 {
+		return float64(db.Stats().Idle)
+	})
+	registry.CounterFunc("blog_db_wait_count_total", "Times a query waited for a connection to the database.", func() float64 {
+		return float64(db.Stats().WaitCount)
+	})
+	registry.CounterFunc("blog_db_wait_duration_seconds_total", "Time queries spent waiting for connections to the database.", func() float64 {
+		return db.Stats().WaitDuration.Seconds()
+	})
+	registry.CounterFunc("blog_db_max_idle_closed_total", "Connections closed as more were idle than the pool keeps.", func() float64 {
+		return float64(db.Stats().MaxIdleClosed)
+	})
+	registry.CounterFunc("blog_db_max_lifetime_closed_total", "Connections closed for reaching their maximum lifetime.", func() float64 {
+		return float64(db.Stats().MaxLifetimeClosed)
+	})
+
+	queries := registry.Histogram("blog_db_query_duration_seconds", "Time model operations spent on the database, by operation.", metrics.DurationBuckets, "operation")
+	models.ObserveQueries(func(operation string, elapsed time.Duration) {
+		queries.Observe(elapsed.Seconds(), operation)
+	})
+
+	if responses != nil {
+		registry.CounterFunc("blog_cache_hits_total", "Requests answered from the response cache.", func() float64 {
+			return float64(responses.Stats().Hits)
+		})
+		registry.CounterFunc("blog_cache_misses_total", "Cacheable requests the response cache couldn't answer.", func() float64 {
+			return float64(responses.Stats().Misses)
+		})
+		registry.CounterFunc("blog_cache_evictions_total", "Responses dropped from the cache to make room for others.", func() float64 {
+			return float64(responses.Stats().Evictions)
+		})
+		registry.CounterFunc("blog_cache_invalidations_total", "Responses dropped from the cache as what they showed changed.", func() float64 {
+			return float64(responses.Stats().Invalidations)
+		})
+		registry.GaugeFunc("blog_cache_entries", "Responses held by the cache.", func() float64 {
+			return float64(responses.Stats().Entries)
+		})
+		registry.GaugeFunc("blog_cache_bytes", "Size of the bodies of the responses held by the cache.", func() float64 {
+			return float64(responses.Stats().Bytes)
+		})
+	}
+
+	if hooks != nil {
+		registry.CounterFunc("blog_webhook_deliveries_queued_total", "Webhook deliveries queued.", func() float64 {
+			return float64(hooks.Stats().Queued)
+		})
+		registry.CounterFunc("blog_webhook_deliveries_delivered_total", "Webhook deliveries accepted by their receiver.", func() float64 {
+			return float64(hooks.Stats().Delivered)
+		})
+		registry.CounterFunc("blog_webhook_attempts_failed_total", "Attempts at delivering webhooks which failed.", func() float64 {
+			return float64(hooks.Stats().Failed)
+		})
+		registry.CounterFunc("blog_webhook_deliveries_abandoned_total", "Webhook deliveries given up on after their last attempt failed.", func() float64 {
+			return float64(hooks.Stats().Abandoned)
+		})
+	}
+
+	if node != nil {
+		registry.CounterFunc("blog_cluster_published_total", "Writes other instances were notified of.", func() float64 {
+			return float64(node.Stats().Published)
+		})
+		registry.CounterFunc("blog_cluster_publish_failures_total", "Writes other instances couldn't be notified of.", func() float64 {
+			return float64(node.Stats().PublishFailures)
+		})
+		registry.CounterFunc("blog_cluster_received_total", "Writes of other instances applied.", func() float64 {
+			return float64(node.Stats().Received)
+		})
+		registry.CounterFunc("blog_cluster_resyncs_total", "Times everything held in memory was reloaded after writes may have been missed.", func() float64 {
+			return float64(node.Stats().Resyncs)
+		})
+	}
+}
@@ -3,11 +3,18 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"log"
 	"regexp"
 	"time"
+
+	"github.com/lib/pq"
 )
 
+// tagsColumn selects the names of an article's tags as an array
+const tagsColumn = `ARRAY(SELECT "tags"."name" FROM "article_tags"
+	JOIN "tags" ON "tags"."tagid" = "article_tags"."tag"
+	WHERE "article_tags"."article" = "articles"."articleid"
+	ORDER BY "tags"."name")`
+
 // Article is an interface for describing articles
 type Article interface {
 	Exists() bool
@@ -19,21 +26,26 @@ type Article interface {
 
 // SQLArticle is a SQL backed Article
 type SQLArticle struct {
-	ID        int          `json:"id"`
-	Author    *SQLUser     `json:"author"`
-	Title     string       `json:"title"`
-	Body      string       `json:"body"`
-	Date      *time.Time   `json:"date"`
-	Slug      string       `json:"slug"`
-	Category  *SQLCategory `json:"category"`
-	Db        *sql.DB      `json:"-"`
+	ID       int          `json:"id"`
+	Author   *SQLUser     `json:"author"`
+	Title    string       `json:"title"`
+	Body     string       `json:"body"`
+	Date     *time.Time   `json:"date"`
+	Updated  *time.Time   `json:"updated"`
+	Slug     string       `json:"slug"`
+	Category *SQLCategory `json:"category"`
+	Tags     []string     `json:"tags"`
+	Version  int          `json:"version"`
+	// Force writes the article whatever the version of its row
+	Force     bool `json:"-"`
+	Db        DB   `json:"-"`
 	populated bool
 	dirty     bool
 	exists    bool
 }
 
 // NewSQLArticle returns a new instance of SQLArticle backed by a database
-func NewSQLArticle(slug string, Db *sql.DB) *SQLArticle {
+func NewSQLArticle(slug string, Db DB) *SQLArticle {
 	p := &SQLArticle{
 		Slug: slug,
 		Db:   Db,
@@ -47,61 +59,42 @@ func NewSQLArticle(slug string, Db *sql.DB) *SQLArticle {
 }
 
 // ArticleListByCategory returns an article list by category, imagine that.
-func ArticleListByCategory(categoryID int, Db *sql.DB) []*SQLArticle {
-	var articles []*SQLArticle
-
-	rows, err := Db.Query(`SELECT "articleid", "title", "slug", "date", "users"."username"
-		FROM "articles"
-		JOIN "users" on "users"."userid" = "articles"."author"
-		WHERE "articles"."category" = $1
-		ORDER BY "date" desc`, categoryID)
-
-	if err != nil {
-		log.Println(err)
-	}
-
-	defer rows.Close()
-
-	for rows.Next() {
-		var (
-			articleID int
-			title     string
-			date      *time.Time
-			slug      string
-			author    string
-		)
-
-		if err := rows.Scan(&articleID, &title, &slug, &date, &author); err != nil {
-			continue
-		}
-
-		article := &SQLArticle{
-			Db:     Db,
-			ID:     articleID,
-			Title:  title,
-			Slug:   slug,
-			Date:   date,
-			Author: NewSQLUser(author, Db),
-		}
+func ArticleListByCategory(categoryID int, Db DB) []*SQLArticle {
+	return listArticles(Db, `WHERE "articles"."category" = $1`, categoryID)
+}
 
-		articles = append(articles, article)
+// ArticleListByAuthor returns the articles written by a user, newest first
+func ArticleListByAuthor(username string, Db DB) []*SQLArticle {
+	return listArticles(Db, `WHERE "users"."username" = $1`, username)
+}
 
-	}
-	return articles
+// ArticleListByTag returns the articles with a tag, newest first
+func ArticleListByTag(tag string, Db DB) []*SQLArticle {
+	return listArticles(Db, `WHERE EXISTS (SELECT 1 FROM "article_tags"
+		JOIN "tags" ON "tags"."tagid" = "article_tags"."tag"
+		WHERE "article_tags"."article" = "articles"."articleid" AND "tags"."name" = $1)`, tag)
 }
 
 // ArticleList is a list of articles
-func ArticleList(Db *sql.DB) []*SQLArticle {
+func ArticleList(Db DB) []*SQLArticle {
+	return listArticles(Db, "")
+}
+
+// listArticles returns the articles matching the where clause, newest first
+func listArticles(Db DB, where string, args ...interface{}) []*SQLArticle {
+	defer timed("article.list")()
 	var articles []*SQLArticle
 
-	rows, err := Db.Query(`SELECT "articleid", "title", "slug", "date", "users"."username", "name", "body"
+	rows, err := Db.Query(`SELECT "articleid", "title", "slug", "date", "updated", "users"."username", "name", "body", `+tagsColumn+`, "articles"."version"
 		FROM "articles"
 		JOIN "category" on "category"."categoryid" = "articles"."category"
 		JOIN "users" on "users"."userid" = "articles"."author"
-		ORDER BY "date" DESC`)
+		`+where+`
+		ORDER BY "date" DESC`, args...)
 
 	if err != nil {
-		log.Println("Error querying for all articles", err)
+		logger(Db).Error("Error querying for articles", "err", err)
+		return nil
 	}
 
 	defer rows.Close()
@@ -111,13 +104,16 @@ func ArticleList(Db *sql.DB) []*SQLArticle {
 			articleID int
 			title     string
 			date      *time.Time
+			updated   *time.Time
 			slug      string
 			author    string
 			category  string
 			body      string
+			tags      []string
+			version   int
 		)
 
-		if err := rows.Scan(&articleID, &title, &slug, &date, &author, &category, &body); err != nil {
+		if err := rows.Scan(&articleID, &title, &slug, &date, &updated, &author, &category, &body, pq.Array(&tags), &version); err != nil {
 			continue
 		}
 
@@ -128,8 +124,12 @@ func ArticleList(Db *sql.DB) []*SQLArticle {
 			Slug:     slug,
 			Body:     body,
 			Date:     date,
+			Updated:  updated,
 			Category: NewSQLCategory(category, Db),
 			Author:   NewSQLUser(author, Db),
+			Tags:     tags,
+			Version:  version,
+			exists:   true,
 		}
 
 		articles = append(articles, article)
@@ -143,6 +143,7 @@ func (p *SQLArticle) Exists() bool {
 	if p.exists {
 		return true
 	}
+	defer timed("article.exists")()
 	var count int
 	err := p.Db.QueryRow(`SELECT COUNT(*) FROM "articles" WHERE "slug" = $1`, p.Slug).Scan(&count)
 	if err != nil {
@@ -157,6 +158,7 @@ func (p *SQLArticle) Exists() bool {
 
 // Populate populates the model with data from the database
 func (p *SQLArticle) Populate() error {
+	defer timed("article.load")()
 	if !p.Exists() {
 		return errors.New("instance does not exist")
 	}
@@ -174,14 +176,14 @@ func (p *SQLArticle) Populate() error {
 		category string
 	)
 
-	err := p.Db.QueryRow(`SELECT "articleid", "title", "users"."username", "body", "date", "slug", "name"
+	err := p.Db.QueryRow(`SELECT "articleid", "title", "users"."username", "body", "date", "updated", "slug", "name", `+tagsColumn+`, "articles"."version"
 	FROM "articles"
 	JOIN "category" ON "articles"."category" = "category"."categoryid"
 	JOIN "users" ON "articles"."author" = "users"."userid"
-	WHERE "slug" = $1`, p.Slug).Scan(&p.ID, &p.Title, &author, &p.Body, &p.Date, &p.Slug, &category)
+	WHERE "slug" = $1`, p.Slug).Scan(&p.ID, &p.Title, &author, &p.Body, &p.Date, &p.Updated, &p.Slug, &category, pq.Array(&p.Tags), &p.Version)
 
 	if err != nil {
-		log.Println("Item does not exist", ErrDoesNotExist)
+		logger(p.Db).Debug("Article does not exist", "slug", p.Slug, "err", err)
 		return ErrDoesNotExist
 	}
 
@@ -194,6 +196,7 @@ func (p *SQLArticle) Populate() error {
 
 // Save the properties of the article into the database
 func (p *SQLArticle) Save() error {
+	defer timed("article.save")()
 	var err error
 	var query string
 
@@ -202,42 +205,98 @@ func (p *SQLArticle) Save() error {
 		// Validation error
 		return err
 	}
+	// The article and its tags are written in one transaction, so a failure
+	// leaves neither changed
+	tx, err := p.Db.Begin()
+	if err != nil {
+		logger(p.Db).Error("Failed to save article", "slug", p.Slug, "err", err)
+		return ErrSave
+	}
+	defer tx.Rollback()
+
+	var (
+		id      = p.ID
+		date    = p.Date
+		updated *time.Time
+		version int
+	)
+	action := Updated
 	if !p.Exists() {
-		query = `INSERT INTO "articles" ("title", "author", "body", "date", "slug", "category") VALUES ($1, $2, $3, $4, $5, $6)`
-		result, err := p.Db.Exec(query, p.Title, p.Author.ID, p.Body, p.Date, p.Slug, p.Category.ID)
-		id, err := result.LastInsertId()
-		if err != nil {
-			return ErrSave
-		}
-		p.ID = int(id)
+		action = Created
+		query = `INSERT INTO "articles" ("title", "author", "body", "date", "slug", "category") VALUES ($1, $2, $3, COALESCE($4, CURRENT_TIMESTAMP), $5, $6) RETURNING "articleid", "date", "updated", "version"`
+		err = tx.QueryRow(query, p.Title, p.Author.ID, p.Body, p.Date, p.Slug, p.Category.ID).Scan(&id, &date, &updated, &version)
 	} else {
-		query = `UPDATE "articles" SET "title" = $1, "author" = $2, "body" = $3, "date" = $4, "slug" = $5, "category" = $6 WHERE "articleid" = $7`
-		_, err = p.Db.Exec(query, p.Title, p.Author.ID, p.Body, p.Date, p.Slug, p.Category.ID, p.ID)
+		query = `UPDATE "articles" SET "title" = $1, "author" = $2, "body" = $3, "date" = $4, "slug" = $5, "category" = $6, "updated" = CURRENT_TIMESTAMP, "version" = "version" + 1
+		WHERE "articleid" = $7 AND ($9 OR "version" = $8) RETURNING "updated", "version"`
+		err = tx.QueryRow(query, p.Title, p.Author.ID, p.Body, p.Date, p.Slug, p.Category.ID, p.ID, p.Version, p.Force).Scan(&updated, &version)
 	}
 
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
 	if err != nil {
-		log.Println("Failed to save article", ErrSave)
+		logger(p.Db).Error("Failed to save article", "slug", p.Slug, "err", err)
 		return ErrSave
 	}
 
+	if err = saveTags(tx, id, p.Tags); err != nil {
+		logger(p.Db).Error("Failed to save article tags", "slug", p.Slug, "err", err)
+		return ErrSave
+	}
+	if err = tx.Commit(); err != nil {
+		logger(p.Db).Error("Failed to save article", "slug", p.Slug, "err", err)
+		return ErrSave
+	}
+
+	p.ID, p.Date, p.Updated, p.Version = id, date, updated, version
+	p.exists = true
+	emit(Event{Model: "article", Action: action, ID: p.ID, Key: p.Slug, Object: p})
+	return nil
+}
+
+// saveTags replaces the tags of an article, creating any tag that doesn't
+// exist yet
+func saveTags(tx *sql.Tx, article int, tags []string) error {
+	if _, err := tx.Exec(`DELETE FROM "article_tags" WHERE "article" = $1`, article); err != nil {
+		return err
+	}
+	for _, tag := range tags {
+		_, err := tx.Exec(`INSERT INTO "tags" ("name") VALUES ($1) ON CONFLICT ("name") DO NOTHING`, tag)
+		if err != nil {
+			return err
+		}
+		_, err = tx.Exec(`INSERT INTO "article_tags" ("article", "tag")
+			SELECT $1, "tagid" FROM "tags" WHERE "name" = $2
+			ON CONFLICT DO NOTHING`, article, tag)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
 // Delete the requested article
 func (p *SQLArticle) Delete() error {
+	defer timed("article.delete")()
 	var err error
 	var query string
 
 	if !p.Exists() {
 		return ErrDoesNotExist
 	}
-	query = `DELETE FROM "articles" WHERE "slug" = $1`
-	_, err = p.Db.Exec(query, p.Slug)
+	query = `DELETE FROM "articles" WHERE "slug" = $1 AND ($3 OR "version" = $2)`
+	result, err := p.Db.Exec(query, p.Slug, p.Version, p.Force)
 
 	if err != nil {
-		log.Println("Failed to delete article", err)
+		logger(p.Db).Error("Failed to delete article", "slug", p.Slug, "err", err)
 		return ErrDelete
 	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ErrConflict
+	}
+
+	p.exists = false
+	emit(Event{Model: "article", Action: Deleted, ID: p.ID, Key: p.Slug, Object: p})
 	return nil
 }
 
@@ -253,7 +312,7 @@ func (p *SQLArticle) Validate() error {
 
 	match := slugRegexp.MatchString(p.Slug)
 	if !match {
-		log.Println("Failed to pass regex", p.Slug)
+		logger(p.Db).Debug("Article slug is invalid", "slug", p.Slug)
 		return ErrValidation
 	}
 
@@ -0,0 +1,387 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// ErrNotEmpty is returned when restoring into a database which has content
+var ErrNotEmpty = errors.New("the database already has content")
+
+// Backup is the whole content of the blog, with rows keyed by their original
+// ids so references between them survive a restore
+type Backup struct {
+	Roles      []RoleRecord      `json:"roles"`
+	Users      []UserRecord      `json:"users"`
+	Categories []CategoryRecord  `json:"categories"`
+	Articles   []ArticleRecord   `json:"articles"`
+	Comments   []CommentRecord   `json:"comments"`
+	SpamTokens []SpamTokenRecord `json:"spamTokens"`
+	Media      []MediaRecord     `json:"media"`
+	Webhooks   []WebhookRecord   `json:"webhooks"`
+}
+
+// RoleRecord is a backed up role
+type RoleRecord struct {
+	Name string `json:"name"`
+}
+
+// UserRecord is a backed up user. Hash is empty unless password hashes were
+// included, leaving the restored user unable to sign in.
+type UserRecord struct {
+	ID       int        `json:"id"`
+	Username string     `json:"username"`
+	Hash     string     `json:"hash,omitempty"`
+	Created  *time.Time `json:"created"`
+	Realname string     `json:"realname,omitempty"`
+	Email    string     `json:"email,omitempty"`
+	Role     string     `json:"role,omitempty"`
+}
+
+// CategoryRecord is a backed up category
+type CategoryRecord struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+// ArticleRecord is a backed up article
+type ArticleRecord struct {
+	ID       int        `json:"id"`
+	Title    string     `json:"title"`
+	Author   int        `json:"author"`
+	Body     string     `json:"body"`
+	Date     *time.Time `json:"date"`
+	Updated  *time.Time `json:"updated"`
+	Slug     string     `json:"slug"`
+	Category int        `json:"category"`
+	Tags     []string   `json:"tags,omitempty"`
+}
+
+// CommentRecord is a backed up comment
+type CommentRecord struct {
+	ID        int        `json:"id"`
+	Article   int        `json:"article"`
+	Parent    int        `json:"parent,omitempty"`
+	Author    int        `json:"author,omitempty"`
+	Name      string     `json:"name,omitempty"`
+	Email     string     `json:"email,omitempty"`
+	Body      string     `json:"body"`
+	Created   *time.Time `json:"created"`
+	Updated   *time.Time `json:"updated,omitempty"`
+	State     string     `json:"state"`
+	Published *time.Time `json:"published,omitempty"`
+	SpamScore *float64   `json:"spamScore,omitempty"`
+	Trained   string     `json:"trained,omitempty"`
+}
+
+// MediaRecord is backed up media. The file itself is archived beside the
+// records, under its key.
+type MediaRecord struct {
+	ID          int        `json:"id"`
+	Key         string     `json:"key"`
+	Filename    string     `json:"filename"`
+	ContentType string     `json:"contentType"`
+	Size        int64      `json:"size"`
+	Width       int        `json:"width,omitempty"`
+	Height      int        `json:"height,omitempty"`
+	Alt         string     `json:"alt,omitempty"`
+	Caption     string     `json:"caption,omitempty"`
+	FocusX      float64    `json:"focusX"`
+	FocusY      float64    `json:"focusY"`
+	Owner       int        `json:"owner"`
+	Created     *time.Time `json:"created"`
+}
+
+// WebhookRecord is a backed up webhook. Secret is empty unless secrets were
+// included, and such webhooks are restored inactive until given a new one.
+type WebhookRecord struct {
+	ID      int        `json:"id"`
+	URL     string     `json:"url"`
+	Secret  string     `json:"secret,omitempty"`
+	Events  []string   `json:"events"`
+	Active  bool       `json:"active"`
+	Created *time.Time `json:"created"`
+}
+
+// SpamTokenRecord is what the spam classifier learnt about a token
+type SpamTokenRecord struct {
+	Token string `json:"token"`
+	Spam  int    `json:"spam"`
+	Ham   int    `json:"ham"`
+}
+
+// Dump reads the content of the blog in a single transaction so it is
+// consistent. Password hashes and webhook secrets are only included when
+// hashes is set.
+func Dump(Db DB, hashes bool) (*Backup, error) {
+	defer timed("backup.dump")()
+	tx, err := Db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SET TRANSACTION ISOLATION LEVEL REPEATABLE READ READ ONLY`); err != nil {
+		return nil, err
+	}
+
+	b := &Backup{}
+	err = dumpRows(tx, `SELECT "name" FROM "role" ORDER BY "roleid"`, func(rows *sql.Rows) error {
+		var r RoleRecord
+		err := rows.Scan(&r.Name)
+		b.Roles = append(b.Roles, r)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "userid", "username", "hash", "created", COALESCE("realname", ''),
+		COALESCE("email", ''), COALESCE("role"."name", '')
+		FROM "users"
+		LEFT JOIN "role" ON "role"."roleid" = "users"."role"
+		ORDER BY "userid"`, func(rows *sql.Rows) error {
+		var u UserRecord
+		err := rows.Scan(&u.ID, &u.Username, &u.Hash, &u.Created, &u.Realname, &u.Email, &u.Role)
+		if !hashes {
+			u.Hash = ""
+		}
+		b.Users = append(b.Users, u)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "categoryid", "name" FROM "category" ORDER BY "categoryid"`, func(rows *sql.Rows) error {
+		var c CategoryRecord
+		err := rows.Scan(&c.ID, &c.Name)
+		b.Categories = append(b.Categories, c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "articleid", "title", "author", "body", "date", "updated", "slug", "category", `+tagsColumn+`
+		FROM "articles"
+		ORDER BY "articleid"`, func(rows *sql.Rows) error {
+		var a ArticleRecord
+		err := rows.Scan(&a.ID, &a.Title, &a.Author, &a.Body, &a.Date, &a.Updated, &a.Slug, &a.Category, pq.Array(&a.Tags))
+		b.Articles = append(b.Articles, a)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "commentid", "article", COALESCE("parent", 0), COALESCE("author", 0),
+		COALESCE("name", ''), COALESCE("email", ''), "body", "created", "updated", "state",
+		"published", "spamscore", COALESCE("trained", '')
+		FROM "comments"
+		ORDER BY "commentid"`, func(rows *sql.Rows) error {
+		var c CommentRecord
+		err := rows.Scan(&c.ID, &c.Article, &c.Parent, &c.Author, &c.Name, &c.Email, &c.Body,
+			&c.Created, &c.Updated, &c.State, &c.Published, &c.SpamScore, &c.Trained)
+		b.Comments = append(b.Comments, c)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "token", "spam", "ham" FROM "spam_tokens" ORDER BY "token"`, func(rows *sql.Rows) error {
+		var t SpamTokenRecord
+		err := rows.Scan(&t.Token, &t.Spam, &t.Ham)
+		b.SpamTokens = append(b.SpamTokens, t)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "mediaid", "key", "filename", "contenttype", "size", "width", "height",
+		"alt", "caption", "focusx", "focusy", "owner", "created"
+		FROM "media"
+		ORDER BY "mediaid"`, func(rows *sql.Rows) error {
+		var m MediaRecord
+		err := rows.Scan(&m.ID, &m.Key, &m.Filename, &m.ContentType, &m.Size, &m.Width, &m.Height,
+			&m.Alt, &m.Caption, &m.FocusX, &m.FocusY, &m.Owner, &m.Created)
+		b.Media = append(b.Media, m)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	err = dumpRows(tx, `SELECT "webhookid", "url", "secret", "events", "active", "created"
+		FROM "webhooks"
+		ORDER BY "webhookid"`, func(rows *sql.Rows) error {
+		var w WebhookRecord
+		err := rows.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.Active, &w.Created)
+		if !hashes {
+			w.Secret = ""
+		}
+		b.Webhooks = append(b.Webhooks, w)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return b, tx.Commit()
+}
+
+// dumpRows calls scan for every row of query
+func dumpRows(tx *sql.Tx, query string, scan func(*sql.Rows) error) error {
+	rows, err := tx.Query(query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Restore writes a backup into an empty database in a single transaction,
+// keeping the original ids. files is called once every row is written but
+// before they are committed, to restore the files they refer to; the restore
+// is abandoned if it fails.
+func Restore(Db DB, b *Backup, files func() error) error {
+	defer timed("backup.restore")()
+	tx, err := Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var content int
+	err = tx.QueryRow(`SELECT (SELECT COUNT(*) FROM "users") + (SELECT COUNT(*) FROM "category") +
+		(SELECT COUNT(*) FROM "articles") + (SELECT COUNT(*) FROM "comments") + (SELECT COUNT(*) FROM "media") +
+		(SELECT COUNT(*) FROM "webhooks")`).Scan(&content)
+	if err != nil {
+		return err
+	}
+	if content > 0 {
+		return ErrNotEmpty
+	}
+
+	// The schema creates the built in roles, only those added since are new
+	for _, r := range b.Roles {
+		_, err := tx.Exec(`INSERT INTO "role" ("name") SELECT $1
+			WHERE NOT EXISTS (SELECT 1 FROM "role" WHERE "name" = $1)`, r.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, u := range b.Users {
+		_, err := tx.Exec(`INSERT INTO "users" ("userid", "username", "hash", "created", "realname", "email", "role")
+			VALUES ($1, $2, $3, $4, NULLIF($5, ''), NULLIF($6, ''), (SELECT "roleid" FROM "role" WHERE "name" = $7))`,
+			u.ID, u.Username, u.Hash, u.Created, u.Realname, u.Email, u.Role)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, c := range b.Categories {
+		_, err := tx.Exec(`INSERT INTO "category" ("categoryid", "name") VALUES ($1, $2)`, c.ID, c.Name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, a := range b.Articles {
+		_, err := tx.Exec(`INSERT INTO "articles" ("articleid", "title", "author", "body", "date", "updated", "slug", "category")
+			VALUES ($1, $2, $3, $4, $5, COALESCE($6, $5), $7, $8)`,
+			a.ID, a.Title, a.Author, a.Body, a.Date, a.Updated, a.Slug, a.Category)
+		if err != nil {
+			return err
+		}
+		for _, tag := range a.Tags {
+			_, err := tx.Exec(`INSERT INTO "tags" ("name") VALUES ($1) ON CONFLICT ("name") DO NOTHING`, tag)
+			if err != nil {
+				return err
+			}
+			_, err = tx.Exec(`INSERT INTO "article_tags" ("article", "tag")
+				SELECT $1, "tagid" FROM "tags" WHERE "name" = $2
+				ON CONFLICT DO NOTHING`, a.ID, tag)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	// Comments are ordered by id, so parents are restored before replies.
+	// Archives from before comments recorded when they were first approved
+	// take the approved ones as published when made.
+	for _, c := range b.Comments {
+		_, err := tx.Exec(`INSERT INTO "comments" ("commentid", "article", "parent", "author", "name", "email",
+			"body", "created", "updated", "state", "published", "spamscore", "trained")
+			VALUES ($1, $2, NULLIF($3, 0), NULLIF($4, 0), NULLIF($5, ''), NULLIF($6, ''), $7, $8, $9, $10,
+				COALESCE($11, CASE WHEN $10 = 'approved' THEN $8 END), $12, NULLIF($13, ''))`,
+			c.ID, c.Article, c.Parent, c.Author, c.Name, c.Email, c.Body, c.Created, c.Updated, c.State,
+			c.Published, c.SpamScore, c.Trained)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, t := range b.SpamTokens {
+		_, err := tx.Exec(`INSERT INTO "spam_tokens" ("token", "spam", "ham") VALUES ($1, $2, $3)
+			ON CONFLICT ("token") DO UPDATE SET "spam" = EXCLUDED."spam", "ham" = EXCLUDED."ham"`,
+			t.Token, t.Spam, t.Ham)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, m := range b.Media {
+		_, err := tx.Exec(`INSERT INTO "media" ("mediaid", "key", "filename", "contenttype", "size", "width", "height",
+			"alt", "caption", "focusx", "focusy", "owner", "created")
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13)`,
+			m.ID, m.Key, m.Filename, m.ContentType, m.Size, m.Width, m.Height,
+			m.Alt, m.Caption, m.FocusX, m.FocusY, m.Owner, m.Created)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, w := range b.Webhooks {
+		_, err := tx.Exec(`INSERT INTO "webhooks" ("webhookid", "url", "secret", "events", "active", "created")
+			VALUES ($1, $2, $3, $4, $5, $6)`,
+			w.ID, w.URL, w.Secret, pq.Array(w.Events), w.Active && w.Secret != "", w.Created)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Continue the id sequences after the restored rows
+	for table, column := range map[string]string{
+		"users":    "userid",
+		"category": "categoryid",
+		"articles": "articleid",
+		"comments": "commentid",
+		"media":    "mediaid",
+		"webhooks": "webhookid",
+	} {
+		_, err := tx.Exec(`SELECT setval(pg_get_serial_sequence($1, $2), GREATEST(MAX(`+column+`), 1), MAX(`+column+`) IS NOT NULL)
+			FROM `+table, table, column)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := files(); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
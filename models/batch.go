@@ -0,0 +1,328 @@
+package models
+
+import (
+	"database/sql"
+
+	"github.com/lib/pq"
+)
+
+// The loaders in this file fetch what a whole set of parents needs with one
+// query, so callers resolving nested data don't query once per parent.
+// Articles come with stub authors and categories holding only an id and name,
+// which UsersByName and CategoriesByName fill in for a batch.
+
+// batchColumns selects the columns scanned by scanBatchArticle
+const batchColumns = `"articles"."articleid", "articles"."title", "articles"."slug", "articles"."date",
+	"articles"."updated", "articles"."body", "users"."userid", "users"."username",
+	"category"."categoryid", "category"."name", ` + tagsColumn + ` AS "tags", "articles"."version"`
+
+// rankedColumns selects batchColumns again from a subquery
+const rankedColumns = `"articleid", "title", "slug", "date", "updated", "body", "userid", "username",
+	"categoryid", "name", "tags", "version"`
+
+// batchJoins joins the authors and categories of articles
+const batchJoins = `JOIN "category" ON "category"."categoryid" = "articles"."category"
+	JOIN "users" ON "users"."userid" = "articles"."author"`
+
+// articleGroups are what ArticlesBy groups articles by, with any join needed
+var articleGroups = map[string]struct{ column, join string }{
+	"category": {column: `"category"."name"`},
+	"author":   {column: `"users"."username"`},
+	"tag": {
+		column: `"tag"."name"`,
+		join: `JOIN "article_tags" "tagged" ON "tagged"."article" = "articles"."articleid"
+			JOIN "tags" "tag" ON "tag"."tagid" = "tagged"."tag"`,
+	},
+}
+
+// scanBatchArticle reads an article selected with batchColumns, after any
+// leading columns in dest
+func scanBatchArticle(row scanner, Db DB, dest ...interface{}) (*SQLArticle, error) {
+	a := &SQLArticle{
+		Db:       Db,
+		Author:   &SQLUser{Db: Db, exists: true},
+		Category: &SQLCategory{Db: Db, exists: true, populated: true},
+		exists:   true,
+	}
+	dest = append(dest, &a.ID, &a.Title, &a.Slug, &a.Date, &a.Updated, &a.Body,
+		&a.Author.ID, &a.Author.Username, &a.Category.ID, &a.Category.Name, pq.Array(&a.Tags), &a.Version)
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	return a, nil
+}
+
+// ArticlePage returns a page of every article, newest first
+func ArticlePage(offset, limit int, Db DB) ([]*SQLArticle, error) {
+	defer timed("article.page")()
+	rows, err := Db.Query(`SELECT `+batchColumns+`
+		FROM "articles"
+		`+batchJoins+`
+		ORDER BY "articles"."date" DESC, "articles"."articleid" DESC
+		OFFSET $1 LIMIT $2`, offset, limit)
+	if err != nil {
+		logger(Db).Error("Error querying for articles", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	var articles []*SQLArticle
+	for rows.Next() {
+		a, err := scanBatchArticle(rows, Db)
+		if err != nil {
+			logger(Db).Error("Failed to scan article", "err", err)
+			return nil, ErrLoad
+		}
+		articles = append(articles, a)
+	}
+	return articles, nil
+}
+
+// ArticlesBySlug returns the articles with the given slugs, by slug
+func ArticlesBySlug(slugs []string, Db DB) (map[string]*SQLArticle, error) {
+	defer timed("article.by_slug")()
+	rows, err := Db.Query(`SELECT `+batchColumns+`
+		FROM "articles"
+		`+batchJoins+`
+		WHERE "articles"."slug" = ANY($1)`, pq.Array(slugs))
+	if err != nil {
+		logger(Db).Error("Error querying for articles", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	articles := make(map[string]*SQLArticle)
+	for rows.Next() {
+		a, err := scanBatchArticle(rows, Db)
+		if err != nil {
+			logger(Db).Error("Failed to scan article", "err", err)
+			return nil, ErrLoad
+		}
+		articles[a.Slug] = a
+	}
+	return articles, nil
+}
+
+// ArticlesBy returns a page of articles, newest first, for each of the keys
+// of a group. The group is "category", "author" or "tag" and the keys are
+// category names, usernames or tag names.
+func ArticlesBy(group string, keys []string, offset, limit int, Db DB) (map[string][]*SQLArticle, error) {
+	defer timed("article.by_group")()
+	g, ok := articleGroups[group]
+	if !ok {
+		return nil, ErrLoad
+	}
+
+	rows, err := Db.Query(`SELECT "grp", `+rankedColumns+` FROM (
+			SELECT `+g.column+` AS "grp", `+batchColumns+`,
+				ROW_NUMBER() OVER (PARTITION BY `+g.column+`
+					ORDER BY "articles"."date" DESC, "articles"."articleid" DESC) AS "n"
+			FROM "articles"
+			`+batchJoins+`
+			`+g.join+`
+			WHERE `+g.column+` = ANY($1)
+		) "ranked"
+		WHERE "n" > $2 AND "n" <= $2 + $3
+		ORDER BY "grp", "n"`, pq.Array(keys), offset, limit)
+	if err != nil {
+		logger(Db).Error("Error querying for articles", "by", group, "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	articles := make(map[string][]*SQLArticle)
+	for rows.Next() {
+		var key string
+		a, err := scanBatchArticle(rows, Db, &key)
+		if err != nil {
+			logger(Db).Error("Failed to scan article", "err", err)
+			return nil, ErrLoad
+		}
+		articles[key] = append(articles[key], a)
+	}
+	return articles, nil
+}
+
+// RelatedArticles returns up to limit articles related to each of the
+// articles with the given ids, by id. Articles sharing more tags come first,
+// then those in the same category, then the newest.
+func RelatedArticles(ids []int, limit int, Db DB) (map[int][]*SQLArticle, error) {
+	defer timed("article.related")()
+	rows, err := Db.Query(`SELECT "source", `+rankedColumns+` FROM (
+			SELECT "origin"."articleid" AS "source", `+batchColumns+`,
+				ROW_NUMBER() OVER (PARTITION BY "origin"."articleid"
+					ORDER BY "shared"."tags" DESC, "articles"."category" = "origin"."category" DESC,
+						"articles"."date" DESC, "articles"."articleid" DESC) AS "n"
+			FROM "articles" "origin"
+			JOIN "articles" ON "articles"."articleid" <> "origin"."articleid"
+			`+batchJoins+`
+			CROSS JOIN LATERAL (
+				SELECT COUNT(*) AS "tags" FROM "article_tags" "mine"
+				JOIN "article_tags" "theirs" ON "theirs"."tag" = "mine"."tag"
+				WHERE "mine"."article" = "origin"."articleid" AND "theirs"."article" = "articles"."articleid"
+			) "shared"
+			WHERE "origin"."articleid" = ANY($1)
+				AND ("shared"."tags" > 0 OR "articles"."category" = "origin"."category")
+		) "ranked"
+		WHERE "n" <= $2
+		ORDER BY "source", "n"`, pq.Array(int64s(ids)), limit)
+	if err != nil {
+		logger(Db).Error("Error querying for related articles", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	articles := make(map[int][]*SQLArticle)
+	for rows.Next() {
+		var source int
+		a, err := scanBatchArticle(rows, Db, &source)
+		if err != nil {
+			logger(Db).Error("Failed to scan article", "err", err)
+			return nil, ErrLoad
+		}
+		articles[source] = append(articles[source], a)
+	}
+	return articles, nil
+}
+
+// userBatchSelect selects the columns scanned by scanUsers
+const userBatchSelect = `SELECT "userid", "username", "created", COALESCE("realname", ''), COALESCE("email", ''), COALESCE("role"."name", ''),
+	"users"."version"
+	FROM "users"
+	LEFT JOIN "role" ON "role"."roleid" = "users"."role"`
+
+// scanUsers reads every user selected with userBatchSelect
+func scanUsers(rows *sql.Rows, Db DB) ([]*SQLUser, error) {
+	var users []*SQLUser
+	for rows.Next() {
+		u := &SQLUser{Db: Db, exists: true, populated: true}
+		if err := rows.Scan(&u.ID, &u.Username, &u.Created, &u.Realname, &u.Email, &u.Role, &u.Version); err != nil {
+			logger(Db).Error("Failed to scan user", "err", err)
+			return nil, ErrLoad
+		}
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// UsersByName returns the users with the given usernames, by username,
+// without their password hashes
+func UsersByName(usernames []string, Db DB) (map[string]*SQLUser, error) {
+	defer timed("user.by_name")()
+	rows, err := Db.Query(userBatchSelect+` WHERE "username" = ANY($1)`, pq.Array(usernames))
+	if err != nil {
+		logger(Db).Error("Error querying for users", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	users, err := scanUsers(rows, Db)
+	if err != nil {
+		return nil, err
+	}
+	byName := make(map[string]*SQLUser, len(users))
+	for _, u := range users {
+		byName[u.Username] = u
+	}
+	return byName, nil
+}
+
+// CategoriesByName returns the categories with the given names, by name
+func CategoriesByName(names []string, Db DB) (map[string]*SQLCategory, error) {
+	defer timed("category.by_name")()
+	rows, err := Db.Query(`SELECT "categoryid", "name", "version" FROM "category" WHERE "name" = ANY($1)`, pq.Array(names))
+	if err != nil {
+		logger(Db).Error("Error querying for categories", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	categories := make(map[string]*SQLCategory)
+	for rows.Next() {
+		c := &SQLCategory{Db: Db, exists: true, populated: true}
+		if err := rows.Scan(&c.ID, &c.Name, &c.Version); err != nil {
+			logger(Db).Error("Failed to scan category", "err", err)
+			return nil, ErrLoad
+		}
+		categories[c.Name] = c
+	}
+	return categories, nil
+}
+
+// CommentsByArticle returns the published comments on each of the articles
+// with the given ids as threads, by article id
+func CommentsByArticle(ids []int, Db DB) (map[int][]*SQLComment, error) {
+	defer timed("comment.by_article")()
+	rows, err := Db.Query(commentSelect+`
+		WHERE "article" = ANY($1) AND "state" IN ($2, $3)
+		ORDER BY "comments"."created", "commentid"`, pq.Array(int64s(ids)), StateApproved, StateDeleted)
+	if err != nil {
+		logger(Db).Error("Error querying for comments", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	byArticle := make(map[int][]*SQLComment)
+	for _, c := range scanComments(rows, Db) {
+		byArticle[c.ArticleID] = append(byArticle[c.ArticleID], c)
+	}
+	for id, comments := range byArticle {
+		byArticle[id] = thread(comments)
+	}
+	return byArticle, nil
+}
+
+// TagList returns the names of the tags on at least one article
+func TagList(Db DB) ([]string, error) {
+	defer timed("tag.list")()
+	rows, err := Db.Query(`SELECT "name" FROM "tags"
+		WHERE EXISTS (SELECT 1 FROM "article_tags" WHERE "article_tags"."tag" = "tags"."tagid")
+		ORDER BY "name"`)
+	if err != nil {
+		logger(Db).Error("Error querying for tags", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	var tags []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			logger(Db).Error("Failed to scan tag", "err", err)
+			return nil, ErrLoad
+		}
+		tags = append(tags, name)
+	}
+	return tags, nil
+}
+
+// UserList returns every user by username, without their password hashes
+func UserList(Db DB) ([]*SQLUser, error) {
+	defer timed("user.list")()
+	rows, err := Db.Query(userBatchSelect + ` ORDER BY "username"`)
+	if err != nil {
+		logger(Db).Error("Error querying for users", "err", err)
+		return nil, ErrLoad
+	}
+
+	defer rows.Close()
+
+	return scanUsers(rows, Db)
+}
+
+// int64s converts ids for use as a SQL array
+func int64s(ids []int) []int64 {
+	out := make([]int64, len(ids))
+	for i, id := range ids {
+		out[i] = int64(id)
+	}
+	return out
+}
@@ -4,9 +4,9 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	"log"
 	"regexp"
 	"strings"
+	"time"
 )
 
 // Category in an interface for categories
@@ -18,16 +18,22 @@ type Category interface {
 
 // SQLCategory is a Category backed by SQL
 type SQLCategory struct {
-	ID        int     `json:"id,omitempty"`
-	Name      string  `json:"name"`
-	Db        *sql.DB `json:"-"`
+	ID   int    `json:"id,omitempty"`
+	Name string `json:"name"`
+	// Updated is when the category or any article filed under it last
+	// changed
+	Updated *time.Time `json:"updated"`
+	Version int        `json:"version"`
+	// Force writes the category whatever the version of its row
+	Force     bool `json:"-"`
+	Db        DB   `json:"-"`
 	populated bool
 	dirty     bool
 	exists    bool
 }
 
 // NewSQLCategory creates a SQLCategory instance configured with a connection
-func NewSQLCategory(name string, db *sql.DB) *SQLCategory {
+func NewSQLCategory(name string, db DB) *SQLCategory {
 	c := &SQLCategory{
 		Db:   db,
 		Name: name,
@@ -36,7 +42,7 @@ func NewSQLCategory(name string, db *sql.DB) *SQLCategory {
 	if c.Exists() {
 		err := c.Populate()
 		if err != nil {
-			log.Println(err)
+			logger(db).Error("Failed to populate category", "name", name, "err", err)
 		}
 	}
 
@@ -44,13 +50,15 @@ func NewSQLCategory(name string, db *sql.DB) *SQLCategory {
 }
 
 // CategoryList is a list of categories
-func CategoryList(Db *sql.DB) []*SQLCategory {
+func CategoryList(Db DB) []*SQLCategory {
+	defer timed("category.list")()
 	var categories []*SQLCategory
 
-	rows, err := Db.Query(`SELECT "categoryid", "name" from "category"`)
+	rows, err := Db.Query(`SELECT "categoryid", "name", "updated", "version" from "category"`)
 
 	if err != nil {
-		log.Println("Error querying for all categories", err)
+		logger(Db).Error("Error querying for all categories", "err", err)
+		return nil
 	}
 
 	defer rows.Close()
@@ -59,17 +67,21 @@ func CategoryList(Db *sql.DB) []*SQLCategory {
 		var (
 			categoryID int
 			name       string
+			updated    *time.Time
+			version    int
 		)
 
-		if err := rows.Scan(&categoryID, &name); err != nil {
-			log.Println(err)
+		if err := rows.Scan(&categoryID, &name, &updated, &version); err != nil {
+			logger(Db).Error("Failed to scan category", "err", err)
 			continue
 		}
 
 		category := &SQLCategory{
-			Db:   Db,
-			ID:   categoryID,
-			Name: name,
+			Db:      Db,
+			ID:      categoryID,
+			Name:    name,
+			Updated: updated,
+			Version: version,
 		}
 
 		categories = append(categories, category)
@@ -83,6 +95,7 @@ func (c *SQLCategory) Exists() bool {
 	if c.exists {
 		return true
 	}
+	defer timed("category.exists")()
 	var count int
 	err := c.Db.QueryRow(`SELECT COUNT(*)
 	FROM "category"
@@ -100,6 +113,7 @@ func (c *SQLCategory) Exists() bool {
 
 // Populate the model with data from the database
 func (c *SQLCategory) Populate() error {
+	defer timed("category.load")()
 	if !c.Exists() {
 		return errors.New("Instance does not exist")
 	}
@@ -113,9 +127,9 @@ func (c *SQLCategory) Populate() error {
 	}
 
 	// Fetch data and populate
-	err := c.Db.QueryRow(`SELECT "categoryid"
+	err := c.Db.QueryRow(`SELECT "categoryid", "updated", "version"
 	FROM "category"
-	WHERE "name" = $1`, c.Name).Scan(&c.ID)
+	WHERE "name" = $1`, c.Name).Scan(&c.ID, &c.Updated, &c.Version)
 
 	if err != nil {
 		return errors.New("Unknown error occurred: " + fmt.Sprintf("%s", err))
@@ -127,6 +141,7 @@ func (c *SQLCategory) Populate() error {
 
 // Save the properties of the category into the database
 func (c *SQLCategory) Save() error {
+	defer timed("category.save")()
 	var err error
 	var query string
 
@@ -135,34 +150,54 @@ func (c *SQLCategory) Save() error {
 		// Validation error
 		return err
 	}
+	action := Updated
 	if !c.Exists() {
-		log.Println("Creating new category")
-		query = `INSERT INTO "category" ("name") VALUES ($1)`
-		_, err = c.Db.Exec(query, c.Name)
+		logger(c.Db).Debug("Creating new category", "name", c.Name)
+		action = Created
+		query = `INSERT INTO "category" ("name") VALUES ($1) RETURNING "categoryid", "updated", "version"`
+		err = c.Db.QueryRow(query, c.Name).Scan(&c.ID, &c.Updated, &c.Version)
 	} else {
-		log.Println("Overwriting existing category")
-		query = `UPDATE "category" SET "name" = $1 WHERE "categoryid" = $2`
-		_, err = c.Db.Exec(query, c.Name, c.ID)
+		logger(c.Db).Debug("Overwriting existing category", "name", c.Name)
+		query = `UPDATE "category" SET "name" = $1, "updated" = CURRENT_TIMESTAMP, "version" = "version" + 1
+		WHERE "categoryid" = $2 AND ($4 OR "version" = $3) RETURNING "updated", "version"`
+		err = c.Db.QueryRow(query, c.Name, c.ID, c.Version, c.Force).Scan(&c.Updated, &c.Version)
 	}
 
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
 	if err != nil {
 		return ErrSave
 	}
 
+	c.exists = true
+	emit(Event{Model: "category", Action: action, ID: c.ID, Key: c.Name, Object: c})
 	return nil
 }
 
 // Validate the properties of category
 func (c *SQLCategory) Validate() error {
-	log.Println(c.Name)
 	match, err := regexp.MatchString(`[a-zA-Z0-9\-_]+`, strings.TrimSpace(c.Name))
 	if err != nil {
-		log.Println(err)
+		logger(c.Db).Error("Failed to match category name", "name", c.Name, "err", err)
 		return ErrValidation
 	}
 	if !match {
-		log.Println("No match")
+		logger(c.Db).Debug("Category name is invalid", "name", c.Name)
 		return ErrValidation
 	}
 	return nil
 }
+
+// LastUpdated returns when any category or article last changed, nil when
+// there are none
+func LastUpdated(Db DB) *time.Time {
+	defer timed("category.last_updated")()
+	var updated *time.Time
+	err := Db.QueryRow(`SELECT MAX("updated") FROM "category"`).Scan(&updated)
+	if err != nil {
+		logger(Db).Error("Error querying when categories were last updated", "err", err)
+		return nil
+	}
+	return updated
+}
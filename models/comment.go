@@ -0,0 +1,453 @@
+package models
+
+import (
+	"database/sql"
+	"net/mail"
+	"strings"
+	"time"
+)
+
+// MaxCommentLength is the longest comment body accepted
+const MaxCommentLength = 10000
+
+// Moderation states of a comment
+const (
+	StatePending  = "pending"
+	StateApproved = "approved"
+	StateSpam     = "spam"
+	StateDeleted  = "deleted"
+)
+
+// ValidState reports whether state is a known moderation state
+func ValidState(state string) bool {
+	switch state {
+	case StatePending, StateApproved, StateSpam, StateDeleted:
+		return true
+	}
+	return false
+}
+
+// Comment is an interface for describing comments
+type Comment interface {
+	Exists() bool
+	Populate() error
+	Save() error
+	Validate() error
+	Delete() error
+	SetState(string) error
+}
+
+// SQLComment is a SQL backed Comment, either by a user or anonymous
+type SQLComment struct {
+	ID          int        `json:"id"`
+	ArticleID   int        `json:"-"`
+	ArticleSlug string     `json:"-"`
+	ParentID    int        `json:"parent,omitempty"`
+	Author      *SQLUser   `json:"author,omitempty"`
+	Name        string     `json:"name,omitempty"`
+	Email       string     `json:"-"`
+	Body        string     `json:"body"`
+	Created     *time.Time `json:"created"`
+	Updated     *time.Time `json:"updated,omitempty"`
+	State       string     `json:"state"`
+	SpamScore   float64    `json:"-"`
+	Trained     string     `json:"-"`
+	Version     int        `json:"version"`
+	// Force writes the comment whatever the version of its row
+	Force     bool          `json:"-"`
+	Replies   []*SQLComment `json:"-"`
+	Db        DB            `json:"-"`
+	populated bool
+	exists    bool
+}
+
+// NewSQLComment returns an instance of SQLComment backed by a database
+func NewSQLComment(id int, Db DB) *SQLComment {
+	c := &SQLComment{
+		ID: id,
+		Db: Db,
+	}
+
+	if c.Exists() {
+		c.Populate()
+	}
+
+	return c
+}
+
+// commentSelect selects the columns scanned by scan
+const commentSelect = `SELECT "commentid", "article", "articles"."slug", COALESCE("parent", 0),
+	COALESCE("users"."userid", 0), COALESCE("users"."username", ''), COALESCE("comments"."name", ''),
+	COALESCE("comments"."email", ''), "comments"."body", "comments"."created", "updated", "state",
+	COALESCE("spamscore", 0), COALESCE("trained", ''), "comments"."version"
+	FROM "comments"
+	JOIN "articles" ON "articles"."articleid" = "comments"."article"
+	LEFT JOIN "users" ON "users"."userid" = "comments"."author"`
+
+// scanner is satisfied by *sql.Row and *sql.Rows
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scan fills c from a row selected with commentSelect
+func (c *SQLComment) scan(row scanner) error {
+	var (
+		userID   int
+		username string
+	)
+	err := row.Scan(&c.ID, &c.ArticleID, &c.ArticleSlug, &c.ParentID, &userID, &username, &c.Name,
+		&c.Email, &c.Body, &c.Created, &c.Updated, &c.State, &c.SpamScore, &c.Trained, &c.Version)
+	if err != nil {
+		return err
+	}
+	if userID != 0 {
+		c.Author = &SQLUser{Db: c.Db, ID: userID, Username: username}
+	}
+	return nil
+}
+
+// scanComments reads every comment from rows
+func scanComments(rows *sql.Rows, Db DB) []*SQLComment {
+	var comments []*SQLComment
+	for rows.Next() {
+		c := &SQLComment{Db: Db, exists: true, populated: true}
+		if err := c.scan(rows); err != nil {
+			logger(Db).Error("Failed to scan comment", "err", err)
+			continue
+		}
+		comments = append(comments, c)
+	}
+	return comments
+}
+
+// CommentList returns the published comments on an article as threads, oldest
+// first, with replies nested under their parents
+func CommentList(articleID int, Db DB) []*SQLComment {
+	defer timed("comment.list")()
+	rows, err := Db.Query(commentSelect+`
+		WHERE "article" = $1 AND "state" IN ($2, $3)
+		ORDER BY "comments"."created", "commentid"`, articleID, StateApproved, StateDeleted)
+
+	if err != nil {
+		logger(Db).Error("Error querying for comments", "err", err)
+		return nil
+	}
+
+	defer rows.Close()
+
+	return thread(scanComments(rows, Db))
+}
+
+// CommentQueue returns a page of comments in the given state across every
+// article, oldest first, along with how many are in that state
+func CommentQueue(state string, offset, limit int, Db DB) ([]*SQLComment, int) {
+	defer timed("comment.queue")()
+	var total int
+	err := Db.QueryRow(`SELECT COUNT(*) FROM "comments" WHERE "state" = $1`, state).Scan(&total)
+	if err != nil {
+		logger(Db).Error("Error counting comments", "err", err)
+		return nil, 0
+	}
+
+	rows, err := Db.Query(commentSelect+`
+		WHERE "state" = $1
+		ORDER BY "comments"."created", "commentid"
+		OFFSET $2 LIMIT $3`, state, offset, limit)
+
+	if err != nil {
+		logger(Db).Error("Error querying for comments", "err", err)
+		return nil, 0
+	}
+
+	defer rows.Close()
+
+	return scanComments(rows, Db), total
+}
+
+// ApprovedCommentCount returns how many approved comments were left by the
+// user
+func ApprovedCommentCount(userID int, Db DB) int {
+	defer timed("comment.approved_count")()
+	var count int
+	err := Db.QueryRow(`SELECT COUNT(*) FROM "comments" WHERE "author" = $1 AND "state" = $2`,
+		userID, StateApproved).Scan(&count)
+	if err != nil {
+		logger(Db).Error("Error counting approved comments", "err", err)
+		return 0
+	}
+	return count
+}
+
+// thread nests comments under their parents, dropping deleted comments
+// nobody has replied to
+func thread(all []*SQLComment) []*SQLComment {
+	byID := make(map[int]*SQLComment, len(all))
+	for _, c := range all {
+		byID[c.ID] = c
+	}
+
+	var roots []*SQLComment
+	for _, c := range all {
+		if parent, ok := byID[c.ParentID]; ok {
+			parent.Replies = append(parent.Replies, c)
+		} else {
+			roots = append(roots, c)
+		}
+	}
+	return prune(roots)
+}
+
+// prune removes deleted comments which have no remaining replies
+func prune(comments []*SQLComment) []*SQLComment {
+	kept := comments[:0]
+	for _, c := range comments {
+		c.Replies = prune(c.Replies)
+		if c.State == StateDeleted && len(c.Replies) == 0 {
+			continue
+		}
+		kept = append(kept, c)
+	}
+	return kept
+}
+
+// Exists determines whether or not the comment exists
+func (c *SQLComment) Exists() bool {
+	if c.exists {
+		return true
+	}
+	defer timed("comment.exists")()
+	if c.ID == 0 {
+		return false
+	}
+	var count int
+	err := c.Db.QueryRow(`SELECT COUNT(*) FROM "comments" WHERE "commentid" = $1`, c.ID).Scan(&count)
+	if err != nil {
+		return false
+	}
+	c.exists = count > 0
+	return count > 0
+}
+
+// Populate populates the model and its published replies with data from the database
+func (c *SQLComment) Populate() error {
+	defer timed("comment.load")()
+	if !c.Exists() {
+		return ErrDoesNotExist
+	}
+
+	row := c.Db.QueryRow(commentSelect+`
+		WHERE "commentid" = $1`, c.ID)
+	if err := c.scan(row); err != nil {
+		logger(c.Db).Debug("Comment does not exist", "id", c.ID, "err", err)
+		return ErrDoesNotExist
+	}
+
+	for _, root := range CommentList(c.ArticleID, c.Db) {
+		if found := root.find(c.ID); found != nil {
+			c.Replies = found.Replies
+		}
+	}
+
+	c.populated = true
+	return nil
+}
+
+// find returns the comment with id from the thread rooted at c
+func (c *SQLComment) find(id int) *SQLComment {
+	if c.ID == id {
+		return c
+	}
+	for _, reply := range c.Replies {
+		if found := reply.find(id); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+// Anonymous reports whether the comment was left without an account
+func (c *SQLComment) Anonymous() bool {
+	return c.Author == nil || c.Author.ID == 0
+}
+
+// DisplayName is the name shown alongside the comment
+func (c *SQLComment) DisplayName() string {
+	if !c.Anonymous() {
+		return c.Author.Username
+	}
+	return c.Name
+}
+
+// Visible reports whether the comment is shown to readers, deleted comments
+// are only shown as placeholders while they have replies
+func (c *SQLComment) Visible() bool {
+	return c.State == StateApproved || (c.State == StateDeleted && len(c.Replies) > 0)
+}
+
+// Save the comment into the database
+func (c *SQLComment) Save() error {
+	defer timed("comment.save")()
+	var err error
+
+	err = c.Validate()
+	if err != nil {
+		return err
+	}
+
+	var (
+		author interface{}
+		parent interface{}
+	)
+	if !c.Anonymous() {
+		author = c.Author.ID
+	}
+	if c.ParentID != 0 {
+		parent = c.ParentID
+	}
+	if c.State == "" {
+		c.State = StatePending
+	}
+
+	action := Updated
+	if !c.Exists() {
+		action = Created
+		err = c.Db.QueryRow(`INSERT INTO "comments" ("article", "parent", "author", "name", "email", "body", "state", "spamscore", "published")
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, CASE WHEN $7 = 'approved' THEN CURRENT_TIMESTAMP END)
+			RETURNING "commentid", "created", "version"`,
+			c.ArticleID, parent, author, c.Name, c.Email, c.Body, c.State, c.SpamScore).Scan(&c.ID, &c.Created, &c.Version)
+	} else {
+		err = c.Db.QueryRow(`UPDATE "comments" SET "body" = $1, "state" = $2, "spamscore" = $3, "updated" = CURRENT_TIMESTAMP, "version" = "version" + 1,
+				"published" = COALESCE("published", CASE WHEN $2 = 'approved' THEN CURRENT_TIMESTAMP END)
+			WHERE "commentid" = $4 AND ($6 OR "version" = $5)
+			RETURNING "updated", "version"`, c.Body, c.State, c.SpamScore, c.ID, c.Version, c.Force).Scan(&c.Updated, &c.Version)
+	}
+
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	if err != nil {
+		logger(c.Db).Error("Failed to save comment", "id", c.ID, "err", err)
+		return ErrSave
+	}
+
+	c.exists = true
+	emit(Event{Model: "comment", Action: action, ID: c.ID, Object: c})
+	return nil
+}
+
+// SetState moves the comment to another moderation state
+func (c *SQLComment) SetState(state string) error {
+	defer timed("comment.set_state")()
+	if !ValidState(state) {
+		return ErrValidation
+	}
+	if state == StateDeleted {
+		return c.Delete()
+	}
+	if !c.Exists() {
+		return ErrDoesNotExist
+	}
+
+	// The comment is only announced as approved the first time, not when
+	// approved again after an edit was held for review
+	var first bool
+	err := c.Db.QueryRow(`UPDATE "comments" SET "state" = $1, "version" = "comments"."version" + 1,
+			"published" = COALESCE("comments"."published", CASE WHEN $1 = 'approved' THEN CURRENT_TIMESTAMP END)
+		FROM (SELECT "published" FROM "comments" WHERE "commentid" = $2 FOR UPDATE) AS "before"
+		WHERE "commentid" = $2 AND ($4 OR "comments"."version" = $3)
+		RETURNING "comments"."version", "before"."published" IS NULL AND "comments"."published" IS NOT NULL`,
+		state, c.ID, c.Version, c.Force).Scan(&c.Version, &first)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	if err != nil {
+		logger(c.Db).Error("Failed to moderate comment", "id", c.ID, "err", err)
+		return ErrSave
+	}
+
+	action := Updated
+	if first {
+		action = Approved
+	}
+	c.State = state
+	emit(Event{Model: "comment", Action: action, ID: c.ID, Object: c})
+	return nil
+}
+
+// SetTrained records which class the spam classifier learnt the comment as
+func (c *SQLComment) SetTrained(class string) error {
+	defer timed("comment.set_trained")()
+	_, err := c.Db.Exec(`UPDATE "comments" SET "trained" = NULLIF($1, '') WHERE "commentid" = $2`, class, c.ID)
+	if err != nil {
+		logger(c.Db).Error("Failed to mark comment trained", "id", c.ID, "err", err)
+		return ErrSave
+	}
+	c.Trained = class
+	return nil
+}
+
+// Delete the comment. The row is kept, without its content, so that replies
+// stay attached to the thread.
+func (c *SQLComment) Delete() error {
+	defer timed("comment.delete")()
+	if !c.Exists() {
+		return ErrDoesNotExist
+	}
+
+	err := c.Db.QueryRow(`UPDATE "comments" SET "state" = $1, "body" = '', "email" = NULL, "version" = "version" + 1
+		WHERE "commentid" = $2 AND ($4 OR "version" = $3)
+		RETURNING "version"`, StateDeleted, c.ID, c.Version, c.Force).Scan(&c.Version)
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	if err != nil {
+		logger(c.Db).Error("Failed to delete comment", "id", c.ID, "err", err)
+		return ErrDelete
+	}
+
+	c.State = StateDeleted
+	c.Body = ""
+	c.Email = ""
+	emit(Event{Model: "comment", Action: Deleted, ID: c.ID, Object: c})
+	return nil
+}
+
+// Validate the properties of the comment
+func (c *SQLComment) Validate() error {
+	defer timed("comment.validate")()
+	c.Body = strings.TrimSpace(c.Body)
+	if c.Body == "" || len(c.Body) > MaxCommentLength {
+		return ErrValidation
+	}
+
+	if c.State != "" && !ValidState(c.State) {
+		return ErrValidation
+	}
+
+	if c.Anonymous() {
+		c.Name = strings.TrimSpace(c.Name)
+		if c.Name == "" || len(c.Name) > 100 {
+			return ErrValidation
+		}
+		if _, err := mail.ParseAddress(c.Email); err != nil {
+			return ErrValidation
+		}
+	}
+
+	// Replies are only made to approved comments of the same article. Once
+	// made, moderating the parent leaves them be
+	if c.ID == 0 && c.ParentID != 0 {
+		var article int
+		err := c.Db.QueryRow(`SELECT "article" FROM "comments" WHERE "commentid" = $1 AND "state" = $2`,
+			c.ParentID, StateApproved).Scan(&article)
+		if err == sql.ErrNoRows || (err == nil && article != c.ArticleID) {
+			return ErrParent
+		}
+		if err != nil {
+			logger(c.Db).Error("Failed to load parent comment", "err", err)
+			return ErrLoad
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"context"
+	"database/sql"
+
+	"github.com/mattgen88/blog/logging"
+)
+
+// DB is the database models are read from and written to, either a *sql.DB
+// or one bound to the context of a request by WithContext
+type DB interface {
+	Query(query string, args ...interface{}) (*sql.Rows, error)
+	QueryRow(query string, args ...interface{}) *sql.Row
+	Exec(query string, args ...interface{}) (sql.Result, error)
+	Begin() (*sql.Tx, error)
+}
+
+// contextDB makes its queries with a context
+type contextDB struct {
+	db  *sql.DB
+	ctx context.Context
+}
+
+// WithContext binds a database to the context of a request, so its queries
+// are abandoned with the request and what models log of them carries its
+// request ID
+func WithContext(ctx context.Context, db *sql.DB) DB {
+	return &contextDB{db: db, ctx: ctx}
+}
+
+func (c *contextDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	return c.db.QueryContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	return c.db.QueryRowContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	return c.db.ExecContext(c.ctx, query, args...)
+}
+
+func (c *contextDB) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+// logs is the logger of the models
+var logs = logging.For("models")
+
+// logger returns the logger of operations on Db, adding the request ID of
+// the context it is bound to
+func logger(Db DB) *logging.Logger {
+	if c, ok := Db.(*contextDB); ok {
+		return logs.Ctx(c.ctx)
+	}
+	return logs
+}
@@ -0,0 +1,48 @@
+package models
+
+import "sync"
+
+// Action describes what happened to a model
+type Action string
+
+// Actions emitted to listeners
+const (
+	Created Action = "created"
+	Updated Action = "updated"
+	Deleted Action = "deleted"
+	// Approved is emitted when a moderator first approves a comment
+	Approved Action = "approved"
+)
+
+// Event is emitted after a model has been written to the database
+type Event struct {
+	Model  string
+	Action Action
+	ID     int
+	Key    string
+	Object interface{}
+}
+
+// Listener receives model events
+type Listener func(Event)
+
+var (
+	listenersMu sync.RWMutex
+	listeners   []Listener
+)
+
+// Listen registers a listener to be called after every model write
+func Listen(l Listener) {
+	listenersMu.Lock()
+	defer listenersMu.Unlock()
+	listeners = append(listeners, l)
+}
+
+// emit calls every registered listener with the event
+func emit(e Event) {
+	listenersMu.RLock()
+	defer listenersMu.RUnlock()
+	for _, l := range listeners {
+		l(e)
+	}
+}
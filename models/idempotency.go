@@ -0,0 +1,92 @@
+package models
+
+import (
+	"database/sql"
+	"encoding/json"
+	"time"
+)
+
+// IdempotentRequest is a request made with an idempotency key, holding the
+// response it was given once it has been handled
+type IdempotentRequest struct {
+	// Scope separates the keys of different clients
+	Scope string
+	Key   string
+	// Fingerprint identifies the request, so the key can't be reused for
+	// another
+	Fingerprint string
+	// Status is zero while the request is being handled
+	Status  int
+	Header  map[string][]string
+	Body    []byte
+	Created *time.Time
+	Db      DB
+}
+
+// ClaimIdempotencyKey claims key for a request, returning true when it was
+// free. Otherwise the request which claimed it is returned. Keys claimed
+// longer ago than window are free again.
+func ClaimIdempotencyKey(scope, key, fingerprint string, window time.Duration, Db DB) (*IdempotentRequest, bool, error) {
+	defer timed("idempotency.claim")()
+	_, err := Db.Exec(`DELETE FROM "idempotency_keys" WHERE "created" < $1`, time.Now().Add(-window))
+	if err != nil {
+		logger(Db).Error("Failed to expire idempotency keys", "err", err)
+		return nil, false, ErrSave
+	}
+
+	req := &IdempotentRequest{Scope: scope, Key: key, Fingerprint: fingerprint, Db: Db}
+	err = Db.QueryRow(`INSERT INTO "idempotency_keys" ("scope", "key", "fingerprint")
+		VALUES ($1, $2, $3)
+		ON CONFLICT DO NOTHING
+		RETURNING "created"`,
+		scope, key, fingerprint).Scan(&req.Created)
+	if err == nil {
+		return req, true, nil
+	}
+	if err != sql.ErrNoRows {
+		logger(Db).Error("Failed to claim idempotency key", "err", err)
+		return nil, false, ErrSave
+	}
+
+	var header string
+	err = Db.QueryRow(`SELECT "fingerprint", "status", "header", "body", "created"
+		FROM "idempotency_keys" WHERE "scope" = $1 AND "key" = $2`,
+		scope, key).Scan(&req.Fingerprint, &req.Status, &header, &req.Body, &req.Created)
+	if err != nil {
+		logger(Db).Error("Error querying for idempotency key", "err", err)
+		return nil, false, ErrLoad
+	}
+	if err := json.Unmarshal([]byte(header), &req.Header); err != nil {
+		logger(Db).Warn("Ignoring malformed headers of idempotent request", "key", req.Key, "err", err)
+	}
+	return req, false, nil
+}
+
+// Complete stores the response to the request, to be replayed to retries
+func (req *IdempotentRequest) Complete(status int, header map[string][]string, body []byte) error {
+	defer timed("idempotency.complete")()
+	encoded, err := json.Marshal(header)
+	if err != nil {
+		return err
+	}
+	_, err = req.Db.Exec(`UPDATE "idempotency_keys" SET "status" = $1, "header" = $2, "body" = $3
+		WHERE "scope" = $4 AND "key" = $5`,
+		status, string(encoded), body, req.Scope, req.Key)
+	if err != nil {
+		logger(req.Db).Error("Failed to store idempotent response", "err", err)
+		return ErrSave
+	}
+	req.Status, req.Header, req.Body = status, header, body
+	return nil
+}
+
+// Release frees the key, so a retry is handled afresh
+func (req *IdempotentRequest) Release() error {
+	defer timed("idempotency.release")()
+	_, err := req.Db.Exec(`DELETE FROM "idempotency_keys" WHERE "scope" = $1 AND "key" = $2`, req.Scope, req.Key)
+	if err != nil {
+		logger(req.Db).Error("Failed to release idempotency key", "err", err)
+		return ErrDelete
+	}
+	return nil
+}
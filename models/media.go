@@ -0,0 +1,286 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// SQLMedia is a file in the media library. The file itself is kept by a
+// storage backend under Key.
+type SQLMedia struct {
+	ID          int    `json:"id"`
+	Key         string `json:"-"`
+	Filename    string `json:"filename"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	Alt         string `json:"alt"`
+	Caption     string `json:"caption"`
+	// FocusX and FocusY are the point of an image crops are centred on,
+	// each from 0 to 1
+	FocusX  float64    `json:"focusX"`
+	FocusY  float64    `json:"focusY"`
+	OwnerID int        `json:"-"`
+	Owner   string     `json:"owner"`
+	Created *time.Time `json:"created"`
+	Version int        `json:"version"`
+	// Force writes the media whatever the version of its row
+	Force  bool `json:"-"`
+	Db     DB   `json:"-"`
+	exists bool
+}
+
+// mediaSelect selects the columns scanned by scan
+const mediaSelect = `SELECT "media"."mediaid", "media"."key", "media"."filename", "media"."contenttype", "media"."size",
+	"media"."width", "media"."height", "media"."alt", "media"."caption", "media"."focusx", "media"."focusy",
+	"media"."owner", "users"."username",
+	"media"."created", "media"."version"
+	FROM "media" JOIN "users" ON "users"."userid" = "media"."owner"`
+
+// NewSQLMedia returns the media with the given id
+func NewSQLMedia(id int, Db DB) *SQLMedia {
+	defer timed("media.load")()
+	m := &SQLMedia{ID: id, Db: Db}
+	err := m.scan(Db.QueryRow(mediaSelect+` WHERE "media"."mediaid" = $1`, id))
+	if err != nil && err != sql.ErrNoRows {
+		logger(Db).Error("Error querying for media", "err", err)
+	}
+	m.exists = err == nil
+	return m
+}
+
+// MediaList returns a page of the media library, newest first, and how many
+// files it holds
+func MediaList(offset, limit int, Db DB) ([]*SQLMedia, int) {
+	defer timed("media.page")()
+	var total int
+	err := Db.QueryRow(`SELECT COUNT(*) FROM "media"`).Scan(&total)
+	if err != nil {
+		logger(Db).Error("Error counting media", "err", err)
+		return nil, 0
+	}
+	return listMedia(Db, `ORDER BY "media"."created" DESC, "media"."mediaid" DESC OFFSET $1 LIMIT $2`, offset, limit), total
+}
+
+// MediaByID returns the media with the given ids which exist, in order of id
+func MediaByID(ids []int, Db DB) []*SQLMedia {
+	if len(ids) == 0 {
+		return nil
+	}
+	return listMedia(Db, `WHERE "media"."mediaid" = ANY($1) ORDER BY "media"."mediaid"`, pq.Array(ids))
+}
+
+// MediaUsage returns the bytes of the files a user has uploaded
+func MediaUsage(ownerID int, Db DB) (int64, error) {
+	defer timed("media.usage")()
+	var usage int64
+	err := Db.QueryRow(`SELECT COALESCE(SUM("size"), 0) FROM "media" WHERE "owner" = $1`, ownerID).Scan(&usage)
+	if err != nil {
+		logger(Db).Error("Error summing media usage", "err", err)
+		return 0, ErrLoad
+	}
+	return usage, nil
+}
+
+// listMedia returns the media matching the clause
+func listMedia(Db DB, clause string, args ...interface{}) []*SQLMedia {
+	defer timed("media.list")()
+	rows, err := Db.Query(mediaSelect+" "+clause, args...)
+	if err != nil {
+		logger(Db).Error("Error querying for media", "err", err)
+		return nil
+	}
+
+	defer rows.Close()
+
+	var media []*SQLMedia
+	for rows.Next() {
+		m := &SQLMedia{Db: Db, exists: true}
+		if err := m.scan(rows); err != nil {
+			logger(Db).Error("Failed to scan media", "err", err)
+			continue
+		}
+		media = append(media, m)
+	}
+	return media
+}
+
+// scan fills m from a row selected with mediaSelect
+func (m *SQLMedia) scan(row scanner) error {
+	return row.Scan(&m.ID, &m.Key, &m.Filename, &m.ContentType, &m.Size,
+		&m.Width, &m.Height, &m.Alt, &m.Caption, &m.FocusX, &m.FocusY, &m.OwnerID, &m.Owner,
+		&m.Created, &m.Version)
+}
+
+// Exists reports whether the media is in the database
+func (m *SQLMedia) Exists() bool {
+	return m.exists
+}
+
+// Save the media into the database. Only the alt text, caption and focus of
+// media which exists are changed, the file it describes never is.
+func (m *SQLMedia) Save() error {
+	defer timed("media.save")()
+	if err := m.Validate(); err != nil {
+		return err
+	}
+
+	var err error
+	action := Updated
+	if !m.exists {
+		action = Created
+		err = m.Db.QueryRow(`INSERT INTO "media" ("key", "filename", "contenttype", "size", "width", "height", "alt", "caption", "focusx", "focusy", "owner")
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11)
+			RETURNING "mediaid", "created", "version"`,
+			m.Key, m.Filename, m.ContentType, m.Size, m.Width, m.Height, m.Alt, m.Caption, m.FocusX, m.FocusY, m.OwnerID).Scan(&m.ID, &m.Created, &m.Version)
+	} else {
+		err = m.Db.QueryRow(`UPDATE "media" SET "alt" = $1, "caption" = $2, "focusx" = $3, "focusy" = $4, "version" = "version" + 1
+			WHERE "mediaid" = $5 AND ($7 OR "version" = $6)
+			RETURNING "version"`,
+			m.Alt, m.Caption, m.FocusX, m.FocusY, m.ID, m.Version, m.Force).Scan(&m.Version)
+	}
+
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	if err != nil {
+		logger(m.Db).Error("Failed to save media", "id", m.ID, "err", err)
+		return ErrSave
+	}
+
+	m.exists = true
+	emit(Event{Model: "media", Action: action, ID: m.ID, Key: m.Key, Object: m})
+	return nil
+}
+
+// Delete the media from the database, leaving the file to be removed from
+// storage
+func (m *SQLMedia) Delete() error {
+	defer timed("media.delete")()
+	if !m.exists {
+		return ErrDoesNotExist
+	}
+	result, err := m.Db.Exec(`DELETE FROM "media" WHERE "mediaid" = $1 AND ($3 OR "version" = $2)`, m.ID, m.Version, m.Force)
+	if err != nil {
+		logger(m.Db).Error("Failed to delete media", "id", m.ID, "err", err)
+		return ErrDelete
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ErrConflict
+	}
+	m.exists = false
+	emit(Event{Model: "media", Action: Deleted, ID: m.ID, Key: m.Key, Object: m})
+	return nil
+}
+
+// Validate checks the media describes a stored file, has an owner and that
+// its focus is within it
+func (m *SQLMedia) Validate() error {
+	if m.Key == "" || m.Filename == "" || m.ContentType == "" || m.Size <= 0 || m.OwnerID == 0 {
+		return ErrValidation
+	}
+	if m.FocusX < 0 || m.FocusX > 1 || m.FocusY < 0 || m.FocusY > 1 {
+		return ErrValidation
+	}
+	return nil
+}
+
+// SQLVariant is an image rendered from media at one of the sizes set up for
+// the blog, kept by the storage backend under Key
+type SQLVariant struct {
+	MediaID int
+	Name    string
+	// Spec is the size the variant was rendered at, which no longer matches
+	// that of its name when the sizes are changed
+	Spec        string
+	Key         string
+	ContentType string
+	Width       int
+	Height      int
+	Size        int64
+	Created     *time.Time
+	Db          DB
+	exists      bool
+}
+
+// variantSelect selects the columns scanned by scan
+const variantSelect = `SELECT "media", "name", "spec", "key", "contenttype", "width", "height", "size", "created" FROM "media_variants"`
+
+// NewSQLVariant returns the variant of media with the given name
+func NewSQLVariant(mediaID int, name string, Db DB) *SQLVariant {
+	defer timed("variant.load")()
+	v := &SQLVariant{MediaID: mediaID, Name: name, Db: Db}
+	err := v.scan(Db.QueryRow(variantSelect+` WHERE "media" = $1 AND "name" = $2`, mediaID, name))
+	if err != nil && err != sql.ErrNoRows {
+		logger(Db).Error("Error querying for variant", "err", err)
+	}
+	v.exists = err == nil
+	return v
+}
+
+// VariantList returns the variants rendered of media
+func VariantList(mediaID int, Db DB) []*SQLVariant {
+	defer timed("variant.list")()
+	rows, err := Db.Query(variantSelect+` WHERE "media" = $1 ORDER BY "name"`, mediaID)
+	if err != nil {
+		logger(Db).Error("Error querying for variants", "err", err)
+		return nil
+	}
+
+	defer rows.Close()
+
+	var variants []*SQLVariant
+	for rows.Next() {
+		v := &SQLVariant{Db: Db, exists: true}
+		if err := v.scan(rows); err != nil {
+			logger(Db).Error("Failed to scan variant", "err", err)
+			continue
+		}
+		variants = append(variants, v)
+	}
+	return variants
+}
+
+// scan fills v from a row selected with variantSelect
+func (v *SQLVariant) scan(row scanner) error {
+	return row.Scan(&v.MediaID, &v.Name, &v.Spec, &v.Key, &v.ContentType, &v.Width, &v.Height, &v.Size, &v.Created)
+}
+
+// Exists reports whether the variant is in the database
+func (v *SQLVariant) Exists() bool {
+	return v.exists
+}
+
+// Save the variant into the database, replacing the one of the same name
+func (v *SQLVariant) Save() error {
+	defer timed("variant.save")()
+	if v.MediaID == 0 || v.Name == "" || v.Key == "" || v.ContentType == "" {
+		return ErrValidation
+	}
+	err := v.Db.QueryRow(`INSERT INTO "media_variants" ("media", "name", "spec", "key", "contenttype", "width", "height", "size")
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		ON CONFLICT ("media", "name") DO UPDATE SET "spec" = $3, "key" = $4, "contenttype" = $5, "width" = $6, "height" = $7, "size" = $8, "created" = CURRENT_TIMESTAMP
+		RETURNING "created"`,
+		v.MediaID, v.Name, v.Spec, v.Key, v.ContentType, v.Width, v.Height, v.Size).Scan(&v.Created)
+	if err != nil {
+		logger(v.Db).Error("Failed to save variant", "err", err)
+		return ErrSave
+	}
+	v.exists = true
+	return nil
+}
+
+// DeleteVariants deletes the variants rendered of media, returning them so
+// their files can be removed from storage
+func DeleteVariants(mediaID int, Db DB) ([]*SQLVariant, error) {
+	defer timed("variant.delete")()
+	variants := VariantList(mediaID, Db)
+	if _, err := Db.Exec(`DELETE FROM "media_variants" WHERE "media" = $1`, mediaID); err != nil {
+		logger(Db).Error("Failed to delete variants", "err", err)
+		return nil, ErrDelete
+	}
+	return variants, nil
+}
@@ -0,0 +1,247 @@
+package models
+
+// migrationLock is the advisory lock key held while applying migrations so
+// instances starting together don't race each other
+const migrationLock = 7226057
+
+// migrations are applied in order on top of docker-entrypoint-initdb.d/init.sql,
+// each exactly once. Never edit one which has been released, append another.
+var migrations = []string{
+	// 1: threaded comments on articles
+	`INSERT INTO "role" ("name") SELECT 'user' WHERE NOT EXISTS (SELECT 1 FROM "role" WHERE "name" = 'user');
+
+	CREATE TABLE comments (
+		commentID SERIAL PRIMARY KEY,
+		article Integer NOT NULL REFERENCES articles(articleID) ON DELETE CASCADE,
+		parent Integer NULL REFERENCES comments(commentID) ON DELETE CASCADE,
+		author Integer NULL REFERENCES users(userID) ON DELETE SET NULL,
+		name Text,
+		email Text,
+		body Text NOT NULL,
+		created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated TIMESTAMP NULL,
+		deleted Boolean NOT NULL DEFAULT FALSE
+	);
+
+	CREATE INDEX comments_article ON comments (article, created);`,
+
+	// 2: comment moderation and spam classification
+	`INSERT INTO "role" ("name") SELECT 'moderator' WHERE NOT EXISTS (SELECT 1 FROM "role" WHERE "name" = 'moderator');
+
+	ALTER TABLE comments ADD COLUMN state Text NOT NULL DEFAULT 'pending'
+		CHECK (state IN ('pending', 'approved', 'spam', 'deleted'));
+	ALTER TABLE comments ADD COLUMN spamScore Double Precision NULL;
+	ALTER TABLE comments ADD COLUMN trained Text NULL;
+	UPDATE comments SET state = CASE WHEN deleted THEN 'deleted' ELSE 'approved' END;
+	ALTER TABLE comments DROP COLUMN deleted;
+
+	CREATE INDEX comments_state ON comments (state, created);
+
+	CREATE TABLE spam_tokens (
+		token Text PRIMARY KEY,
+		spam Integer NOT NULL DEFAULT 0,
+		ham Integer NOT NULL DEFAULT 0
+	);`,
+
+	// 3: when articles were last changed, for feeds and caching
+	`ALTER TABLE articles ADD COLUMN updated TIMESTAMP NULL;
+	UPDATE articles SET updated = date;
+	ALTER TABLE articles ALTER COLUMN updated SET NOT NULL;
+	ALTER TABLE articles ALTER COLUMN updated SET DEFAULT CURRENT_TIMESTAMP;`,
+
+	// 4: free form tags on articles
+	`CREATE TABLE tags (
+		tagID SERIAL PRIMARY KEY,
+		name Text NOT NULL UNIQUE
+	);
+
+	CREATE TABLE article_tags (
+		article Integer NOT NULL REFERENCES articles(articleID) ON DELETE CASCADE,
+		tag Integer NOT NULL REFERENCES tags(tagID) ON DELETE CASCADE,
+		PRIMARY KEY (article, tag)
+	);
+
+	CREATE INDEX article_tags_tag ON article_tags (tag);`,
+
+	// 5: outbound webhooks and their delivery log
+	`CREATE TABLE webhooks (
+		webhookID SERIAL PRIMARY KEY,
+		url Text NOT NULL,
+		secret Text NOT NULL,
+		events Text[] NOT NULL,
+		active Boolean NOT NULL DEFAULT TRUE,
+		created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE webhook_deliveries (
+		deliveryID SERIAL PRIMARY KEY,
+		webhook Integer NOT NULL REFERENCES webhooks(webhookID) ON DELETE CASCADE,
+		event Text NOT NULL,
+		payload Text NOT NULL,
+		state Text NOT NULL DEFAULT 'pending' CHECK (state IN ('pending', 'delivered', 'failed')),
+		attempts Integer NOT NULL DEFAULT 0,
+		nextAttempt TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		responseStatus Integer NULL,
+		error Text NULL,
+		created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		delivered TIMESTAMP NULL
+	);
+
+	CREATE INDEX webhook_deliveries_due ON webhook_deliveries (nextAttempt) WHERE state = 'pending';
+	CREATE INDEX webhook_deliveries_webhook ON webhook_deliveries (webhook, created);`,
+
+	// 6: when each category or the articles filed under it last changed
+	`ALTER TABLE category ADD COLUMN updated TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP;
+
+	CREATE FUNCTION touch_category() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP <> 'INSERT' THEN
+			UPDATE category SET updated = CURRENT_TIMESTAMP WHERE categoryID = OLD.category;
+		END IF;
+		IF TG_OP <> 'DELETE' THEN
+			UPDATE category SET updated = CURRENT_TIMESTAMP WHERE categoryID = NEW.category;
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER articles_touch_category AFTER INSERT OR UPDATE OR DELETE ON articles
+		FOR EACH ROW EXECUTE PROCEDURE touch_category();`,
+
+	// 7: versions of the rows which can be edited, for optimistic concurrency
+	`ALTER TABLE articles ADD COLUMN version Integer NOT NULL DEFAULT 1;
+	ALTER TABLE category ADD COLUMN version Integer NOT NULL DEFAULT 1;
+	ALTER TABLE users ADD COLUMN version Integer NOT NULL DEFAULT 1;
+	ALTER TABLE comments ADD COLUMN version Integer NOT NULL DEFAULT 1;
+	ALTER TABLE webhooks ADD COLUMN version Integer NOT NULL DEFAULT 1;`,
+
+	// 8: responses to requests made with an Idempotency-Key, replayed to
+	// retries
+	`CREATE TABLE idempotency_keys (
+		scope Text NOT NULL,
+		key Text NOT NULL,
+		fingerprint Text NOT NULL,
+		status Integer NOT NULL DEFAULT 0,
+		header Text NOT NULL DEFAULT '{}',
+		body Bytea NULL,
+		created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (scope, key)
+	);
+
+	CREATE INDEX idempotency_keys_created ON idempotency_keys (created);`,
+
+	// 9: the media library, with files kept by a storage backend
+	`CREATE TABLE media (
+		mediaID SERIAL PRIMARY KEY,
+		key Text NOT NULL UNIQUE,
+		filename Text NOT NULL,
+		contentType Text NOT NULL,
+		size BigInt NOT NULL,
+		width Integer NOT NULL DEFAULT 0,
+		height Integer NOT NULL DEFAULT 0,
+		alt Text NOT NULL DEFAULT '',
+		caption Text NOT NULL DEFAULT '',
+		owner Integer NOT NULL REFERENCES users(userID),
+		created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		version Integer NOT NULL DEFAULT 1
+	);
+
+	CREATE INDEX media_owner ON media (owner);`,
+
+	// 10: focal points of images and the variants rendered of them
+	`ALTER TABLE media ADD COLUMN focusX Real NOT NULL DEFAULT 0.5;
+	ALTER TABLE media ADD COLUMN focusY Real NOT NULL DEFAULT 0.5;
+
+	CREATE TABLE media_variants (
+		media Integer NOT NULL REFERENCES media(mediaID) ON DELETE CASCADE,
+		name Text NOT NULL,
+		spec Text NOT NULL,
+		key Text NOT NULL,
+		contentType Text NOT NULL,
+		width Integer NOT NULL,
+		height Integer NOT NULL,
+		size BigInt NOT NULL,
+		created TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (media, name)
+	);`,
+
+	// 11: when each comment was first approved, so approving it again after
+	// an edit doesn't announce it anew
+	`ALTER TABLE comments ADD COLUMN published TIMESTAMP NULL;
+	UPDATE comments SET published = created WHERE state = 'approved';`,
+}
+
+// LatestSchemaVersion is the schema version this build expects
+func LatestSchemaVersion() int {
+	return len(migrations)
+}
+
+// SchemaVersion returns the version of the schema applied to the database
+func SchemaVersion(Db DB) (int, error) {
+	defer timed("migration.version")()
+	var version int
+	err := Db.QueryRow(`SELECT COALESCE(MAX("version"), 0) FROM "schema_migrations"`).Scan(&version)
+	return version, err
+}
+
+// Migrate applies any migrations the database is missing
+func Migrate(Db DB) error {
+	defer timed("migration.apply")()
+	_, err := Db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		version Integer PRIMARY KEY,
+		applied TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP
+	)`)
+	if err != nil {
+		return err
+	}
+
+	for version := 1; version <= len(migrations); version++ {
+		if err := migrate(Db, version); err != nil {
+			logger(Db).Error("Failed to apply migration", "version", version, "err", err)
+			return err
+		}
+	}
+	return nil
+}
+
+// PendingMigrations returns how many migrations haven't been applied yet
+func PendingMigrations(Db DB) (int, error) {
+	defer timed("migration.pending")()
+	var applied int
+	err := Db.QueryRow(`SELECT COUNT(*) FROM "schema_migrations" WHERE "version" <= $1`, len(migrations)).Scan(&applied)
+	if err != nil {
+		return 0, err
+	}
+	return len(migrations) - applied, nil
+}
+
+// migrate applies a single migration unless it has already been applied
+func migrate(Db DB, version int) error {
+	tx, err := Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`SELECT pg_advisory_xact_lock($1)`, migrationLock); err != nil {
+		return err
+	}
+
+	var applied int
+	err = tx.QueryRow(`SELECT COUNT(*) FROM "schema_migrations" WHERE "version" = $1`, version).Scan(&applied)
+	if err != nil {
+		return err
+	}
+	if applied > 0 {
+		return nil
+	}
+
+	logger(Db).Info("Applying migration", "version", version)
+	if _, err := tx.Exec(migrations[version-1]); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`INSERT INTO "schema_migrations" ("version") VALUES ($1)`, version); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"sync"
+	"time"
+)
+
+// QueryObserver is told how long each model operation, such as
+// "article.save", spent on the database
+type QueryObserver func(operation string, elapsed time.Duration)
+
+var (
+	observersMu sync.RWMutex
+	observers   []QueryObserver
+)
+
+// ObserveQueries registers an observer to be told the duration of every
+// model operation
+func ObserveQueries(o QueryObserver) {
+	observersMu.Lock()
+	defer observersMu.Unlock()
+	observers = append(observers, o)
+}
+
+// timed starts timing an operation, returning the function which reports
+// it, to be deferred
+func timed(operation string) func() {
+	start := time.Now()
+	return func() {
+		elapsed := time.Since(start)
+		observersMu.RLock()
+		defer observersMu.RUnlock()
+		for _, o := range observers {
+			o(operation, elapsed)
+		}
+	}
+}
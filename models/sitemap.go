@@ -0,0 +1,93 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// Listed is a page listed in a sitemap, by the key its route takes, with
+// when what it shows last changed
+type Listed struct {
+	Key      string
+	Modified time.Time
+}
+
+// modifiedColumn is when an article last changed
+const modifiedColumn = `COALESCE("articles"."updated", "articles"."date")`
+
+// ListedArticleCount returns how many articles a sitemap lists and when the
+// latest of them changed
+func ListedArticleCount(Db DB) (int, time.Time, error) {
+	defer timed("article.listed_count")()
+	var (
+		count  int
+		latest *time.Time
+	)
+	err := Db.QueryRow(`SELECT COUNT(*), MAX(`+modifiedColumn+`) FROM "articles"`).Scan(&count, &latest)
+	if err != nil {
+		logger(Db).Error("Error counting articles", "err", err)
+		return 0, time.Time{}, ErrLoad
+	}
+	if latest == nil {
+		return count, time.Time{}, nil
+	}
+	return count, *latest, nil
+}
+
+// ListedArticles returns a page of the articles a sitemap lists by slug,
+// without loading their bodies, in the order they were written
+func ListedArticles(offset, limit int, Db DB) ([]Listed, error) {
+	defer timed("article.listed")()
+	rows, err := Db.Query(`SELECT "slug", `+modifiedColumn+` FROM "articles"
+		ORDER BY "articleid"
+		OFFSET $1 LIMIT $2`, offset, limit)
+	if err != nil {
+		logger(Db).Error("Error querying for articles", "err", err)
+		return nil, ErrLoad
+	}
+	return scanListed(rows, Db)
+}
+
+// ListedGroups returns the categories, authors or tags of articles a
+// sitemap lists by name, as grouped by ArticlesBy, with when the latest of
+// their articles changed
+func ListedGroups(group string, Db DB) ([]Listed, error) {
+	defer timed("article.listed_groups")()
+	g, ok := articleGroups[group]
+	if !ok {
+		return nil, ErrLoad
+	}
+	rows, err := Db.Query(`SELECT ` + g.column + `, MAX(` + modifiedColumn + `)
+		FROM "articles"
+		` + batchJoins + `
+		` + g.join + `
+		GROUP BY ` + g.column + `
+		ORDER BY ` + g.column)
+	if err != nil {
+		logger(Db).Error("Error querying for articles", "by", group, "err", err)
+		return nil, ErrLoad
+	}
+	return scanListed(rows, Db)
+}
+
+// scanListed reads the keys and modification times of listed pages
+func scanListed(rows *sql.Rows, Db DB) ([]Listed, error) {
+	defer rows.Close()
+
+	var listed []Listed
+	for rows.Next() {
+		var (
+			l        Listed
+			modified *time.Time
+		)
+		if err := rows.Scan(&l.Key, &modified); err != nil {
+			logger(Db).Error("Failed to scan listed page", "err", err)
+			return nil, ErrLoad
+		}
+		if modified != nil {
+			l.Modified = *modified
+		}
+		listed = append(listed, l)
+	}
+	return listed, rows.Err()
+}
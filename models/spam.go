@@ -0,0 +1,84 @@
+package models
+
+// SpamCounts are what the spam classifier has learnt from moderator decisions:
+// how many spam and ham comments were trained, and how many of each
+// contained a token
+type SpamCounts struct {
+	SpamDocs int
+	HamDocs  int
+	Spam     map[string]int
+	Ham      map[string]int
+}
+
+// LoadSpamCounts reads the trained token counts from the database
+func LoadSpamCounts(Db DB) (*SpamCounts, error) {
+	defer timed("spam.load")()
+	counts := &SpamCounts{
+		Spam: make(map[string]int),
+		Ham:  make(map[string]int),
+	}
+
+	err := Db.QueryRow(`SELECT
+		COUNT(*) FILTER (WHERE "trained" = $1),
+		COUNT(*) FILTER (WHERE "trained" = $2)
+		FROM "comments"`, StateSpam, StateApproved).Scan(&counts.SpamDocs, &counts.HamDocs)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := Db.Query(`SELECT "token", "spam", "ham" FROM "spam_tokens"`)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			token     string
+			spam, ham int
+		)
+		if err := rows.Scan(&token, &spam, &ham); err != nil {
+			logger(Db).Error("Failed to scan spam token", "err", err)
+			continue
+		}
+		if spam > 0 {
+			counts.Spam[token] = spam
+		}
+		if ham > 0 {
+			counts.Ham[token] = ham
+		}
+	}
+	return counts, rows.Err()
+}
+
+// TrainSpam adds delta to the spam or ham count of each token
+func TrainSpam(tokens []string, spam bool, delta int, Db DB) error {
+	defer timed("spam.train")()
+	query := `INSERT INTO "spam_tokens" ("token", "ham") VALUES ($1, GREATEST($2, 0))
+		ON CONFLICT ("token") DO UPDATE SET "ham" = GREATEST("spam_tokens"."ham" + $2, 0)`
+	if spam {
+		query = `INSERT INTO "spam_tokens" ("token", "spam") VALUES ($1, GREATEST($2, 0))
+		ON CONFLICT ("token") DO UPDATE SET "spam" = GREATEST("spam_tokens"."spam" + $2, 0)`
+	}
+
+	tx, err := Db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmt, err := tx.Prepare(query)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for _, token := range tokens {
+		if _, err := stmt.Exec(token, delta); err != nil {
+			logger(Db).Error("Failed to train spam token", "err", err)
+			return ErrSave
+		}
+	}
+	return tx.Commit()
+}
@@ -3,7 +3,6 @@ package models
 import (
 	"database/sql"
 	"errors"
-	"log"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
@@ -25,13 +24,16 @@ type User interface {
 
 // SQLUser is a SQL based User model
 type SQLUser struct {
-	Db            *sql.DB    `json:"-"`
-	ID            int        `json:"id,omitempty"`
-	Username      string     `json:"username"`
-	Realname      string     `json:"realname,omitempty"`
-	Role          string     `json:"role,omitempty"`
-	Created       *time.Time `json:"created,omitempty"`
-	Email         string     `json:"email,omitempty"`
+	Db       DB         `json:"-"`
+	ID       int        `json:"id,omitempty"`
+	Username string     `json:"username"`
+	Realname string     `json:"realname,omitempty"`
+	Role     string     `json:"role,omitempty"`
+	Created  *time.Time `json:"created,omitempty"`
+	Email    string     `json:"email,omitempty"`
+	Version  int        `json:"version,omitempty"`
+	// Force writes the user whatever the version of its row
+	Force         bool `json:"-"`
 	pwhash        string
 	authenticated bool
 	dirty         bool
@@ -40,7 +42,7 @@ type SQLUser struct {
 }
 
 // NewSQLUser Creates a User model
-func NewSQLUser(username string, db *sql.DB) *SQLUser {
+func NewSQLUser(username string, db DB) *SQLUser {
 	u := &SQLUser{
 		Db:       db,
 		Username: username,
@@ -58,7 +60,7 @@ func (u *SQLUser) SetPassword(pw string) string {
 	bs, err := bcrypt.GenerateFromPassword([]byte(pw), bcrypt.DefaultCost)
 
 	if err != nil {
-		log.Println(err)
+		logger(u.Db).Error("Failed to hash password", "err", err)
 	}
 
 	u.pwhash = string(bs)
@@ -83,11 +85,12 @@ func (u *SQLUser) Exists() bool {
 	if u.exists {
 		return true
 	}
+	defer timed("user.exists")()
 	var count int
 	err := u.Db.QueryRow(`SELECT COUNT(*) FROM "users" WHERE "username" = $1`, u.Username).Scan(&count)
 
 	if err != nil {
-		log.Println(err)
+		logger(u.Db).Error("Error querying for user", "username", u.Username, "err", err)
 		if err == sql.ErrNoRows {
 			return false
 		}
@@ -105,9 +108,10 @@ func (u *SQLUser) Authenticate(pw string) bool {
 
 	err := bcrypt.CompareHashAndPassword([]byte(u.pwhash), []byte(pw))
 	if err != nil {
-		log.Println("mismatched hashing")
+		logger(u.Db).Debug("Password does not match", "username", u.Username)
 	}
-	return err == nil
+	u.authenticated = err == nil
+	return u.authenticated
 }
 
 // IsAuthenticated checks if user is authenticated
@@ -127,6 +131,7 @@ func (u *SQLUser) HasRole(role string) bool {
 
 // Populate Fetches data and populates struct
 func (u *SQLUser) Populate() error {
+	defer timed("user.load")()
 
 	if !u.Exists() {
 		return errors.New("Instance does not exist")
@@ -138,12 +143,13 @@ func (u *SQLUser) Populate() error {
 	}
 
 	// Fetch data and populate
-	err := u.Db.QueryRow(`SELECT "userid", "created", "realname", "email", "role", "hash"
+	err := u.Db.QueryRow(`SELECT "userid", "created", COALESCE("realname", ''), COALESCE("email", ''), COALESCE("role"."name", ''), "hash", "version"
 	FROM "users"
-	WHERE "username" = $1`, u.Username).Scan(&u.ID, &u.Created, &u.Realname, &u.Email, &u.Role, &u.pwhash)
+	LEFT JOIN "role" ON "role"."roleid" = "users"."role"
+	WHERE "username" = $1`, u.Username).Scan(&u.ID, &u.Created, &u.Realname, &u.Email, &u.Role, &u.pwhash, &u.Version)
 
 	if err != nil {
-		log.Println(err)
+		logger(u.Db).Error("Error querying for user", "username", u.Username, "err", err)
 		return errors.New("Unknown error occurred")
 	}
 
@@ -152,6 +158,7 @@ func (u *SQLUser) Populate() error {
 }
 
 func (u *SQLUser) Save() error {
+	defer timed("user.save")()
 	var err error
 	var query string
 
@@ -160,11 +167,12 @@ func (u *SQLUser) Save() error {
 		// Validation error
 		return err
 	}
+	action := Updated
 	if !u.Exists() {
 		query = `INSERT INTO "users" (
 			"username",
 			"hash",
-			"realName",
+			"realname",
 			"email",
 			"created",
 			"role"
@@ -179,27 +187,32 @@ func (u *SQLUser) Save() error {
 				FROM "role"
 				WHERE "name" = $5
 			)
-		);`
-		result, err := u.Db.Exec(query, u.Username, u.pwhash, u.Realname, u.Email, "user")
-		if err != nil {
-			log.Println(err)
-			return ErrSave
+		) RETURNING "userid", "version"`
+		action = Created
+		if u.Role == "" {
+			u.Role = "user"
 		}
-		id, err := result.LastInsertId()
+		err = u.Db.QueryRow(query, u.Username, u.pwhash, u.Realname, u.Email, u.Role).Scan(&u.ID, &u.Version)
 		if err != nil {
-			log.Println(err)
+			logger(u.Db).Error("Failed to save user", "username", u.Username, "err", err)
 			return ErrSave
 		}
-		u.ID = int(id)
 	} else {
-		query = `UPDATE "users" SET "hash" = $1, "realname" = $2, "email" = $3, "role" = $4 WHERE "userid" = $5`
-		_, err = u.Db.Exec(query, u.pwhash, u.Realname, u.Email, u.Role, u.ID)
+		query = `UPDATE "users" SET "hash" = $1, "realname" = $2, "email" = $3, "role" = (SELECT "roleid" FROM "role" WHERE "name" = $4), "version" = "version" + 1
+		WHERE "userid" = $5 AND ($7 OR "version" = $6) RETURNING "version"`
+		err = u.Db.QueryRow(query, u.pwhash, u.Realname, u.Email, u.Role, u.ID, u.Version, u.Force).Scan(&u.Version)
 	}
 
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
 	if err != nil {
 		return ErrSave
 	}
 
+	u.exists = true
+	u.dirty = false
+	emit(Event{Model: "user", Action: action, ID: u.ID, Key: u.Username, Object: u})
 	return nil
 }
 
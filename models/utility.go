@@ -8,4 +8,13 @@ var (
 	ErrSave         = errors.New("an error occurred saving the model")
 	ErrDoesNotExist = errors.New("an error occurred finding the requested model")
 	ErrDelete       = errors.New("an error occurred in deleting the model")
+	ErrLoad         = errors.New("an error occurred loading models")
+	// ErrConflict is returned when saving or deleting a model whose row has
+	// changed since the model was loaded from it. Models hold the Version
+	// they were loaded at, and are only written whatever the version of
+	// their row when Force is set.
+	ErrConflict = errors.New("the model was changed since it was loaded")
+	// ErrParent is returned when replying to a comment that isn't approved
+	// or is on another article
+	ErrParent = errors.New("the parent comment can't be replied to")
 )
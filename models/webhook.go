@@ -0,0 +1,353 @@
+package models
+
+import (
+	"database/sql"
+	"net/url"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// Events webhooks can subscribe to
+const (
+	EventArticlePublished = "article.published"
+	EventArticleUpdated   = "article.updated"
+	EventArticleDeleted   = "article.deleted"
+	EventCommentCreated   = "comment.created"
+	EventUserCreated      = "user.created"
+	// EventPing is only sent when testing a webhook
+	EventPing = "ping"
+)
+
+// WebhookEvents lists the events webhooks can subscribe to
+var WebhookEvents = []string{
+	EventArticlePublished,
+	EventArticleUpdated,
+	EventArticleDeleted,
+	EventCommentCreated,
+	EventUserCreated,
+}
+
+// Delivery states
+const (
+	DeliveryPending   = "pending"
+	DeliveryDelivered = "delivered"
+	DeliveryFailed    = "failed"
+)
+
+// SQLWebhook is a subscription to events, delivered to a URL
+type SQLWebhook struct {
+	ID      int        `json:"id"`
+	URL     string     `json:"url"`
+	Secret  string     `json:"-"`
+	Events  []string   `json:"events"`
+	Active  bool       `json:"active"`
+	Created *time.Time `json:"created"`
+	Version int        `json:"version"`
+	// Force writes the webhook whatever the version of its row
+	Force  bool `json:"-"`
+	Db     DB   `json:"-"`
+	exists bool
+}
+
+// webhookSelect selects the columns scanned by scan
+const webhookSelect = `SELECT "webhookid", "url", "secret", "events", "active", "created", "version" FROM "webhooks"`
+
+// NewSQLWebhook returns the webhook with the given id
+func NewSQLWebhook(id int, Db DB) *SQLWebhook {
+	defer timed("webhook.load")()
+	w := &SQLWebhook{ID: id, Db: Db}
+	err := w.scan(Db.QueryRow(webhookSelect+` WHERE "webhookid" = $1`, id))
+	if err != nil && err != sql.ErrNoRows {
+		logger(Db).Error("Error querying for webhook", "err", err)
+	}
+	w.exists = err == nil
+	return w
+}
+
+// WebhookList returns every webhook
+func WebhookList(Db DB) []*SQLWebhook {
+	return listWebhooks(Db, `ORDER BY "webhookid"`)
+}
+
+// WebhooksFor returns the active webhooks subscribed to event
+func WebhooksFor(event string, Db DB) []*SQLWebhook {
+	return listWebhooks(Db, `WHERE "active" AND $1 = ANY("events") ORDER BY "webhookid"`, event)
+}
+
+// listWebhooks returns the webhooks matching the clause
+func listWebhooks(Db DB, clause string, args ...interface{}) []*SQLWebhook {
+	defer timed("webhook.list")()
+	rows, err := Db.Query(webhookSelect+" "+clause, args...)
+	if err != nil {
+		logger(Db).Error("Error querying for webhooks", "err", err)
+		return nil
+	}
+
+	defer rows.Close()
+
+	var webhooks []*SQLWebhook
+	for rows.Next() {
+		w := &SQLWebhook{Db: Db, exists: true}
+		if err := w.scan(rows); err != nil {
+			logger(Db).Error("Failed to scan webhook", "err", err)
+			continue
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks
+}
+
+// scan fills w from a row selected with webhookSelect
+func (w *SQLWebhook) scan(row scanner) error {
+	return row.Scan(&w.ID, &w.URL, &w.Secret, pq.Array(&w.Events), &w.Active, &w.Created, &w.Version)
+}
+
+// Exists reports whether the webhook is in the database
+func (w *SQLWebhook) Exists() bool {
+	return w.exists
+}
+
+// Subscribed reports whether the webhook receives event
+func (w *SQLWebhook) Subscribed(event string) bool {
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// Save the webhook into the database
+func (w *SQLWebhook) Save() error {
+	defer timed("webhook.save")()
+	if err := w.Validate(); err != nil {
+		return err
+	}
+
+	var err error
+	if !w.exists {
+		err = w.Db.QueryRow(`INSERT INTO "webhooks" ("url", "secret", "events", "active")
+			VALUES ($1, $2, $3, $4)
+			RETURNING "webhookid", "created", "version"`,
+			w.URL, w.Secret, pq.Array(w.Events), w.Active).Scan(&w.ID, &w.Created, &w.Version)
+	} else {
+		err = w.Db.QueryRow(`UPDATE "webhooks" SET "url" = $1, "secret" = $2, "events" = $3, "active" = $4, "version" = "version" + 1
+			WHERE "webhookid" = $5 AND ($7 OR "version" = $6)
+			RETURNING "version"`,
+			w.URL, w.Secret, pq.Array(w.Events), w.Active, w.ID, w.Version, w.Force).Scan(&w.Version)
+	}
+
+	if err == sql.ErrNoRows {
+		return ErrConflict
+	}
+	if err != nil {
+		logger(w.Db).Error("Failed to save webhook", "id", w.ID, "err", err)
+		return ErrSave
+	}
+
+	w.exists = true
+	return nil
+}
+
+// Delete the webhook along with its deliveries
+func (w *SQLWebhook) Delete() error {
+	defer timed("webhook.delete")()
+	if !w.exists {
+		return ErrDoesNotExist
+	}
+	result, err := w.Db.Exec(`DELETE FROM "webhooks" WHERE "webhookid" = $1 AND ($3 OR "version" = $2)`, w.ID, w.Version, w.Force)
+	if err != nil {
+		logger(w.Db).Error("Failed to delete webhook", "id", w.ID, "err", err)
+		return ErrDelete
+	}
+	if deleted, err := result.RowsAffected(); err == nil && deleted == 0 {
+		return ErrConflict
+	}
+	w.exists = false
+	return nil
+}
+
+// Validate checks the webhook has an http(s) URL, a secret and only known
+// events
+func (w *SQLWebhook) Validate() error {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return ErrValidation
+	}
+	if w.Secret == "" || len(w.Events) == 0 {
+		return ErrValidation
+	}
+	for _, event := range w.Events {
+		known := false
+		for _, e := range WebhookEvents {
+			if e == event {
+				known = true
+			}
+		}
+		if !known {
+			return ErrValidation
+		}
+	}
+	return nil
+}
+
+// SQLDelivery is an attempt, or series of attempts, to deliver an event to
+// a webhook
+type SQLDelivery struct {
+	ID             int        `json:"id"`
+	WebhookID      int        `json:"webhook"`
+	Event          string     `json:"event"`
+	Payload        string     `json:"payload"`
+	State          string     `json:"state"`
+	Attempts       int        `json:"attempts"`
+	NextAttempt    *time.Time `json:"nextAttempt"`
+	ResponseStatus int        `json:"responseStatus,omitempty"`
+	Error          string     `json:"error,omitempty"`
+	Created        *time.Time `json:"created"`
+	Delivered      *time.Time `json:"delivered,omitempty"`
+	Db             DB         `json:"-"`
+	exists         bool
+}
+
+// deliverySelect selects the columns scanned by scan
+const deliverySelect = `SELECT "deliveryid", "webhook", "event", "payload", "state", "attempts", "nextattempt",
+	COALESCE("responsestatus", 0), COALESCE("error", ''), "created", "delivered"
+	FROM "webhook_deliveries"`
+
+// scan fills d from a row selected with deliverySelect
+func (d *SQLDelivery) scan(row scanner) error {
+	return row.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Payload, &d.State, &d.Attempts, &d.NextAttempt,
+		&d.ResponseStatus, &d.Error, &d.Created, &d.Delivered)
+}
+
+// NewSQLDelivery returns the delivery with the given id
+func NewSQLDelivery(id int, Db DB) *SQLDelivery {
+	defer timed("delivery.load")()
+	d := &SQLDelivery{ID: id, Db: Db}
+	err := d.scan(Db.QueryRow(deliverySelect+` WHERE "deliveryid" = $1`, id))
+	if err != nil && err != sql.ErrNoRows {
+		logger(Db).Error("Error querying for delivery", "err", err)
+	}
+	d.exists = err == nil
+	return d
+}
+
+// Exists reports whether the delivery is in the database
+func (d *SQLDelivery) Exists() bool {
+	return d.exists
+}
+
+// QueueDelivery records a delivery of payload to a webhook, due immediately
+func QueueDelivery(webhookID int, event string, payload []byte, Db DB) (*SQLDelivery, error) {
+	defer timed("delivery.queue")()
+	d := &SQLDelivery{Db: Db}
+	err := d.scan(Db.QueryRow(`INSERT INTO "webhook_deliveries" ("webhook", "event", "payload")
+		VALUES ($1, $2, $3)
+		RETURNING "deliveryid", "webhook", "event", "payload", "state", "attempts", "nextattempt",
+			COALESCE("responsestatus", 0), COALESCE("error", ''), "created", "delivered"`,
+		webhookID, event, string(payload)))
+	if err != nil {
+		logger(Db).Error("Failed to queue delivery", "err", err)
+		return nil, ErrSave
+	}
+	d.exists = true
+	return d, nil
+}
+
+// DeliveryList returns a page of a webhook's deliveries, newest first, along
+// with how many there are
+func DeliveryList(webhookID, offset, limit int, Db DB) ([]*SQLDelivery, int) {
+	defer timed("delivery.list")()
+	var total int
+	err := Db.QueryRow(`SELECT COUNT(*) FROM "webhook_deliveries" WHERE "webhook" = $1`, webhookID).Scan(&total)
+	if err != nil {
+		logger(Db).Error("Error counting deliveries", "err", err)
+		return nil, 0
+	}
+
+	rows, err := Db.Query(deliverySelect+`
+		WHERE "webhook" = $1
+		ORDER BY "created" DESC, "deliveryid" DESC
+		OFFSET $2 LIMIT $3`, webhookID, offset, limit)
+	if err != nil {
+		logger(Db).Error("Error querying for deliveries", "err", err)
+		return nil, 0
+	}
+
+	defer rows.Close()
+
+	return scanDeliveries(rows, Db), total
+}
+
+// ClaimDeliveries takes up to limit due deliveries, pushing their next
+// attempt back by lease so no other worker takes them meanwhile
+func ClaimDeliveries(limit int, lease time.Duration, Db DB) ([]*SQLDelivery, error) {
+	defer timed("delivery.claim")()
+	rows, err := Db.Query(`UPDATE "webhook_deliveries"
+		SET "nextattempt" = CURRENT_TIMESTAMP + make_interval(secs => $1)
+		WHERE "deliveryid" IN (
+			SELECT "deliveryid" FROM "webhook_deliveries"
+			WHERE "state" = $2 AND "nextattempt" <= CURRENT_TIMESTAMP
+			ORDER BY "nextattempt"
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING "deliveryid", "webhook", "event", "payload", "state", "attempts", "nextattempt",
+			COALESCE("responsestatus", 0), COALESCE("error", ''), "created", "delivered"`,
+		lease.Seconds(), DeliveryPending, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanDeliveries(rows, Db), rows.Err()
+}
+
+// scanDeliveries reads every delivery from rows
+func scanDeliveries(rows *sql.Rows, Db DB) []*SQLDelivery {
+	var deliveries []*SQLDelivery
+	for rows.Next() {
+		d := &SQLDelivery{Db: Db, exists: true}
+		if err := d.scan(rows); err != nil {
+			logger(Db).Error("Failed to scan delivery", "err", err)
+			continue
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries
+}
+
+// Attempted records the outcome of an attempt. Successful deliveries are
+// done, failed ones are retried after retry unless this was the last attempt.
+func (d *SQLDelivery) Attempted(status int, message string, delivered bool, retry time.Duration, last bool) error {
+	defer timed("delivery.attempted")()
+	state := DeliveryPending
+	switch {
+	case delivered:
+		state = DeliveryDelivered
+	case last:
+		state = DeliveryFailed
+	}
+
+	var responseStatus interface{}
+	if status != 0 {
+		responseStatus = status
+	}
+
+	err := d.Db.QueryRow(`UPDATE "webhook_deliveries"
+		SET "state" = $1, "attempts" = "attempts" + 1, "responsestatus" = $2, "error" = NULLIF($3, ''),
+			"nextattempt" = CURRENT_TIMESTAMP + make_interval(secs => $4),
+			"delivered" = CASE WHEN $5 THEN CURRENT_TIMESTAMP END
+		WHERE "deliveryid" = $6
+		RETURNING "state", "attempts", "nextattempt", "delivered"`,
+		state, responseStatus, message, retry.Seconds(), delivered, d.ID).Scan(&d.State, &d.Attempts, &d.NextAttempt, &d.Delivered)
+	if err != nil {
+		logger(d.Db).Error("Failed to record delivery attempt", "id", d.ID, "err", err)
+		return ErrSave
+	}
+	d.ResponseStatus = status
+	d.Error = message
+	return nil
+}
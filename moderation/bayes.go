@@ -0,0 +1,133 @@
+package moderation
+
+import (
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mattgen88/blog/models"
+	"github.com/mattgen88/blog/search"
+)
+
+// minTrained is how many comments of each class must be learnt before the
+// classifier's opinion is trusted
+const minTrained = 5
+
+var urlRegexp = regexp.MustCompile(`(?i)\bhttps?://[^\s<>()\[\]"']+`)
+
+// Links returns the URLs mentioned in text
+func Links(text string) []string {
+	return urlRegexp.FindAllString(text, -1)
+}
+
+// Features extracts the distinct tokens the classifier learns from: stemmed
+// words, the hosts of linked URLs and the domain of the commenter's email
+func Features(body, email string) []string {
+	seen := make(map[string]bool)
+	var features []string
+	add := func(f string) {
+		if !seen[f] {
+			seen[f] = true
+			features = append(features, f)
+		}
+	}
+
+	for _, link := range Links(body) {
+		if u, err := url.Parse(link); err == nil {
+			add("host:" + strings.ToLower(u.Hostname()))
+		}
+	}
+	for _, term := range search.Tokenize(urlRegexp.ReplaceAllString(body, " ")) {
+		add(term)
+	}
+	if at := strings.LastIndex(email, "@"); at >= 0 {
+		add("email:" + strings.ToLower(email[at+1:]))
+	}
+	return features
+}
+
+// Classifier is a naive Bayes spam classifier over comment features
+type Classifier struct {
+	mu       sync.RWMutex
+	spamDocs int
+	hamDocs  int
+	spam     map[string]int
+	ham      map[string]int
+}
+
+// NewClassifier returns an untrained classifier
+func NewClassifier() *Classifier {
+	return &Classifier{
+		spam: make(map[string]int),
+		ham:  make(map[string]int),
+	}
+}
+
+// Ready reports whether the classifier has seen enough examples to be trusted
+func (c *Classifier) Ready() bool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.spamDocs >= minTrained && c.hamDocs >= minTrained
+}
+
+// reset replaces everything the classifier knows with counts
+func (c *Classifier) reset(counts *models.SpamCounts) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.spamDocs, c.hamDocs = counts.SpamDocs, counts.HamDocs
+	c.spam, c.ham = counts.Spam, counts.Ham
+}
+
+// Learn adds delta examples of features to the spam or ham class, a negative
+// delta forgets them
+func (c *Classifier) Learn(features []string, spam bool, delta int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	counts, docs := c.ham, &c.hamDocs
+	if spam {
+		counts, docs = c.spam, &c.spamDocs
+	}
+	*docs = max0(*docs + delta)
+	for _, f := range features {
+		if n := max0(counts[f] + delta); n > 0 {
+			counts[f] = n
+		} else {
+			delete(counts, f)
+		}
+	}
+}
+
+// Probability estimates how likely features are to belong to spam, 0.5 when
+// nothing can be said
+func (c *Classifier) Probability(features []string) float64 {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	if c.spamDocs == 0 || c.hamDocs == 0 {
+		return 0.5
+	}
+
+	// Log odds of spam with Laplace smoothing, only considering features
+	// which have been seen before
+	odds := math.Log(float64(c.spamDocs+1) / float64(c.hamDocs+1))
+	for _, f := range features {
+		s, h := c.spam[f], c.ham[f]
+		if s == 0 && h == 0 {
+			continue
+		}
+		ps := float64(s+1) / float64(c.spamDocs+2)
+		ph := float64(h+1) / float64(c.hamDocs+2)
+		odds += math.Log(ps / ph)
+	}
+	return 1 / (1 + math.Exp(-odds))
+}
+
+func max0(n int) int {
+	if n < 0 {
+		return 0
+	}
+	return n
+}
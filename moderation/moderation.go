@@ -0,0 +1,141 @@
+// Package moderation decides which comments are published, held for review
+// or rejected as spam, and learns from moderators' decisions.
+package moderation
+
+import (
+	"database/sql"
+
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/models"
+)
+
+// logs is the logger of moderation
+var logs = logging.For("moderation")
+
+// Options tunes the moderation rules
+type Options struct {
+	// TrustAfter is how many approved comments make a signed in commenter
+	// trusted, zero disables auto approval
+	TrustAfter int
+	// MaxLinks is how many links a comment may hold before it is held for
+	// review, twice as many mark it as spam
+	MaxLinks int
+	// SpamThreshold is the classifier probability above which a comment is spam
+	SpamThreshold float64
+	// ReviewThreshold is the classifier probability above which a comment is
+	// held for review even from a trusted commenter
+	ReviewThreshold float64
+}
+
+// Moderator applies the moderation rules to comments
+type Moderator struct {
+	db         *sql.DB
+	opts       Options
+	classifier *Classifier
+}
+
+// New returns a Moderator with its classifier trained from the database
+func New(db *sql.DB, opts Options) *Moderator {
+	if opts.SpamThreshold <= 0 {
+		opts.SpamThreshold = 0.9
+	}
+	if opts.ReviewThreshold <= 0 {
+		opts.ReviewThreshold = 0.5
+	}
+
+	m := &Moderator{db: db, opts: opts, classifier: NewClassifier()}
+	if err := m.Reload(); err != nil {
+		logs.Error("Failed to load spam classifier", "err", err)
+	}
+	return m
+}
+
+// Reload replaces the classifier's knowledge with what is in the database
+func (m *Moderator) Reload() error {
+	counts, err := models.LoadSpamCounts(m.db)
+	if err != nil {
+		return err
+	}
+	m.classifier.reset(counts)
+	return nil
+}
+
+// Assess sets the initial moderation state and spam score of a new comment.
+// honeypot is the value of a form field hidden from humans, bots fill it in.
+func (m *Moderator) Assess(c *models.SQLComment, honeypot string) {
+	c.SpamScore = m.classifier.Probability(Features(c.Body, c.Email))
+
+	links := len(Links(c.Body))
+	switch {
+	case honeypot != "":
+		c.State = models.StateSpam
+	case m.opts.MaxLinks > 0 && links > 2*m.opts.MaxLinks:
+		c.State = models.StateSpam
+	case m.classifier.Ready() && c.SpamScore >= m.opts.SpamThreshold:
+		c.State = models.StateSpam
+	case m.trusted(c) && !(m.opts.MaxLinks > 0 && links > m.opts.MaxLinks) &&
+		!(m.classifier.Ready() && c.SpamScore >= m.opts.ReviewThreshold):
+		c.State = models.StateApproved
+	default:
+		c.State = models.StatePending
+	}
+}
+
+// trusted reports whether the commenter's comments may skip review. Only
+// signed in commenters are trusted, as anyone could give the email address
+// of an anonymous one.
+func (m *Moderator) trusted(c *models.SQLComment) bool {
+	if c.Anonymous() || c.Author.ID == 0 {
+		return false
+	}
+	if c.Author.HasRole("admin") || c.Author.HasRole("moderator") {
+		return true
+	}
+	if m.opts.TrustAfter <= 0 {
+		return false
+	}
+	return models.ApprovedCommentCount(c.Author.ID, m.db) >= m.opts.TrustAfter
+}
+
+// Decide records a moderator's decision on a comment and teaches the
+// classifier from it. Approved comments are learnt as ham and spam as spam;
+// a reversed decision forgets what was learnt before.
+func (m *Moderator) Decide(c *models.SQLComment, state string) error {
+	var learn string
+	switch state {
+	case models.StateApproved, models.StateSpam:
+		learn = state
+	}
+
+	if c.State == models.StateDeleted && state != models.StateDeleted {
+		// The content is gone, there is nothing left to restore
+		return models.ErrValidation
+	}
+
+	features := Features(c.Body, c.Email)
+	if err := c.SetState(state); err != nil {
+		return err
+	}
+
+	if learn == "" || learn == c.Trained {
+		return nil
+	}
+	if c.Trained != "" {
+		if err := m.train(features, c.Trained == models.StateSpam, -1); err != nil {
+			return err
+		}
+	}
+	if err := m.train(features, learn == models.StateSpam, 1); err != nil {
+		return err
+	}
+	return c.SetTrained(learn)
+}
+
+// train updates the stored and in-memory token counts
+func (m *Moderator) train(features []string, spam bool, delta int) error {
+	if err := models.TrainSpam(features, spam, delta, m.db); err != nil {
+		return err
+	}
+	m.classifier.Learn(features, spam, delta)
+	return nil
+}
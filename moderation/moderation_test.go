@@ -0,0 +1,162 @@
+package moderation
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mattgen88/blog/models"
+)
+
+func TestLinks(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"no links here", nil},
+		{"see https://example.com/a?b=c.", []string{"https://example.com/a?b=c."}},
+		{"(http://example.com) and HTTPS://Other.org/x", []string{"http://example.com", "HTTPS://Other.org/x"}},
+		{`<a href="http://example.com/">`, []string{"http://example.com/"}},
+		{"ftp://example.com www.example.com", nil},
+	}
+	for _, test := range tests {
+		if got := Links(test.text); !reflect.DeepEqual(got, test.want) {
+			t.Errorf("Links(%q) = %q, want %q", test.text, got, test.want)
+		}
+	}
+}
+
+func TestFeatures(t *testing.T) {
+	tests := []struct {
+		name, body, email string
+		want, not         []string
+	}{
+		{"hosts", "Buy at https://Shop.Example.com/deal and https://shop.example.com/other", "",
+			[]string{"host:shop.example.com"}, []string{"https", "deal"}},
+		{"email domain", "Nice post", "someone@Mail.Example.org",
+			[]string{"email:mail.example.org"}, nil},
+		{"no email", "Nice post", "",
+			nil, []string{"email:"}},
+	}
+	for _, test := range tests {
+		features := Features(test.body, test.email)
+		seen := make(map[string]int)
+		for _, f := range features {
+			seen[f]++
+			if seen[f] > 1 {
+				t.Errorf("%s: %s repeated", test.name, f)
+			}
+		}
+		for _, want := range test.want {
+			if seen[want] == 0 {
+				t.Errorf("%s: missing %s from %q", test.name, want, features)
+			}
+		}
+		for _, not := range test.not {
+			for _, f := range features {
+				if strings.HasPrefix(f, not) {
+					t.Errorf("%s: unexpected %s in %q", test.name, f, features)
+				}
+			}
+		}
+	}
+}
+
+// trained returns a classifier ready to be trusted, having learnt spam about
+// cheap pills and ham about Go
+func trained() *Classifier {
+	c := NewClassifier()
+	for i := 0; i < minTrained; i++ {
+		c.Learn(Features("cheap pills at https://pills.example.com", "bot@spam.example"), true, 1)
+		c.Learn(Features("thanks for the post about goroutines", "reader@example.org"), false, 1)
+	}
+	return c
+}
+
+func TestClassifier(t *testing.T) {
+	c := trained()
+	if !c.Ready() {
+		t.Fatal("classifier isn't ready after learning enough of each class")
+	}
+
+	tests := []struct {
+		name, body, email string
+		low, high         float64
+	}{
+		{"spam", "cheap pills https://pills.example.com", "other@spam.example", 0.9, 1},
+		{"ham", "goroutines thanks", "someone@example.org", 0, 0.1},
+		{"unknown", "completely unrelated words", "", 0.49, 0.51},
+	}
+	for _, test := range tests {
+		p := c.Probability(Features(test.body, test.email))
+		if p < test.low || p > test.high {
+			t.Errorf("%s: probability %v, want between %v and %v", test.name, p, test.low, test.high)
+		}
+	}
+
+	if p := NewClassifier().Probability(Features("cheap pills", "")); p != 0.5 {
+		t.Errorf("untrained probability = %v, want 0.5", p)
+	}
+}
+
+func TestClassifierForget(t *testing.T) {
+	c := trained()
+	features := Features("cheap pills at https://pills.example.com", "bot@spam.example")
+	for i := 0; i < minTrained; i++ {
+		c.Learn(features, true, -1)
+	}
+	if c.Ready() {
+		t.Error("classifier is ready after forgetting every spam example")
+	}
+	if len(c.spam) != 0 || c.spamDocs != 0 {
+		t.Errorf("forgotten spam left %d documents, counts %v", c.spamDocs, c.spam)
+	}
+
+	// Forgetting more than was learnt never goes negative
+	c.Learn(features, true, -1)
+	if c.spamDocs != 0 || len(c.spam) != 0 {
+		t.Errorf("counts went negative: %d documents, counts %v", c.spamDocs, c.spam)
+	}
+}
+
+func TestAssess(t *testing.T) {
+	admin := &models.SQLUser{ID: 1, Username: "admin", Role: "admin"}
+	links := "https://a.example https://b.example https://c.example"
+	tests := []struct {
+		name     string
+		opts     Options
+		trained  bool
+		author   *models.SQLUser
+		body     string
+		honeypot string
+		want     string
+	}{
+		{"anonymous", Options{}, false, nil, "Nice post", "", models.StatePending},
+		{"honeypot", Options{}, false, admin, "Nice post", "filled", models.StateSpam},
+		{"trusted", Options{}, false, admin, "Nice post", "", models.StateApproved},
+		{"trusted with links", Options{MaxLinks: 2}, false, admin, links, "", models.StatePending},
+		{"too many links", Options{MaxLinks: 1}, false, nil, links, "", models.StateSpam},
+		{"classified spam", Options{}, true, nil, "cheap pills https://pills.example.com", "", models.StateSpam},
+		{"trusted but doubtful", Options{SpamThreshold: 0.99, ReviewThreshold: 0.1}, true, admin, "cheap pills", "", models.StatePending},
+		{"classified ham", Options{}, true, nil, "thanks for goroutines", "", models.StatePending},
+	}
+	for _, test := range tests {
+		opts := test.opts
+		if opts.SpamThreshold <= 0 {
+			opts.SpamThreshold = 0.9
+		}
+		if opts.ReviewThreshold <= 0 {
+			opts.ReviewThreshold = 0.5
+		}
+		m := &Moderator{opts: opts, classifier: NewClassifier()}
+		if test.trained {
+			m.classifier = trained()
+		}
+
+		c := &models.SQLComment{Author: test.author, Body: test.body}
+		m.Assess(c, test.honeypot)
+		if c.State != test.want {
+			t.Errorf("%s: state %s, want %s (score %v)", test.name, c.State, test.want, c.SpamScore)
+		}
+	}
+}
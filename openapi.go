@@ -0,0 +1,61 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/spf13/viper"
+
+	"github.com/mattgen88/blog/handlers"
+)
+
+// describeAPI prints the OpenAPI description of the blog's routes. With
+// -check it fails when a route is not described or an operation described
+// has no route, so the description can't drift from the router.
+func describeAPI(db *sql.DB) error {
+	flags := flag.NewFlagSet("openapi", flag.ContinueOnError)
+	check := flags.Bool("check", false, "only check every route is described")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: blog openapi [flags]")
+		flags.PrintDefaults()
+	}
+	if err := flags.Parse(os.Args[2:]); err != nil {
+		return err
+	}
+
+	r, _, err := router(db, nil, nil, nil, nil, nil, viper.GetString("path_prefix"))
+	if err != nil {
+		return err
+	}
+	doc, report, err := handlers.Describe(r, handlers.Site{
+		Title:       viper.GetString("site_title"),
+		Description: viper.GetString("site_description"),
+		BaseURL:     viper.GetString("base_url"),
+	})
+	if err != nil {
+		return err
+	}
+
+	if *check {
+		var problems []string
+		for _, route := range report.Missing {
+			problems = append(problems, "not described: "+route)
+		}
+		for _, op := range report.Unused {
+			problems = append(problems, "no route: "+op)
+		}
+		if len(problems) > 0 {
+			return fmt.Errorf("the API description is out of date\n%s", strings.Join(problems, "\n"))
+		}
+		fmt.Println("Every route is described")
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
@@ -0,0 +1,293 @@
+// Package openapi describes the routes of a mux router as an OpenAPI 3.1
+// document.
+//
+// The paths of the document come from walking the router, so every route is
+// listed even when nobody has described it yet. What each route does is
+// looked up in a table of operations keyed by method and path, and routes
+// missing from the table are reported so they can be described.
+package openapi
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// Version is the OpenAPI version documents are written in
+const Version = "3.1.0"
+
+// Document is an OpenAPI document
+type Document struct {
+	OpenAPI    string              `json:"openapi"`
+	Info       Info                `json:"info"`
+	Servers    []Server            `json:"servers,omitempty"`
+	Tags       []Tag               `json:"tags,omitempty"`
+	Paths      map[string]PathItem `json:"paths"`
+	Components Components          `json:"components"`
+}
+
+// Info describes the API
+type Info struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Server is a URL the API is served from
+type Server struct {
+	URL string `json:"url"`
+}
+
+// Tag groups operations
+type Tag struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+}
+
+// PathItem holds the operations on a path by lower case method
+type PathItem map[string]*Operation
+
+// Operation describes what a method does on a path
+type Operation struct {
+	Summary     string                `json:"summary,omitempty"`
+	Description string                `json:"description,omitempty"`
+	OperationID string                `json:"operationId,omitempty"`
+	Tags        []string              `json:"tags,omitempty"`
+	Parameters  []Parameter           `json:"parameters,omitempty"`
+	RequestBody *RequestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]*Response  `json:"responses"`
+	Security    []map[string][]string `json:"security,omitempty"`
+}
+
+// Parameter is a path, query or header parameter
+type Parameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      Schema `json:"schema,omitempty"`
+}
+
+// RequestBody describes the body of a request
+type RequestBody struct {
+	Description string               `json:"description,omitempty"`
+	Required    bool                 `json:"required,omitempty"`
+	Content     map[string]MediaType `json:"content"`
+}
+
+// Response describes a response, or refers to one in the components when
+// Ref is set
+type Response struct {
+	Ref         string               `json:"$ref,omitempty"`
+	Description string               `json:"description,omitempty"`
+	Headers     map[string]Header    `json:"headers,omitempty"`
+	Content     map[string]MediaType `json:"content,omitempty"`
+}
+
+// Header describes a response header
+type Header struct {
+	Description string `json:"description,omitempty"`
+	Schema      Schema `json:"schema,omitempty"`
+}
+
+// MediaType is the schema of a body in one media type
+type MediaType struct {
+	Schema Schema `json:"schema,omitempty"`
+}
+
+// SecurityScheme describes how requests are authenticated
+type SecurityScheme struct {
+	Type        string `json:"type"`
+	Scheme      string `json:"scheme,omitempty"`
+	Description string `json:"description,omitempty"`
+}
+
+// Components holds what operations refer to
+type Components struct {
+	Schemas         map[string]Schema         `json:"schemas,omitempty"`
+	Responses       map[string]*Response      `json:"responses,omitempty"`
+	SecuritySchemes map[string]SecurityScheme `json:"securitySchemes,omitempty"`
+}
+
+// Schema is a JSON Schema
+type Schema map[string]interface{}
+
+// Ref returns a schema referring to a schema in the components
+func Ref(name string) Schema {
+	return Schema{"$ref": "#/components/schemas/" + name}
+}
+
+// ResponseRef returns a response referring to a response in the components
+func ResponseRef(name string) *Response {
+	return &Response{Ref: "#/components/responses/" + name}
+}
+
+// Report lists the differences between the router and the operations
+type Report struct {
+	// Missing are the routes without an operation, as "METHOD /path"
+	Missing []string
+	// Unused are the operations without a route
+	Unused []string
+}
+
+// route is a method and path served by the router
+type route struct {
+	method string
+	path   string
+	params []Parameter
+}
+
+// Build adds every route of r to the paths of doc. Operations are taken from
+// ops by method and path, such as "GET /articles/{id}". Paths are written as
+// in OpenAPI, with the patterns of variables moved into their parameters and
+// the prefix the router is mounted under removed, which belongs in the URL
+// of the servers instead.
+// Routes ending in a slash that are otherwise the same as another route are
+// left out as aliases. Routes served for any method are listed as GET.
+func Build(doc *Document, r *mux.Router, prefix string, ops map[string]*Operation) (Report, error) {
+	var routes []route
+	paths := make(map[string]bool)
+
+	err := r.Walk(func(rt *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		tpl, err := rt.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		path, params := convert(strings.TrimPrefix(tpl, prefix))
+
+		// Prefix routes match anything beneath them
+		if re, err := rt.GetPathRegexp(); err == nil && !strings.HasSuffix(re, "$") {
+			path = strings.TrimSuffix(path, "/") + "/{path}"
+			params = append(params, Parameter{Name: "path", In: "path", Required: true, Schema: Schema{"type": "string"}})
+		}
+
+		methods, err := rt.GetMethods()
+		if err != nil {
+			methods = []string{"GET"}
+		}
+		for _, method := range methods {
+			routes = append(routes, route{method: method, path: path, params: params})
+		}
+		paths[path] = true
+		return nil
+	})
+	if err != nil {
+		return Report{}, err
+	}
+
+	if doc.Paths == nil {
+		doc.Paths = make(map[string]PathItem)
+	}
+
+	var report Report
+	used := make(map[string]bool)
+	for _, rt := range routes {
+		if rt.path != "/" && strings.HasSuffix(rt.path, "/") && paths[strings.TrimSuffix(rt.path, "/")] {
+			continue
+		}
+
+		key := rt.method + " " + rt.path
+		op, ok := ops[key]
+		if !ok {
+			report.Missing = append(report.Missing, key)
+			op = &Operation{
+				Summary:   "Undocumented",
+				Responses: map[string]*Response{"default": {Description: "Undocumented"}},
+			}
+		}
+		used[key] = true
+
+		item, ok := doc.Paths[rt.path]
+		if !ok {
+			item = make(PathItem)
+			doc.Paths[rt.path] = item
+		}
+		item[strings.ToLower(rt.method)] = withParams(op, rt.params)
+	}
+
+	for key := range ops {
+		if !used[key] {
+			report.Unused = append(report.Unused, key)
+		}
+	}
+	sort.Strings(report.Missing)
+	sort.Strings(report.Unused)
+	return report, nil
+}
+
+// withParams returns the operation with the path parameters it doesn't
+// describe itself added
+func withParams(op *Operation, params []Parameter) *Operation {
+	out := *op
+	out.Parameters = nil
+	for _, p := range params {
+		described := false
+		for _, q := range op.Parameters {
+			if q.In == "path" && q.Name == p.Name {
+				described = true
+			}
+		}
+		if !described {
+			out.Parameters = append(out.Parameters, p)
+		}
+	}
+	out.Parameters = append(out.Parameters, op.Parameters...)
+	return &out
+}
+
+// alternation matches variable patterns listing literal choices
+var alternation = regexp.MustCompile(`^[A-Za-z0-9_-]+(\|[A-Za-z0-9_-]+)*$`)
+
+// convert turns a mux path template into an OpenAPI path and the parameters
+// of its variables
+func convert(tpl string) (string, []Parameter) {
+	var (
+		path   strings.Builder
+		params []Parameter
+	)
+	for i := 0; i < len(tpl); i++ {
+		if tpl[i] != '{' {
+			path.WriteByte(tpl[i])
+			continue
+		}
+
+		// Patterns may hold braces of their own, such as {2}
+		depth, end := 0, i
+		for ; end < len(tpl); end++ {
+			if tpl[end] == '{' {
+				depth++
+			} else if tpl[end] == '}' {
+				depth--
+				if depth == 0 {
+					break
+				}
+			}
+		}
+		variable := tpl[i+1 : end]
+		i = end
+
+		name, pattern := variable, ""
+		if colon := strings.Index(variable, ":"); colon >= 0 {
+			name, pattern = variable[:colon], variable[colon+1:]
+		}
+
+		schema := Schema{"type": "string"}
+		switch {
+		case pattern == "":
+		case alternation.MatchString(pattern):
+			var choices []interface{}
+			for _, choice := range strings.Split(pattern, "|") {
+				choices = append(choices, choice)
+			}
+			schema["enum"] = choices
+		default:
+			schema["pattern"] = "^" + pattern + "$"
+		}
+
+		path.WriteString("{" + name + "}")
+		params = append(params, Parameter{Name: name, In: "path", Required: true, Schema: schema})
+	}
+	return path.String(), params
+}
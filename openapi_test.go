@@ -0,0 +1,25 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/mattgen88/blog/handlers"
+)
+
+// TestAPIDescribed fails when a route is added without describing it, or an
+// operation is described for a route which no longer exists
+func TestAPIDescribed(t *testing.T) {
+	r, cleanup := testRouter(t)
+	defer cleanup()
+
+	_, report, err := handlers.Describe(r, handlers.Site{Title: "Blog"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, route := range report.Missing {
+		t.Errorf("not described: %s", route)
+	}
+	for _, op := range report.Unused {
+		t.Errorf("no route: %s", op)
+	}
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/spf13/viper"
+
+	"github.com/mattgen88/blog/search"
+)
+
+// reindex rebuilds the search index from the database. Running instances of
+// a cluster are asked to rebuild and save their own, as they would overwrite
+// the file with the index they hold. Otherwise the file is rebuilt here and
+// the server must be stopped while it is.
+func reindex(db *sql.DB) error {
+	path := viper.GetString("search_index")
+	if path == "" {
+		return errors.New("search_index must be set to rebuild the index")
+	}
+
+	if node := clusterNode(db); node != nil {
+		if err := waitForDatabase(db); err != nil {
+			return err
+		}
+		if err := node.PublishResync(); err != nil {
+			return err
+		}
+		logs.Info("Asked running instances to rebuild their search index", "path", path)
+		return nil
+	}
+
+	index := search.New()
+	index.Rebuild(db)
+	if err := index.SaveFile(path); err != nil {
+		return err
+	}
+
+	logs.Info("Indexed articles", "articles", index.Len(), "path", path)
+	return nil
+}
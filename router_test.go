@@ -0,0 +1,53 @@
+package main
+
+import (
+	"database/sql"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+)
+
+// testRouter returns the router of the blog over a database which can't be
+// reached, along with a function closing it
+func testRouter(t *testing.T) (*mux.Router, func()) {
+	configure()
+	db, err := sql.Open("postgres", "host=127.0.0.1 port=1 sslmode=disable connect_timeout=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, _, err := router(db, nil, nil, nil, nil, nil, "")
+	if err != nil {
+		db.Close()
+		t.Fatal(err)
+	}
+	return r, func() { db.Close() }
+}
+
+// TestRoutesNamed fails when a route is added without a name, which cache
+// policies, cached responses and links rely on. Only the aliases of paths
+// ending in a slash go unnamed.
+func TestRoutesNamed(t *testing.T) {
+	r, cleanup := testRouter(t)
+	defer cleanup()
+
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return err
+		}
+		if route.GetName() == "" && (path == "/" || !strings.HasSuffix(path, "/")) {
+			t.Errorf("route %s has no name", path)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"feed", "category-feed", "user-feed"} {
+		if r.Get(name) == nil {
+			t.Errorf("no route named %s", name)
+		}
+	}
+}
@@ -0,0 +1,8 @@
+package search
+
+import "errors"
+
+// Error messages
+var (
+	ErrVersion = errors.New("the search index was written by an incompatible version")
+)
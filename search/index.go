@@ -0,0 +1,419 @@
+package search
+
+import (
+	"encoding/gob"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BM25 tuning parameters
+const (
+	k1 = 1.2
+	b  = 0.75
+
+	// titleBoost is how many times a title term counts compared to the body
+	titleBoost = 3
+
+	// fuzzyWeight scales the score of terms matched by edit distance
+	fuzzyWeight = 0.5
+
+	// prefixWeight scales the score of terms matched by prefix
+	prefixWeight = 0.75
+)
+
+// Document is an article as seen by the index
+type Document struct {
+	ID       int
+	Slug     string
+	Title    string
+	Body     string
+	Author   string
+	Category string
+	Date     *time.Time
+}
+
+// Result is a ranked match for a query
+type Result struct {
+	Document
+	Score float64
+}
+
+// Options changes how a query is matched
+type Options struct {
+	// Limit is the maximum number of results, zero for all
+	Limit int
+	// Prefix treats the last query word as an incomplete prefix
+	Prefix bool
+	// Fuzzy matches query terms missing from the index by edit distance
+	Fuzzy bool
+}
+
+// posting is the frequency of a term in a document
+type posting map[int]int
+
+// Index is an in-memory inverted index over documents ranked by BM25
+type Index struct {
+	mu       sync.RWMutex
+	docs     map[int]Document
+	lengths  map[int]int
+	total    int
+	postings map[string]posting
+	words    map[string]int
+	sorted   []string
+}
+
+// New returns an empty index
+func New() *Index {
+	return &Index{
+		docs:     make(map[int]Document),
+		lengths:  make(map[int]int),
+		postings: make(map[string]posting),
+		words:    make(map[string]int),
+	}
+}
+
+// Len returns the number of indexed documents
+func (i *Index) Len() int {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return len(i.docs)
+}
+
+// Add indexes a document, replacing any previous version with the same ID
+func (i *Index) Add(d Document) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(d.ID)
+
+	length := 0
+	for _, term := range Tokenize(d.Title) {
+		i.addTerm(term, d.ID, titleBoost)
+		length += titleBoost
+	}
+	for _, term := range Tokenize(d.Body) {
+		i.addTerm(term, d.ID, 1)
+		length++
+	}
+	for _, w := range words(d.Title + " " + d.Body) {
+		if stopwords[w] {
+			continue
+		}
+		if i.words[w] == 0 {
+			i.sorted = nil
+		}
+		i.words[w]++
+	}
+
+	i.docs[d.ID] = d
+	i.lengths[d.ID] = length
+	i.total += length
+}
+
+// Remove drops a document from the index
+func (i *Index) Remove(id int) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.remove(id)
+}
+
+// Reset replaces the contents of the index with docs
+func (i *Index) Reset(docs []Document) {
+	fresh := New()
+	for _, d := range docs {
+		fresh.Add(d)
+	}
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.docs = fresh.docs
+	i.lengths = fresh.lengths
+	i.total = fresh.total
+	i.postings = fresh.postings
+	i.words = fresh.words
+	i.sorted = nil
+}
+
+func (i *Index) addTerm(term string, id, weight int) {
+	p, ok := i.postings[term]
+	if !ok {
+		p = make(posting)
+		i.postings[term] = p
+	}
+	p[id] += weight
+}
+
+func (i *Index) remove(id int) {
+	d, ok := i.docs[id]
+	if !ok {
+		return
+	}
+	for _, term := range append(Tokenize(d.Title), Tokenize(d.Body)...) {
+		if p, ok := i.postings[term]; ok {
+			delete(p, id)
+			if len(p) == 0 {
+				delete(i.postings, term)
+			}
+		}
+	}
+	for _, w := range words(d.Title + " " + d.Body) {
+		if n, ok := i.words[w]; ok {
+			if n <= 1 {
+				delete(i.words, w)
+				i.sorted = nil
+			} else {
+				i.words[w] = n - 1
+			}
+		}
+	}
+	i.total -= i.lengths[id]
+	delete(i.lengths, id)
+	delete(i.docs, id)
+}
+
+// vocabulary returns the sorted list of indexed words, the caller must hold
+// the write lock
+func (i *Index) vocabulary() []string {
+	if i.sorted == nil {
+		i.sorted = make([]string, 0, len(i.words))
+		for w := range i.words {
+			i.sorted = append(i.sorted, w)
+		}
+		sort.Strings(i.sorted)
+	}
+	return i.sorted
+}
+
+// withPrefix returns indexed words starting with prefix, the caller must hold
+// the write lock
+func (i *Index) withPrefix(prefix string) []string {
+	vocab := i.vocabulary()
+	var matches []string
+	for n := sort.SearchStrings(vocab, prefix); n < len(vocab) && strings.HasPrefix(vocab[n], prefix); n++ {
+		matches = append(matches, vocab[n])
+	}
+	return matches
+}
+
+// Search returns documents matching query ordered by relevance
+func (i *Index) Search(query string, opts Options) []Result {
+	// The write lock is taken since the sorted vocabulary is built lazily
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	// weights maps each term to search for to how strongly it counts
+	weights := make(map[string]float64)
+	add := func(term string, w float64) {
+		if w > weights[term] {
+			weights[term] = w
+		}
+	}
+
+	qwords := words(query)
+	for n, w := range qwords {
+		last := n == len(qwords)-1
+		if stopwords[w] && !(last && opts.Prefix) {
+			continue
+		}
+		term := Stem(w)
+		if _, ok := i.postings[term]; ok {
+			add(term, 1)
+		} else if opts.Fuzzy {
+			for _, match := range i.fuzzy(term) {
+				add(match, fuzzyWeight)
+			}
+		}
+		if last && opts.Prefix {
+			for _, match := range i.withPrefix(w) {
+				add(Stem(match), prefixWeight)
+			}
+		}
+	}
+
+	n := float64(len(i.docs))
+	if n == 0 {
+		return nil
+	}
+	avg := float64(i.total) / n
+
+	scores := make(map[int]float64)
+	for term, weight := range weights {
+		p := i.postings[term]
+		df := float64(len(p))
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for id, tf := range p {
+			f := float64(tf)
+			norm := f + k1*(1-b+b*float64(i.lengths[id])/avg)
+			scores[id] += weight * idf * f * (k1 + 1) / norm
+		}
+	}
+
+	results := make([]Result, 0, len(scores))
+	for id, score := range scores {
+		results = append(results, Result{Document: i.docs[id], Score: score})
+	}
+	sort.Slice(results, func(a, c int) bool {
+		if results[a].Score != results[c].Score {
+			return results[a].Score > results[c].Score
+		}
+		return results[a].ID > results[c].ID
+	})
+	if opts.Limit > 0 && len(results) > opts.Limit {
+		results = results[:opts.Limit]
+	}
+	return results
+}
+
+// Suggest returns indexed words beginning with the last word of prefix,
+// most frequent first, for autocompletion
+func (i *Index) Suggest(prefix string, limit int) []string {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	ws := words(prefix)
+	if len(ws) == 0 {
+		return nil
+	}
+	matches := i.withPrefix(ws[len(ws)-1])
+	sort.SliceStable(matches, func(a, c int) bool {
+		return i.words[matches[a]] > i.words[matches[c]]
+	})
+	if limit > 0 && len(matches) > limit {
+		matches = matches[:limit]
+	}
+	return matches
+}
+
+// fuzzy returns indexed terms within a few edits of term
+func (i *Index) fuzzy(term string) []string {
+	max := maxEdits(term)
+	if max == 0 {
+		return nil
+	}
+	var matches []string
+	for candidate := range i.postings {
+		if distance(term, candidate, max) <= max {
+			matches = append(matches, candidate)
+		}
+	}
+	return matches
+}
+
+// maxEdits is how many typos are tolerated for a term of a given length
+func maxEdits(term string) int {
+	switch n := len([]rune(term)); {
+	case n <= 3:
+		return 0
+	case n <= 6:
+		return 1
+	default:
+		return 2
+	}
+}
+
+// distance computes the Levenshtein distance between a and b, giving up
+// with max+1 once it is certain to exceed max
+func distance(a, c string, max int) int {
+	s, t := []rune(a), []rune(c)
+	if d := len(s) - len(t); d > max || -d > max {
+		return max + 1
+	}
+	prev := make([]int, len(t)+1)
+	cur := make([]int, len(t)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for x := 1; x <= len(s); x++ {
+		cur[0] = x
+		best := cur[0]
+		for y := 1; y <= len(t); y++ {
+			cost := 1
+			if s[x-1] == t[y-1] {
+				cost = 0
+			}
+			cur[y] = min3(prev[y]+1, cur[y-1]+1, prev[y-1]+cost)
+			if cur[y] < best {
+				best = cur[y]
+			}
+		}
+		if best > max {
+			return max + 1
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(t)]
+}
+
+func min3(x, y, z int) int {
+	if y < x {
+		x = y
+	}
+	if z < x {
+		x = z
+	}
+	return x
+}
+
+// snapshot is the on-disk form of the index
+type snapshot struct {
+	Version   int
+	Documents []Document
+}
+
+const snapshotVersion = 1
+
+// Write serializes the indexed documents to w
+func (i *Index) Write(w io.Writer) error {
+	i.mu.RLock()
+	s := snapshot{Version: snapshotVersion}
+	for _, d := range i.docs {
+		s.Documents = append(s.Documents, d)
+	}
+	i.mu.RUnlock()
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Read replaces the index with documents previously written by Write
+func (i *Index) Read(r io.Reader) error {
+	var s snapshot
+	if err := gob.NewDecoder(r).Decode(&s); err != nil {
+		return err
+	}
+	if s.Version != snapshotVersion {
+		return ErrVersion
+	}
+	i.Reset(s.Documents)
+	return nil
+}
+
+// SaveFile writes the index to path, replacing it atomically
+func (i *Index) SaveFile(path string) error {
+	tmp, err := os.Create(filepath.Join(filepath.Dir(path), "."+filepath.Base(path)+".tmp"))
+	if err != nil {
+		return err
+	}
+	if err := i.Write(tmp); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// LoadFile reads an index previously written by SaveFile
+func (i *Index) LoadFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	return i.Read(f)
+}
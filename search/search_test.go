@@ -0,0 +1,123 @@
+package search
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStem(t *testing.T) {
+	tests := []struct {
+		word, stem string
+	}{
+		{"caresses", "caress"},
+		{"ponies", "poni"},
+		{"cats", "cat"},
+		{"agreed", "agre"},
+		{"plastered", "plaster"},
+		{"motoring", "motor"},
+		{"sing", "sing"},
+		{"hopping", "hop"},
+		{"filing", "file"},
+		{"happy", "happi"},
+		{"relational", "relat"},
+		{"generalization", "gener"},
+		{"electrical", "electr"},
+		{"adjustment", "adjust"},
+		{"hopeful", "hope"},
+		{"goodness", "good"},
+		{"running", "run"},
+		{"go", "go"},
+		{"http2", "http2"},
+	}
+	for _, test := range tests {
+		if stem := Stem(test.word); stem != test.stem {
+			t.Errorf("Stem(%q) = %q, want %q", test.word, stem, test.stem)
+		}
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		text  string
+		terms []string
+	}{
+		{"The Running of the Bulls", []string{"run", "bull"}},
+		{"Café crème", []string{"cafe", "creme"}},
+		{"go-lang, HTTP/2!", []string{"go", "lang", "http", "2"}},
+		{"the and of", nil},
+	}
+	for _, test := range tests {
+		if terms := Tokenize(test.text); !reflect.DeepEqual(terms, test.terms) {
+			t.Errorf("Tokenize(%q) = %q, want %q", test.text, terms, test.terms)
+		}
+	}
+}
+
+// ranked returns the IDs of the results of a query in order
+func ranked(i *Index, query string, opts Options) []int {
+	ids := []int{}
+	for _, r := range i.Search(query, opts) {
+		ids = append(ids, r.ID)
+	}
+	return ids
+}
+
+func TestSearchRanking(t *testing.T) {
+	i := New()
+	i.Reset([]Document{
+		{ID: 1, Title: "Gardening", Body: "Planting tomatoes in spring"},
+		{ID: 2, Title: "Tomatoes", Body: "Growing tomatoes on a balcony"},
+		{ID: 3, Title: "Cooking", Body: "A tomato sauce, more tomatoes and tomato soup"},
+		{ID: 4, Title: "Databases", Body: "Indexing tables for faster queries"},
+		{ID: 5, Title: "Deployment", Body: "Containers and orchestration"},
+	})
+
+	tests := []struct {
+		name  string
+		query string
+		opts  Options
+		ids   []int
+	}{
+		{"title outranks body", "tomatoes", Options{}, []int{2, 3, 1}},
+		{"stemmed", "indexes", Options{}, []int{4}},
+		{"stopwords only", "the and", Options{}, []int{}},
+		{"no match", "kubernetes", Options{}, []int{}},
+		{"limit", "tomatoes", Options{Limit: 1}, []int{2}},
+		{"prefix", "contai", Options{Prefix: true}, []int{5}},
+		{"no prefix", "contai", Options{}, []int{}},
+		{"fuzzy", "databsaes", Options{Fuzzy: true}, []int{4}},
+		{"no fuzzy", "databsaes", Options{}, []int{}},
+	}
+	for _, test := range tests {
+		if ids := ranked(i, test.query, test.opts); !reflect.DeepEqual(ids, test.ids) {
+			t.Errorf("%s: Search(%q) = %v, want %v", test.name, test.query, ids, test.ids)
+		}
+	}
+}
+
+func TestSearchRemove(t *testing.T) {
+	i := New()
+	i.Add(Document{ID: 1, Title: "Tomatoes"})
+	i.Add(Document{ID: 2, Title: "Tomatoes again"})
+	i.Remove(1)
+	i.Add(Document{ID: 2, Title: "Cucumbers"})
+
+	if ids := ranked(i, "tomatoes", Options{}); len(ids) != 0 {
+		t.Errorf("removed and replaced documents still match: %v", ids)
+	}
+	if ids := ranked(i, "cucumbers", Options{}); !reflect.DeepEqual(ids, []int{2}) {
+		t.Errorf("Search(cucumbers) = %v, want [2]", ids)
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	i := New()
+	i.Reset([]Document{
+		{ID: 1, Body: "golang gophers golang"},
+		{ID: 2, Body: "golang good"},
+	})
+	// Words used as often are suggested alphabetically
+	if s := i.Suggest("learning go", 2); !reflect.DeepEqual(s, []string{"golang", "good"}) {
+		t.Errorf("Suggest(learning go) = %q, want [golang good]", s)
+	}
+}
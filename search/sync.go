@@ -0,0 +1,220 @@
+package search
+
+import (
+	"database/sql"
+	"sync"
+	"time"
+
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/models"
+)
+
+// logs is the logger of the search index
+var logs = logging.For("search")
+
+// FromArticle converts an article model into an indexable document
+func FromArticle(a *models.SQLArticle) Document {
+	d := Document{
+		ID:    a.ID,
+		Slug:  a.Slug,
+		Title: a.Title,
+		Body:  a.Body,
+		Date:  a.Date,
+	}
+	if a.Author != nil {
+		d.Author = a.Author.Username
+	}
+	if a.Category != nil {
+		d.Category = a.Category.Name
+	}
+	return d
+}
+
+// Rebuild replaces the contents of the index with every article in the database
+func (i *Index) Rebuild(db *sql.DB) {
+	var docs []Document
+	for _, article := range models.ArticleList(db) {
+		docs = append(docs, FromArticle(article))
+	}
+	i.Reset(docs)
+}
+
+// Open loads the index stored at path, rebuilding it from the database when
+// the file is missing or unreadable. An empty path keeps the index in memory.
+func Open(path string, db *sql.DB) *Index {
+	i := New()
+	if path != "" {
+		err := i.LoadFile(path)
+		if err == nil {
+			return i
+		}
+		logs.Info("Rebuilding search index", "err", err)
+	}
+	i.Rebuild(db)
+	i.persist(path)
+	return i
+}
+
+// saveDelay is how long the index waits for further writes before being
+// saved, so a burst of writes saves it once
+const saveDelay = 2 * time.Second
+
+// Syncer keeps an index up to date with model writes in the background, so
+// saving the index and rebuilding it when a category is renamed never hold
+// up a write
+type Syncer struct {
+	index *Index
+	path  string
+	db    *sql.DB
+
+	mu      sync.Mutex
+	pending []change
+
+	wake chan struct{}
+	stop chan struct{}
+	done sync.WaitGroup
+	once sync.Once
+}
+
+// change is a write waiting to be applied to the index, or a request to
+// rebuild it. The article written is copied into doc when the write is made,
+// as the model may change again before the worker gets to it.
+type change struct {
+	doc     Document
+	deleted bool
+	rebuild bool
+}
+
+// NewSyncer returns a syncer keeping index up to date with db and saving it
+// to path. An empty path keeps the index in memory.
+func NewSyncer(index *Index, path string, db *sql.DB) *Syncer {
+	return &Syncer{
+		index: index,
+		path:  path,
+		db:    db,
+		wake:  make(chan struct{}, 1),
+		stop:  make(chan struct{}),
+	}
+}
+
+// Listen applies the model writes of this instance to the index
+func (s *Syncer) Listen() {
+	models.Listen(s.Apply)
+}
+
+// Apply queues a model write to be applied to the index. Renaming a category
+// rebuilds the whole index since the change touches every article
+// referencing it.
+func (s *Syncer) Apply(e models.Event) {
+	switch e.Model {
+	case "article":
+	case "category":
+		if e.Action != models.Updated {
+			return
+		}
+	default:
+		return
+	}
+	if e.Model == "category" {
+		s.queue(change{rebuild: true})
+		return
+	}
+	article, ok := e.Object.(*models.SQLArticle)
+	if !ok {
+		return
+	}
+	s.queue(change{doc: FromArticle(article), deleted: e.Action == models.Deleted})
+}
+
+// Resync queues a rebuild of the index from the database
+func (s *Syncer) Resync() {
+	s.queue(change{rebuild: true})
+}
+
+// queue adds a change for the worker and wakes it
+func (s *Syncer) queue(c change) {
+	s.mu.Lock()
+	s.pending = append(s.pending, c)
+	s.mu.Unlock()
+	select {
+	case s.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start starts the worker applying changes and saving the index
+func (s *Syncer) Start() {
+	s.done.Add(1)
+	go s.run()
+}
+
+// Stop stops the worker, applying the changes still queued and saving the
+// index if it changed
+func (s *Syncer) Stop() {
+	s.once.Do(func() { close(s.stop) })
+	s.done.Wait()
+}
+
+// run applies changes as they are queued, saving the index saveDelay after
+// the first change since it was last saved
+func (s *Syncer) run() {
+	defer s.done.Done()
+
+	var save <-chan time.Time
+	for {
+		select {
+		case <-s.stop:
+			if s.apply() || save != nil {
+				s.index.persist(s.path)
+			}
+			return
+		case <-s.wake:
+			if s.apply() && save == nil {
+				save = time.After(saveDelay)
+			}
+		case <-save:
+			save = nil
+			s.index.persist(s.path)
+		}
+	}
+}
+
+// apply applies the queued changes to the index in order, reporting whether
+// it changed. A rebuild reads every write made before it, so only the
+// changes queued after the last rebuild are applied on top of it.
+func (s *Syncer) apply() bool {
+	s.mu.Lock()
+	changes := s.pending
+	s.pending = nil
+	s.mu.Unlock()
+
+	from, rebuild := 0, false
+	for n, c := range changes {
+		if c.rebuild {
+			from, rebuild = n+1, true
+		}
+	}
+	if rebuild {
+		s.index.Rebuild(s.db)
+	}
+	changed := rebuild
+	for _, c := range changes[from:] {
+		if c.deleted {
+			s.index.Remove(c.doc.ID)
+		} else {
+			s.index.Add(c.doc)
+		}
+		changed = true
+	}
+	return changed
+}
+
+// persist saves the index to path, logging any failure
+func (i *Index) persist(path string) {
+	if path == "" {
+		return
+	}
+	if err := i.SaveFile(path); err != nil {
+		logs.Error("Failed to save search index", "path", path, "err", err)
+	}
+}
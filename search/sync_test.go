@@ -0,0 +1,39 @@
+package search
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mattgen88/blog/models"
+)
+
+func TestSyncerSavesOnStop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "search")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "search.idx")
+
+	index := New()
+	s := NewSyncer(index, path, nil)
+	s.Start()
+	s.Apply(models.Event{Model: "article", Action: models.Created, Object: &models.SQLArticle{ID: 1, Title: "Hello"}})
+	s.Apply(models.Event{Model: "article", Action: models.Created, Object: &models.SQLArticle{ID: 2, Title: "World"}})
+	s.Apply(models.Event{Model: "article", Action: models.Deleted, Object: &models.SQLArticle{ID: 1}})
+	s.Apply(models.Event{Model: "user", Action: models.Created})
+	s.Stop()
+
+	if index.Len() != 1 {
+		t.Errorf("indexed %d articles, want 1", index.Len())
+	}
+	saved := New()
+	if err := saved.LoadFile(path); err != nil {
+		t.Fatal(err)
+	}
+	if saved.Len() != 1 {
+		t.Errorf("saved %d articles, want 1", saved.Len())
+	}
+}
@@ -0,0 +1,106 @@
+// Package sitemap renders sitemaps and sitemap indexes as described by
+// https://www.sitemaps.org/protocol.html
+package sitemap
+
+import (
+	"encoding/xml"
+	"time"
+)
+
+// MaxURLs is the most URLs a single sitemap may list, larger sites are split
+// into several sitemaps referenced from an index
+const MaxURLs = 50000
+
+// ContentType is the media type sitemaps are served as
+const ContentType = "application/xml; charset=utf-8"
+
+const namespace = "http://www.sitemaps.org/schemas/sitemap/0.9"
+
+// URL is a page listed in a sitemap
+type URL struct {
+	Loc     string
+	LastMod time.Time
+}
+
+type urlset struct {
+	XMLName xml.Name `xml:"urlset"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	URLs    []entry  `xml:"url"`
+}
+
+type index struct {
+	XMLName  xml.Name `xml:"sitemapindex"`
+	XMLNS    string   `xml:"xmlns,attr"`
+	Sitemaps []entry  `xml:"sitemap"`
+}
+
+type entry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod,omitempty"`
+}
+
+func newEntry(u URL) entry {
+	e := entry{Loc: u.Loc}
+	if !u.LastMod.IsZero() {
+		e.LastMod = u.LastMod.UTC().Format(time.RFC3339)
+	}
+	return e
+}
+
+// Pages returns how many sitemaps are needed to list n URLs
+func Pages(n int) int {
+	if n == 0 {
+		return 1
+	}
+	return (n + MaxURLs - 1) / MaxURLs
+}
+
+// Page returns the URLs listed on the given one-based page
+func Page(urls []URL, page int) []URL {
+	start := (page - 1) * MaxURLs
+	if page < 1 || start >= len(urls) {
+		return nil
+	}
+	end := start + MaxURLs
+	if end > len(urls) {
+		end = len(urls)
+	}
+	return urls[start:end]
+}
+
+// Latest returns the most recent modification of any of urls
+func Latest(urls []URL) time.Time {
+	var latest time.Time
+	for _, u := range urls {
+		if u.LastMod.After(latest) {
+			latest = u.LastMod
+		}
+	}
+	return latest
+}
+
+// URLSet renders a sitemap listing urls
+func URLSet(urls []URL) ([]byte, error) {
+	doc := urlset{XMLNS: namespace, URLs: []entry{}}
+	for _, u := range urls {
+		doc.URLs = append(doc.URLs, newEntry(u))
+	}
+	return marshal(doc)
+}
+
+// Index renders a sitemap index referencing the given sitemaps
+func Index(sitemaps []URL) ([]byte, error) {
+	doc := index{XMLNS: namespace}
+	for _, u := range sitemaps {
+		doc.Sitemaps = append(doc.Sitemaps, newEntry(u))
+	}
+	return marshal(doc)
+}
+
+func marshal(doc interface{}) ([]byte, error) {
+	out, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), out...), nil
+}
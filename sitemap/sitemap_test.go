@@ -0,0 +1,87 @@
+package sitemap
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPages(t *testing.T) {
+	tests := []struct {
+		urls, want int
+	}{
+		{0, 1},
+		{1, 1},
+		{MaxURLs, 1},
+		{MaxURLs + 1, 2},
+		{2 * MaxURLs, 2},
+		{2*MaxURLs + 1, 3},
+	}
+	for _, test := range tests {
+		if got := Pages(test.urls); got != test.want {
+			t.Errorf("Pages(%d) = %d, want %d", test.urls, got, test.want)
+		}
+	}
+}
+
+func TestPage(t *testing.T) {
+	urls := make([]URL, MaxURLs+10)
+	tests := []struct {
+		page, want int
+	}{
+		{0, 0},
+		{1, MaxURLs},
+		{2, 10},
+		{3, 0},
+	}
+	for _, test := range tests {
+		if got := len(Page(urls, test.page)); got != test.want {
+			t.Errorf("Page(%d) lists %d, want %d", test.page, got, test.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	modified := time.Date(2024, 3, 1, 12, 0, 0, 0, time.FixedZone("CET", 3600))
+	urls := []URL{
+		{Loc: "https://example.com/", LastMod: modified},
+		{Loc: "https://example.com/articles/a&b"},
+	}
+
+	set, err := URLSet(urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+	index, err := Index(urls)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		doc  []byte
+		want []string
+	}{
+		{"urlset", set, []string{
+			`<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+			`<loc>https://example.com/</loc>`,
+			`<lastmod>2024-03-01T11:00:00Z</lastmod>`,
+			`<loc>https://example.com/articles/a&amp;b</loc>`,
+		}},
+		{"index", index, []string{
+			`<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`,
+			`<sitemap>`,
+			`<lastmod>2024-03-01T11:00:00Z</lastmod>`,
+		}},
+	}
+	for _, test := range tests {
+		for _, want := range test.want {
+			if !strings.Contains(string(test.doc), want) {
+				t.Errorf("%s: missing %s", test.name, want)
+			}
+		}
+		if strings.Count(string(test.doc), "<lastmod>") != 1 {
+			t.Errorf("%s: URLs without a modification should have no lastmod", test.name)
+		}
+	}
+}
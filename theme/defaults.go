@@ -0,0 +1,138 @@
+package theme
+
+// defaults are the built in templates, keyed by the name of the file that
+// overrides them in a theme directory
+var defaults = map[string]string{
+	"layout": `<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{block "title" .}}{{.Site.Title}}{{end}}</title>
+<link rel="alternate" type="application/rss+xml" title="{{.Site.Title}}" href="/feed.rss">
+<link rel="alternate" type="application/atom+xml" title="{{.Site.Title}}" href="/feed.atom">
+{{block "head" .}}<style>
+body { font-family: Georgia, serif; line-height: 1.6; max-width: 42em; margin: 0 auto; padding: 1em; color: #222; }
+header, footer { font-family: sans-serif; }
+header nav a, footer a { margin-right: 1em; }
+.meta { color: #666; font-size: 0.9em; }
+pre { overflow-x: auto; background: #f4f4f4; padding: 0.5em; }
+blockquote { border-left: 3px solid #ccc; margin-left: 0; padding-left: 1em; color: #555; }
+.comments ol { list-style: none; padding-left: 1.5em; }
+</style>{{end}}
+</head>
+<body>
+<header>
+<h1><a href="/">{{.Site.Title}}</a></h1>
+{{with .Site.Description}}<p>{{.}}</p>{{end}}
+<nav><a href="/">Home</a><a href="/articles">Archive</a></nav>
+</header>
+<main>
+{{block "content" .}}{{end}}
+</main>
+<footer>
+<a href="/feed.rss">RSS</a><a href="/feed.atom">Atom</a><a href="/feed.json">JSON Feed</a>
+</footer>
+</body>
+</html>
+`,
+
+	"home": `{{define "content"}}
+{{range .Articles}}
+<article>
+<h2><a href="/articles/{{.Slug}}">{{.Title}}</a></h2>
+<p class="meta"><time datetime="{{datetime .Date}}">{{date .Date}}</time>
+{{with .Author}}by <a href="/users/{{.Username}}">{{.Username}}</a>{{end}}
+{{with .Category}}in <a href="/categories/{{.Name}}">{{.Name}}</a>{{end}}</p>
+<p>{{excerpt .Body}}</p>
+<p><a href="/articles/{{.Slug}}">Read more</a></p>
+</article>
+{{else}}
+<p>Nothing has been published yet.</p>
+{{end}}
+<p><a href="/articles">All articles</a></p>
+{{end}}`,
+
+	"article": `{{define "title"}}{{.Article.Title}} - {{.Site.Title}}{{end}}
+{{define "content"}}
+<article>
+<h2>{{.Article.Title}}</h2>
+<p class="meta"><time datetime="{{datetime .Article.Date}}">{{date .Article.Date}}</time>
+{{with .Article.Author}}by <a href="/users/{{.Username}}">{{.Username}}</a>{{end}}
+{{with .Article.Category}}in <a href="/categories/{{.Name}}">{{.Name}}</a>{{end}}</p>
+{{markdown .Article.Body}}
+{{with .Article.Tags}}<p class="meta">Tagged {{range $i, $tag := .}}{{if $i}}, {{end}}<a href="/tags/{{$tag}}">{{$tag}}</a>{{end}}</p>{{end}}
+</article>
+<section class="comments">
+<h3>Comments</h3>
+{{if .Comments}}<ol>{{range .Comments}}{{template "comment" .}}{{end}}</ol>{{else}}<p>No comments yet.</p>{{end}}
+</section>
+{{end}}
+{{define "comment"}}
+<li id="comment-{{.ID}}">
+{{if eq .State "deleted"}}<p class="meta">This comment was deleted.</p>{{else}}
+<p class="meta">{{.DisplayName}} on <time datetime="{{datetime .Created}}">{{date .Created}}</time></p>
+{{markdown .Body}}{{end}}
+{{if .Replies}}<ol>{{range .Replies}}{{template "comment" .}}{{end}}</ol>{{end}}
+</li>
+{{end}}`,
+
+	"category": `{{define "title"}}{{.Category.Name}} - {{.Site.Title}}{{end}}
+{{define "content"}}
+<h2>{{.Category.Name}}</h2>
+<p><a href="/categories/{{.Category.Name}}/feed.rss">Feed for this category</a></p>
+<ul>
+{{range .Articles}}<li><a href="/articles/{{.Slug}}">{{.Title}}</a> <span class="meta">{{date .Date}}</span></li>
+{{else}}<li>No articles in this category.</li>
+{{end}}
+</ul>
+{{end}}`,
+
+	"tag": `{{define "title"}}{{.Tag}} - {{.Site.Title}}{{end}}
+{{define "content"}}
+<h2>Tagged {{.Tag}}</h2>
+<ul>
+{{range .Articles}}<li><a href="/articles/{{.Slug}}">{{.Title}}</a> <span class="meta">{{date .Date}}</span></li>
+{{end}}
+</ul>
+{{end}}`,
+
+	"author": `{{define "title"}}{{.Author.Username}} - {{.Site.Title}}{{end}}
+{{define "content"}}
+<h2>{{with .Author.Realname}}{{.}}{{else}}{{.Author.Username}}{{end}}</h2>
+<p><a href="/users/{{.Author.Username}}/feed.rss">Feed for this author</a></p>
+<ul>
+{{range .Articles}}<li><a href="/articles/{{.Slug}}">{{.Title}}</a> <span class="meta">{{date .Date}}</span></li>
+{{else}}<li>No articles by this author.</li>
+{{end}}
+</ul>
+{{end}}`,
+
+	"archive": `{{define "title"}}Archive - {{.Site.Title}}{{end}}
+{{define "content"}}
+<h2>Archive</h2>
+{{range .Months}}
+<h3>{{.Name}}</h3>
+<ul>
+{{range .Articles}}<li><a href="/articles/{{.Slug}}">{{.Title}}</a> <span class="meta">{{date .Date}}</span></li>
+{{end}}
+</ul>
+{{else}}
+<p>Nothing has been published yet.</p>
+{{end}}
+{{end}}`,
+
+	"notfound": `{{define "title"}}Not found - {{.Site.Title}}{{end}}
+{{define "content"}}
+<h2>Not found</h2>
+<p>There is nothing here. Try the <a href="/articles">archive</a>.</p>
+{{end}}`,
+
+	"relation": `{{define "title"}}{{.Relation.Title}} - {{.Site.Title}}{{end}}
+{{define "content"}}
+<h2>{{.Relation.Title}}</h2>
+<p class="meta">Link relation <code>blog:{{.Relation.Name}}</code></p>
+<p>{{.Relation.Description}}</p>
+<p>Methods: {{range $i, $m := .Relation.Methods}}{{if $i}}, {{end}}<code>{{$m}}</code>{{end}}</p>
+{{end}}`,
+}
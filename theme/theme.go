@@ -0,0 +1,128 @@
+// Package theme renders the blog's HTML pages from html/template templates.
+//
+// Every page is rendered through the "layout" template, which includes the
+// page's "title" and "content" templates. The built in templates can be
+// replaced one at a time by files in a theme directory: layout.html replaces
+// the layout, <page>.html replaces a page and any other .html file is parsed
+// alongside the layout so pages can share partials.
+package theme
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/mattgen88/blog/markdown"
+)
+
+// Pages rendered by the blog
+const (
+	Home     = "home"
+	Article  = "article"
+	Category = "category"
+	Tag      = "tag"
+	Author   = "author"
+	Archive  = "archive"
+	NotFound = "notfound"
+	Relation = "relation"
+)
+
+var pages = []string{Home, Article, Category, Tag, Author, Archive, NotFound, Relation}
+
+// funcs are available to every template
+var funcs = template.FuncMap{
+	"markdown": markdown.Render,
+	"excerpt": func(src string) string {
+		return markdown.Excerpt(src, 300)
+	},
+	"date": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.Format("January 2, 2006")
+	},
+	"datetime": func(t *time.Time) string {
+		if t == nil {
+			return ""
+		}
+		return t.UTC().Format(time.RFC3339)
+	},
+}
+
+// Theme holds the parsed templates of every page
+type Theme struct {
+	pages map[string]*template.Template
+	// Static is the directory of the theme's static assets, empty if it has none
+	Static string
+}
+
+// Load parses the built in templates, overridden by those found in dir. An
+// empty dir uses the built in templates alone.
+func Load(dir string) (*Theme, error) {
+	sources := make(map[string]string, len(defaults))
+	for name, src := range defaults {
+		sources[name] = src
+	}
+
+	partials := make(map[string]string)
+	t := &Theme{pages: make(map[string]*template.Template)}
+	if dir != "" {
+		files, err := filepath.Glob(filepath.Join(dir, "*.html"))
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			src, err := ioutil.ReadFile(file)
+			if err != nil {
+				return nil, err
+			}
+			name := strings.TrimSuffix(filepath.Base(file), ".html")
+			if _, ok := sources[name]; ok {
+				sources[name] = string(src)
+			} else {
+				partials[name] = string(src)
+			}
+		}
+
+		static := filepath.Join(dir, "static")
+		if info, err := os.Stat(static); err == nil && info.IsDir() {
+			t.Static = static
+		}
+	}
+
+	base, err := template.New("layout").Funcs(funcs).Parse(sources["layout"])
+	if err != nil {
+		return nil, fmt.Errorf("layout: %v", err)
+	}
+	for name, src := range partials {
+		if _, err := base.New(name).Parse(src); err != nil {
+			return nil, fmt.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for _, page := range pages {
+		tmpl, err := base.Clone()
+		if err != nil {
+			return nil, err
+		}
+		if _, err := tmpl.New(page).Parse(sources[page]); err != nil {
+			return nil, fmt.Errorf("%s: %v", page, err)
+		}
+		t.pages[page] = tmpl
+	}
+	return t, nil
+}
+
+// Render writes a page with data to w
+func (t *Theme) Render(w io.Writer, page string, data interface{}) error {
+	tmpl, ok := t.pages[page]
+	if !ok {
+		return fmt.Errorf("no such page %q", page)
+	}
+	return tmpl.ExecuteTemplate(w, "layout", data)
+}
@@ -0,0 +1,108 @@
+package util
+
+import (
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MediaRange is one entry of an Accept header
+type MediaRange struct {
+	Type    string
+	Subtype string
+	Q       float64
+}
+
+// ParseAccept parses an Accept header into its media ranges, ignoring
+// malformed entries
+func ParseAccept(header string) []MediaRange {
+	var ranges []MediaRange
+	for _, part := range strings.Split(header, ",") {
+		params := strings.Split(part, ";")
+		typ := strings.ToLower(strings.TrimSpace(params[0]))
+		slash := strings.Index(typ, "/")
+		if slash <= 0 || slash == len(typ)-1 {
+			continue
+		}
+
+		mr := MediaRange{Type: typ[:slash], Subtype: typ[slash+1:], Q: 1}
+		for _, param := range params[1:] {
+			kv := strings.SplitN(strings.TrimSpace(param), "=", 2)
+			if len(kv) == 2 && strings.ToLower(kv[0]) == "q" {
+				q, err := strconv.ParseFloat(strings.TrimSpace(kv[1]), 64)
+				if err != nil || q < 0 || q > 1 {
+					q = 0
+				}
+				mr.Q = q
+			}
+		}
+		ranges = append(ranges, mr)
+	}
+	return ranges
+}
+
+// quality returns the q-value the most specific matching range gives offer,
+// and how specific that range is, or -1 when nothing matches
+func quality(ranges []MediaRange, offer string) (float64, int) {
+	slash := strings.Index(offer, "/")
+	typ, sub := offer[:slash], offer[slash+1:]
+
+	q, specificity := 0.0, -1
+	for _, mr := range ranges {
+		s := -1
+		switch {
+		case mr.Type == typ && mr.Subtype == sub:
+			s = 2
+		case mr.Type == typ && mr.Subtype == "*":
+			s = 1
+		case mr.Type == "*" && mr.Subtype == "*":
+			s = 0
+		}
+		if s > specificity {
+			q, specificity = mr.Q, s
+		}
+	}
+	return q, specificity
+}
+
+// Negotiate picks the offered media type the Accept header prefers, earlier
+// offers winning ties. Without an Accept header the first offer is chosen, and
+// when nothing offered is acceptable the result is empty.
+func Negotiate(accept string, offers []string) string {
+	if len(offers) == 0 {
+		return ""
+	}
+	if strings.TrimSpace(accept) == "" {
+		return offers[0]
+	}
+
+	ranges := ParseAccept(accept)
+	type scored struct {
+		offer       string
+		q           float64
+		specificity int
+		order       int
+	}
+	var candidates []scored
+	for i, offer := range offers {
+		q, s := quality(ranges, offer)
+		if s < 0 || q == 0 {
+			continue
+		}
+		candidates = append(candidates, scored{offer, q, s, i})
+	}
+	if len(candidates) == 0 {
+		return ""
+	}
+
+	sort.Slice(candidates, func(a, b int) bool {
+		if candidates[a].q != candidates[b].q {
+			return candidates[a].q > candidates[b].q
+		}
+		if candidates[a].specificity != candidates[b].specificity {
+			return candidates[a].specificity > candidates[b].specificity
+		}
+		return candidates[a].order < candidates[b].order
+	})
+	return candidates[0].offer
+}
@@ -0,0 +1,52 @@
+package util
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseAccept(t *testing.T) {
+	tests := []struct {
+		header string
+		ranges []MediaRange
+	}{
+		{"text/html", []MediaRange{{"text", "html", 1}}},
+		{"Text/HTML;q=0.5, */*;Q=0.1", []MediaRange{{"text", "html", 0.5}, {"*", "*", 0.1}}},
+		{"text/html;level=1;q=0.2", []MediaRange{{"text", "html", 0.2}}},
+		{"text/html;q=2, text/plain;q=x", []MediaRange{{"text", "html", 0}, {"text", "plain", 0}}},
+		{"html, /json, text/, application/json", []MediaRange{{"application", "json", 1}}},
+		{"", nil},
+	}
+	for _, test := range tests {
+		if ranges := ParseAccept(test.header); !reflect.DeepEqual(ranges, test.ranges) {
+			t.Errorf("ParseAccept(%q) = %v, want %v", test.header, ranges, test.ranges)
+		}
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{"application/hal+json", "application/json", "text/html"}
+	tests := []struct {
+		name, accept, chosen string
+	}{
+		{"no header", "", "application/hal+json"},
+		{"exact", "text/html", "text/html"},
+		{"browser", "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8", "text/html"},
+		{"anything", "*/*", "application/hal+json"},
+		{"type wildcard", "application/*", "application/hal+json"},
+		{"quality", "application/json;q=0.5, text/html;q=0.9", "text/html"},
+		{"specific beats wildcard", "*/*;q=0.5, application/json", "application/json"},
+		{"specific refusal", "*/*, application/hal+json;q=0", "application/json"},
+		{"nothing acceptable", "image/png", ""},
+		{"everything refused", "*/*;q=0", ""},
+	}
+	for _, test := range tests {
+		if chosen := Negotiate(test.accept, offers); chosen != test.chosen {
+			t.Errorf("%s: Negotiate(%q) = %q, want %q", test.name, test.accept, chosen, test.chosen)
+		}
+	}
+
+	if chosen := Negotiate("text/html", nil); chosen != "" {
+		t.Errorf("Negotiate without offers = %q, want none", chosen)
+	}
+}
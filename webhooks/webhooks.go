@@ -0,0 +1,394 @@
+// Package webhooks delivers content events to subscribed URLs.
+//
+// Model writes are turned into events and queued in the database as one
+// delivery per subscribed webhook. A background worker posts each delivery
+// as JSON, signed with the webhook's secret, and retries failures with
+// exponential backoff until they succeed or run out of attempts. Queuing in
+// the database means deliveries survive restarts and several instances can
+// share the work.
+//
+// Receivers verify a delivery by computing the HMAC-SHA256, keyed with the
+// secret, of the X-Blog-Timestamp header, a ".", and the request body, and
+// comparing it, hex encoded, to the X-Blog-Signature header after its
+// "sha256=" prefix. The timestamp is in Unix seconds and is signed so a
+// captured delivery can't be replayed later; receivers should reject those
+// more than Tolerance away from their own clock.
+package webhooks
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/mattgen88/blog/logging"
+	"github.com/mattgen88/blog/models"
+)
+
+// Options configures delivery
+type Options struct {
+	// MaxAttempts is how many times a delivery is tried before it fails
+	MaxAttempts int
+	// Timeout bounds each attempt
+	Timeout time.Duration
+	// Backoff is the wait after the first failed attempt, doubling after
+	// each one after that up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Interval is how often the queue is polled for retries that are due
+	Interval time.Duration
+}
+
+// logs is the logger of webhook delivery
+var logs = logging.For("webhooks")
+
+// Payload is the body of every delivery
+type Payload struct {
+	Event   string      `json:"event"`
+	Created time.Time   `json:"created"`
+	Data    interface{} `json:"data"`
+}
+
+// Dispatcher queues events for webhooks and delivers them
+type Dispatcher struct {
+	db     *sql.DB
+	opts   Options
+	client *http.Client
+
+	wake chan struct{}
+	stop chan struct{}
+	done sync.WaitGroup
+	once sync.Once
+
+	mu    sync.Mutex
+	stats Stats
+}
+
+// Stats counts the work of a dispatcher
+type Stats struct {
+	Queued    uint64
+	Delivered uint64
+	// Failed counts attempts which failed, Abandoned the deliveries given
+	// up on after their last attempt failed
+	Failed    uint64
+	Abandoned uint64
+}
+
+// Stats returns the counts of the work of the dispatcher
+func (d *Dispatcher) Stats() Stats {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.stats
+}
+
+// count updates the counts of the work of the dispatcher
+func (d *Dispatcher) count(f func(*Stats)) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f(&d.stats)
+}
+
+// New returns a dispatcher, which does nothing until it listens for events
+// and is started
+func New(db *sql.DB, opts Options) *Dispatcher {
+	if opts.MaxAttempts <= 0 {
+		opts.MaxAttempts = 8
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 10 * time.Second
+	}
+	if opts.Backoff <= 0 {
+		opts.Backoff = 30 * time.Second
+	}
+	if opts.MaxBackoff <= 0 {
+		opts.MaxBackoff = 6 * time.Hour
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = 15 * time.Second
+	}
+	return &Dispatcher{
+		db:     db,
+		opts:   opts,
+		client: &http.Client{Timeout: opts.Timeout},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Listen queues deliveries for model events
+func (d *Dispatcher) Listen() {
+	models.Listen(d.handle)
+}
+
+// handle turns a model event into a webhook event
+func (d *Dispatcher) handle(e models.Event) {
+	var (
+		event string
+		data  interface{}
+	)
+	switch {
+	case e.Model == "article" && e.Action == models.Created:
+		event, data = models.EventArticlePublished, articleData(e)
+	case e.Model == "article" && e.Action == models.Updated:
+		event, data = models.EventArticleUpdated, articleData(e)
+	case e.Model == "article" && e.Action == models.Deleted:
+		event, data = models.EventArticleDeleted, map[string]interface{}{"id": e.ID, "slug": e.Key}
+	case e.Model == "comment" && (e.Action == models.Created || e.Action == models.Approved):
+		// Comments are only sent once published, so spam and those held
+		// for review never reach subscribers
+		comment := models.NewSQLComment(e.ID, d.db)
+		if comment.State != models.StateApproved {
+			return
+		}
+		event, data = models.EventCommentCreated, commentData(comment)
+	case e.Model == "user" && e.Action == models.Created:
+		event, data = models.EventUserCreated, userData(e)
+	default:
+		return
+	}
+
+	queued := false
+	for _, hook := range models.WebhooksFor(event, d.db) {
+		if _, err := d.Enqueue(hook, event, data); err == nil {
+			queued = true
+		}
+	}
+	if queued {
+		d.Wake()
+	}
+}
+
+// articleData describes an article to receivers
+func articleData(e models.Event) interface{} {
+	article, ok := e.Object.(*models.SQLArticle)
+	if !ok {
+		return map[string]interface{}{"id": e.ID, "slug": e.Key}
+	}
+	data := map[string]interface{}{
+		"id":      article.ID,
+		"slug":    article.Slug,
+		"title":   article.Title,
+		"date":    article.Date,
+		"updated": article.Updated,
+		"tags":    article.Tags,
+	}
+	if article.Author != nil {
+		data["author"] = article.Author.Username
+	}
+	if article.Category != nil {
+		data["category"] = article.Category.Name
+	}
+	return data
+}
+
+// commentData describes a comment to receivers, leaving out the email
+// address of anonymous commenters
+func commentData(c *models.SQLComment) interface{} {
+	return map[string]interface{}{
+		"id":      c.ID,
+		"article": c.ArticleSlug,
+		"parent":  c.ParentID,
+		"author":  c.DisplayName(),
+		"body":    c.Body,
+		"state":   c.State,
+		"created": c.Created,
+	}
+}
+
+// userData describes a user to receivers
+func userData(e models.Event) interface{} {
+	data := map[string]interface{}{"id": e.ID, "username": e.Key}
+	if user, ok := e.Object.(*models.SQLUser); ok {
+		data["created"] = user.Created
+	}
+	return data
+}
+
+// Enqueue queues a delivery of event to a webhook
+func (d *Dispatcher) Enqueue(hook *models.SQLWebhook, event string, data interface{}) (*models.SQLDelivery, error) {
+	payload, err := json.Marshal(Payload{
+		Event:   event,
+		Created: time.Now().UTC(),
+		Data:    data,
+	})
+	if err != nil {
+		return nil, err
+	}
+	delivery, err := models.QueueDelivery(hook.ID, event, payload, d.db)
+	if err == nil {
+		d.count(func(s *Stats) { s.Queued++ })
+	}
+	return delivery, err
+}
+
+// Redeliver queues another delivery of the same payload, keeping the
+// original in the log
+func (d *Dispatcher) Redeliver(delivery *models.SQLDelivery) (*models.SQLDelivery, error) {
+	again, err := models.QueueDelivery(delivery.WebhookID, delivery.Event, []byte(delivery.Payload), d.db)
+	if err == nil {
+		d.count(func(s *Stats) { s.Queued++ })
+		d.Wake()
+	}
+	return again, err
+}
+
+// Wake has the worker look for due deliveries now rather than at its next
+// poll
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Start runs the delivery worker in the background
+func (d *Dispatcher) Start() {
+	d.done.Add(1)
+	go d.run()
+}
+
+// Stop stops the worker, waiting for the deliveries in flight to finish
+func (d *Dispatcher) Stop() {
+	d.once.Do(func() { close(d.stop) })
+	d.done.Wait()
+}
+
+// run delivers due deliveries whenever woken or polled until stopped
+func (d *Dispatcher) run() {
+	defer d.done.Done()
+
+	ticker := time.NewTicker(d.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		d.deliverDue()
+		select {
+		case <-d.stop:
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+// deliverDue delivers every due delivery. Each is claimed just before its
+// attempt, so its lease never runs out while others are being delivered and
+// another worker delivers it again, and stopping waits for one attempt at
+// most.
+func (d *Dispatcher) deliverDue() {
+	for {
+		select {
+		case <-d.stop:
+			return
+		default:
+		}
+
+		// Claimed deliveries are left alone by other workers for longer than
+		// an attempt can take
+		deliveries, err := models.ClaimDeliveries(1, 2*d.opts.Timeout, d.db)
+		if err != nil {
+			logs.Error("Failed to claim webhook deliveries", "err", err)
+			return
+		}
+		if len(deliveries) == 0 {
+			return
+		}
+		d.deliver(deliveries[0])
+	}
+}
+
+// deliver makes one attempt at a delivery and records the outcome
+func (d *Dispatcher) deliver(delivery *models.SQLDelivery) {
+	hook := models.NewSQLWebhook(delivery.WebhookID, d.db)
+	if !hook.Exists() {
+		return
+	}
+
+	status, err := d.post(hook, delivery)
+	delivered := err == nil
+
+	message := ""
+	if err != nil {
+		message = err.Error()
+	}
+	last := delivery.Attempts+1 >= d.opts.MaxAttempts
+	if err := delivery.Attempted(status, message, delivered, d.backoff(delivery.Attempts+1), last); err != nil {
+		return
+	}
+	d.count(func(s *Stats) {
+		switch {
+		case delivered:
+			s.Delivered++
+		case last:
+			s.Failed++
+			s.Abandoned++
+		default:
+			s.Failed++
+		}
+	})
+	if !delivered {
+		logs.Warn("Webhook delivery failed", "delivery", delivery.ID, "url", hook.URL, "err", message)
+	}
+}
+
+// post sends a delivery to its webhook, returning the response status
+func (d *Dispatcher) post(hook *models.SQLWebhook, delivery *models.SQLDelivery) (int, error) {
+	body := []byte(delivery.Payload)
+	req, err := http.NewRequest("POST", hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "blog-webhooks")
+	req.Header.Set("X-Blog-Event", delivery.Event)
+	req.Header.Set("X-Blog-Delivery", strconv.Itoa(delivery.ID))
+	timestamp := time.Now().Unix()
+	req.Header.Set("X-Blog-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-Blog-Signature", "sha256="+Sign(hook.Secret, timestamp, body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("receiver responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns how long to wait after the given failed attempt
+func (d *Dispatcher) backoff(attempt int) time.Duration {
+	wait := d.opts.Backoff
+	for i := 1; i < attempt && wait < d.opts.MaxBackoff; i++ {
+		wait *= 2
+	}
+	if wait > d.opts.MaxBackoff {
+		wait = d.opts.MaxBackoff
+	}
+	return wait
+}
+
+// Tolerance is how far the timestamp of a delivery may be from the clock of
+// its receiver before the receiver should reject it as replayed
+const Tolerance = 5 * time.Minute
+
+// Sign returns the hex encoded HMAC-SHA256, keyed with secret, of a delivery
+// of body sent at timestamp, in Unix seconds
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,93 @@
+package webhooks
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/mattgen88/blog/models"
+)
+
+func TestSign(t *testing.T) {
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp int64
+		body      string
+		want      string
+	}{
+		{"ping", "secret", 1700000000, `{"event":"ping"}`, "4d39bd2442f073b6bc62e95d0297ce25475582a17389ab860abdc778fe1d9f77"},
+		{"empty", "", 0, "", "b849d5a581847b281957065739df36df2463d1977ea8d6e1e4e6cf33fadc68c3"},
+		{"later", "another secret", 1700000300, `{"event":"ping"}`, "dce498d03107322712f756f8de13aa3f508e66e93d5b3a3771b58d638c0cd76a"},
+	}
+	for _, test := range tests {
+		if got := Sign(test.secret, test.timestamp, []byte(test.body)); got != test.want {
+			t.Errorf("%s: Sign = %s, want %s", test.name, got, test.want)
+		}
+	}
+
+	// The timestamp is signed, so replaying a body at another time fails
+	if Sign("secret", 1700000000, []byte("{}")) == Sign("secret", 1700000001, []byte("{}")) {
+		t.Error("signature doesn't depend on the timestamp")
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    Options
+		attempt int
+		want    time.Duration
+	}{
+		{"first", Options{}, 1, 30 * time.Second},
+		{"second", Options{}, 2, time.Minute},
+		{"fifth", Options{}, 5, 8 * time.Minute},
+		{"capped", Options{}, 20, 6 * time.Hour},
+		{"custom", Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 3, 4 * time.Second},
+		{"custom capped", Options{Backoff: time.Second, MaxBackoff: 5 * time.Second}, 4, 5 * time.Second},
+		{"backoff over max", Options{Backoff: time.Minute, MaxBackoff: time.Second}, 1, time.Second},
+	}
+	for _, test := range tests {
+		d := New(nil, test.opts)
+		if got := d.backoff(test.attempt); got != test.want {
+			t.Errorf("%s: backoff(%d) = %v, want %v", test.name, test.attempt, got, test.want)
+		}
+	}
+}
+
+func TestPostSigned(t *testing.T) {
+	var header http.Header
+	var body []byte
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header = r.Header
+		body, _ = ioutil.ReadAll(r.Body)
+	}))
+	defer server.Close()
+
+	d := New(nil, Options{})
+	hook := &models.SQLWebhook{URL: server.URL, Secret: "secret"}
+	delivery := &models.SQLDelivery{ID: 7, Event: models.EventPing, Payload: `{"event":"ping"}`}
+	if status, err := d.post(hook, delivery); err != nil || status != http.StatusOK {
+		t.Fatalf("post = %d, %v", status, err)
+	}
+
+	timestamp, err := strconv.ParseInt(header.Get("X-Blog-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("X-Blog-Timestamp = %q", header.Get("X-Blog-Timestamp"))
+	}
+	if skew := time.Since(time.Unix(timestamp, 0)); skew < -Tolerance || skew > Tolerance {
+		t.Errorf("timestamp is %v from now", skew)
+	}
+	if got, want := header.Get("X-Blog-Signature"), "sha256="+Sign("secret", timestamp, body); got != want {
+		t.Errorf("X-Blog-Signature = %s, want %s", got, want)
+	}
+	if got := header.Get("X-Blog-Event"); got != models.EventPing {
+		t.Errorf("X-Blog-Event = %s", got)
+	}
+	if got := header.Get("X-Blog-Delivery"); got != "7" {
+		t.Errorf("X-Blog-Delivery = %s", got)
+	}
+}